@@ -0,0 +1,690 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sampling holds the default generation options, overridable per request
+type Sampling struct {
+	NumPredict    int     `json:"num_predict"`
+	Temperature   float64 `json:"temperature"`
+	TopP          float64 `json:"top_p"`
+	TopK          int     `json:"top_k"`
+	RepeatPenalty float64 `json:"repeat_penalty"`
+	TfsZ          float64 `json:"tfs_z"`
+}
+
+// samplingRanges are the accepted bounds for each sampling option
+var samplingRanges = map[string][2]float64{
+	"num_predict":    {-2, 1 << 20}, // -1 generates until done, -2 until the context is full
+	"temperature":    {0, 2},
+	"top_p":          {0, 1},
+	"top_k":          {1, 1000},
+	"repeat_penalty": {0, 2},
+	"tfs_z":          {0, 1},
+}
+
+// CheckSampling returns an error if value is outside the accepted range for the option
+func CheckSampling(option string, value float64) error {
+	bounds, ok := samplingRanges[option]
+	if !ok {
+		return fmt.Errorf("unknown sampling option %s", option)
+	}
+	if value < bounds[0] || value > bounds[1] {
+		return fmt.Errorf("%s must be between %v and %v", option, bounds[0], bounds[1])
+	}
+	return nil
+}
+
+// stripTagPattern is the form of a tag name accepted for stripping
+var stripTagPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,31}$`)
+
+// CheckStripTag returns an error if tag can't be stripped from completions
+func CheckStripTag(tag string) error {
+	if !stripTagPattern.MatchString(tag) {
+		return fmt.Errorf("strip tag %q must be a tag name such as think, without angle brackets", tag)
+	}
+	return nil
+}
+
+// Config holds the runtime settings read from the config file and the environment
+type Config struct {
+	// ConfigFile is the file named by OWNGPT_CONFIG_FILE, if any
+	ConfigFile string `json:"config_file"`
+	// MaxConcurrentBuilds caps how many docker builds run at the same time
+	MaxConcurrentBuilds int `json:"max_concurrent_builds"`
+	// MinFreeDisk refuses builds while BuildDiskPath has fewer free bytes (0 disables)
+	MinFreeDisk int64 `json:"min_free_disk"`
+	// BuildDiskPath is where MinFreeDisk is checked, the models directory when
+	// empty; point it at Docker's data root when that is mounted
+	BuildDiskPath string `json:"build_disk_path"`
+	// MaxImages is the most images accepted on a single chat request
+	MaxImages int `json:"max_images"`
+	// MaxImageBytes is the largest decoded image accepted on a chat request
+	MaxImageBytes int `json:"max_image_bytes"`
+	// SkipPreload builds model images without the warm-up generation
+	SkipPreload bool `json:"skip_preload"`
+	// BuildNoCache builds model images without the layer cache
+	BuildNoCache bool `json:"build_no_cache"`
+	// BuildInlineCache embeds BuildKit cache metadata in model images and
+	// reuses the model's previous image as a cache source
+	BuildInlineCache bool `json:"build_inline_cache"`
+	// VerifyModels checks model names against the Ollama registry before building
+	VerifyModels bool `json:"verify_models"`
+	// OllamaRegistry is the registry used to verify model names
+	OllamaRegistry string `json:"ollama_registry"`
+	// OllamaScheme is how the backend reaches Ollama inside model containers
+	OllamaScheme string `json:"ollama_scheme"`
+	// OllamaPort is the port Ollama listens on inside model containers
+	OllamaPort int `json:"ollama_port"`
+	// OllamaVersion is the base image tag model images are built from
+	OllamaVersion string `json:"ollama_version"`
+	// Mode is how models are run: "docker" builds a container per model, "local"
+	// pulls them into the Ollama server at OllamaURL
+	Mode string `json:"mode"`
+	// OllamaURL is the Ollama server local mode talks to
+	OllamaURL string `json:"ollama_url"`
+	// SpawnOllama runs "ollama serve" in local mode when nothing answers at OllamaURL
+	SpawnOllama bool `json:"spawn_ollama"`
+	// BaseImage is the Ollama image model images are built from, without a tag
+	BaseImage string `json:"base_image"`
+	// DockerfileTemplate is a file holding a Dockerfile template model images
+	// are built from instead of the built-in one
+	DockerfileTemplate string `json:"dockerfile_template"`
+	// Network is the Docker network model containers join so the backend can reach them
+	Network string `json:"network"`
+	// GenerationTimeout bounds a single generation unless the model overrides it
+	GenerationTimeout time.Duration `json:"generation_timeout"`
+	// DockerTimeout bounds quick docker commands (ps, run, rm, inspect, ...)
+	DockerTimeout time.Duration `json:"docker_timeout"`
+	// DockerBuildTimeout bounds a single docker build
+	DockerBuildTimeout time.Duration `json:"docker_build_timeout"`
+	// StatsFile persists usage statistics across restarts when set
+	StatsFile string `json:"stats_file"`
+	// MetadataFile persists model tags across restarts when set
+	MetadataFile string `json:"metadata_file"`
+	// EvalFile appends A/B evaluations and their feedback when set, for later analysis
+	EvalFile string `json:"eval_file"`
+	// BasePath is the prefix every route is served under, such as /owngpt,
+	// or empty to serve them at the root
+	BasePath string `json:"base_path"`
+	// RootProbes also serves /health, /health/ready and /metrics at the root
+	// when BasePath is set, for probes that bypass the reverse proxy
+	RootProbes bool `json:"root_probes"`
+	// ReadOnly refuses every request that would create, change or delete
+	// models, configuration or server state, leaving chat and reads
+	ReadOnly bool `json:"read_only"`
+	// AdminToken protects the /admin endpoints; they are disabled when empty
+	AdminToken string `json:"admin_token" redact:"true"`
+	// Pprof serves Go's runtime profiles under /debug/pprof, behind the admin token
+	Pprof bool `json:"pprof"`
+	// StrictStartup exits when a startup self-check fails instead of only logging it
+	StrictStartup bool `json:"strict_startup"`
+	// StopOnExit stops every OWNGPT-managed container when the server shuts down
+	StopOnExit bool `json:"stop_on_exit"`
+	// DiscoverExternal also lists Ollama containers not created by OWNGPT so they can be adopted
+	DiscoverExternal bool `json:"discover_external"`
+	// PrepareOnStart pulls the Ollama base image in the background at startup
+	PrepareOnStart bool `json:"prepare_on_start"`
+	// ShutdownTimeout bounds graceful shutdown, including stopping containers
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"`
+	// ReadyServerTimeout bounds how long a new container's Ollama server may take to answer
+	ReadyServerTimeout time.Duration `json:"ready_server_timeout"`
+	// PullTimeout bounds a model pull when the model's size is unknown
+	PullTimeout time.Duration `json:"pull_timeout"`
+	// PullAttempts is how many times an interrupted model pull is tried
+	PullAttempts int `json:"pull_attempts"`
+	// PullRetryBackoff is the wait before retrying a pull, doubling after each retry
+	PullRetryBackoff time.Duration `json:"pull_retry_backoff"`
+	// CreateAttempts is how many times creating a model's image and container
+	// is tried when it fails for a reason that may pass, such as a network error
+	CreateAttempts int `json:"create_attempts"`
+	// CreateRetryBackoff is the wait before retrying a model's creation, doubling after each retry
+	CreateRetryBackoff time.Duration `json:"create_retry_backoff"`
+	// PullMinBandwidth is the slowest pull speed, in bytes per second, allowed for models of known size
+	PullMinBandwidth int64 `json:"pull_min_bandwidth"`
+	// LoadTimeout bounds the warm-up generation that loads a freshly pulled model
+	LoadTimeout time.Duration `json:"load_timeout"`
+	// SessionTTL expires chat sessions idle for longer than this
+	SessionTTL time.Duration `json:"session_ttl"`
+	// SessionMaxTurns caps the turns an imported transcript keeps, dropping
+	// the oldest; 0 for no limit
+	SessionMaxTurns int `json:"session_max_turns"`
+	// HistoryTokenBudget caps the tokens of session history sent with each
+	// generation; 0 uses whatever num_ctx leaves after the reply's num_predict
+	HistoryTokenBudget int `json:"history_token_budget"`
+	// SummarizeHistory replaces turns trimmed from the history with a generated summary
+	SummarizeHistory bool `json:"summarize_history"`
+	// CompareConcurrency caps how many models one /chat/compare request generates with at once
+	CompareConcurrency int `json:"compare_concurrency"`
+	// AccessLog is the access log format: "json" lines with sizes, model and
+	// streaming timings, "text" for gin's default lines, or "off"
+	AccessLog string `json:"access_log"`
+	// EmbedConcurrency caps how many /embeddings requests run at once
+	EmbedConcurrency int `json:"embed_concurrency"`
+	// EmbedQueueDepth is how many /embeddings requests may wait for a slot
+	// before further ones are turned away
+	EmbedQueueDepth int `json:"embed_queue_depth"`
+	// ChatConcurrency caps how many chats each model answers at once, 0 for no limit
+	ChatConcurrency int `json:"chat_concurrency"`
+	// ChatQueueDepth is how many chats may wait for a model's slot before
+	// further ones are turned away
+	ChatQueueDepth int `json:"chat_queue_depth"`
+	// LoadingRetryAfter is the Retry-After sent to chats for a model still
+	// starting, until its startup times have been observed
+	LoadingRetryAfter time.Duration `json:"loading_retry_after"`
+	// MaxStreams caps the streaming responses open at once, 0 for no limit
+	MaxStreams int `json:"max_streams"`
+	// MaxStreamsPerSession caps the streams open at once for one chat
+	// session, or one client address for streams without a session
+	MaxStreamsPerSession int `json:"max_streams_per_session"`
+	// TrustedProxies are the addresses or CIDR ranges whose X-Forwarded-For
+	// is believed when telling clients apart; none by default
+	TrustedProxies []string `json:"trusted_proxies"`
+	// EmbedBatchSize is how many inputs are embedded in one Ollama call
+	EmbedBatchSize int `json:"embed_batch_size"`
+	// DeleteRequiresForce refuses to delete a running model unless the request
+	// passes force=true
+	DeleteRequiresForce bool `json:"delete_requires_force"`
+	// LoadBalance spreads chats across every running model by weight instead
+	// of sending them all to the current model
+	LoadBalance bool `json:"load_balance"`
+	// RouteByContext sends each chat to the running model with the smallest
+	// context window its prompt fits in
+	RouteByContext bool `json:"route_by_context"`
+	// NoModelPolicy is what chat requests do when no model is running: "error"
+	// lists the installed models, "autostart" starts DefaultModel and waits for it
+	NoModelPolicy string `json:"no_model_policy"`
+	// DefaultModel is the model autostart starts; empty means the only installed model
+	DefaultModel string `json:"default_model"`
+	// StreamStallTimeout aborts a streamed generation when the client stops reading for this long
+	StreamStallTimeout time.Duration `json:"stream_stall_timeout"`
+	// Sampling is the default sampling applied to every generation
+	Sampling Sampling `json:"sampling"`
+	// StripTags are the tags, such as think, whose sections are removed from completions
+	StripTags []string `json:"strip_tags"`
+	// TrimOutput trims the whitespace around completions
+	TrimOutput bool `json:"trim_output"`
+	// NumCtx is the context window, in tokens, generations run with
+	NumCtx int `json:"num_ctx"`
+	// NumThread is the default num_thread option for generations (0 leaves it to Ollama)
+	NumThread int `json:"num_thread"`
+	// SlowRequestThreshold logs requests that take longer in total (0 disables)
+	SlowRequestThreshold time.Duration `json:"slow_request_threshold"`
+	// SlowFirstTokenThreshold logs streamed chats whose first token takes longer (0 disables)
+	SlowFirstTokenThreshold time.Duration `json:"slow_first_token_threshold"`
+	// ListingMaxAge is how long clients may reuse /models and /available-models
+	// without asking again; 0 has them revalidate with the ETag every time
+	ListingMaxAge time.Duration `json:"listing_max_age"`
+	// ModelPolicy restricts which models can be created
+	ModelPolicy ModelPolicy `json:"model_policy"`
+	// Labels are custom Docker labels put on every model container, such as
+	// team or cost center; create requests can add to them
+	Labels map[string]string `json:"labels"`
+	// Welcome is the opening assistant message of new chat sessions
+	Welcome Welcome `json:"welcome"`
+	// Moderation screens chat prompts and replies against a content policy
+	Moderation Moderation `json:"moderation"`
+	// ModerationTimeout bounds each call to the moderation endpoint
+	ModerationTimeout time.Duration `json:"moderation_timeout"`
+	// Platform is the platform model images are built and run for, such as
+	// linux/arm64; empty leaves it to docker
+	Platform string `json:"platform"`
+	// CORSOrigins are the origins browsers may call the API from, "*" for any
+	CORSOrigins []string `json:"cors_origins"`
+	// StreamKeepAlive sends Connection: keep-alive on HTTP/1.1 streams
+	StreamKeepAlive bool `json:"stream_keep_alive"`
+	// StreamNoBuffering sends X-Accel-Buffering: no on streams, so nginx
+	// passes events on as they are written instead of buffering them
+	StreamNoBuffering bool `json:"stream_no_buffering"`
+	// GenerationHistory is how many recent generations are kept per model (0 disables)
+	GenerationHistory int `json:"generation_history"`
+	// LogPrompts keeps the prompt text in generation history
+	LogPrompts bool `json:"log_prompts"`
+	// Profiles are per-model settings from the config file, keyed by model name
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+var (
+	current  *Config
+	loadOnce sync.Once
+)
+
+// Get returns the process-wide configuration, loading it on first use
+func Get() *Config {
+	loadOnce.Do(func() {
+		current = Load()
+	})
+	return current
+}
+
+// Load reads the configuration from the file named by OWNGPT_CONFIG_FILE and
+// the environment. Environment variables override the file, which overrides
+// the built-in defaults. An invalid file stops the server.
+func Load() *Config {
+	path := lookupEnv("OWNGPT_CONFIG_FILE")
+	file, err := loadFile(path)
+	if err != nil {
+		log.Fatalf("Invalid config file %s: %v", path, err)
+	}
+	if path != "" {
+		log.Printf("Loaded config file %s", path)
+	}
+
+	cfg := &Config{
+		ConfigFile:          path,
+		MaxConcurrentBuilds: getEnvInt("OWNGPT_MAX_CONCURRENT_BUILDS", or(file.Limits.MaxConcurrentBuilds, 2)),
+		MinFreeDisk:         int64(getEnvInt("OWNGPT_MIN_FREE_DISK", 5<<30)),
+		BuildDiskPath:       lookupEnv("OWNGPT_BUILD_DISK_PATH"),
+		MaxImages:           getEnvInt("OWNGPT_MAX_IMAGES", or(file.Limits.MaxImages, 4)),
+		MaxImageBytes:       getEnvInt("OWNGPT_MAX_IMAGE_BYTES", or(file.Limits.MaxImageBytes, 10*1024*1024)),
+		SkipPreload:         getEnvBool("OWNGPT_SKIP_PRELOAD", false),
+		BuildNoCache:        getEnvBool("OWNGPT_BUILD_NO_CACHE", false),
+		BuildInlineCache:    getEnvBool("OWNGPT_BUILD_INLINE_CACHE", false),
+		Platform:            getEnvChoice("OWNGPT_PLATFORM", HostPlatform(), Platforms...),
+		VerifyModels:        getEnvBool("OWNGPT_VERIFY_MODELS", true),
+		OllamaRegistry:      getEnv("OWNGPT_OLLAMA_REGISTRY", or(file.Ollama.Registry, "https://registry.ollama.ai")),
+		OllamaScheme:        getEnv("OWNGPT_OLLAMA_SCHEME", or(file.Ollama.Scheme, "http")),
+		OllamaPort:          getEnvInt("OWNGPT_OLLAMA_PORT", or(file.Ollama.Port, 11434)),
+		OllamaVersion:       getEnvImageTag("OWNGPT_OLLAMA_VERSION", or(file.Ollama.Version, "latest")),
+		Mode:                getEnvChoice("OWNGPT_MODE", "docker", "docker", "local"),
+		OllamaURL:           strings.TrimSuffix(getEnv("OWNGPT_OLLAMA_URL", "http://localhost:11434"), "/"),
+		SpawnOllama:         getEnvBool("OWNGPT_SPAWN_OLLAMA", false),
+		BaseImage:           getEnvImageRepo("OWNGPT_BASE_IMAGE", or(file.BaseImage, "ollama/ollama")),
+		DockerfileTemplate:  getEnv("OWNGPT_DOCKERFILE_TEMPLATE", or(file.DockerfileTemplate, "")),
+		Network:             getEnv("OWNGPT_NETWORK", or(file.Network, "owngpt_owngpt-network")),
+		GenerationTimeout:   getEnvDuration("OWNGPT_GENERATION_TIMEOUT", orDuration(file.Limits.GenerationTimeout, 15*time.Second)),
+		DockerTimeout:       getEnvDuration("OWNGPT_DOCKER_TIMEOUT", 2*time.Minute),
+		DockerBuildTimeout:  getEnvDuration("OWNGPT_DOCKER_BUILD_TIMEOUT", 20*time.Minute),
+		StatsFile:           lookupEnv("OWNGPT_STATS_FILE"),
+		MetadataFile:        lookupEnv("OWNGPT_METADATA_FILE"),
+		EvalFile:            lookupEnv("OWNGPT_EVAL_FILE"),
+		ReadOnly:            getEnvBool("OWNGPT_READONLY", false),
+		AdminToken:          lookupEnv("OWNGPT_ADMIN_TOKEN"),
+		BasePath:            getEnvBasePath("OWNGPT_BASE_PATH"),
+		RootProbes:          getEnvBool("OWNGPT_ROOT_PROBES", false),
+		Pprof:               getEnvBool("OWNGPT_PPROF", false),
+		StrictStartup:       getEnvBool("OWNGPT_STRICT_STARTUP", false),
+		StopOnExit:          getEnvBool("OWNGPT_STOP_ON_EXIT", false),
+		DiscoverExternal:    getEnvBool("OWNGPT_DISCOVER_EXTERNAL", false),
+		PrepareOnStart:      getEnvBool("OWNGPT_PREPARE_ON_START", false),
+		ShutdownTimeout:     getEnvDuration("OWNGPT_SHUTDOWN_TIMEOUT", 30*time.Second),
+		ReadyServerTimeout:  getEnvDuration("OWNGPT_READY_SERVER_TIMEOUT", time.Minute),
+		PullTimeout:         getEnvDuration("OWNGPT_PULL_TIMEOUT", 10*time.Minute),
+		PullAttempts:        getEnvInt("OWNGPT_PULL_ATTEMPTS", 3),
+		PullRetryBackoff:    getEnvDuration("OWNGPT_PULL_RETRY_BACKOFF", 5*time.Second),
+		CreateAttempts:      getEnvInt("OWNGPT_CREATE_ATTEMPTS", 2),
+		CreateRetryBackoff:  getEnvDuration("OWNGPT_CREATE_RETRY_BACKOFF", 10*time.Second),
+		PullMinBandwidth:    int64(getEnvInt("OWNGPT_PULL_MIN_BANDWIDTH", 5*1024*1024)),
+		LoadTimeout:         getEnvDuration("OWNGPT_LOAD_TIMEOUT", 3*time.Minute),
+		SessionTTL:          getEnvDuration("OWNGPT_SESSION_TTL", orDuration(file.Limits.SessionTTL, 30*time.Minute)),
+		SessionMaxTurns:     getEnvInt("OWNGPT_SESSION_MAX_TURNS", 100),
+		StreamStallTimeout:  getEnvDuration("OWNGPT_STREAM_STALL_TIMEOUT", 10*time.Second),
+		HistoryTokenBudget:  getEnvInt("OWNGPT_HISTORY_TOKEN_BUDGET", or(file.Limits.HistoryTokenBudget, 0)),
+		SummarizeHistory:    getEnvBool("OWNGPT_SUMMARIZE_HISTORY", false),
+		CompareConcurrency:  getEnvInt("OWNGPT_COMPARE_CONCURRENCY", 2),
+		AccessLog:           getEnvChoice("OWNGPT_ACCESS_LOG", "json", "json", "text", "off"),
+		EmbedConcurrency:    getEnvInt("OWNGPT_EMBED_CONCURRENCY", 1),
+		EmbedQueueDepth:     getEnvInt("OWNGPT_EMBED_QUEUE_DEPTH", 16),
+		EmbedBatchSize:      getEnvInt("OWNGPT_EMBED_BATCH_SIZE", 32),
+		ChatConcurrency:     getEnvInt("OWNGPT_CHAT_CONCURRENCY", 0),
+		ChatQueueDepth:      getEnvInt("OWNGPT_CHAT_QUEUE_DEPTH", 16),
+		LoadingRetryAfter:   getEnvDuration("OWNGPT_LOADING_RETRY_AFTER", 10*time.Second),
+		LoadBalance:         getEnvBool("OWNGPT_LOAD_BALANCE", false),
+		RouteByContext:      getEnvBool("OWNGPT_ROUTE_BY_CONTEXT", false),
+		DeleteRequiresForce: getEnvBool("OWNGPT_DELETE_REQUIRES_FORCE", true),
+		NoModelPolicy:       getEnvChoice("OWNGPT_NO_MODEL_POLICY", "error", "error", "autostart"),
+		DefaultModel:        lookupEnv("OWNGPT_DEFAULT_MODEL"),
+
+		// Caps on open streams keep a client from exhausting the server
+		MaxStreams:           getEnvInt("OWNGPT_MAX_STREAMS", 256),
+		MaxStreamsPerSession: getEnvInt("OWNGPT_MAX_STREAMS_PER_SESSION", 4),
+		TrustedProxies:       getEnvProxies("OWNGPT_TRUSTED_PROXIES"),
+
+		// Streams have to get through browsers' CORS checks and any proxy in between
+		CORSOrigins:       getEnvOrigins("OWNGPT_CORS_ORIGINS"),
+		StreamKeepAlive:   getEnvBool("OWNGPT_STREAM_KEEP_ALIVE", true),
+		StreamNoBuffering: getEnvBool("OWNGPT_STREAM_NO_BUFFERING", true),
+
+		Moderation:        getEnvModeration(),
+		ModerationTimeout: getEnvDuration("OWNGPT_MODERATION_TIMEOUT", 5*time.Second),
+
+		GenerationHistory: getEnvInt("OWNGPT_GENERATION_HISTORY", 50),
+		LogPrompts:        getEnvBool("OWNGPT_LOG_PROMPTS", false),
+
+		// The defaults favour short, focused answers for sub-6s responses
+		Sampling: Sampling{
+			NumPredict:    int(getEnvSampling("OWNGPT_NUM_PREDICT", "num_predict", float64(or(file.Defaults.NumPredict, 250)))),
+			Temperature:   getEnvSampling("OWNGPT_TEMPERATURE", "temperature", or(file.Defaults.Temperature, 0.2)),
+			TopP:          getEnvSampling("OWNGPT_TOP_P", "top_p", or(file.Defaults.TopP, 0.7)),
+			TopK:          int(getEnvSampling("OWNGPT_TOP_K", "top_k", float64(or(file.Defaults.TopK, 15)))),
+			RepeatPenalty: getEnvSampling("OWNGPT_REPEAT_PENALTY", "repeat_penalty", or(file.Defaults.RepeatPenalty, 1.05)),
+			TfsZ:          getEnvSampling("OWNGPT_TFS_Z", "tfs_z", or(file.Defaults.TfsZ, 0.95)),
+		},
+		NumCtx:     getEnvInt("OWNGPT_NUM_CTX", 2048),
+		NumThread:  getEnvNumThread("OWNGPT_NUM_THREAD"),
+		StripTags:  getEnvStripTags("OWNGPT_STRIP_TAGS"),
+		TrimOutput: getEnvBool("OWNGPT_TRIM_OUTPUT", false),
+
+		// Polled model listings are revalidated with their ETag unless clients may reuse them
+		ListingMaxAge: getEnvThreshold("OWNGPT_LISTING_MAX_AGE", 0),
+
+		// The Dockerfile tunes models for sub-6s responses
+		SlowRequestThreshold:    getEnvThreshold("OWNGPT_SLOW_REQUEST_THRESHOLD", 6*time.Second),
+		SlowFirstTokenThreshold: getEnvThreshold("OWNGPT_SLOW_FIRST_TOKEN_THRESHOLD", 2*time.Second),
+		ModelPolicy: ModelPolicy{
+			Allow: getEnvModelPatterns("OWNGPT_MODEL_ALLOWLIST", file.Models.Allow),
+			Deny:  getEnvModelPatterns("OWNGPT_MODEL_DENYLIST", file.Models.Deny),
+		},
+		Labels:   getEnvLabels("OWNGPT_LABELS", file.Labels),
+		Welcome:  getEnvWelcome(file.Welcome),
+		Profiles: file.Profiles,
+	}
+
+	if cfg.OllamaScheme != "http" && cfg.OllamaScheme != "https" {
+		log.Printf("Invalid value %q for OWNGPT_OLLAMA_SCHEME, using http", cfg.OllamaScheme)
+		cfg.OllamaScheme = "http"
+	}
+	if cfg.OllamaPort < 1 || cfg.OllamaPort > 65535 {
+		log.Printf("Invalid value %d for OWNGPT_OLLAMA_PORT, using 11434", cfg.OllamaPort)
+		cfg.OllamaPort = 11434
+	}
+
+	if cfg.CompareConcurrency < 1 {
+		log.Printf("Invalid value %d for OWNGPT_COMPARE_CONCURRENCY, using 1", cfg.CompareConcurrency)
+		cfg.CompareConcurrency = 1
+	}
+	if cfg.EmbedConcurrency < 1 {
+		log.Printf("Invalid value %d for OWNGPT_EMBED_CONCURRENCY, using 1", cfg.EmbedConcurrency)
+		cfg.EmbedConcurrency = 1
+	}
+	if cfg.EmbedQueueDepth < 0 {
+		log.Printf("Invalid value %d for OWNGPT_EMBED_QUEUE_DEPTH, using 0", cfg.EmbedQueueDepth)
+		cfg.EmbedQueueDepth = 0
+	}
+	if cfg.PullAttempts < 1 {
+		log.Printf("Invalid value %d for OWNGPT_PULL_ATTEMPTS, using 1", cfg.PullAttempts)
+		cfg.PullAttempts = 1
+	}
+	if cfg.CreateAttempts < 1 {
+		log.Printf("Invalid value %d for OWNGPT_CREATE_ATTEMPTS, using 1", cfg.CreateAttempts)
+		cfg.CreateAttempts = 1
+	}
+	if cfg.ChatConcurrency < 0 {
+		log.Printf("Invalid value %d for OWNGPT_CHAT_CONCURRENCY, using 0", cfg.ChatConcurrency)
+		cfg.ChatConcurrency = 0
+	}
+	if cfg.ChatQueueDepth < 0 {
+		log.Printf("Invalid value %d for OWNGPT_CHAT_QUEUE_DEPTH, using 0", cfg.ChatQueueDepth)
+		cfg.ChatQueueDepth = 0
+	}
+	if cfg.MaxStreams < 0 {
+		log.Printf("Invalid value %d for OWNGPT_MAX_STREAMS, using 0", cfg.MaxStreams)
+		cfg.MaxStreams = 0
+	}
+	if cfg.MaxStreamsPerSession < 0 {
+		log.Printf("Invalid value %d for OWNGPT_MAX_STREAMS_PER_SESSION, using 0", cfg.MaxStreamsPerSession)
+		cfg.MaxStreamsPerSession = 0
+	}
+	if cfg.SessionMaxTurns < 0 {
+		log.Printf("Invalid value %d for OWNGPT_SESSION_MAX_TURNS, using 0", cfg.SessionMaxTurns)
+		cfg.SessionMaxTurns = 0
+	}
+	if cfg.EmbedBatchSize < 1 {
+		log.Printf("Invalid value %d for OWNGPT_EMBED_BATCH_SIZE, using 1", cfg.EmbedBatchSize)
+		cfg.EmbedBatchSize = 1
+	}
+
+	if CheckNumCtx(cfg.NumCtx) != nil {
+		log.Printf("Invalid value %d for OWNGPT_NUM_CTX, must be between %d and %d, using 2048", cfg.NumCtx, minNumCtx, maxNumCtx)
+		cfg.NumCtx = 2048
+	}
+
+	s := cfg.Sampling
+	log.Printf("Sampling defaults: num_predict=%d temperature=%v top_p=%v top_k=%d repeat_penalty=%v tfs_z=%v num_ctx=%d",
+		s.NumPredict, s.Temperature, s.TopP, s.TopK, s.RepeatPenalty, s.TfsZ, cfg.NumCtx)
+
+	// Every build competes for the same Docker daemon, CPU and image storage,
+	// so running more builds than cores only makes each of them slower
+	if cfg.MaxConcurrentBuilds < 1 {
+		cfg.MaxConcurrentBuilds = 1
+	}
+	if maxBuilds := runtime.NumCPU(); cfg.MaxConcurrentBuilds > maxBuilds {
+		log.Printf("OWNGPT_MAX_CONCURRENT_BUILDS=%d exceeds %d CPUs, capping it", cfg.MaxConcurrentBuilds, maxBuilds)
+		cfg.MaxConcurrentBuilds = maxBuilds
+	}
+	if cfg.MinFreeDisk < 0 {
+		log.Printf("Invalid value %d for OWNGPT_MIN_FREE_DISK, using 0", cfg.MinFreeDisk)
+		cfg.MinFreeDisk = 0
+	}
+
+	return cfg
+}
+
+// getEnv reads a string environment variable with a fallback
+func getEnv(key, fallback string) string {
+	if value := lookupEnv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt reads an integer environment variable, falling back on missing or invalid values
+func getEnvInt(key string, fallback int) int {
+	value := lookupEnv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using %d", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvBool reads a boolean environment variable, falling back on missing or invalid values
+func getEnvBool(key string, fallback bool) bool {
+	value := lookupEnv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using %t", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvDuration reads a duration environment variable such as "30s" or "2m"
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := lookupEnv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Invalid value %q for %s, using %v", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvThreshold reads a duration environment variable where "0" turns the check off
+func getEnvThreshold(key string, fallback time.Duration) time.Duration {
+	if lookupEnv(key) == "0" {
+		return 0
+	}
+	return getEnvDuration(key, fallback)
+}
+
+// The context window OWNGPT_NUM_CTX may be set to. Below a few hundred tokens
+// hardly any prompt fits, and beyond a million no model is trained for it.
+const (
+	minNumCtx = 128
+	maxNumCtx = 1 << 20
+)
+
+// CheckNumCtx checks a context window is within the range OWNGPT_NUM_CTX allows
+func CheckNumCtx(numCtx int) error {
+	if numCtx < minNumCtx || numCtx > maxNumCtx {
+		return fmt.Errorf("num_ctx must be between %d and %d", minNumCtx, maxNumCtx)
+	}
+	return nil
+}
+
+// CheckMaxTokens checks a model's cap on num_predict is a length a reply may have
+func CheckMaxTokens(maxTokens int) error {
+	maxNumPredict := int(samplingRanges["num_predict"][1])
+	if maxTokens < 1 || maxTokens > maxNumPredict {
+		return fmt.Errorf("max_tokens must be between 1 and %d", maxNumPredict)
+	}
+	return nil
+}
+
+// getEnvNumThread reads the default generation thread count. "auto" uses one
+// thread per visible CPU; unset leaves the choice to Ollama.
+func getEnvNumThread(key string) int {
+	if lookupEnv(key) == "auto" {
+		return runtime.NumCPU()
+	}
+	threads := getEnvInt(key, 0)
+	if threads < 0 {
+		log.Printf("Invalid value %d for %s, leaving num_thread to Ollama", threads, key)
+		return 0
+	}
+	return threads
+}
+
+// getEnvStripTags reads a comma-separated list of tag names, skipping invalid ones
+func getEnvStripTags(key string) []string {
+	var tags []string
+	for _, tag := range strings.Split(lookupEnv(key), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if err := CheckStripTag(tag); err != nil {
+			log.Printf("Ignoring %s entry: %v", key, err)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// imageTagPattern is Docker's image tag format
+var imageTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// getEnvImageTag reads a Docker image tag, falling back on missing or malformed values
+func getEnvImageTag(key, fallback string) string {
+	value := lookupEnv(key)
+	if value == "" {
+		return fallback
+	}
+	if !imageTagPattern.MatchString(value) {
+		log.Printf("Invalid image tag %q for %s, using %s", value, key, fallback)
+		return fallback
+	}
+	return value
+}
+
+// getEnvImageRepo reads a Docker image name without a tag, falling back on missing or malformed values
+func getEnvImageRepo(key, fallback string) string {
+	value := lookupEnv(key)
+	if value == "" {
+		return fallback
+	}
+	if !imageRepoPattern.MatchString(value) {
+		log.Printf("Invalid image name %q for %s, using %s", value, key, fallback)
+		return fallback
+	}
+	return value
+}
+
+// basePathPattern is a URL path of one or more plain segments
+var basePathPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// getEnvBasePath reads a route prefix, adding the leading slash and dropping
+// trailing ones, so "owngpt/" becomes "/owngpt". Invalid prefixes are logged
+// and ignored.
+func getEnvBasePath(key string) string {
+	value := strings.TrimRight(strings.TrimSpace(lookupEnv(key)), "/")
+	if value == "" {
+		return ""
+	}
+	if !strings.HasPrefix(value, "/") {
+		value = "/" + value
+	}
+	if !basePathPattern.MatchString(value) {
+		log.Printf("Invalid value %q for %s, serving routes at the root", lookupEnv(key), key)
+		return ""
+	}
+	return value
+}
+
+// getEnvChoice reads an environment variable that must be one of choices,
+// falling back on missing or unknown values
+func getEnvChoice(key, fallback string, choices ...string) string {
+	value := lookupEnv(key)
+	if value == "" {
+		return fallback
+	}
+	for _, choice := range choices {
+		if value == choice {
+			return value
+		}
+	}
+	log.Printf("Invalid value %q for %s, expected one of %s, using %s", value, key, strings.Join(choices, ", "), fallback)
+	return fallback
+}
+
+// getEnvSampling reads a sampling option, falling back on missing, invalid or out-of-range values
+func getEnvSampling(key, option string, fallback float64) float64 {
+	value := lookupEnv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		err = CheckSampling(option, parsed)
+	}
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using %v: %v", value, key, fallback, err)
+		return fallback
+	}
+	return parsed
+}
+
+// Redacted returns the configuration for display, with secrets hidden and
+// durations written like "30s"
+func (c *Config) Redacted() map[string]interface{} {
+	view := make(map[string]interface{})
+	value := reflect.ValueOf(*c)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := field.Tag.Get("json")
+		switch v := value.Field(i).Interface().(type) {
+		case string:
+			if field.Tag.Get("redact") == "true" && v != "" {
+				view[name] = "[redacted]"
+			} else {
+				view[name] = v
+			}
+		case time.Duration:
+			view[name] = v.String()
+		default:
+			view[name] = v
+		}
+	}
+	return view
+}
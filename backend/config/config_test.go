@@ -0,0 +1,117 @@
+package config
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestMaxConcurrentBuildsBounds(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"0", 1},
+		{"-3", 1},
+		{"1", 1},
+		{"100000", runtime.NumCPU()},
+	}
+	for _, tt := range tests {
+		t.Setenv("OWNGPT_MAX_CONCURRENT_BUILDS", tt.value)
+		if got := Load().MaxConcurrentBuilds; got != tt.want {
+			t.Errorf("OWNGPT_MAX_CONCURRENT_BUILDS=%s gives %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBaseImageFromEnv(t *testing.T) {
+	tests := []struct {
+		version, image         string
+		wantVersion, wantImage string
+	}{
+		{"", "", "latest", "ollama/ollama"},
+		{"0.1.32", "registry.local:5000/mirror/ollama", "0.1.32", "registry.local:5000/mirror/ollama"},
+		{"0.1.32; rm -rf /", "Ollama/Ollama", "latest", "ollama/ollama"},
+		{".hidden", "ollama/ollama:0.1.32", "latest", "ollama/ollama"},
+	}
+	for _, tt := range tests {
+		t.Setenv("OWNGPT_OLLAMA_VERSION", tt.version)
+		t.Setenv("OWNGPT_BASE_IMAGE", tt.image)
+		cfg := Load()
+		if cfg.OllamaVersion != tt.wantVersion || cfg.BaseImage != tt.wantImage {
+			t.Errorf("version %q, image %q gives %s:%s, want %s:%s",
+				tt.version, tt.image, cfg.BaseImage, cfg.OllamaVersion, tt.wantImage, tt.wantVersion)
+		}
+	}
+}
+
+func TestOllamaSchemeAndPort(t *testing.T) {
+	tests := []struct {
+		scheme, port string
+		wantScheme   string
+		wantPort     int
+	}{
+		{"", "", "http", 11434},
+		{"https", "8443", "https", 8443},
+		{"ftp", "0", "http", 11434},
+		{"HTTP", "70000", "http", 11434},
+	}
+	for _, tt := range tests {
+		t.Setenv("OWNGPT_OLLAMA_SCHEME", tt.scheme)
+		t.Setenv("OWNGPT_OLLAMA_PORT", tt.port)
+		cfg := Load()
+		if cfg.OllamaScheme != tt.wantScheme || cfg.OllamaPort != tt.wantPort {
+			t.Errorf("scheme %q, port %q gives %s:%d, want %s:%d",
+				tt.scheme, tt.port, cfg.OllamaScheme, cfg.OllamaPort, tt.wantScheme, tt.wantPort)
+		}
+	}
+}
+
+func TestNumCtxBounds(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", 2048},
+		{"8192", 8192},
+		{"128", 128},
+		{"64", 2048},
+		{"2097152", 2048},
+		{"lots", 2048},
+	}
+	for _, tt := range tests {
+		t.Setenv("OWNGPT_NUM_CTX", tt.value)
+		if got := Load().NumCtx; got != tt.want {
+			t.Errorf("OWNGPT_NUM_CTX=%s gives %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBasePathFromEnv(t *testing.T) {
+	tests := map[string]string{
+		"":               "",
+		"/":              "",
+		"owngpt":         "/owngpt",
+		"/owngpt/":       "/owngpt",
+		" /api/owngpt ":  "/api/owngpt",
+		"/own gpt":       "",
+		"/owngpt//chat":  "",
+		"/owngpt?x=1":    "",
+		"https://x/path": "",
+	}
+	for value, want := range tests {
+		t.Setenv("OWNGPT_BASE_PATH", value)
+		if got := Load().BasePath; got != want {
+			t.Errorf("OWNGPT_BASE_PATH=%q gives %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestMinFreeDiskFromEnv(t *testing.T) {
+	tests := map[string]int64{"": 5 << 30, "0": 0, "1073741824": 1 << 30, "-1": 0, "lots": 5 << 30}
+	for value, want := range tests {
+		t.Setenv("OWNGPT_MIN_FREE_DISK", value)
+		if got := Load().MinFreeDisk; got != want {
+			t.Errorf("OWNGPT_MIN_FREE_DISK=%q gives %d, want %d", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// defaultCORSOrigins are where the frontend is served from, locally and in compose
+var defaultCORSOrigins = []string{"http://localhost:9090", "http://frontend:9090"}
+
+// getEnvOrigins reads a comma-separated list of origins allowed to call the
+// API from a browser, skipping invalid ones. "*" allows every origin. Without
+// any valid origin the frontend's are kept.
+func getEnvOrigins(key string) []string {
+	value := lookupEnv(key)
+	if value == "" {
+		return defaultCORSOrigins
+	}
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			return []string{"*"}
+		}
+		if err := checkOrigin(origin); err != nil {
+			log.Printf("Ignoring %s entry: %v", key, err)
+			continue
+		}
+		origins = append(origins, origin)
+	}
+	if len(origins) == 0 {
+		log.Printf("No valid origins in %s, using %s", key, strings.Join(defaultCORSOrigins, ","))
+		return defaultCORSOrigins
+	}
+	return origins
+}
+
+// checkOrigin checks an origin is a scheme and host, such as https://chat.example.com
+func checkOrigin(origin string) error {
+	parsed, err := url.Parse(origin)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Path != "" || parsed.RawQuery != "" {
+		return fmt.Errorf("origin %q must be http:// or https:// and a host, such as https://chat.example.com", origin)
+	}
+	return nil
+}
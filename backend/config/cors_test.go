@@ -0,0 +1,24 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCORSOriginsFromEnv(t *testing.T) {
+	tests := map[string][]string{
+		"":                             defaultCORSOrigins,
+		"https://chat.example.com/":    {"https://chat.example.com"},
+		" http://a:8080 , https://b ,": {"http://a:8080", "https://b"},
+		"https://a,*":                  {"*"},
+		"ftp://a,https://b":            {"https://b"},
+		"chat.example.com":             defaultCORSOrigins,
+		"https://a/app,https://a?x":    defaultCORSOrigins,
+	}
+	for value, want := range tests {
+		t.Setenv("OWNGPT_CORS_ORIGINS", value)
+		if got := Load().CORSOrigins; !reflect.DeepEqual(got, want) {
+			t.Errorf("OWNGPT_CORS_ORIGINS=%q gives %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// lookupEnv reads a setting from the environment. KEY_FILE, when set, names a
+// file holding the value, as Docker and Kubernetes secrets are mounted, and
+// takes precedence over KEY itself so secrets stay out of docker inspect and
+// process listings. Trailing newlines in the file are dropped. An unreadable
+// file stops the server rather than running without the secret.
+func lookupEnv(key string) string {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return os.Getenv(key)
+	}
+	if os.Getenv(key) != "" {
+		log.Printf("Both %s and %s_FILE are set, using %s_FILE", key, key, key)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read %s_FILE: %v", key, err)
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// secretFile writes value to a file in the test's temporary directory
+func secretFile(t *testing.T, value string) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLookupEnvFile(t *testing.T) {
+	t.Setenv("OWNGPT_ADMIN_TOKEN", "from-env")
+	if got := Load().AdminToken; got != "from-env" {
+		t.Errorf("AdminToken = %q, want the variable's value", got)
+	}
+
+	// The file wins over the variable, without its trailing newline
+	t.Setenv("OWNGPT_ADMIN_TOKEN_FILE", secretFile(t, "from-file\r\n"))
+	if got := Load().AdminToken; got != "from-file" {
+		t.Errorf("AdminToken = %q, want the file's value", got)
+	}
+
+	// Settings other than secrets can come from files too
+	t.Setenv("OWNGPT_OLLAMA_PORT_FILE", secretFile(t, "8443\n"))
+	if got := Load().OllamaPort; got != 8443 {
+		t.Errorf("OllamaPort = %d, want 8443 from the file", got)
+	}
+}
+
+func TestLookupEnvFileUnreadable(t *testing.T) {
+	if os.Getenv("OWNGPT_TEST_UNREADABLE") == "1" {
+		lookupEnv("OWNGPT_ADMIN_TOKEN")
+		return
+	}
+
+	// Reading the secret fails the process, so it runs in a child
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLookupEnvFileUnreadable$")
+	cmd.Env = append(os.Environ(),
+		"OWNGPT_TEST_UNREADABLE=1",
+		"OWNGPT_ADMIN_TOKEN_FILE="+filepath.Join(t.TempDir(), "missing"),
+	)
+	if err := cmd.Run(); err == nil {
+		t.Error("the server kept running without its secret")
+	}
+}
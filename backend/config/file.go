@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SamplingOverrides replaces some of the sampling defaults. Unset options
+// keep the value from the layer below.
+type SamplingOverrides struct {
+	NumPredict    *int     `yaml:"num_predict" json:"num_predict,omitempty"`
+	Temperature   *float64 `yaml:"temperature" json:"temperature,omitempty"`
+	TopP          *float64 `yaml:"top_p" json:"top_p,omitempty"`
+	TopK          *int     `yaml:"top_k" json:"top_k,omitempty"`
+	RepeatPenalty *float64 `yaml:"repeat_penalty" json:"repeat_penalty,omitempty"`
+	TfsZ          *float64 `yaml:"tfs_z" json:"tfs_z,omitempty"`
+}
+
+// Profile holds the settings the config file gives a single model. Settings
+// made with PUT /models/:name/config take precedence.
+type Profile struct {
+	TimeoutSeconds int               `yaml:"timeout_seconds" json:"timeout_seconds,omitempty"`
+	Scheme         string            `yaml:"scheme" json:"scheme,omitempty"`
+	Port           int               `yaml:"port" json:"port,omitempty"`
+	Weight         *int              `yaml:"weight" json:"weight,omitempty"`
+	NumCtx         int               `yaml:"num_ctx" json:"num_ctx,omitempty"`
+	MaxTokens      int               `yaml:"max_tokens" json:"max_tokens,omitempty"`
+	Options        SamplingOverrides `yaml:"options" json:"options"`
+	// Welcome replaces the welcome message of sessions started on the model
+	Welcome *Welcome `yaml:"welcome" json:"welcome,omitempty"`
+}
+
+// fileDuration is a duration written like "30s" or "2m" in the config file
+type fileDuration time.Duration
+
+func (d *fileDuration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil || parsed <= 0 {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, node.Value)
+	}
+	*d = fileDuration(parsed)
+	return nil
+}
+
+// fileConfig is the layout of the file named by OWNGPT_CONFIG_FILE. Every key
+// is optional, and environment variables override the file.
+type fileConfig struct {
+	Defaults           SamplingOverrides  `yaml:"defaults"`
+	Limits             fileLimits         `yaml:"limits"`
+	Network            *string            `yaml:"network"`
+	BaseImage          *string            `yaml:"base_image"`
+	DockerfileTemplate *string            `yaml:"dockerfile_template"`
+	Ollama             fileOllama         `yaml:"ollama"`
+	Models             ModelPolicy        `yaml:"models"`
+	Labels             map[string]string  `yaml:"labels"`
+	Welcome            Welcome            `yaml:"welcome"`
+	Profiles           map[string]Profile `yaml:"profiles"`
+}
+
+// fileLimits is the limits section of the config file
+type fileLimits struct {
+	MaxImages           *int          `yaml:"max_images"`
+	MaxImageBytes       *int          `yaml:"max_image_bytes"`
+	MaxConcurrentBuilds *int          `yaml:"max_concurrent_builds"`
+	GenerationTimeout   *fileDuration `yaml:"generation_timeout"`
+	HistoryTokenBudget  *int          `yaml:"history_token_budget"`
+	SessionTTL          *fileDuration `yaml:"session_ttl"`
+}
+
+// fileOllama is the ollama section of the config file
+type fileOllama struct {
+	Version  *string `yaml:"version"`
+	Scheme   *string `yaml:"scheme"`
+	Port     *int    `yaml:"port"`
+	Registry *string `yaml:"registry"`
+}
+
+// imageRepoPattern is a Docker image reference without a tag, optionally
+// prefixed with a registry host
+var imageRepoPattern = regexp.MustCompile(`^([A-Za-z0-9.-]+(:[0-9]+)?/)?[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*$`)
+
+// loadFile reads and validates the config file. An empty path is no file.
+// YAML is a superset of JSON, so either format is accepted.
+func loadFile(path string) (*fileConfig, error) {
+	file := &fileConfig{}
+	if path == "" {
+		return file, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			return nil, errors.New(strings.Join(typeErr.Errors, "; "))
+		}
+		return nil, err
+	}
+	if err := file.validate(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// validate checks values the YAML types can't, naming the offending key
+func (f *fileConfig) validate() error {
+	if err := f.Defaults.validate("defaults"); err != nil {
+		return err
+	}
+	if v := f.Limits.MaxImages; v != nil && *v < 0 {
+		return fmt.Errorf("limits.max_images must not be negative")
+	}
+	if v := f.Limits.MaxImageBytes; v != nil && *v < 1 {
+		return fmt.Errorf("limits.max_image_bytes must be positive")
+	}
+	if v := f.Limits.MaxConcurrentBuilds; v != nil && *v < 1 {
+		return fmt.Errorf("limits.max_concurrent_builds must be at least 1")
+	}
+	if v := f.Limits.HistoryTokenBudget; v != nil && *v < 0 {
+		return fmt.Errorf("limits.history_token_budget must not be negative")
+	}
+	if v := f.Network; v != nil && *v == "" {
+		return fmt.Errorf("network must not be empty")
+	}
+	if v := f.BaseImage; v != nil && !imageRepoPattern.MatchString(*v) {
+		return fmt.Errorf("base_image %q is not an image name; set the tag with ollama.version", *v)
+	}
+	if v := f.Ollama.Version; v != nil && !imageTagPattern.MatchString(*v) {
+		return fmt.Errorf("ollama.version %q is not a valid image tag", *v)
+	}
+	if v := f.Ollama.Scheme; v != nil && *v != "http" && *v != "https" {
+		return fmt.Errorf("ollama.scheme must be http or https")
+	}
+	if v := f.Ollama.Port; v != nil && (*v < 1 || *v > 65535) {
+		return fmt.Errorf("ollama.port must be between 1 and 65535")
+	}
+	for i, pattern := range f.Models.Allow {
+		if err := checkModelPattern(pattern); err != nil {
+			return fmt.Errorf("models.allow[%d]: %v", i, err)
+		}
+		f.Models.Allow[i] = strings.ToLower(pattern)
+	}
+	for i, pattern := range f.Models.Deny {
+		if err := checkModelPattern(pattern); err != nil {
+			return fmt.Errorf("models.deny[%d]: %v", i, err)
+		}
+		f.Models.Deny[i] = strings.ToLower(pattern)
+	}
+	if err := CheckLabels(f.Labels); err != nil {
+		return fmt.Errorf("labels: %v", err)
+	}
+	if err := f.Welcome.validate("welcome"); err != nil {
+		return err
+	}
+	for name, profile := range f.Profiles {
+		key := "profiles." + name
+		if profile.TimeoutSeconds < 0 {
+			return fmt.Errorf("%s.timeout_seconds must not be negative", key)
+		}
+		if profile.Scheme != "" && profile.Scheme != "http" && profile.Scheme != "https" {
+			return fmt.Errorf("%s.scheme must be http or https", key)
+		}
+		if profile.Port < 0 || profile.Port > 65535 {
+			return fmt.Errorf("%s.port must be between 1 and 65535", key)
+		}
+		if profile.Weight != nil && *profile.Weight < 0 {
+			return fmt.Errorf("%s.weight must not be negative", key)
+		}
+		if profile.NumCtx != 0 {
+			if err := CheckNumCtx(profile.NumCtx); err != nil {
+				return fmt.Errorf("%s.%v", key, err)
+			}
+		}
+		if profile.MaxTokens != 0 {
+			if err := CheckMaxTokens(profile.MaxTokens); err != nil {
+				return fmt.Errorf("%s.%v", key, err)
+			}
+		}
+		if err := profile.Options.validate(key + ".options"); err != nil {
+			return err
+		}
+		if profile.Welcome != nil {
+			if err := profile.Welcome.validate(key + ".welcome"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks each set option is in range, prefixing errors with the key path
+func (o SamplingOverrides) validate(key string) error {
+	check := func(option string, value float64) error {
+		if err := CheckSampling(option, value); err != nil {
+			return fmt.Errorf("%s.%v", key, err)
+		}
+		return nil
+	}
+	if o.NumPredict != nil {
+		if err := check("num_predict", float64(*o.NumPredict)); err != nil {
+			return err
+		}
+	}
+	if o.Temperature != nil {
+		if err := check("temperature", *o.Temperature); err != nil {
+			return err
+		}
+	}
+	if o.TopP != nil {
+		if err := check("top_p", *o.TopP); err != nil {
+			return err
+		}
+	}
+	if o.TopK != nil {
+		if err := check("top_k", float64(*o.TopK)); err != nil {
+			return err
+		}
+	}
+	if o.RepeatPenalty != nil {
+		if err := check("repeat_penalty", *o.RepeatPenalty); err != nil {
+			return err
+		}
+	}
+	if o.TfsZ != nil {
+		if err := check("tfs_z", *o.TfsZ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// or returns the file's value when set, otherwise the built-in default
+func or[T any](value *T, fallback T) T {
+	if value != nil {
+		return *value
+	}
+	return fallback
+}
+
+// orDuration is or for durations from the file
+func orDuration(value *fileDuration, fallback time.Duration) time.Duration {
+	if value != nil {
+		return time.Duration(*value)
+	}
+	return fallback
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MaxLabels is the most custom labels a model container can carry
+const MaxLabels = 32
+
+// labelKeyPattern is a Docker label key in the lower-case, dotted form Docker
+// recommends, such as team or com.example.cost-center
+var labelKeyPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]{0,126}[a-z0-9])?$`)
+
+// CheckLabel validates a custom container label. Keys under owngpt. are kept
+// for the labels OWNGPT sets itself, and values can't hold commas, which
+// separate labels when docker lists them.
+func CheckLabel(key, value string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("label key %q must be 1-128 lower-case letters, digits, '.', '_' or '-', starting and ending with a letter or digit", key)
+	}
+	if strings.HasPrefix(key, "owngpt.") || strings.HasPrefix(key, "com.docker.") {
+		return fmt.Errorf("label key %q uses a reserved prefix", key)
+	}
+	if len(value) > 256 {
+		return fmt.Errorf("label %s is longer than 256 bytes", key)
+	}
+	if strings.ContainsRune(value, ',') || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return fmt.Errorf("label %s must not contain commas or control characters", key)
+	}
+	return nil
+}
+
+// CheckLabels validates a set of custom container labels
+func CheckLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("a model can have at most %d labels", MaxLabels)
+	}
+	for key, value := range labels {
+		if err := CheckLabel(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getEnvLabels reads comma-separated key=value labels, such as
+// "team=ml,project=chat", skipping invalid ones. Unset is the fallback.
+func getEnvLabels(key string, fallback map[string]string) map[string]string {
+	value := lookupEnv(key)
+	labels := make(map[string]string)
+	if value == "" {
+		for k, v := range fallback {
+			labels[k] = v
+		}
+		return labels
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(entry, "=")
+		if err := CheckLabel(k, v); err != nil {
+			log.Printf("Ignoring %s entry: %v", key, err)
+			continue
+		}
+		labels[k] = v
+	}
+	if len(labels) > MaxLabels {
+		log.Printf("%s has more than %d labels, ignoring it", key, MaxLabels)
+		return make(map[string]string)
+	}
+	return labels
+}
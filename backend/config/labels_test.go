@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckLabel(t *testing.T) {
+	valid := map[string]string{
+		"team":                    "ml",
+		"com.example.cost-center": "4711",
+		"a":                       "",
+		"env_1":                   "prod east",
+	}
+	for key, value := range valid {
+		if err := CheckLabel(key, value); err != nil {
+			t.Errorf("CheckLabel(%q, %q) = %v", key, value, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"Team":                   "ml",
+		"-team":                  "ml",
+		"team.":                  "ml",
+		"":                       "ml",
+		"owngpt.model":           "llama2",
+		"com.docker.compose":     "x",
+		"notes":                  "a,b",
+		"line":                   "a\nb",
+		"long":                   strings.Repeat("x", 257),
+		strings.Repeat("k", 129): "v",
+	}
+	for key, value := range invalid {
+		if err := CheckLabel(key, value); err == nil {
+			t.Errorf("CheckLabel(%q, %q) accepted an invalid label", key, value)
+		}
+	}
+
+	labels := make(map[string]string)
+	for i := 0; i <= MaxLabels; i++ {
+		labels[fmt.Sprintf("l%d", i)] = "x"
+	}
+	if err := CheckLabels(labels); err == nil {
+		t.Errorf("CheckLabels accepted %d labels", len(labels))
+	}
+}
+
+func TestLabelsFromEnv(t *testing.T) {
+	t.Setenv("OWNGPT_LABELS", " team=ml, project=chat,owngpt.model=x,,Bad=1,empty=")
+	want := map[string]string{"team": "ml", "project": "chat", "empty": ""}
+	if got := Load().Labels; !reflect.DeepEqual(got, want) {
+		t.Errorf("Labels = %v, want %v", got, want)
+	}
+
+	var many []string
+	for i := 0; i <= MaxLabels; i++ {
+		many = append(many, fmt.Sprintf("l%d=x", i))
+	}
+	t.Setenv("OWNGPT_LABELS", strings.Join(many, ","))
+	if got := Load().Labels; len(got) != 0 {
+		t.Errorf("Labels = %v, want none past the limit", got)
+	}
+}
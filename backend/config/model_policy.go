@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+// ModelPolicy restricts which models can be created. Patterns are globs as
+// in path.Match, such as "llama3*" or "*:70b". A pattern without a tag is
+// matched against the model name without its tag, so "mistral" covers every
+// mistral tag. Denied patterns win over allowed ones, and with no allowed
+// patterns every model not denied is allowed.
+type ModelPolicy struct {
+	Allow []string `yaml:"allow" json:"allow"`
+	Deny  []string `yaml:"deny" json:"deny"`
+}
+
+// Check returns an error naming the rule that keeps the model from being created
+func (p ModelPolicy) Check(model string) error {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if pattern, ok := matchModel(p.Deny, model); ok {
+		return fmt.Errorf("model %s is not allowed on this server (denied by %q)", model, pattern)
+	}
+	if len(p.Allow) > 0 {
+		if _, ok := matchModel(p.Allow, model); !ok {
+			return fmt.Errorf("model %s is not allowed on this server, which only allows %s", model, strings.Join(p.Allow, ", "))
+		}
+	}
+	return nil
+}
+
+// matchModel returns the first pattern matching the model
+func matchModel(patterns []string, model string) (string, bool) {
+	untagged, _, _ := strings.Cut(model, ":")
+	for _, pattern := range patterns {
+		name := model
+		if !strings.Contains(pattern, ":") {
+			name = untagged
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// checkModelPattern returns an error for a pattern path.Match can't use
+func checkModelPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("model pattern %q is not a valid glob", pattern)
+	}
+	return nil
+}
+
+// getEnvModelPatterns reads a comma-separated list of model patterns,
+// lowercased, skipping invalid ones. Unset keeps the config file's list.
+func getEnvModelPatterns(key string, fallback []string) []string {
+	value := lookupEnv(key)
+	if value == "" {
+		return append([]string{}, fallback...)
+	}
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if err := checkModelPattern(pattern); err != nil {
+			log.Printf("Ignoring %s entry: %v", key, err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
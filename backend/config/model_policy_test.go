@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestModelPolicyCheck(t *testing.T) {
+	policy := ModelPolicy{Allow: []string{"llama3*", "mistral", "*:7b"}, Deny: []string{"llama3:70b", "*:405b"}}
+	tests := map[string]bool{
+		"llama3":         true,
+		"llama3.1:8b":    true,
+		"mistral":        true,
+		"mistral:latest": true,
+		"Mistral ":       true,
+		"qwen2:7b":       true,
+		"llama3:70b":     false,
+		"llama3.1:405b":  false,
+		"phi3":           false,
+		"mistral-nemo":   false,
+	}
+	for model, allowed := range tests {
+		if err := policy.Check(model); (err == nil) != allowed {
+			t.Errorf("Check(%q) = %v, want allowed %v", model, err, allowed)
+		}
+	}
+
+	if err := policy.Check("llama3:70b"); err == nil || !strings.Contains(err.Error(), `denied by "llama3:70b"`) {
+		t.Errorf("Check(llama3:70b) = %v, want the denying pattern named", err)
+	}
+	if err := (ModelPolicy{Deny: []string{"phi*"}}).Check("gemma"); err != nil {
+		t.Errorf("a deny-only policy rejected gemma: %v", err)
+	}
+	if err := (ModelPolicy{}).Check("anything:1t"); err != nil {
+		t.Errorf("an empty policy rejected a model: %v", err)
+	}
+}
+
+func TestModelPolicyFromEnv(t *testing.T) {
+	t.Setenv("OWNGPT_MODEL_ALLOWLIST", " Llama3*, [bad ,,mistral")
+	t.Setenv("OWNGPT_MODEL_DENYLIST", "*:70b")
+	want := ModelPolicy{Allow: []string{"llama3*", "mistral"}, Deny: []string{"*:70b"}}
+	if got := Load().ModelPolicy; !reflect.DeepEqual(got, want) {
+		t.Errorf("ModelPolicy = %+v, want %+v", got, want)
+	}
+}
+
+func TestModelPolicyFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "owngpt.yaml")
+	os.WriteFile(path, []byte("models:\n  allow: [\"Llama3*\"]\n  deny: [\"*:70b\"]\n"), 0o600)
+	file, err := loadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ModelPolicy{Allow: []string{"llama3*"}, Deny: []string{"*:70b"}}); !reflect.DeepEqual(file.Models, want) {
+		t.Errorf("models = %+v, want %+v", file.Models, want)
+	}
+
+	os.WriteFile(path, []byte("models:\n  deny: [\"[bad\"]\n"), 0o600)
+	if _, err := loadFile(path); err == nil || !strings.Contains(err.Error(), "models.deny[0]") {
+		t.Errorf("loadFile with an invalid pattern = %v, want models.deny[0] named", err)
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bufio"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Moderation screens chat prompts, and optionally the replies, against a
+// content policy
+type Moderation struct {
+	// Mode is "off", "patterns" to block text matching any of Patterns, or
+	// "http" to ask the moderation endpoint at URL
+	Mode string `json:"mode"`
+	// Patterns are regular expressions matched case-insensitively; a plain
+	// word matches anywhere, \bword\b only as a whole word
+	Patterns []string `json:"patterns"`
+	URL      string   `json:"url"`
+	// Responses also screens the model's replies
+	Responses bool `json:"responses"`
+}
+
+// getEnvModeration reads the moderation settings, turning moderation off when
+// the chosen mode has nothing to check against
+func getEnvModeration() Moderation {
+	moderation := Moderation{
+		Mode:      getEnvChoice("OWNGPT_MODERATION", "off", "off", "patterns", "http"),
+		URL:       lookupEnv("OWNGPT_MODERATION_URL"),
+		Responses: getEnvBool("OWNGPT_MODERATION_RESPONSES", false),
+	}
+	switch moderation.Mode {
+	case "patterns":
+		moderation.Patterns = moderationPatterns()
+		if len(moderation.Patterns) == 0 {
+			log.Printf("OWNGPT_MODERATION is patterns but no valid patterns are set, moderation is off")
+			moderation.Mode = "off"
+		}
+	case "http":
+		if u, err := url.Parse(moderation.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("OWNGPT_MODERATION is http but OWNGPT_MODERATION_URL %q is not an http(s) URL, moderation is off", moderation.URL)
+			moderation.Mode = "off"
+		}
+	}
+	return moderation
+}
+
+// moderationPatterns reads the comma-separated OWNGPT_MODERATION_PATTERNS and
+// the OWNGPT_MODERATION_PATTERNS_FILE, one pattern per line with # comments,
+// skipping patterns that don't compile
+func moderationPatterns() []string {
+	candidates := strings.Split(lookupEnv("OWNGPT_MODERATION_PATTERNS"), ",")
+	if path := lookupEnv("OWNGPT_MODERATION_PATTERNS_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Failed to read OWNGPT_MODERATION_PATTERNS_FILE: %v", err)
+		} else {
+			defer file.Close()
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				if line := scanner.Text(); !strings.HasPrefix(strings.TrimSpace(line), "#") {
+					candidates = append(candidates, line)
+				}
+			}
+		}
+	}
+
+	patterns := []string{}
+	for _, pattern := range candidates {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+			log.Printf("Ignoring moderation pattern %q: %v", pattern, err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Platforms are the platforms model images can be built and run for, those
+// the Ollama base image is published for
+var Platforms = []string{"linux/amd64", "linux/arm64"}
+
+// HostPlatform returns the platform of the machine the server runs on, or ""
+// when it isn't one of Platforms and docker is left to pick
+func HostPlatform() string {
+	platform := "linux/" + runtime.GOARCH
+	for _, known := range Platforms {
+		if platform == known {
+			return platform
+		}
+	}
+	return ""
+}
+
+// CheckPlatform checks a platform is one of Platforms
+func CheckPlatform(platform string) error {
+	for _, known := range Platforms {
+		if platform == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported platform %q, expected one of %s", platform, strings.Join(Platforms, ", "))
+}
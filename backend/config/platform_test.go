@@ -0,0 +1,43 @@
+package config
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestCheckPlatform(t *testing.T) {
+	for _, platform := range Platforms {
+		if err := CheckPlatform(platform); err != nil {
+			t.Errorf("CheckPlatform(%q) = %v", platform, err)
+		}
+	}
+	for _, platform := range []string{"", "linux/386", "windows/amd64", "amd64", "linux/arm64/v8"} {
+		if err := CheckPlatform(platform); err == nil {
+			t.Errorf("CheckPlatform(%q) accepted an unsupported platform", platform)
+		}
+	}
+}
+
+func TestHostPlatform(t *testing.T) {
+	want := ""
+	if runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64" {
+		want = "linux/" + runtime.GOARCH
+	}
+	if got := HostPlatform(); got != want {
+		t.Errorf("HostPlatform() = %q, want %q", got, want)
+	}
+}
+
+func TestPlatformFromEnv(t *testing.T) {
+	if got := Load().Platform; got != HostPlatform() {
+		t.Errorf("Platform = %q, want the host's by default", got)
+	}
+	t.Setenv("OWNGPT_PLATFORM", "linux/arm64")
+	if got := Load().Platform; got != "linux/arm64" {
+		t.Errorf("Platform = %q, want linux/arm64", got)
+	}
+	t.Setenv("OWNGPT_PLATFORM", "windows/amd64")
+	if got := Load().Platform; got != HostPlatform() {
+		t.Errorf("Platform = %q, want the host's in place of an unsupported one", got)
+	}
+}
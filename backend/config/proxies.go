@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// getEnvProxies reads a comma-separated list of proxy addresses or CIDR
+// ranges, such as 10.0.0.0/8, skipping invalid ones
+func getEnvProxies(key string) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(lookupEnv(key), ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if err := checkProxy(proxy); err != nil {
+			log.Printf("Ignoring %s entry: %v", key, err)
+			continue
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies
+}
+
+// checkProxy checks a proxy is an IP address or a CIDR range
+func checkProxy(proxy string) error {
+	if net.ParseIP(proxy) != nil {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(proxy); err == nil {
+		return nil
+	}
+	return fmt.Errorf("proxy %q must be an IP address or a CIDR range, such as 10.0.0.0/8", proxy)
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetEnvProxies(t *testing.T) {
+	t.Setenv("OWNGPT_TEST_PROXIES", " 10.0.0.0/8, 192.0.2.7,not-a-proxy,,2001:db8::/32")
+	want := []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"}
+	if got := getEnvProxies("OWNGPT_TEST_PROXIES"); !reflect.DeepEqual(got, want) {
+		t.Errorf("getEnvProxies = %v, want %v", got, want)
+	}
+
+	t.Setenv("OWNGPT_TEST_PROXIES", "")
+	if got := getEnvProxies("OWNGPT_TEST_PROXIES"); len(got) != 0 {
+		t.Errorf("getEnvProxies without a value = %v, want none", got)
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"log"
+)
+
+// Welcome is the opening assistant message of new chat sessions. Message is
+// used as is, while Prompt is sent to the model and its reply used instead.
+// At most one of them is set.
+type Welcome struct {
+	Message string `yaml:"message" json:"message,omitempty"`
+	Prompt  string `yaml:"prompt" json:"prompt,omitempty"`
+}
+
+// Enabled reports whether new sessions get a welcome message
+func (w Welcome) Enabled() bool {
+	return w.Message != "" || w.Prompt != ""
+}
+
+// validate checks at most one of message and prompt is set, prefixing errors
+// with the key path
+func (w Welcome) validate(key string) error {
+	if w.Message != "" && w.Prompt != "" {
+		return fmt.Errorf("%s: set either message or prompt, not both", key)
+	}
+	return nil
+}
+
+// getEnvWelcome reads the welcome message from OWNGPT_WELCOME_MESSAGE or
+// OWNGPT_WELCOME_PROMPT, which replace the config file's welcome section
+func getEnvWelcome(fallback Welcome) Welcome {
+	welcome := Welcome{
+		Message: lookupEnv("OWNGPT_WELCOME_MESSAGE"),
+		Prompt:  lookupEnv("OWNGPT_WELCOME_PROMPT"),
+	}
+	if !welcome.Enabled() {
+		return fallback
+	}
+	if welcome.Message != "" && welcome.Prompt != "" {
+		log.Printf("Both OWNGPT_WELCOME_MESSAGE and OWNGPT_WELCOME_PROMPT are set, using the message")
+		welcome.Prompt = ""
+	}
+	return welcome
+}
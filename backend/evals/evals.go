@@ -0,0 +1,136 @@
+package evals
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// maxKept bounds how many comparisons are held in memory to take feedback;
+// OWNGPT_EVAL_FILE keeps all of them
+const maxKept = 1000
+
+// ErrNotFound is returned for feedback on a comparison that isn't kept
+var ErrNotFound = errors.New("comparison not found")
+
+var (
+	mu sync.Mutex
+	// comparisons are the kept comparisons by ID, and order their IDs oldest first
+	comparisons = make(map[string]*models.EvalComparison)
+	order       []string
+)
+
+// Load restores the most recent comparisons from OWNGPT_EVAL_FILE, if
+// configured, so feedback can still be given on them after a restart
+func Load() {
+	path := config.Get().EvalFile
+	if path == "" {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read evaluations from %s: %v", path, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var comparison models.EvalComparison
+		if err := json.Unmarshal(scanner.Bytes(), &comparison); err != nil || comparison.ID == "" {
+			log.Printf("Skipping invalid evaluation on line %d of %s", line, path)
+			continue
+		}
+		keep(&comparison)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Failed to read evaluations from %s: %v", path, err)
+	}
+}
+
+// Add records a new comparison under a fresh ID, returning it
+func Add(comparison models.EvalComparison) models.EvalComparison {
+	comparison.ID = newID()
+	comparison.CreatedAt = time.Now().UTC()
+
+	mu.Lock()
+	defer mu.Unlock()
+	keep(&comparison)
+	appendToFile(comparison)
+	return comparison
+}
+
+// Feedback records which reply of the comparison was preferred, replacing any
+// earlier feedback on it
+func Feedback(id, preferred, comment string) (models.EvalComparison, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	comparison, ok := comparisons[id]
+	if !ok {
+		return models.EvalComparison{}, ErrNotFound
+	}
+	now := time.Now().UTC()
+	comparison.Preferred, comparison.Comment, comparison.FeedbackAt = preferred, comment, &now
+	appendToFile(*comparison)
+	return *comparison, nil
+}
+
+// keep holds the comparison in memory, replacing an earlier version of it and
+// dropping the oldest beyond maxKept; callers hold mu
+func keep(comparison *models.EvalComparison) {
+	if _, ok := comparisons[comparison.ID]; !ok {
+		order = append(order, comparison.ID)
+	}
+	comparisons[comparison.ID] = comparison
+	for len(order) > maxKept {
+		delete(comparisons, order[0])
+		order = order[1:]
+	}
+}
+
+// appendToFile writes the comparison as a line of OWNGPT_EVAL_FILE. Feedback
+// appends the comparison again, so the last line for an ID is the current
+// one. Callers hold mu.
+func appendToFile(comparison models.EvalComparison) {
+	path := config.Get().EvalFile
+	if path == "" {
+		return
+	}
+
+	data, err := json.Marshal(comparison)
+	if err != nil {
+		log.Printf("Failed to encode evaluation %s: %v", comparison.ID, err)
+		return
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Failed to write evaluation to %s: %v", path, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write evaluation to %s: %v", path, err)
+	}
+}
+
+// newID returns a random 128-bit comparison ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
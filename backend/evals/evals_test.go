@@ -0,0 +1,125 @@
+package evals
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// useEvalFile sets OWNGPT_EVAL_FILE to a file in the test's temporary
+// directory, returning its path; the test starts without any comparisons
+func useEvalFile(t *testing.T) string {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.EvalFile
+	cfg.EvalFile = filepath.Join(t.TempDir(), "evals.jsonl")
+	forget()
+	t.Cleanup(func() {
+		cfg.EvalFile = previous
+		forget()
+	})
+	return cfg.EvalFile
+}
+
+// forget drops the kept comparisons
+func forget() {
+	mu.Lock()
+	comparisons, order = make(map[string]*models.EvalComparison), nil
+	mu.Unlock()
+}
+
+// lines counts the lines of the file
+func lines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	count := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		count++
+	}
+	return count
+}
+
+func TestFeedback(t *testing.T) {
+	useEvalFile(t)
+	added := Add(models.EvalComparison{Prompt: "hi"})
+	if added.ID == "" || added.CreatedAt.IsZero() {
+		t.Fatalf("Add = %+v, want an ID and creation time", added)
+	}
+	if other := Add(models.EvalComparison{Prompt: "hi"}); other.ID == added.ID {
+		t.Error("two comparisons got the same ID")
+	}
+
+	got, err := Feedback(added.ID, models.PreferA, "")
+	if err != nil || got.Preferred != models.PreferA || got.FeedbackAt == nil {
+		t.Fatalf("Feedback = %+v, %v", got, err)
+	}
+	// Feedback again replaces it
+	got, err = Feedback(added.ID, models.PreferTie, "both fine")
+	if err != nil || got.Preferred != models.PreferTie || got.Comment != "both fine" || got.Prompt != "hi" {
+		t.Errorf("Feedback = %+v, %v, want the tie", got, err)
+	}
+
+	if _, err := Feedback("missing", models.PreferB, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Feedback on a missing comparison = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := useEvalFile(t)
+	first := Add(models.EvalComparison{Prompt: "first"})
+	second := Add(models.EvalComparison{Prompt: "second"})
+	if _, err := Feedback(first.ID, models.PreferB, "shorter"); err != nil {
+		t.Fatal(err)
+	}
+	// Each comparison and the feedback on it are appended
+	if got := lines(t, path); got != 3 {
+		t.Errorf("file has %d lines, want 3", got)
+	}
+
+	// After a restart the last line for each comparison wins, and bad lines are skipped
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString("not json\n{}\n")
+	file.Close()
+	forget()
+	Load()
+
+	mu.Lock()
+	kept := len(order)
+	restored := *comparisons[first.ID]
+	mu.Unlock()
+	if kept != 2 {
+		t.Errorf("restored %d comparisons, want 2", kept)
+	}
+	if restored.Preferred != models.PreferB || restored.Comment != "shorter" || restored.Prompt != "first" {
+		t.Errorf("restored %+v, want its feedback", restored)
+	}
+	if got, err := Feedback(second.ID, models.PreferA, ""); err != nil || got.Prompt != "second" {
+		t.Errorf("Feedback after a restart = %+v, %v", got, err)
+	}
+}
+
+func TestKeepDropsOldest(t *testing.T) {
+	useEvalFile(t)
+	config.Get().EvalFile = ""
+	first := Add(models.EvalComparison{})
+	for i := 0; i < maxKept; i++ {
+		Add(models.EvalComparison{})
+	}
+	if _, err := Feedback(first.ID, models.PreferA, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Feedback on the oldest comparison = %v, want ErrNotFound", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != maxKept || len(comparisons) != maxKept {
+		t.Errorf("kept %d comparisons (%d IDs), want %d", len(comparisons), len(order), maxKept)
+	}
+}
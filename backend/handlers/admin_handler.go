@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/services"
+)
+
+type AdminHandler struct{}
+
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{}
+}
+
+// CancelAll stops every in-flight generation, freeing the model during incidents
+func (ah *AdminHandler) CancelAll(c *gin.Context) {
+	cancelled := services.CancelAllGenerations()
+	log.Printf("Admin cancelled %d in-flight generations", cancelled)
+	respond(c, http.StatusOK, gin.H{"cancelled": cancelled})
+}
+
+// GetConfig returns the effective configuration, after the config file and
+// environment are merged, with secrets redacted
+func (ah *AdminHandler) GetConfig(c *gin.Context) {
+	respond(c, http.StatusOK, config.Get().Redacted())
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/services"
+)
+
+func TestBuildOptions(t *testing.T) {
+	cfg := config.Get()
+	noCache, inlineCache := cfg.BuildNoCache, cfg.BuildInlineCache
+	t.Cleanup(func() { cfg.BuildNoCache, cfg.BuildInlineCache = noCache, inlineCache })
+	yes, no := true, false
+
+	tests := []struct {
+		noCache, inlineCache bool
+		req                  models.CreateDockerfileRequest
+		want                 services.BuildOptions
+	}{
+		{false, false, models.CreateDockerfileRequest{Model: "llama2"}, services.BuildOptions{}},
+		{true, true, models.CreateDockerfileRequest{Model: "llama2"}, services.BuildOptions{NoCache: true, InlineCache: true}},
+		{false, false, models.CreateDockerfileRequest{Model: "llama2", NoCache: &yes, InlineCache: &yes}, services.BuildOptions{NoCache: true, InlineCache: true}},
+		{true, true, models.CreateDockerfileRequest{Model: "llama2", NoCache: &no, InlineCache: &no}, services.BuildOptions{}},
+	}
+	for _, tt := range tests {
+		cfg.BuildNoCache, cfg.BuildInlineCache = tt.noCache, tt.inlineCache
+		tt.want.CacheFrom = "ollama-llama2"
+		got := buildOptions(tt.req)
+		got.Platform = ""
+		if got != tt.want {
+			t.Errorf("buildOptions with no_cache=%v inline_cache=%v and %+v = %+v, want %+v", tt.noCache, tt.inlineCache, tt.req, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/utils"
+)
+
+// maxCompareModels bounds how many models a single comparison may fan out to
+const maxCompareModels = 8
+
+// compareEvent is a token from one model, or that model's result once it has
+// finished or failed
+type compareEvent struct {
+	model  string
+	token  string
+	result *models.CompareResult
+}
+
+// CompareModels sends one prompt to several running models and streams their
+// answers side by side over a single SSE connection. Every event names its
+// model, a model that fails doesn't stop the others, and a final summary
+// event reports each model's latency and token count.
+func (ch *ChatHandler) CompareModels(c *gin.Context) {
+	var req models.CompareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range req.Models {
+		if name != "" && !seen[utils.NormalizeModelName(name)] {
+			seen[utils.NormalizeModelName(name)] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		respondError(c, http.StatusBadRequest, "models must name at least one model")
+		return
+	}
+	if len(names) > maxCompareModels {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("At most %d models can be compared at once", maxCompareModels))
+		return
+	}
+
+	if err := validateSampling(req.Options); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !moderatePrompt(c, req.Prompt, false) {
+		return
+	}
+
+	installedModels, err := ch.dockerService.GetInstalledModels()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+		return
+	}
+	running := make(map[string]bool)
+	for _, model := range installedModels {
+		running[model.ContainerName] = model.IsRunning
+	}
+
+	closeStream, ok := openStream(c, "")
+	if !ok {
+		return
+	}
+	defer closeStream()
+
+	streamHeaders(c, "text/event-stream")
+
+	// A write that can't finish within the stall timeout fails and cancels the
+	// request context, which stops every generation
+	rc := http.NewResponseController(c.Writer)
+	defer rc.SetWriteDeadline(time.Time{})
+	stall := config.Get().StreamStallTimeout
+
+	ctx := c.Request.Context()
+	events := make(chan compareEvent)
+	slots := make(chan struct{}, config.Get().CompareConcurrency)
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			result := ch.compareOne(ctx, name, req, running[utils.ContainerName(name)], slots, events)
+			select {
+			case events <- compareEvent{model: name, result: &result}:
+			case <-ctx.Done():
+			}
+		}(name)
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	results := make(map[string]models.CompareResult, len(names))
+	for event := range events {
+		rc.SetWriteDeadline(time.Now().Add(stall))
+		switch {
+		case event.result == nil:
+			c.SSEvent("token", gin.H{"model": event.model, "token": event.token})
+		case event.result.Error != "":
+			results[event.model] = *event.result
+			c.SSEvent("error", gin.H{"model": event.model, "error": event.result.Error})
+		default:
+			results[event.model] = *event.result
+			c.SSEvent("done", event.result)
+		}
+		c.Writer.Flush()
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+	summary := make([]models.CompareResult, 0, len(names))
+	for _, name := range names {
+		summary = append(summary, results[name])
+	}
+	rc.SetWriteDeadline(time.Now().Add(stall))
+	c.SSEvent("summary", gin.H{"results": summary})
+	c.Writer.Flush()
+}
+
+// compareOne streams one model's answer into events once a concurrency slot
+// is free, returning how it went
+func (ch *ChatHandler) compareOne(ctx context.Context, name string, req models.CompareRequest, running bool, slots chan struct{}, events chan<- compareEvent) models.CompareResult {
+	result := models.CompareResult{Model: name}
+	if !running {
+		result.Error = fmt.Sprintf("Model %s is not running", name)
+		return result
+	}
+
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		result.Error = ctx.Err().Error()
+		return result
+	}
+
+	// A blocked reply stops only this model's generation
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	screen := newReplyScreen(ctx)
+	send := func(token string) {
+		if token == "" {
+			return
+		}
+		select {
+		case events <- compareEvent{model: name, token: token}:
+		case <-ctx.Done():
+		}
+	}
+
+	containerName := utils.ContainerName(name)
+	start := time.Now()
+	responseChan, errorChan := ch.ollamaService.SendMessageStream(ctx, models.ChatRequest{Message: req.Prompt, Options: req.Options}, containerName)
+	for {
+		select {
+		case chunk, ok := <-responseChan:
+			if !ok {
+				result.Error = "stream ended without a final response"
+				recordUsage(ctx, containerName, req.Prompt, nil, "", start, errors.New(result.Error))
+				return result
+			}
+			if chunk.Done {
+				rest, _, cerr := screen.Flush()
+				if cerr != nil {
+					result.Error = cerr.message
+					recordUsage(ctx, containerName, req.Prompt, chunk.Stats, chunk.FinishReason, start, nil)
+					return result
+				}
+				send(rest)
+				result.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+				if chunk.Stats != nil {
+					result.Tokens = chunk.Stats.EvalCount
+				}
+				result.FinishReason = chunk.FinishReason
+				recordUsage(ctx, containerName, req.Prompt, chunk.Stats, chunk.FinishReason, start, nil)
+				return result
+			}
+			token, _, cerr := screen.Write(chunk.Token, nil)
+			if cerr != nil {
+				result.Error = cerr.message
+				recordUsage(ctx, containerName, req.Prompt, nil, "", start, nil)
+				return result
+			}
+			send(token)
+		case err := <-errorChan:
+			if err == nil {
+				// Closed after the final chunk, which is still buffered
+				errorChan = nil
+				continue
+			}
+			result.Error = err.Error()
+			recordUsage(ctx, containerName, req.Prompt, nil, "", start, err)
+			return result
+		}
+	}
+}
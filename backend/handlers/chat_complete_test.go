@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/models"
+	"owngpt/sessions"
+)
+
+// streamReply splits an SSE chat stream into the text of its data events and
+// the complete event that ends it
+func streamReply(t *testing.T, body string) (string, models.StreamComplete) {
+	t.Helper()
+	events := sseEvents(body)
+	if len(events) == 0 {
+		t.Fatal("the stream sent no events")
+	}
+	last, ok := strings.CutPrefix(events[len(events)-1], "complete: ")
+	if !ok {
+		t.Fatalf("events = %q, want a complete event last", events)
+	}
+	var complete models.StreamComplete
+	if err := json.Unmarshal([]byte(last), &complete); err != nil {
+		t.Fatalf("complete event %q: %v", last, err)
+	}
+	var text strings.Builder
+	for _, event := range events {
+		if data, ok := strings.CutPrefix(event, "data: "); ok {
+			text.WriteString(data)
+		}
+	}
+	return text.String(), complete
+}
+
+func TestStreamCompleteEvent(t *testing.T) {
+	fake := startFakeOllama(t, "Hello", " there", ".")
+	fake.doneReason = "length"
+	text, complete := streamReply(t, chat(NewChatHandler().SendMessageStream, `{"message":"hi"}`).Body.String())
+	if text != "Hello there." || complete.Text != text {
+		t.Errorf("complete text %q, want the %q the data events sent", complete.Text, text)
+	}
+	if complete.FinishReason != models.FinishLength || complete.Stats == nil || complete.Stats.EvalCount != 3 {
+		t.Errorf("complete = %+v, want finish_reason length and the stats", complete)
+	}
+}
+
+func TestStreamCompleteEventFiltered(t *testing.T) {
+	// The complete event repeats what was shown, not what was generated
+	startFakeOllama(t, "<think>", "plan", "</think>", "Hi ", "<", "b>.")
+	text, complete := streamReply(t, chat(NewChatHandler().SendMessageStream, `{"message":"hi","strip_tags":["think"]}`).Body.String())
+	if complete.Text != text || text != "Hi <b>." {
+		t.Errorf("complete text %q, data events %q, want both Hi <b>.", complete.Text, text)
+	}
+}
+
+func TestStreamWithoutCompleteEvent(t *testing.T) {
+	startFakeOllama(t, "Hello", " there.")
+	events := sseEvents(chat(NewChatHandler().SendMessageStream, `{"message":"hi","complete":false}`).Body.String())
+	want := []string{"data: Hello", "data:  there.", "finish: " + models.FinishEnd}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+
+	w := chat(NewChatHandler().SendMessageStream, `{"message":"hi","complete":false,"format":"json"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "complete can't be false") {
+		t.Errorf("status %d: %s, want 400 for a JSON reply without its complete event", w.Code, w.Body)
+	}
+}
+
+func TestStreamWithoutCompleteEventKeepsSession(t *testing.T) {
+	startFakeOllama(t, "Nice to meet you.")
+	welcomeWith(t, "")
+	_, session := createSession(context.Background())
+
+	body := `{"message":"I'm Ada","complete":false,"session_id":"` + session.ID + `"}`
+	chat(NewChatHandler().SendMessageStream, body)
+	history, _ := sessions.History(session.ID)
+	if len(history) != 2 || history[1].Content != "Nice to meet you." {
+		t.Errorf("history = %+v, want the streamed reply recorded", history)
+	}
+}
+
+func TestKeepReply(t *testing.T) {
+	tests := []struct {
+		req      models.ChatRequest
+		complete bool
+		want     bool
+	}{
+		{models.ChatRequest{}, true, true},
+		{models.ChatRequest{}, false, false},
+		{models.ChatRequest{SessionID: "abc"}, false, true},
+	}
+	for _, tt := range tests {
+		if got := keepReply(tt.req, tt.complete); got != tt.want {
+			t.Errorf("keepReply(%+v, %v) = %v, want %v", tt.req, tt.complete, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/evals"
+	"owngpt/models"
+	"owngpt/moderation"
+	"owngpt/services"
+	"owngpt/utils"
+)
+
+// EvalCompare answers one prompt under two variants, two models or the same
+// model with two sets of sampling options, and records the pair so the
+// preferred reply can be given with EvalFeedback. A variant that fails doesn't
+// fail the other, its error is reported in its place.
+func (ch *ChatHandler) EvalCompare(c *gin.Context) {
+	var req models.EvalCompareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, variant := range []models.EvalVariant{req.A, req.B} {
+		if err := validateSampling(variant.Options); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if !moderatePrompt(c, req.Prompt, false) {
+		return
+	}
+
+	containerA, ok := ch.evalContainer(c, req.A)
+	if !ok {
+		return
+	}
+	containerB, ok := ch.evalContainer(c, req.B)
+	if !ok {
+		return
+	}
+
+	comparison := models.EvalComparison{Prompt: req.Prompt}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		comparison.A = ch.evalOne(c.Request.Context(), req.Prompt, req.A, containerA)
+	}()
+	go func() {
+		defer wg.Done()
+		comparison.B = ch.evalOne(c.Request.Context(), req.Prompt, req.B, containerB)
+	}()
+	wg.Wait()
+
+	respond(c, http.StatusOK, evals.Add(comparison))
+}
+
+// EvalFeedback records which reply of an EvalCompare comparison was
+// preferred, a, b or tie. Giving feedback again replaces it.
+func (ch *ChatHandler) EvalFeedback(c *gin.Context) {
+	var req models.EvalFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch req.Preferred {
+	case models.PreferA, models.PreferB, models.PreferTie:
+	default:
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid preferred %q, expected %s, %s or %s", req.Preferred, models.PreferA, models.PreferB, models.PreferTie))
+		return
+	}
+
+	comparison, err := evals.Feedback(req.ID, req.Preferred, req.Comment)
+	if errors.Is(err, evals.ErrNotFound) {
+		respondErrorCode(c, http.StatusNotFound, "EVAL_NOT_FOUND", fmt.Sprintf("Comparison %s does not exist or is too old to take feedback", req.ID))
+		return
+	}
+	respond(c, http.StatusOK, comparison)
+}
+
+// evalContainer returns the container answering for the variant: its model's,
+// which has to be running, or the current model's when it names none
+func (ch *ChatHandler) evalContainer(c *gin.Context, variant models.EvalVariant) (string, bool) {
+	if variant.Model == "" {
+		containerName, ok := ch.runningModel(c, true)
+		return containerName, ok && modelReady(c, containerName)
+	}
+
+	installed, err := ch.dockerService.GetInstalledModels()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+		return "", false
+	}
+	containerName := utils.ContainerName(variant.Model)
+	for _, model := range installed {
+		if model.ContainerName != containerName {
+			continue
+		}
+		if !model.IsRunning {
+			respondError(c, http.StatusConflict, fmt.Sprintf("Model %s is not running", variant.Model))
+			return "", false
+		}
+		return containerName, modelReady(c, containerName)
+	}
+	respondError(c, http.StatusNotFound, fmt.Sprintf("Model %s is not installed", variant.Model))
+	return "", false
+}
+
+// evalOne generates the variant's reply to the prompt, with its latency and
+// token counts. It is abandoned when ctx is done.
+func (ch *ChatHandler) evalOne(ctx context.Context, prompt string, variant models.EvalVariant, containerName string) models.EvalResponse {
+	result := models.EvalResponse{
+		Model:   services.ModelForContainer(containerName),
+		Options: variant.Options,
+	}
+
+	start := time.Now()
+	req := models.ChatRequest{Message: prompt, Options: variant.Options}
+	ollamaResp, err := ch.ollamaService.Generate(ctx, req, containerName)
+	result.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	response, finish := finishReply(req, ollamaResp.Response, ollamaResp.FinishReason)
+	recordUsage(ctx, containerName, prompt, &ollamaResp.GenerationStats, finish, start, err)
+	if err != nil {
+		result.Error = ch.recordChatFailure(containerName, start, err).Error()
+		return result
+	}
+
+	if cerr := moderate(ctx, moderation.Response, response); cerr != nil {
+		result.Error = cerr.message
+		return result
+	}
+
+	result.Response, result.FinishReason = response, finish
+	result.PromptTokens, result.CompletionTokens = ollamaResp.PromptEvalCount, ollamaResp.EvalCount
+	return result
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"owngpt/models"
+)
+
+func TestEvalCompare(t *testing.T) {
+	fake := startFakeOllama(t, "Hello", " there.")
+	ch := NewChatHandler()
+
+	body := `{"prompt":"hi","a":{"options":{"temperature":0.2}},"b":{"options":{"temperature":1.2}}}`
+	w := serve(http.MethodPost, "/eval/compare", "/eval/compare", body, ch.EvalCompare)
+	var comparison models.EvalComparison
+	json.Unmarshal(w.Body.Bytes(), &comparison)
+	if w.Code != http.StatusOK || comparison.ID == "" || comparison.Prompt != "hi" {
+		t.Fatalf("status %d: %s, want a comparison", w.Code, w.Body)
+	}
+	for name, reply := range map[string]models.EvalResponse{"a": comparison.A, "b": comparison.B} {
+		if reply.Model != "llama2" || reply.Response != "Hello there." || reply.FinishReason != models.FinishEnd || reply.CompletionTokens != 2 || reply.Error != "" {
+			t.Errorf("%s = %+v, want the current model's reply", name, reply)
+		}
+	}
+
+	// Each variant generated with its own sampling
+	var temperatures []float64
+	for _, generation := range fake.generations() {
+		options, _ := generation["options"].(map[string]interface{})
+		temperature, _ := options["temperature"].(float64)
+		temperatures = append(temperatures, temperature)
+	}
+	if len(temperatures) != 2 || temperatures[0] == temperatures[1] || temperatures[0] != 0.2 && temperatures[0] != 1.2 {
+		t.Errorf("generated with temperatures %v, want 0.2 and 1.2", temperatures)
+	}
+
+	w = serve(http.MethodPost, "/eval/compare", "/eval/compare", `{"prompt":"hi","b":{"options":{"temperature":-1}}}`, ch.EvalCompare)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid sampling: status %d: %s, want 400", w.Code, w.Body)
+	}
+	if len(fake.generations()) != 2 {
+		t.Error("an invalid comparison was generated")
+	}
+}
+
+func TestEvalFeedback(t *testing.T) {
+	startFakeOllama(t, "Hi")
+	ch := NewChatHandler()
+	w := serve(http.MethodPost, "/eval/compare", "/eval/compare", `{"prompt":"hi"}`, ch.EvalCompare)
+	var comparison models.EvalComparison
+	json.Unmarshal(w.Body.Bytes(), &comparison)
+
+	feedback := func(body string) *httptest.ResponseRecorder {
+		return serve(http.MethodPost, "/eval/feedback", "/eval/feedback", body, ch.EvalFeedback)
+	}
+	w = feedback(`{"id":"` + comparison.ID + `","preferred":"b","comment":"warmer"}`)
+	json.Unmarshal(w.Body.Bytes(), &comparison)
+	if w.Code != http.StatusOK || comparison.Preferred != models.PreferB || comparison.Comment != "warmer" || comparison.FeedbackAt == nil {
+		t.Errorf("status %d: %s, want b preferred", w.Code, w.Body)
+	}
+
+	if w := feedback(`{"id":"` + comparison.ID + `","preferred":"c"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("preferred c: status %d, want 400", w.Code)
+	}
+	w = feedback(`{"id":"missing","preferred":"a"}`)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "EVAL_NOT_FOUND") {
+		t.Errorf("missing comparison: status %d: %s, want 404 EVAL_NOT_FOUND", w.Code, w.Body)
+	}
+}
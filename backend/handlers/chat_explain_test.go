@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"owngpt/models"
+)
+
+func TestExplainChat(t *testing.T) {
+	fake := startFakeOllama(t, "unused")
+	handler := NewChatHandler().ExplainChat
+
+	w := chat(handler, `{"message":"hi","options":{"temperature":0.9,"top_k":40}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var explanation models.ChatExplanation
+	if err := json.Unmarshal(w.Body.Bytes(), &explanation); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	if explanation.Model != "llama2" || explanation.Endpoint != "/api/generate" {
+		t.Errorf("explanation = %+v, want llama2 on /api/generate", explanation)
+	}
+	// The overrides are merged over the defaults, which are still there
+	if explanation.Options["temperature"] != 0.9 || explanation.Options["top_k"] != float64(40) {
+		t.Errorf("options = %v, want the request's temperature and top_k", explanation.Options)
+	}
+	if _, ok := explanation.Options["num_predict"]; !ok {
+		t.Errorf("options = %v, want the default num_predict", explanation.Options)
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("explaining a chat generated a reply")
+	}
+
+	w = chat(handler, `{"message":"hi","tools":[{"type":"function","function":{"name":"f"}}]}`)
+	json.Unmarshal(w.Body.Bytes(), &explanation)
+	if explanation.Endpoint != "/api/chat" {
+		t.Errorf("endpoint with tools = %q, want /api/chat", explanation.Endpoint)
+	}
+
+	if w := chat(handler, `{"message":"hi","options":{"temperature":-1}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid temperature: status = %d, want 400", w.Code)
+	}
+}
@@ -1,104 +1,990 @@
 package handlers
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 
+	"owngpt/config"
+	"owngpt/middleware"
 	"owngpt/models"
+	"owngpt/moderation"
+	"owngpt/registry"
 	"owngpt/services"
+	"owngpt/sessions"
+	"owngpt/usage"
+	"owngpt/utils"
 )
 
 type ChatHandler struct {
 	ollamaService *services.OllamaService
+	dockerService *services.DockerService
 }
 
 func NewChatHandler() *ChatHandler {
 	return &ChatHandler{
 		ollamaService: services.NewOllamaService(),
+		dockerService: services.NewDockerService(),
 	}
 }
 
-// SendMessageStream handles streaming chat message requests
+// SendMessageStream handles streaming chat message requests. It streams
+// whether or not the request sets stream, as it did before /chat could.
 func (ch *ChatHandler) SendMessageStream(c *gin.Context) {
 	var req models.ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	ch.streamMessage(c, req)
+}
+
+// streamMessage answers a chat as the reply is generated, as Server-Sent
+// Events or, when the client asks for them, NDJSON lines
+func (ch *ChatHandler) streamMessage(c *gin.Context, req models.ChatRequest) {
+	containerName, ok := ch.chatModel(c, req)
+	if !ok {
+		return
+	}
+	timer := newChatTimer(containerName)
+
+	if !ch.validateChat(c, req, containerName, true) {
+		return
+	}
+	clampNumPredict(c, &req, containerName)
+
+	if !moderatePrompt(c, req.Message, false) {
 		return
 	}
 
-	models.ModelMutex.RLock()
-	if !models.CurrentModel.IsRunning {
-		models.ModelMutex.RUnlock()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No model is currently running. Please create a model first."})
+	closeStream, ok := openStream(c, req.SessionID)
+	if !ok {
 		return
 	}
-	containerName := models.CurrentModel.Name
-	models.ModelMutex.RUnlock()
+	defer closeStream()
+
+	endSession, ok := loadSessionHistory(c, &req)
+	if !ok {
+		return
+	}
+	defer endSession()
+	ch.fitHistory(c, &req, containerName)
+
+	release, ok := ch.waitForChatSlot(c, req, containerName)
+	if !ok {
+		return
+	}
+	defer release()
 
 	log.Printf("Streaming message to model: %s", req.Message)
 
-	// Set headers for Server-Sent Events
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
+	// Get streaming response. Its context is also cancelled once the reply
+	// reaches max_sentences, dropping the rest of the generation.
+	start := time.Now()
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	responseChan, errorChan := ch.ollamaService.SendMessageStream(ctx, req, containerName)
+
+	// A write that can't finish within the stall timeout fails and cancels the
+	// request context, which stops the generation
+	rc := http.NewResponseController(c.Writer)
+	defer rc.SetWriteDeadline(time.Time{})
+	stall := config.Get().StreamStallTimeout
 
-	// Get streaming response
-	responseChan, errorChan := ch.ollamaService.SendMessageStream(req.Message, containerName)
+	if c.Query("format") == "ndjson" || c.NegotiateFormat("text/event-stream", "application/x-ndjson") == "application/x-ndjson" {
+		ch.streamNDJSON(c, req, containerName, start, timer, responseChan, errorChan)
+		return
+	}
+
+	// Set headers for Server-Sent Events
+	streamHeaders(c, "text/event-stream")
 
 	// Stream responses to client
+	filter := outputFilter(req)
+	limit := utils.NewSentenceLimit(req.MaxSentences)
+	screen := newReplyScreen(c.Request.Context())
+	// reply is the text sent in data events so far, which the complete event
+	// repeats whole. It is only kept when something needs the whole reply.
+	complete := req.Complete == nil || *req.Complete
+	keep := keepReply(req, complete)
+	var reply strings.Builder
+	// A JSON reply is only sent whole, in the complete event, with the
+	// elements of an array also sent as item events as each completes
+	jsonStream := jsonReply(req)
 	for {
 		select {
-		case response, ok := <-responseChan:
+		case chunk, ok := <-responseChan:
 			if !ok {
 				return
 			}
+			// Log probabilities go with the text they belong to, which the
+			// filter may hold back or strip
+			shown, logprobs := filter.WriteLogprobs(chunk.Token, chunk.Logprobs)
+			response := limit.Write(shown)
+			if chunk.Done {
+				// The final chunk's complete response has already been streamed,
+				// only the text the filter held back in case it started a tag is left
+				rest, restLogprobs := filter.FlushLogprobs()
+				response += limit.Write(rest)
+				logprobs = append(logprobs, restLogprobs...)
+			}
+			// Only screened text is sent, the rest waits for its sentence to end
+			var cerr *createError
+			if chunk.Done || limit.Reached() {
+				response, logprobs, cerr = screen.WriteLast(response, logprobs)
+			} else {
+				response, logprobs, cerr = screen.Write(response, logprobs)
+			}
+			if cerr != nil {
+				recordUsage(c.Request.Context(), containerName, req.Message, nil, "", start, nil)
+				rc.SetWriteDeadline(time.Now().Add(stall))
+				c.SSEvent("error", "Error: "+cerr.message)
+				c.Writer.Flush()
+				return
+			}
+			if jsonStream != nil {
+				for _, item := range jsonStream.Write(response) {
+					timer.tokenSent(c)
+					rc.SetWriteDeadline(time.Now().Add(stall))
+					c.SSEvent("item", item)
+					c.Writer.Flush()
+				}
+				response = ""
+			}
 			if response != "" {
+				if keep {
+					reply.WriteString(response)
+				}
+				timer.tokenSent(c)
+				rc.SetWriteDeadline(time.Now().Add(stall))
 				c.SSEvent("data", response)
+				if len(logprobs) > 0 {
+					c.SSEvent("logprobs", logprobs)
+				}
 				c.Writer.Flush()
 			}
+			if !chunk.Done && !limit.Reached() {
+				continue
+			}
+
+			// The reply is finished, or has its sentences and the rest of the
+			// generation is dropped
+			finish, stats := chunk.FinishReason, chunk.Stats
+			if limit.Reached() {
+				finish, stats = models.FinishSentences, nil
+			}
+			recordUsage(c.Request.Context(), containerName, req.Message, stats, finish, start, nil)
+			stats = timer.streamDone(stats)
+			text := reply.String()
+			if jsonStream != nil {
+				text = jsonStream.Text()
+				if err := jsonStream.Check(); err != nil {
+					rc.SetWriteDeadline(time.Now().Add(stall))
+					c.SSEvent("error", fmt.Sprintf("Error: %v", invalidJSON(err, finish)))
+					c.Writer.Flush()
+					return
+				}
+			}
+			appendSessionTurn(req, models.OllamaChatMessage{Role: "assistant", Content: text})
+			rc.SetWriteDeadline(time.Now().Add(stall))
+			if finish != "" {
+				c.SSEvent("finish", finish)
+			}
+			if complete {
+				c.SSEvent("complete", models.StreamComplete{
+					Text:              text,
+					FinishReason:      finish,
+					Stats:             stats,
+					HistoryTrimmed:    req.HistoryTrimmed,
+					NumCtx:            services.ModelContextWindow(services.ModelForContainer(containerName)),
+					NumPredictClamped: req.NumPredictClamped,
+				})
+			}
+			c.Writer.Flush()
+			return
 		case err := <-errorChan:
-			if err != nil {
+			if err == nil {
+				// Closed after the final chunk, which is still buffered
+				errorChan = nil
+				continue
+			}
+			recordUsage(c.Request.Context(), containerName, req.Message, nil, "", start, err)
+			err = ch.recordChatFailure(containerName, start, err)
+			rc.SetWriteDeadline(time.Now().Add(stall))
+			if errors.Is(err, services.ErrGenerationCancelled) {
+				c.SSEvent("cancelled", err.Error())
+			} else {
 				c.SSEvent("error", fmt.Sprintf("Error: %v", err))
+			}
+			c.Writer.Flush()
+			return
+		case <-c.Request.Context().Done():
+			recordUsage(c.Request.Context(), containerName, req.Message, nil, "", start, c.Request.Context().Err())
+			return
+		}
+	}
+}
+
+// streamNDJSON writes the stream as newline-delimited JSON objects, for clients that don't parse SSE
+func (ch *ChatHandler) streamNDJSON(c *gin.Context, req models.ChatRequest, containerName string, start time.Time, timer *chatTimer, responseChan chan models.StreamChunk, errorChan chan error) {
+	streamHeaders(c, "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	rc := http.NewResponseController(c.Writer)
+	stall := config.Get().StreamStallTimeout
+
+	encoder := json.NewEncoder(c.Writer)
+	filter := outputFilter(req)
+	limit := utils.NewSentenceLimit(req.MaxSentences)
+	jsonStream := jsonReply(req)
+	screen := newReplyScreen(c.Request.Context())
+	// reply is the text sent in token lines so far, kept only when the
+	// session needs the whole reply
+	keep := keepReply(req, false)
+	var reply strings.Builder
+	// write sends the next text of the reply as a token line, or for a JSON
+	// reply as item lines for the array elements it completes
+	write := func(text string, logprobs []models.TokenLogprob) {
+		if jsonStream != nil {
+			for _, item := range jsonStream.Write(text) {
+				timer.tokenSent(c)
+				encoder.Encode(models.NDJSONChunk{Item: item})
+			}
+			return
+		}
+		if text != "" {
+			if keep {
+				reply.WriteString(text)
+			}
+			timer.tokenSent(c)
+			encoder.Encode(models.NDJSONChunk{Token: text, Logprobs: logprobs})
+		}
+	}
+	for {
+		select {
+		case chunk, ok := <-responseChan:
+			if !ok {
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(stall))
+			if chunk.Done {
+				// Text the filter held back in case it started a tag, and what
+				// the screen held back until it was screened
+				rest, restLogprobs := filter.FlushLogprobs()
+				text, logprobs, cerr := screen.WriteLast(limit.Write(rest), restLogprobs)
+				if cerr == nil {
+					write(text, logprobs)
+				}
+				response, finish := reply.String(), chunk.FinishReason
+				if limit.Reached() {
+					finish = models.FinishSentences
+				}
+				recordUsage(c.Request.Context(), containerName, req.Message, chunk.Stats, finish, start, nil)
+				final := models.NDJSONChunk{Done: true, Stats: timer.streamDone(chunk.Stats), HistoryTrimmed: req.HistoryTrimmed, FinishReason: finish, NumCtx: services.ModelContextWindow(services.ModelForContainer(containerName)), NumPredictClamped: req.NumPredictClamped}
+				var jsonErr error
+				if jsonStream != nil {
+					response, jsonErr = jsonStream.Text(), jsonStream.Check()
+				}
+				if cerr != nil {
+					final.Error, final.Code = cerr.message, cerr.code
+				} else if jsonErr != nil {
+					final.Error, final.Code = invalidJSON(jsonErr, finish).Error(), "INVALID_JSON"
+				} else {
+					if jsonStream != nil {
+						final.JSON = json.RawMessage(response)
+					}
+					appendSessionTurn(req, models.OllamaChatMessage{Role: "assistant", Content: response})
+				}
+				encoder.Encode(final)
+				c.Writer.Flush()
+				return
+			}
+			text, logprobs := filter.WriteLogprobs(chunk.Token, chunk.Logprobs)
+			text = limit.Write(text)
+			var cerr *createError
+			if limit.Reached() {
+				text, logprobs, cerr = screen.WriteLast(text, logprobs)
+			} else {
+				text, logprobs, cerr = screen.Write(text, logprobs)
+			}
+			if cerr != nil {
+				recordUsage(c.Request.Context(), containerName, req.Message, nil, "", start, nil)
+				encoder.Encode(models.NDJSONChunk{Done: true, Stats: timer.streamDone(nil), Error: cerr.message, Code: cerr.code})
+				c.Writer.Flush()
+				return
+			}
+			write(text, logprobs)
+			c.Writer.Flush()
+			// The reply has its sentences, so the rest of the generation is dropped
+			if limit.Reached() {
+				recordUsage(c.Request.Context(), containerName, req.Message, nil, models.FinishSentences, start, nil)
+				appendSessionTurn(req, models.OllamaChatMessage{Role: "assistant", Content: limit.Text()})
+				encoder.Encode(models.NDJSONChunk{Done: true, Stats: timer.streamDone(nil), HistoryTrimmed: req.HistoryTrimmed, FinishReason: models.FinishSentences, NumCtx: services.ModelContextWindow(services.ModelForContainer(containerName)), NumPredictClamped: req.NumPredictClamped})
 				c.Writer.Flush()
+				return
+			}
+		case err := <-errorChan:
+			if err == nil {
+				// Closed after the final chunk, which is still buffered
+				errorChan = nil
+				continue
 			}
+			recordUsage(c.Request.Context(), containerName, req.Message, nil, "", start, err)
+			err = ch.recordChatFailure(containerName, start, err)
+			rc.SetWriteDeadline(time.Now().Add(stall))
+			encoder.Encode(models.NDJSONChunk{
+				Done:      true,
+				Error:     err.Error(),
+				Cancelled: errors.Is(err, services.ErrGenerationCancelled),
+				Code:      generationErrorCode(err),
+			})
+			c.Writer.Flush()
+			return
+		case <-c.Request.Context().Done():
+			recordUsage(c.Request.Context(), containerName, req.Message, nil, "", start, c.Request.Context().Err())
 			return
 		}
 	}
 }
 
-// SendMessage handles chat message requests
+// SendMessage handles chat message requests, answering with the whole reply
+// or, with stream set, streaming it like SendMessageStream
 func (ch *ChatHandler) SendMessage(c *gin.Context) {
 	var req models.ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Stream {
+		ch.streamMessage(c, req)
+		return
+	}
+
+	containerName, ok := ch.chatModel(c, req)
+	if !ok {
 		return
 	}
+	timer := newChatTimer(containerName)
 
-	models.ModelMutex.RLock()
-	if !models.CurrentModel.IsRunning {
-		models.ModelMutex.RUnlock()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No model is currently running. Please create a model first."})
+	if !ch.validateChat(c, req, containerName, false) {
 		return
 	}
-	containerName := models.CurrentModel.Name
-	models.ModelMutex.RUnlock()
+	clampNumPredict(c, &req, containerName)
 
 	log.Printf("Sending message to model: %s", req.Message)
 
-	// Send message to Ollama
-	response, err := ch.ollamaService.SendMessage(req.Message, containerName)
+	// Plain-text clients (curl, shell scripts) get the raw completion
+	plainText := c.NegotiateFormat(gin.MIMEJSON, gin.MIMEPlain) == gin.MIMEPlain
+
+	if !moderatePrompt(c, req.Message, plainText) {
+		return
+	}
+
+	endSession, ok := loadSessionHistory(c, &req)
+	if !ok {
+		return
+	}
+	defer endSession()
+	ch.fitHistory(c, &req, containerName)
+
+	release, ok := ch.waitForChatSlot(c, req, containerName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Tools and conversations need Ollama's chat API
+	if len(req.Tools) > 0 || req.SessionID != "" {
+		ch.sendChat(c, req, containerName, timer, plainText)
+		return
+	}
+
+	// Send message to Ollama, giving up on it, and the chat slot it holds,
+	// if the client goes away
+	start := time.Now()
+	ollamaResp, err := ch.ollamaService.Generate(c.Request.Context(), req, containerName)
+	response, finish := finishReply(req, ollamaResp.Response, ollamaResp.FinishReason)
+	recordUsage(c.Request.Context(), containerName, req.Message, &ollamaResp.GenerationStats, finish, start, err)
+	if err != nil {
+		respondGenerationError(c, ch.recordChatFailure(containerName, start, err), plainText)
+		return
+	}
+	if cerr := moderate(c.Request.Context(), moderation.Response, response); cerr != nil {
+		respondModeration(c, cerr, plainText)
+		return
+	}
+
+	totalMs := timer.answered(c)
+	if plainText {
+		c.String(http.StatusOK, response)
+		return
+	}
+
+	respond(c, http.StatusOK, models.ChatResponse{
+		Response:          response,
+		FinishReason:      finish,
+		Logprobs:          ollamaResp.Logprobs,
+		NumCtx:            services.ModelContextWindow(services.ModelForContainer(containerName)),
+		NumPredictClamped: req.NumPredictClamped,
+		TotalMs:           totalMs,
+	})
+}
+
+// validateChat checks a chat request's options before anything is generated,
+// responding 400 (or the image or thread check's status) and returning false
+// for the first that is invalid. Tools need the whole reply, so they can't be
+// streamed.
+func (ch *ChatHandler) validateChat(c *gin.Context, req models.ChatRequest, containerName string, stream bool) bool {
+	if len(req.Images) > 0 {
+		if status, err := ch.validateImages(req.Images, containerName); err != nil {
+			respondError(c, status, err.Error())
+			return false
+		}
+	}
+
+	if len(req.Tools) > 0 {
+		if stream {
+			respondError(c, http.StatusBadRequest, "Tools are not supported on streaming requests, send them to /chat without stream")
+			return false
+		}
+		if err := validateTools(req.Tools); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return false
+		}
+	}
+
+	if req.NumThread != nil {
+		if status, err := ch.validateNumThread(*req.NumThread, containerName); err != nil {
+			respondError(c, status, err.Error())
+			return false
+		}
+	}
+
+	if err := validateSampling(req.Options); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	if err := validateLang(req.Lang); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	if err := validateLogprobs(req.Logprobs); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	if err := validateStripTags(req.StripTags); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	if err := validateMaxSentences(req.MaxSentences); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	if err := validateFormat(req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// recordUsage adds a finished chat request to the usage statistics, under the
+// client of the request behind ctx, and the model's generation history,
+// clearing the model's last error when it succeeded
+func recordUsage(ctx context.Context, containerName, prompt string, stats *models.GenerationStats, finish string, start time.Time, err error) {
+	model, latency := services.ModelForContainer(containerName), time.Since(start)
+	generation := models.Generation{
+		Time:         time.Now().UTC(),
+		PromptChars:  utf8.RuneCountInString(prompt),
+		LatencyMs:    float64(latency) / float64(time.Millisecond),
+		FinishReason: finish,
+		Prompt:       prompt,
+	}
+	if stats != nil {
+		generation.PromptTokens, generation.CompletionTokens = stats.PromptEvalCount, stats.EvalCount
+	}
+	if err != nil {
+		generation.FinishReason, generation.Error = "", err.Error()
+	}
+	usage.Record(model, middleware.ClientOf(ctx), generation.PromptTokens+generation.CompletionTokens, latency, err != nil)
+	usage.RecordGeneration(model, generation)
+	if err == nil {
+		registry.ClearError(model)
+	}
+}
+
+// respondGenerationError reports a failed generation, with 503
+// GENERATION_CANCELLED when an operator cancelled it and 503 MODEL_OOM when
+// the model's container ran out of memory
+func respondGenerationError(c *gin.Context, err error, plainText bool) {
+	status, code := http.StatusInternalServerError, generationErrorCode(err)
+	if code != "" {
+		status = http.StatusServiceUnavailable
+	}
+
+	errMsg := fmt.Sprintf("Failed to get response from model: %v", err)
+	if plainText {
+		c.String(status, errMsg)
+		return
+	}
+	respondErrorCode(c, status, code, errMsg)
+}
+
+// generationErrorCode returns the error code for a failed generation, or ""
+// for failures without one
+func generationErrorCode(err error) string {
+	var oomErr *services.OOMError
+	switch {
+	case errors.Is(err, services.ErrGenerationCancelled):
+		return "GENERATION_CANCELLED"
+	case errors.As(err, &oomErr):
+		return "MODEL_OOM"
+	}
+	return ""
+}
+
+// loadSessionHistory claims the session of a request continuing one and fills
+// in the conversation so far, so no other chat can extend the history until
+// end is called. It responds 404 if the session doesn't exist and 409
+// SESSION_BUSY while another chat is answering in it, returning false.
+func loadSessionHistory(c *gin.Context, req *models.ChatRequest) (end func(), ok bool) {
+	if req.SessionID == "" {
+		return func() {}, true
+	}
+	end, err := sessions.Begin(req.SessionID)
+	if errors.Is(err, sessions.ErrBusy) {
+		respondErrorCode(c, http.StatusConflict, "SESSION_BUSY", fmt.Sprintf("Session %s is already generating a reply, wait for it to finish", req.SessionID))
+		return nil, false
+	}
+	history, found := sessions.History(req.SessionID)
+	if err != nil || !found {
+		if err == nil {
+			end()
+		}
+		respondErrorCode(c, http.StatusNotFound, "SESSION_NOT_FOUND", fmt.Sprintf("Session %s does not exist or has expired", req.SessionID))
+		return nil, false
+	}
+	req.History = history
+	return end, true
+}
+
+// fitHistory trims the oldest turns of a session's history so it fits the
+// history token budget alongside the new message, optionally replacing them
+// with a summary. The number of turns trimmed is reported in the
+// X-History-Trimmed header.
+func (ch *ChatHandler) fitHistory(c *gin.Context, req *models.ChatRequest, containerName string) {
+	if len(req.History) == 0 {
+		return
+	}
+	budget := services.HistoryBudget(*req, containerName) - utils.EstimateMessageTokens(req.Message)
+	kept, evicted, turns := utils.TrimHistory(req.History, budget)
+	if turns == 0 {
+		return
+	}
+
+	if config.Get().SummarizeHistory {
+		summary, err := ch.ollamaService.SummarizeConversation(evicted, containerName)
+		if err != nil {
+			log.Printf("Failed to summarize trimmed history of session %s: %v", req.SessionID, err)
+		} else if summary != "" {
+			// The summary goes after any system messages, then has to fit the budget too
+			summarized := make([]models.OllamaChatMessage, 0, len(kept)+1)
+			i := 0
+			for ; i < len(kept) && kept[i].Role == "system"; i++ {
+				summarized = append(summarized, kept[i])
+			}
+			summarized = append(summarized, models.OllamaChatMessage{Role: "system", Content: "Summary of the earlier conversation: " + summary})
+			summarized = append(summarized, kept[i:]...)
+
+			var more int
+			kept, _, more = utils.TrimHistory(summarized, budget)
+			turns += more
+		}
+	}
+
+	log.Printf("Trimmed %d turns from session %s to fit %d history tokens", turns, req.SessionID, budget)
+	req.History = kept
+	req.HistoryTrimmed = turns
+	c.Header("X-History-Trimmed", strconv.Itoa(turns))
+}
+
+// clampNumPredict records when the model's max_tokens lowers the num_predict
+// the request asks for, reporting the value generated with in the
+// X-Num-Predict-Clamped header
+func clampNumPredict(c *gin.Context, req *models.ChatRequest, containerName string) {
+	clamped := services.NumPredictClamp(*req, containerName)
+	if clamped == 0 {
+		return
+	}
+	req.NumPredictClamped = clamped
+	c.Header("X-Num-Predict-Clamped", strconv.Itoa(clamped))
+}
+
+// keepReply reports whether a streamed reply has to be kept whole as it is
+// sent: to repeat it in the complete event or add it to the session.
+// Otherwise only the text being sent is held in memory, apart from what
+// response moderation holds to screen it.
+func keepReply(req models.ChatRequest, complete bool) bool {
+	return complete || req.SessionID != ""
+}
+
+// appendSessionTurn records the user's message and the model's reply in the request's session
+func appendSessionTurn(req models.ChatRequest, reply models.OllamaChatMessage) {
+	if req.SessionID == "" {
+		return
+	}
+	reply.Role = "assistant"
+	sessions.Append(req.SessionID,
+		models.OllamaChatMessage{Role: "user", Content: req.Message, Images: req.Images},
+		reply,
+	)
+}
+
+// CountTokens estimates how many tokens a prompt or conversation takes and
+// whether it fits the context window
+func (ch *ChatHandler) CountTokens(c *gin.Context) {
+	var req models.CountTokensRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Prompt == "" && len(req.Messages) == 0 && req.SessionID == "" {
+		respondError(c, http.StatusBadRequest, "prompt, messages or session_id is required")
+		return
+	}
+
+	messages := req.Messages
+	if req.SessionID != "" {
+		history, ok := sessions.History(req.SessionID)
+		if !ok {
+			respondErrorCode(c, http.StatusNotFound, "SESSION_NOT_FOUND", fmt.Sprintf("Session %s does not exist or has expired", req.SessionID))
+			return
+		}
+		messages = append(history, messages...)
+	}
+
+	tokens := 0
+	for _, message := range messages {
+		tokens += utils.EstimateMessageTokens(message.Content)
+	}
+	if req.Prompt != "" {
+		if len(messages) > 0 {
+			tokens += utils.EstimateMessageTokens(req.Prompt)
+		} else {
+			tokens += utils.EstimateTokens(req.Prompt)
+		}
+	}
+
+	numCtx := currentContextWindow()
+	respond(c, http.StatusOK, models.TokenCount{
+		Tokens:    tokens,
+		NumCtx:    numCtx,
+		Remaining: numCtx - tokens,
+		Overflow:  tokens > numCtx,
+		Method:    "approximate",
+	})
+}
+
+// ExplainChat returns the options a chat request would be sent to Ollama with,
+// after defaults and per-request overrides are merged, without generating
+func (ch *ChatHandler) ExplainChat(c *gin.Context) {
+	var req models.ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	containerName, ok := ch.runningModel(c, false)
+	if !ok {
+		return
+	}
+
+	if req.NumThread != nil {
+		if status, err := ch.validateNumThread(*req.NumThread, containerName); err != nil {
+			respondError(c, status, err.Error())
+			return
+		}
+	}
+
+	if err := validateSampling(req.Options); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateLang(req.Lang); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, services.ExplainRequest(req, containerName))
+}
+
+// Embed returns an embedding of each input from the running model. Requests
+// beyond the embedding queue's capacity get 503 EMBED_QUEUE_FULL.
+func (ch *ChatHandler) Embed(c *gin.Context) {
+	var req models.EmbeddingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	containerName, ok := ch.runningModel(c, true)
+	if !ok || !modelReady(c, containerName) {
+		return
+	}
+
+	start := time.Now()
+	embeddings, err := ch.ollamaService.Embed(c.Request.Context(), containerName, req.Input)
+	if errors.Is(err, services.ErrEmbedQueueFull) {
+		c.Header("Retry-After", "1")
+		respondErrorCode(c, http.StatusServiceUnavailable, "EMBED_QUEUE_FULL", err.Error())
+		return
+	}
+	if err != nil {
+		respondGenerationError(c, ch.recordChatFailure(containerName, start, err), false)
+		return
+	}
+	registry.ClearError(services.ModelForContainer(containerName))
+
+	respond(c, http.StatusOK, models.EmbeddingsResponse{
+		Model:      services.ModelForContainer(containerName),
+		Embeddings: embeddings,
+	})
+}
+
+// CreateSession starts a new conversation, opening with the welcome message
+// configured for the running model, if any
+func (ch *ChatHandler) CreateSession(c *gin.Context) {
+	welcome := ch.welcomeMessage(c.Request.Context())
+	if welcome == "" {
+		respond(c, http.StatusCreated, sessions.Create())
+		return
+	}
+	session := sessions.Create(models.OllamaChatMessage{Role: "assistant", Content: welcome})
+	session.Welcome = welcome
+	respond(c, http.StatusCreated, session)
+}
+
+// ListSessions returns active conversations, most recently used first
+func (ch *ChatHandler) ListSessions(c *gin.Context) {
+	respond(c, http.StatusOK, gin.H{"sessions": sessions.List()})
+}
+
+// validateImages checks image count, encoding and size, and that the current model accepts images
+func (ch *ChatHandler) validateImages(images []string, containerName string) (int, error) {
+	cfg := config.Get()
+	if len(images) > cfg.MaxImages {
+		return http.StatusBadRequest, fmt.Errorf("too many images: %d (maximum is %d)", len(images), cfg.MaxImages)
+	}
+
+	for i, image := range images {
+		decoded, err := base64.StdEncoding.DecodeString(image)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("image %d is not valid base64: %v", i+1, err)
+		}
+		if len(decoded) > cfg.MaxImageBytes {
+			return http.StatusBadRequest, fmt.Errorf("image %d is %d bytes (maximum is %d)", i+1, len(decoded), cfg.MaxImageBytes)
+		}
+	}
+
+	multimodal, err := ch.ollamaService.IsMultimodal(containerName)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Errorf("failed to inspect model capabilities: %v", err)
+	}
+	if !multimodal {
+		return http.StatusBadRequest, fmt.Errorf("the current model does not accept images, use a multimodal model such as llava")
+	}
+	return http.StatusOK, nil
+}
+
+// validateNumThread checks a num_thread override fits within the container's CPU limit
+func (ch *ChatHandler) validateNumThread(threads int, containerName string) (int, error) {
+	if threads < 1 {
+		return http.StatusBadRequest, fmt.Errorf("num_thread must be at least 1")
+	}
+	limit, err := ch.dockerService.CPULimit(containerName)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	if threads > limit {
+		return http.StatusBadRequest, fmt.Errorf("num_thread %d exceeds the %d CPUs available to the model container", threads, limit)
+	}
+	return http.StatusOK, nil
+}
+
+// validateLang checks a reply language is one the server knows how to ask for
+func validateLang(lang string) error {
+	if lang == "" {
+		return nil
+	}
+	if _, ok := utils.LanguageName(lang); !ok {
+		return fmt.Errorf("lang %q is not a supported language code", lang)
+	}
+	return nil
+}
+
+// validateLogprobs checks the number of alternatives asked for per token
+func validateLogprobs(logprobs *int) error {
+	if logprobs != nil && (*logprobs < 0 || *logprobs > services.MaxLogprobs) {
+		return fmt.Errorf("logprobs must be between 0 and %d", services.MaxLogprobs)
+	}
+	return nil
+}
+
+// validateStripTags checks each tag asked to be stripped is a plain tag name
+func validateStripTags(tags []string) error {
+	for _, tag := range tags {
+		if err := config.CheckStripTag(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMaxSentences checks a request's sentence limit
+func validateMaxSentences(maxSentences int) error {
+	if maxSentences < 0 {
+		return fmt.Errorf("max_sentences must not be negative, got %d", maxSentences)
+	}
+	return nil
+}
+
+// finishReply post-processes a whole completion with outputFilter, then cuts
+// it off at the request's max_sentences, in which case the finish reason
+// becomes FinishSentences
+func finishReply(req models.ChatRequest, text, finishReason string) (string, string) {
+	text, cut := utils.NewSentenceLimit(req.MaxSentences).Apply(outputFilter(req).Apply(text))
+	if cut {
+		finishReason = models.FinishSentences
+	}
+	return text, finishReason
+}
+
+// outputFilter returns the post-processing for the request's completion: the
+// request's strip_tags and trim when given, otherwise OWNGPT_STRIP_TAGS and
+// OWNGPT_TRIM_OUTPUT
+func outputFilter(req models.ChatRequest) *utils.OutputFilter {
+	tags, trim := config.Get().StripTags, config.Get().TrimOutput
+	if req.StripTags != nil {
+		tags = req.StripTags
+	}
+	if req.Trim != nil {
+		trim = *req.Trim
+	}
+	return utils.NewOutputFilter(tags, trim)
+}
+
+// validateSampling checks per-request sampling overrides are within range
+func validateSampling(options *models.SamplingOptions) error {
+	if options == nil {
+		return nil
+	}
+	checks := []struct {
+		option string
+		value  *float64
+	}{
+		{"temperature", options.Temperature},
+		{"top_p", options.TopP},
+		{"repeat_penalty", options.RepeatPenalty},
+		{"tfs_z", options.TfsZ},
+	}
+	for _, check := range checks {
+		if check.value != nil {
+			if err := config.CheckSampling(check.option, *check.value); err != nil {
+				return err
+			}
+		}
+	}
+	if options.NumPredict != nil {
+		if err := config.CheckSampling("num_predict", float64(*options.NumPredict)); err != nil {
+			return err
+		}
+	}
+	if options.TopK != nil {
+		if err := config.CheckSampling("top_k", float64(*options.TopK)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendChat answers a request via Ollama's chat API, continuing the session's
+// conversation and returning any tool calls alongside the text
+func (ch *ChatHandler) sendChat(c *gin.Context, req models.ChatRequest, containerName string, timer *chatTimer, plainText bool) {
+	start := time.Now()
+	chatResp, err := ch.ollamaService.SendChat(c.Request.Context(), req, containerName)
+	if err == nil {
+		chatResp.Message.Content, chatResp.FinishReason = finishReply(req, chatResp.Message.Content, chatResp.FinishReason)
+	}
+	recordUsage(c.Request.Context(), containerName, req.Message, &chatResp.GenerationStats, chatResp.FinishReason, start, err)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ChatResponse{
-			Error: fmt.Sprintf("Failed to get response from model: %v", err),
-		})
+		respondGenerationError(c, ch.recordChatFailure(containerName, start, err), plainText)
+		return
+	}
+	if cerr := moderate(c.Request.Context(), moderation.Response, chatResp.Message.Content); cerr != nil {
+		respondModeration(c, cerr, plainText)
+		return
+	}
+	appendSessionTurn(req, chatResp.Message)
+
+	totalMs := timer.answered(c)
+	if plainText {
+		c.String(http.StatusOK, chatResp.Message.Content)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.ChatResponse{
-		Response: response,
+	respond(c, http.StatusOK, models.ChatResponse{
+		Response:          chatResp.Message.Content,
+		ToolCalls:         chatResp.Message.ToolCalls,
+		HistoryTrimmed:    req.HistoryTrimmed,
+		FinishReason:      chatResp.FinishReason,
+		Logprobs:          chatResp.Logprobs,
+		NumCtx:            services.ModelContextWindow(services.ModelForContainer(containerName)),
+		NumPredictClamped: req.NumPredictClamped,
+		TotalMs:           totalMs,
 	})
 }
+
+// validateTools checks each tool is a well-formed function spec
+func validateTools(tools []json.RawMessage) error {
+	for i, raw := range tools {
+		var tool struct {
+			Type     string `json:"type"`
+			Function *struct {
+				Name       string          `json:"name"`
+				Parameters json.RawMessage `json:"parameters"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(raw, &tool); err != nil {
+			return fmt.Errorf("tool %d is not a valid JSON object: %v", i+1, err)
+		}
+		if tool.Type != "function" {
+			return fmt.Errorf("tool %d must have type \"function\"", i+1)
+		}
+		if tool.Function == nil || tool.Function.Name == "" {
+			return fmt.Errorf("tool %d is missing function.name", i+1)
+		}
+		if len(tool.Function.Parameters) > 0 {
+			var parameters map[string]interface{}
+			if err := json.Unmarshal(tool.Function.Parameters, &parameters); err != nil {
+				return fmt.Errorf("tool %d function.parameters must be a JSON schema object", i+1)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// fakeOllama is an Ollama server answering every generation with the same
+// tokens, streamed one per line, and recording the payloads it was sent
+type fakeOllama struct {
+	tokens []string
+	// doneReason is sent on the final line
+	doneReason string
+	// installed are the models /api/tags lists
+	installed []string
+	// capabilities are what /api/show lists for every model
+	capabilities []string
+	// system is the Modelfile SYSTEM prompt /api/show reports
+	system string
+	// digest is what /api/tags lists for every model, until a pull changes
+	// it to pulledDigest
+	digest, pulledDigest string
+	// toolCalls are returned with whole /api/chat replies
+	toolCalls []models.ToolCall
+
+	mu       sync.Mutex
+	payloads []map[string]interface{}
+}
+
+// startFakeOllama serves the tokens from a fake Ollama in local mode with
+// llama2 as the current model, restoring the config and model after the test
+func startFakeOllama(t *testing.T, tokens ...string) *fakeOllama {
+	fake := &fakeOllama{tokens: tokens, doneReason: "stop", installed: []string{"llama2:latest"}}
+	server := httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(server.Close)
+
+	cfg := config.Get()
+	mode, url := cfg.Mode, cfg.OllamaURL
+	cfg.Mode, cfg.OllamaURL = "local", server.URL
+	models.ModelMutex.Lock()
+	current := models.CurrentModel
+	models.CurrentModel = models.ModelContainer{Name: "ollama-llama2-container", IsRunning: true}
+	models.ModelMutex.Unlock()
+	t.Cleanup(func() {
+		cfg.Mode, cfg.OllamaURL = mode, url
+		models.ModelMutex.Lock()
+		models.CurrentModel = current
+		models.ModelMutex.Unlock()
+	})
+	return fake
+}
+
+func (f *fakeOllama) serve(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&payload)
+	f.mu.Lock()
+	f.payloads = append(f.payloads, payload)
+	f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/tags":
+		tags := []map[string]string{}
+		f.mu.Lock()
+		for _, name := range f.installed {
+			tags = append(tags, map[string]string{"name": name, "model": name, "digest": f.digest})
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"models": tags})
+		return
+	case "/api/show":
+		json.NewEncoder(w).Encode(map[string]interface{}{"capabilities": f.capabilities, "system": f.system})
+		return
+	case "/api/pull":
+		f.mu.Lock()
+		if f.pulledDigest != "" {
+			f.digest = f.pulledDigest
+		}
+		f.mu.Unlock()
+		w.Write([]byte(`{"status":"success"}`))
+		return
+	case "/api/generate", "/api/chat":
+	default:
+		w.Write([]byte(`{}`))
+		return
+	}
+
+	chat := r.URL.Path == "/api/chat"
+	line := func(token string, done bool, index int) map[string]interface{} {
+		resp := map[string]interface{}{"done": done}
+		if chat {
+			resp["message"] = map[string]string{"role": "assistant", "content": token}
+		} else {
+			resp["response"] = token
+		}
+		if done {
+			resp["done_reason"] = f.doneReason
+			resp["eval_count"] = len(f.tokens)
+		} else if payload["logprobs"] == true {
+			resp["logprobs"] = []models.TokenLogprob{{Token: token, Logprob: -float64(index)}}
+		}
+		return resp
+	}
+
+	encoder := json.NewEncoder(w)
+	if stream, _ := payload["stream"].(bool); !stream {
+		resp := line(strings.Join(f.tokens, ""), true, 0)
+		if chat && len(f.toolCalls) > 0 {
+			resp["message"] = models.OllamaChatMessage{Role: "assistant", Content: strings.Join(f.tokens, ""), ToolCalls: f.toolCalls}
+		}
+		if payload["logprobs"] == true {
+			var logprobs []models.TokenLogprob
+			for i, token := range f.tokens {
+				logprobs = append(logprobs, models.TokenLogprob{Token: token, Logprob: -float64(i)})
+			}
+			resp["logprobs"] = logprobs
+		}
+		encoder.Encode(resp)
+		return
+	}
+	for i, token := range f.tokens {
+		encoder.Encode(line(token, false, i))
+		w.(http.Flusher).Flush()
+	}
+	encoder.Encode(line("", true, 0))
+}
+
+// generations returns the payloads of the generation requests made so far
+func (f *fakeOllama) generations() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var generations []map[string]interface{}
+	for _, payload := range f.payloads {
+		if _, ok := payload["options"]; ok {
+			generations = append(generations, payload)
+		}
+	}
+	return generations
+}
+
+// chat sends a request body to the handler with the given headers, as
+// "Name: value" strings
+func chat(handler gin.HandlerFunc, body string, headers ...string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.POST("/chat", handler)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ": ")
+		req.Header.Set(name, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// sseEvents parses a Server-Sent Events body into its events, in order, as
+// "event: data" strings
+func sseEvents(body string) []string {
+	var events []string
+	for _, block := range strings.Split(body, "\n\n") {
+		var event, data string
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				event = name
+			} else if value, ok := strings.CutPrefix(line, "data:"); ok {
+				data = value
+			}
+		}
+		if event != "" {
+			events = append(events, event+": "+data)
+		}
+	}
+	return events
+}
+
+// ndjsonLines parses an NDJSON body into its chunks
+func ndjsonLines(t *testing.T, body string) []models.NDJSONChunk {
+	var chunks []models.NDJSONChunk
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		var chunk models.NDJSONChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", line, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func TestSendMessage(t *testing.T) {
+	startFakeOllama(t, "Hello", " there.")
+	w := chat(NewChatHandler().SendMessage, `{"message":"hi"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp models.ChatResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Response != "Hello there." || resp.FinishReason != models.FinishEnd {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestStreamLogprobsFollowFilteredText(t *testing.T) {
+	// "<" is held back until "b>." shows it isn't a tag, and its logprob with it
+	startFakeOllama(t, "<think>", "plan", "</th", "ink>", "Hello ", "<", "b>.")
+	body := `{"message":"hi","logprobs":1,"strip_tags":["think"]}`
+	chunks := ndjsonLines(t, chat(NewChatHandler().SendMessageStream, body, "Accept: application/x-ndjson").Body.String())
+
+	var text strings.Builder
+	var logprobs []string
+	for _, chunk := range chunks {
+		text.WriteString(chunk.Token)
+		for _, logprob := range chunk.Logprobs {
+			logprobs = append(logprobs, logprob.Token)
+		}
+	}
+	if text.String() != "Hello <b>." {
+		t.Errorf("text = %q, want Hello <b>.", text.String())
+	}
+	if got := strings.Join(logprobs, "|"); got != "Hello |<|b>." {
+		t.Errorf("logprobs = %q, want those of the shown tokens only", got)
+	}
+}
+
+func TestStreamFinishReason(t *testing.T) {
+	fake := startFakeOllama(t, "Once", " upon")
+	fake.doneReason = "length"
+	chunks := ndjsonLines(t, chat(NewChatHandler().SendMessageStream, `{"message":"tell a story"}`, "Accept: application/x-ndjson").Body.String())
+	final := chunks[len(chunks)-1]
+	if !final.Done || final.FinishReason != models.FinishLength {
+		t.Errorf("final chunk = %+v, want finish_reason length", final)
+	}
+	for _, chunk := range chunks[:len(chunks)-1] {
+		if chunk.FinishReason != "" {
+			t.Errorf("chunk %+v has a finish_reason before the end", chunk)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/services"
+)
+
+func TestChatImages(t *testing.T) {
+	fake := startFakeOllama(t, "A cat.")
+	cfg := config.Get()
+	previousImages, previousBytes := cfg.MaxImages, cfg.MaxImageBytes
+	cfg.MaxImages, cfg.MaxImageBytes = 2, 16
+	t.Cleanup(func() {
+		cfg.MaxImages, cfg.MaxImageBytes = previousImages, previousBytes
+		services.ForgetCapabilities("llama2")
+	})
+
+	image := base64.StdEncoding.EncodeToString([]byte("png bytes"))
+	large := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 17)))
+	tests := []struct {
+		name         string
+		images       []string
+		capabilities []string
+		status       int
+		message      string
+	}{
+		{"vision model", []string{image, image}, []string{"completion", "vision"}, http.StatusOK, ""},
+		{"text model", []string{image}, []string{"completion"}, http.StatusBadRequest, "does not accept images"},
+		{"too many", []string{image, image, image}, []string{"vision"}, http.StatusBadRequest, "too many images"},
+		{"not base64", []string{"not base64!"}, []string{"vision"}, http.StatusBadRequest, "image 1 is not valid base64"},
+		{"too large", []string{image, large}, []string{"vision"}, http.StatusBadRequest, "image 2 is 17 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services.ForgetCapabilities("llama2")
+			fake.capabilities = tt.capabilities
+			before := len(fake.generations())
+
+			body := fmt.Sprintf(`{"message":"what is this?","images":["%s"]}`, strings.Join(tt.images, `","`))
+			w := chat(NewChatHandler().SendMessage, body)
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.message) {
+				t.Fatalf("status %d: %s, want %d with %q", w.Code, w.Body, tt.status, tt.message)
+			}
+
+			generations := fake.generations()[before:]
+			if tt.status != http.StatusOK {
+				if len(generations) != 0 {
+					t.Error("a rejected request was generated")
+				}
+				return
+			}
+			if len(generations) != 1 {
+				t.Fatalf("%d generations, want 1", len(generations))
+			}
+			if sent, _ := generations[0]["images"].([]interface{}); len(sent) != len(tt.images) {
+				t.Errorf("sent %d images, want %d", len(sent), len(tt.images))
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+
+	"owngpt/models"
+	"owngpt/services"
+	"owngpt/utils"
+)
+
+// validateFormat checks the request's format is one Ollama supports and can
+// be combined with its other options
+func validateFormat(req models.ChatRequest) error {
+	switch req.Format {
+	case "":
+		return nil
+	case services.FormatJSON:
+		if req.MaxSentences > 0 {
+			return fmt.Errorf("max_sentences can't be used with format %q, cutting the reply short would break the JSON", req.Format)
+		}
+		if req.Complete != nil && !*req.Complete {
+			return fmt.Errorf("complete can't be false with format %q, the reply is only sent whole in the complete event", req.Format)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported format %q, expected %q", req.Format, services.FormatJSON)
+}
+
+// jsonReply returns the JSONStream assembling a streamed reply requested in
+// JSON, or nil for other replies
+func jsonReply(req models.ChatRequest) *utils.JSONStream {
+	if req.Format != services.FormatJSON {
+		return nil
+	}
+	return utils.NewJSONStream()
+}
+
+// invalidJSON explains a JSON reply that doesn't parse, which is most often
+// one cut off at num_predict
+func invalidJSON(err error, finishReason string) error {
+	if finishReason == models.FinishLength {
+		return fmt.Errorf("%v; it was cut off at num_predict, raise it for longer replies", err)
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestChatLang(t *testing.T) {
+	fake := startFakeOllama(t, "Bonjour")
+	handler := NewChatHandler().SendMessage
+
+	if w := chat(handler, `{"message":"hi","lang":"fr"}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	// The Modelfile's SYSTEM prompt is kept, with the instruction after it
+	fake.system = "You are a helpful assistant."
+	if w := chat(handler, `{"message":"hi","lang":"PT-br"}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	// Without a lang the model's own system prompt is left alone
+	if w := chat(handler, `{"message":"hi"}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	generations := fake.generations()
+	want := []interface{}{
+		"Respond in French.",
+		"You are a helpful assistant.\n\nRespond in Brazilian Portuguese.",
+		nil,
+	}
+	for i, system := range want {
+		if got := generations[i]["system"]; got != system {
+			t.Errorf("chat %d: system = %q, want %q", i+1, got, system)
+		}
+	}
+
+	if w := chat(handler, `{"message":"hi","lang":"klingon"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported lang: status = %d, want 400", w.Code)
+	}
+	if len(fake.generations()) != 3 {
+		t.Error("a chat with an unsupported lang was generated")
+	}
+}
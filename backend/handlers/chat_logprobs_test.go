@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"owngpt/models"
+)
+
+func TestSendMessageLogprobs(t *testing.T) {
+	fake := startFakeOllama(t, "Hello", " there.")
+	handler := NewChatHandler().SendMessage
+
+	w := chat(handler, `{"message":"hi","logprobs":3}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp models.ChatResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Logprobs) != 2 || resp.Logprobs[0].Token != "Hello" || resp.Logprobs[1].Logprob != -1 {
+		t.Errorf("logprobs = %+v, want one per token", resp.Logprobs)
+	}
+
+	// logprobs 0 asks for the chosen tokens only, without alternatives
+	chat(handler, `{"message":"hi","logprobs":0}`)
+	chat(handler, `{"message":"hi"}`)
+	generations := fake.generations()
+	want := []struct {
+		logprobs    interface{}
+		topLogprobs interface{}
+	}{
+		{true, float64(3)},
+		{true, nil},
+		{nil, nil},
+	}
+	for i, tt := range want {
+		if generations[i]["logprobs"] != tt.logprobs || generations[i]["top_logprobs"] != tt.topLogprobs {
+			t.Errorf("chat %d sent logprobs %v, top_logprobs %v; want %v, %v", i+1,
+				generations[i]["logprobs"], generations[i]["top_logprobs"], tt.logprobs, tt.topLogprobs)
+		}
+	}
+
+	var none models.ChatResponse
+	json.Unmarshal(chat(handler, `{"message":"hi"}`).Body.Bytes(), &none)
+	if none.Logprobs != nil {
+		t.Errorf("logprobs = %+v without asking for them", none.Logprobs)
+	}
+}
+
+func TestLogprobsBounds(t *testing.T) {
+	fake := startFakeOllama(t, "Hello")
+	for _, body := range []string{`{"message":"hi","logprobs":-1}`, `{"message":"hi","logprobs":21}`} {
+		if w := chat(NewChatHandler().SendMessage, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("a chat with out-of-range logprobs was generated")
+	}
+}
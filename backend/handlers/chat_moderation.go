@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/models"
+	"owngpt/moderation"
+	"owngpt/utils"
+)
+
+// moderate screens text going in the direction under OWNGPT_MODERATION,
+// returning 422 CONTENT_BLOCKED when the policy blocks it and 503
+// MODERATION_UNAVAILABLE when the moderation endpoint can't tell
+func moderate(ctx context.Context, direction, text string) *createError {
+	verdict, err := moderation.Check(ctx, direction, text)
+	if err != nil {
+		return &createError{http.StatusServiceUnavailable, "MODERATION_UNAVAILABLE", fmt.Sprintf("Failed to screen the %s: %v", direction, err)}
+	}
+	if verdict.Blocked {
+		return &createError{http.StatusUnprocessableEntity, "CONTENT_BLOCKED", fmt.Sprintf("The %s was blocked because %s", direction, verdict.Reason)}
+	}
+	return nil
+}
+
+// moderatePrompt screens a chat's message before anything is generated for
+// it, responding with the moderation error and returning false when it may
+// not be answered
+func moderatePrompt(c *gin.Context, message string, plainText bool) bool {
+	cerr := moderate(c.Request.Context(), moderation.Prompt, message)
+	if cerr == nil {
+		return true
+	}
+	respondModeration(c, cerr, plainText)
+	return false
+}
+
+// respondModeration reports a moderation error, as text to plain-text clients
+func respondModeration(c *gin.Context, cerr *createError, plainText bool) {
+	if plainText {
+		c.String(cerr.status, cerr.message)
+		return
+	}
+	respondErrorCode(c, cerr.status, cerr.code, cerr.message)
+}
+
+// replyScreen holds a streamed reply back until response moderation has
+// screened it. It is released a sentence at a time, once the reply up to the
+// end of the sentence passes, so nothing blocked reaches the client. Without
+// OWNGPT_MODERATION_RESPONSES text passes straight through.
+type replyScreen struct {
+	ctx     context.Context
+	enabled bool
+	// text is the reply so far, of which released has been screened and let through
+	text     strings.Builder
+	released int
+	// logprobs wait with the text they came with; each ends at offset end of text
+	logprobs []screenedLogprobs
+	blocked  *createError
+}
+
+type screenedLogprobs struct {
+	end      int
+	logprobs []models.TokenLogprob
+}
+
+func newReplyScreen(ctx context.Context) *replyScreen {
+	return &replyScreen{ctx: ctx, enabled: moderation.Enabled(moderation.Response)}
+}
+
+// Write takes the next text of the reply, with the log probabilities of its
+// tokens, and returns what has been screened and may be sent. Once the reply
+// is blocked it returns the moderation error.
+func (s *replyScreen) Write(text string, logprobs []models.TokenLogprob) (string, []models.TokenLogprob, *createError) {
+	if !s.enabled {
+		return text, logprobs, nil
+	}
+	if s.blocked != nil {
+		return "", nil, s.blocked
+	}
+	s.text.WriteString(text)
+	if len(logprobs) > 0 {
+		s.logprobs = append(s.logprobs, screenedLogprobs{end: s.text.Len(), logprobs: logprobs})
+	}
+
+	held := s.text.String()[s.released:]
+	cut := 0
+	for {
+		end := utils.SentenceEnd(held[cut:], 1, false)
+		if end < 0 {
+			break
+		}
+		cut += end
+	}
+	if cut == 0 {
+		return "", nil, nil
+	}
+	return s.release(s.released + cut)
+}
+
+// Flush screens the whole reply once it has ended and returns the rest of it
+func (s *replyScreen) Flush() (string, []models.TokenLogprob, *createError) {
+	if !s.enabled {
+		return "", nil, nil
+	}
+	if s.blocked != nil {
+		return "", nil, s.blocked
+	}
+	return s.release(s.text.Len())
+}
+
+// WriteLast is Write for the final text of the reply, followed by Flush
+func (s *replyScreen) WriteLast(text string, logprobs []models.TokenLogprob) (string, []models.TokenLogprob, *createError) {
+	out, outLogprobs, cerr := s.Write(text, logprobs)
+	if cerr != nil {
+		return "", nil, cerr
+	}
+	rest, restLogprobs, cerr := s.Flush()
+	if cerr != nil {
+		return "", nil, cerr
+	}
+	return out + rest, append(outLogprobs, restLogprobs...), nil
+}
+
+// release screens the reply up to end and, if it passes, returns the part of
+// it not yet let through with its log probabilities
+func (s *replyScreen) release(end int) (string, []models.TokenLogprob, *createError) {
+	text := s.text.String()
+	if cerr := moderate(s.ctx, moderation.Response, text[:end]); cerr != nil {
+		s.blocked = cerr
+		return "", nil, cerr
+	}
+
+	var logprobs []models.TokenLogprob
+	for len(s.logprobs) > 0 && s.logprobs[0].end <= end {
+		logprobs = append(logprobs, s.logprobs[0].logprobs...)
+		s.logprobs = s.logprobs[1:]
+	}
+	out := text[s.released:end]
+	s.released = end
+	return out, logprobs, nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// moderateWith turns on pattern moderation blocking "forbidden", of replies
+// too when responses is set, for the test
+func moderateWith(t *testing.T, responses bool) {
+	cfg := config.Get()
+	previous := cfg.Moderation
+	cfg.Moderation = config.Moderation{Mode: "patterns", Patterns: []string{"forbidden"}, Responses: responses}
+	t.Cleanup(func() { cfg.Moderation = previous })
+}
+
+func TestModerationBlocksPrompt(t *testing.T) {
+	fake := startFakeOllama(t, "Hello.")
+	moderateWith(t, false)
+
+	w := chat(NewChatHandler().SendMessage, `{"message":"tell me something forbidden"}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "CONTENT_BLOCKED") {
+		t.Errorf("blocked prompt: status %d %s, want 422 CONTENT_BLOCKED", w.Code, w.Body)
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("a blocked prompt was sent to the model")
+	}
+
+	if w := chat(NewChatHandler().SendMessage, `{"message":"tell me something nice"}`); w.Code != http.StatusOK {
+		t.Errorf("allowed prompt: status %d %s, want 200", w.Code, w.Body)
+	}
+}
+
+func TestModerationBlocksReply(t *testing.T) {
+	startFakeOllama(t, "This is ", "forbidden.")
+	moderateWith(t, true)
+
+	w := chat(NewChatHandler().SendMessage, `{"message":"hi"}`)
+	if w.Code != http.StatusUnprocessableEntity || strings.Contains(w.Body.String(), "This is") {
+		t.Errorf("blocked reply: status %d %s, want 422 without the reply", w.Code, w.Body)
+	}
+}
+
+func TestModerationAllowsReply(t *testing.T) {
+	startFakeOllama(t, "Nice ", "day. ", "Indeed.")
+	moderateWith(t, true)
+
+	w := chat(NewChatHandler().SendMessageStream, `{"message":"hi"}`)
+	events := sseEvents(w.Body.String())
+	var text string
+	for _, event := range events {
+		if data, ok := strings.CutPrefix(event, "data: "); ok {
+			text += data
+		}
+	}
+	if text != "Nice day. Indeed." || !strings.HasPrefix(events[len(events)-1], "complete: ") {
+		t.Errorf("events = %q, want the whole reply then complete", events)
+	}
+}
+
+func TestModerationScreensStreamBeforeSending(t *testing.T) {
+	startFakeOllama(t, "Fine ", "start. ", "Then ", "forbidden ", "words. ", "More.")
+	moderateWith(t, true)
+
+	events := sseEvents(chat(NewChatHandler().SendMessageStream, `{"message":"hi"}`).Body.String())
+	if len(events) != 2 || events[0] != "data: Fine start." || !strings.HasPrefix(events[1], "error: ") {
+		t.Errorf("SSE events = %q, want the first sentence and then an error", events)
+	}
+
+	chunks := ndjsonLines(t, chat(NewChatHandler().SendMessageStream, `{"message":"hi"}`, "Accept: application/x-ndjson").Body.String())
+	last := chunks[len(chunks)-1]
+	if !last.Done || last.Code != "CONTENT_BLOCKED" {
+		t.Errorf("final NDJSON chunk = %+v, want CONTENT_BLOCKED", last)
+	}
+	for _, chunk := range chunks {
+		if strings.Contains(chunk.Token, "forbidden") {
+			t.Errorf("blocked text was streamed: %q", chunk.Token)
+		}
+	}
+}
+
+func TestModerationScreensEvalAndWelcome(t *testing.T) {
+	startFakeOllama(t, "Something ", "forbidden.")
+	moderateWith(t, true)
+	ch := NewChatHandler()
+
+	result := ch.evalOne(context.Background(), "hi", models.EvalVariant{}, "ollama-llama2-container")
+	if result.Error == "" || result.Response != "" {
+		t.Errorf("eval result = %+v, want the reply blocked", result)
+	}
+
+	cfg := config.Get()
+	previous := cfg.Welcome
+	cfg.Welcome = config.Welcome{Prompt: "Greet the user"}
+	t.Cleanup(func() { cfg.Welcome = previous })
+	if welcome := ch.welcomeMessage(context.Background()); welcome != "" {
+		t.Errorf("welcome = %q, want a blocked greeting left out", welcome)
+	}
+}
+
+func TestModerationScreensCompare(t *testing.T) {
+	startFakeOllama(t, "Something ", "forbidden.")
+	moderateWith(t, true)
+
+	events := sseEvents(chat(NewChatHandler().CompareModels, `{"prompt":"hi","models":["llama2"]}`).Body.String())
+	var sawError bool
+	for _, event := range events {
+		if strings.HasPrefix(event, "token: ") && strings.Contains(event, "forbidden") {
+			t.Errorf("blocked text was streamed: %s", event)
+		}
+		if strings.HasPrefix(event, "error: ") {
+			var data struct{ Error string }
+			json.Unmarshal([]byte(strings.TrimPrefix(event, "error: ")), &data)
+			sawError = strings.Contains(data.Error, "blocked")
+		}
+	}
+	if !sawError {
+		t.Errorf("events = %q, want the model's reply blocked", events)
+	}
+}
+
+func TestReplyScreen(t *testing.T) {
+	moderateWith(t, true)
+	screen := newReplyScreen(context.Background())
+
+	text, logprobs, cerr := screen.Write("One", []models.TokenLogprob{{Token: "One"}})
+	if text != "" || cerr != nil {
+		t.Fatalf("Write before a sentence ended = %q, %v, want it held", text, cerr)
+	}
+	text, logprobs, cerr = screen.Write(". Two", []models.TokenLogprob{{Token: ". Two"}})
+	if text != "One." || len(logprobs) != 1 || logprobs[0].Token != "One" || cerr != nil {
+		t.Fatalf("Write after a sentence = %q %v, %v, want One. with its logprob", text, logprobs, cerr)
+	}
+	text, logprobs, cerr = screen.Flush()
+	if text != " Two" || len(logprobs) != 1 || cerr != nil {
+		t.Fatalf("Flush = %q %v, %v, want the rest", text, logprobs, cerr)
+	}
+
+	screen = newReplyScreen(context.Background())
+	if _, _, cerr := screen.WriteLast("All forbidden.", nil); cerr == nil || cerr.code != "CONTENT_BLOCKED" {
+		t.Errorf("WriteLast of blocked text = %v, want CONTENT_BLOCKED", cerr)
+	}
+	if _, _, cerr := screen.Write(" More.", nil); cerr == nil {
+		t.Error("Write after a block succeeded")
+	}
+
+	moderateWith(t, false)
+	screen = newReplyScreen(context.Background())
+	if text, _, _ := screen.Write("forbidden", nil); text != "forbidden" {
+		t.Errorf("Write without response moderation = %q, want it passed through", text)
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+func TestChatNumCtx(t *testing.T) {
+	fake := startFakeOllama(t, "Hello")
+	cfg := config.Get()
+	previous := cfg.NumCtx
+	cfg.NumCtx = 8192
+	t.Cleanup(func() { cfg.NumCtx = previous })
+
+	var resp models.ChatResponse
+	json.Unmarshal(chat(NewChatHandler().SendMessage, `{"message":"hi"}`).Body.Bytes(), &resp)
+	if resp.NumCtx != 8192 {
+		t.Errorf("reply num_ctx = %d, want OWNGPT_NUM_CTX", resp.NumCtx)
+	}
+	chunks := ndjsonLines(t, chat(NewChatHandler().SendMessageStream, `{"message":"hi"}`, "Accept: application/x-ndjson").Body.String())
+	if final := chunks[len(chunks)-1]; final.NumCtx != 8192 {
+		t.Errorf("final chunk num_ctx = %d, want OWNGPT_NUM_CTX", final.NumCtx)
+	}
+
+	for i, generation := range fake.generations() {
+		options, _ := generation["options"].(map[string]interface{})
+		if options["num_ctx"] != float64(8192) {
+			t.Errorf("generation %d ran with num_ctx %v, want 8192", i+1, options["num_ctx"])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+func TestSendMessageNegotiatesPlainText(t *testing.T) {
+	startFakeOllama(t, "Hello", " there.")
+
+	tests := []struct {
+		accept string
+		plain  bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"*/*", false},
+		{"text/plain", true},
+		{"text/plain, application/json;q=0.5", true},
+		{"application/json, text/plain;q=0.5", false},
+	}
+	for _, tt := range tests {
+		var headers []string
+		if tt.accept != "" {
+			headers = append(headers, "Accept: "+tt.accept)
+		}
+		w := chat(NewChatHandler().SendMessage, `{"message":"hi"}`, headers...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status %d: %s", tt.accept, w.Code, w.Body)
+		}
+
+		contentType := w.Header().Get("Content-Type")
+		if tt.plain {
+			if !strings.HasPrefix(contentType, "text/plain") || w.Body.String() != "Hello there." {
+				t.Errorf("Accept %q: got %s %q, want the bare reply", tt.accept, contentType, w.Body)
+			}
+			continue
+		}
+		var resp models.ChatResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Response != "Hello there." {
+			t.Errorf("Accept %q: got %s %q, want a JSON reply", tt.accept, contentType, w.Body)
+		}
+	}
+}
+
+func TestSendMessagePlainTextError(t *testing.T) {
+	startFakeOllama(t, "Hello")
+	// Nothing listens here, so the generation fails; startFakeOllama restores it
+	config.Get().OllamaURL = "http://127.0.0.1:1"
+
+	w := chat(NewChatHandler().SendMessage, `{"message":"hi"}`, "Accept: text/plain")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") || !strings.HasPrefix(w.Body.String(), "Failed to get response from model") {
+		t.Errorf("got %s %q, want a plain-text error", w.Header().Get("Content-Type"), w.Body)
+	}
+}
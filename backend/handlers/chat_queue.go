@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/models"
+	"owngpt/services"
+)
+
+// waitForChatSlot holds the chat until its model has a free slot under
+// OWNGPT_CHAT_CONCURRENCY. Chats beyond the queue's capacity get 503
+// CHAT_QUEUE_FULL and chats removed with DELETE /queue/:id get 503
+// CHAT_DEQUEUED. It returns false when the chat can't go ahead.
+func (ch *ChatHandler) waitForChatSlot(c *gin.Context, req models.ChatRequest, containerName string) (release func(), ok bool) {
+	release, err := services.AcquireChat(c.Request.Context(), containerName, req.SessionID)
+	switch {
+	case err == nil:
+		return release, true
+	case errors.Is(err, services.ErrChatQueueFull):
+		c.Header("Retry-After", "1")
+		respondErrorCode(c, http.StatusServiceUnavailable, "CHAT_QUEUE_FULL", err.Error())
+	case errors.Is(err, services.ErrChatDequeued):
+		respondErrorCode(c, http.StatusServiceUnavailable, "CHAT_DEQUEUED", err.Error())
+	}
+	// Otherwise the client went away while waiting and there is no one to answer
+	return nil, false
+}
+
+// ListQueue returns the chats waiting for a free slot on their model
+func (ch *ChatHandler) ListQueue(c *gin.Context) {
+	respond(c, http.StatusOK, gin.H{"queued": services.QueuedChats()})
+}
+
+// CancelQueued removes a waiting chat from its model's queue. Chats that have
+// already started are not affected and give 404.
+func (ch *ChatHandler) CancelQueued(c *gin.Context) {
+	id := c.Param("id")
+	if !services.CancelQueuedChat(id) {
+		respondErrorCode(c, http.StatusNotFound, "NOT_QUEUED", fmt.Sprintf("No chat with ID %s is waiting in the queue", id))
+		return
+	}
+	log.Printf("Removed queued chat %s", id)
+	respond(c, http.StatusOK, gin.H{"cancelled": id})
+}
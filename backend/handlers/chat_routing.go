@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/lifecycle"
+	"owngpt/middleware"
+	"owngpt/models"
+	"owngpt/services"
+	"owngpt/sessions"
+	"owngpt/utils"
+)
+
+// chatModel returns the container a chat goes to, once it is ready to answer.
+// A model still starting gets 503 MODEL_LOADING, see modelReady.
+func (ch *ChatHandler) chatModel(c *gin.Context, req models.ChatRequest) (string, bool) {
+	containerName, ok := ch.routeModel(c, req)
+	return containerName, ok && modelReady(c, containerName)
+}
+
+// routeModel picks the container for a chat. With OWNGPT_ROUTE_BY_CONTEXT set
+// the candidates are the running models with the smallest context window the
+// prompt fits in. With OWNGPT_LOAD_BALANCE set it is picked among the
+// candidates, or every running model, by weight and load. The choice is named
+// in the X-Model-Routed and X-Model-Route headers. Otherwise, or when no model
+// fits the prompt or has a positive weight, it is the current model.
+func (ch *ChatHandler) routeModel(c *gin.Context, req models.ChatRequest) (string, bool) {
+	cfg := config.Get()
+	if !cfg.LoadBalance && !cfg.RouteByContext {
+		return ch.runningModel(c, true)
+	}
+
+	installed, err := ch.dockerService.GetInstalledModels()
+	if err != nil {
+		log.Printf("Failed to list installed models, not routing: %v", err)
+		return ch.runningModel(c, true)
+	}
+	running := []string{}
+	for _, model := range installed {
+		// Models still starting can't answer yet
+		if _, loading := services.ModelLoading(model.ContainerName); model.IsRunning && !loading {
+			running = append(running, model.ContainerName)
+		}
+	}
+
+	if cfg.RouteByContext {
+		tokens := promptTokens(req)
+		fits, numCtx := services.FitContext(running, req, tokens)
+		if len(fits) == 0 {
+			log.Printf("A prompt of about %d tokens fits no running model's context window, using the current model", tokens)
+			return ch.runningModel(c, true)
+		}
+		if !cfg.LoadBalance {
+			containerName := fits[0]
+			// The current model is kept when it is as good a fit as any
+			if current, ok := currentContainer(); ok {
+				for _, fit := range fits {
+					if fit == current {
+						containerName = current
+					}
+				}
+			}
+			model := services.ModelForContainer(containerName)
+			c.Header("X-Model-Routed", model)
+			c.Header("X-Model-Route", fmt.Sprintf("num_ctx=%d; prompt_tokens=%d; candidates=%d", numCtx, tokens, len(fits)))
+			middleware.SetModel(c, model)
+			return containerName, true
+		}
+		running = fits
+	}
+
+	route, release, ok := services.RouteChat(running)
+	if !ok {
+		return ch.runningModel(c, true)
+	}
+	// The request's context ends once the handler has returned, streams included
+	lifecycle.Go("route release", c.Request.Context(), func(ctx context.Context) {
+		<-ctx.Done()
+		release()
+	})
+
+	c.Header("X-Model-Routed", route.Model)
+	c.Header("X-Model-Route", fmt.Sprintf("weight=%d; in_flight=%d; candidates=%d", route.Weight, route.InFlight, route.Candidates))
+	middleware.SetModel(c, route.Model)
+	return route.ContainerName, true
+}
+
+// promptTokens estimates the tokens a chat's prompt takes, with the history
+// of the session it continues
+func promptTokens(req models.ChatRequest) int {
+	tokens := utils.EstimateMessageTokens(req.Message)
+	if req.SessionID != "" {
+		history, _ := sessions.History(req.SessionID)
+		for _, message := range history {
+			tokens += utils.EstimateMessageTokens(message.Content)
+		}
+	}
+	return tokens
+}
+
+// modelReady responds 503 MODEL_LOADING and returns false while the model is
+// still starting, with a Retry-After header from its observed startup times,
+// so clients retry shortly instead of treating the chat as failed. A model
+// that failed to start isn't loading, and its chats fail as before.
+func modelReady(c *gin.Context, containerName string) bool {
+	status, loading := services.ModelLoading(containerName)
+	if !loading {
+		return true
+	}
+	retryAfter := int(math.Ceil(status.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	respondErrorData(c, http.StatusServiceUnavailable, "MODEL_LOADING",
+		fmt.Sprintf("Model %s is still starting (%s), retry in %ds", services.ModelForContainer(containerName), status.Status, retryAfter),
+		gin.H{"status": status.Status, "elapsed_seconds": math.Round(status.Elapsed.Seconds()), "retry_after": retryAfter})
+	return false
+}
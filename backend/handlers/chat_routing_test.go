@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+// setContextWindows gives each model a num_ctx for the test
+func setContextWindows(t *testing.T, windows map[string]int) {
+	for model, numCtx := range windows {
+		model, numCtx := model, numCtx
+		registry.Update(model, func(record *models.ModelRecord) { record.Config.NumCtx = numCtx })
+		t.Cleanup(func() { registry.Delete(model) })
+	}
+}
+
+func TestRouteByContext(t *testing.T) {
+	fake := startFakeOllama(t, "Hi.")
+	fake.installed = []string{"llama2:latest", "tiny:latest"}
+	setContextWindows(t, map[string]int{"llama2": 8192, "tiny": 512})
+	cfg := config.Get()
+	routeByContext := cfg.RouteByContext
+	cfg.RouteByContext = true
+	t.Cleanup(func() { cfg.RouteByContext = routeByContext })
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"small prompt goes to the fast model", "hi", "tiny"},
+		{"large prompt goes to the large context model", strings.Repeat("word ", 1000), "llama2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"message": tt.message})
+			w := chat(NewChatHandler().SendMessage, string(body))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if routed := w.Header().Get("X-Model-Routed"); routed != tt.want {
+				t.Errorf("X-Model-Routed = %q, want %q", routed, tt.want)
+			}
+			generations := fake.generations()
+			if model := generations[len(generations)-1]["model"]; model != tt.want {
+				t.Errorf("generated with %v, want %s", model, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountTokensUsesCurrentModelWindow(t *testing.T) {
+	startFakeOllama(t)
+	setContextWindows(t, map[string]int{"llama2": 8192})
+
+	w := chat(NewChatHandler().CountTokens, `{"prompt":"hello there"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var count models.TokenCount
+	json.Unmarshal(w.Body.Bytes(), &count)
+	if count.NumCtx != 8192 || count.Remaining != 8192-count.Tokens {
+		t.Errorf("count = %+v, want the current model's num_ctx of 8192", count)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/sessions"
+)
+
+func TestChatContinuesSession(t *testing.T) {
+	fake := startFakeOllama(t, "Nice to meet you.")
+	welcomeWith(t, "")
+	_, session := createSession(context.Background())
+
+	for _, message := range []string{"I'm Ada", "What's my name?"} {
+		body, _ := json.Marshal(map[string]string{"message": message, "session_id": session.ID})
+		if w := chat(NewChatHandler().SendMessage, string(body)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+	}
+
+	// The second chat sent the first turn along with the new message
+	generations := fake.generations()
+	if len(generations) != 2 {
+		t.Fatalf("%d generations, want 2", len(generations))
+	}
+	messages, _ := generations[1]["messages"].([]interface{})
+	var contents []string
+	for _, message := range messages {
+		if m, ok := message.(map[string]interface{}); ok && m["role"] != "system" {
+			contents = append(contents, m["content"].(string))
+		}
+	}
+	want := []string{"I'm Ada", "Nice to meet you.", "What's my name?"}
+	if len(contents) != len(want) || contents[0] != want[0] || contents[1] != want[1] || contents[2] != want[2] {
+		t.Errorf("sent %q, want %q", contents, want)
+	}
+
+	history, _ := sessions.History(session.ID)
+	if len(history) != 4 {
+		t.Errorf("history has %d messages, want both turns", len(history))
+	}
+}
+
+func TestChatUnknownSession(t *testing.T) {
+	fake := startFakeOllama(t, "Hi")
+	w := chat(NewChatHandler().SendMessage, `{"message":"hi","session_id":"missing"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d: %s, want 404", w.Code, w.Body)
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("a chat in an unknown session was generated")
+	}
+}
+
+func TestChatTrimsSessionHistory(t *testing.T) {
+	fake := startFakeOllama(t, "ok")
+	welcomeWith(t, "")
+	cfg := config.Get()
+	budget, summarize := cfg.HistoryTokenBudget, cfg.SummarizeHistory
+	// Every message counts as 5 tokens, so the new message and two more fit
+	cfg.HistoryTokenBudget, cfg.SummarizeHistory = 15, false
+	t.Cleanup(func() { cfg.HistoryTokenBudget, cfg.SummarizeHistory = budget, summarize })
+	_, session := createSession(context.Background())
+
+	var w *httptest.ResponseRecorder
+	for _, message := range []string{"q1", "q2", "q3"} {
+		body, _ := json.Marshal(map[string]string{"message": message, "session_id": session.ID})
+		if w = chat(NewChatHandler().SendMessage, string(body)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+	}
+
+	if got := w.Header().Get("X-History-Trimmed"); got != "1" {
+		t.Errorf("X-History-Trimmed = %q, want 1", got)
+	}
+	var resp models.ChatResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.HistoryTrimmed != 1 {
+		t.Errorf("history_trimmed = %d, want 1", resp.HistoryTrimmed)
+	}
+
+	generations := fake.generations()
+	messages, _ := generations[len(generations)-1]["messages"].([]interface{})
+	var contents []string
+	for _, message := range messages {
+		contents = append(contents, message.(map[string]interface{})["content"].(string))
+	}
+	if want := []string{"q2", "ok", "q3"}; !reflect.DeepEqual(contents, want) {
+		t.Errorf("sent %q, want %q", contents, want)
+	}
+
+	// The session itself keeps every turn
+	if history, _ := sessions.History(session.ID); len(history) != 6 {
+		t.Errorf("history has %d messages, want all 3 turns", len(history))
+	}
+}
+
+func TestChatSessionBusy(t *testing.T) {
+	fake := startFakeOllama(t, "Hi")
+	welcomeWith(t, "")
+	_, session := createSession(context.Background())
+	body := `{"message":"hi","session_id":"` + session.ID + `"}`
+
+	// Another chat is answering in the session
+	end, err := sessions.Begin(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, handler := range []gin.HandlerFunc{NewChatHandler().SendMessage, NewChatHandler().SendMessageStream} {
+		w := chat(handler, body)
+		if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "SESSION_BUSY") {
+			t.Errorf("status = %d: %s, want 409 SESSION_BUSY", w.Code, w.Body)
+		}
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("a chat in a busy session was generated")
+	}
+	end()
+
+	// Each chat frees the session for the next once it has answered
+	for i := 0; i < 2; i++ {
+		if w := chat(NewChatHandler().SendMessage, body); w.Code != http.StatusOK {
+			t.Fatalf("chat %d: status = %d: %s", i, w.Code, w.Body)
+		}
+	}
+	chat(NewChatHandler().SendMessageStream, body)
+	if w := chat(NewChatHandler().SendMessage, body); w.Code != http.StatusOK {
+		t.Errorf("chat after a stream: status = %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/models"
+)
+
+func TestSendMessageStreamField(t *testing.T) {
+	startFakeOllama(t, "Hello", " there.")
+
+	// /chat streams like /chat/stream when asked to
+	w := chat(NewChatHandler().SendMessage, `{"message":"hi","stream":true}`)
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want an event stream", got)
+	}
+	text, complete := streamReply(t, w.Body.String())
+	if text != "Hello there." || complete.FinishReason != models.FinishEnd {
+		t.Errorf("streamed %q ending %+v", text, complete)
+	}
+
+	lines := ndjsonLines(t, chat(NewChatHandler().SendMessage, `{"message":"hi","stream":true}`, "Accept: application/x-ndjson").Body.String())
+	if len(lines) != 3 || lines[0].Token != "Hello" || !lines[2].Done {
+		t.Errorf("NDJSON lines = %+v, want two tokens and done", lines)
+	}
+
+	// Without it the reply comes whole
+	w = chat(NewChatHandler().SendMessage, `{"message":"hi","stream":false}`)
+	var resp models.ChatResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Response != "Hello there." {
+		t.Errorf("status %d: %s, want the whole reply", w.Code, w.Body)
+	}
+
+	// /chat/stream streams whatever stream is set to
+	if text, _ := streamReply(t, chat(NewChatHandler().SendMessageStream, `{"message":"hi","stream":false}`).Body.String()); text != "Hello there." {
+		t.Errorf("/chat/stream with stream false sent %q", text)
+	}
+}
+
+func TestSendMessageStreamFieldTools(t *testing.T) {
+	fake := startFakeOllama(t, "Hi")
+	body := `{"message":"time?","stream":true,"tools":[{"type":"function","function":{"name":"time","description":"Current time","parameters":{"type":"object"}}}]}`
+	w := chat(NewChatHandler().SendMessage, body)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "not supported on streaming requests") {
+		t.Errorf("status %d: %s, want 400 for tools on a stream", w.Code, w.Body)
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("a streamed chat with tools was generated")
+	}
+}
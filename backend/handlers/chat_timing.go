@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/metrics"
+	"owngpt/middleware"
+	"owngpt/models"
+	"owngpt/services"
+)
+
+// Latency buckets in seconds, around the sub-6s response target
+var chatLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 4, 6, 10, 20, 60}
+
+var (
+	firstTokenLatency = metrics.NewHistogram(
+		"owngpt_chat_time_to_first_token_seconds",
+		"Time from receiving a streamed chat to sending its first token",
+		chatLatencyBuckets,
+		"model",
+	)
+	chatLatency = metrics.NewHistogram(
+		"owngpt_chat_duration_seconds",
+		"Time from receiving a chat to sending its complete answer",
+		chatLatencyBuckets,
+		"model", "stream",
+	)
+)
+
+// chatTimer measures a chat from when the handler received it
+type chatTimer struct {
+	received time.Time
+	model    string
+	// firstToken is the time to the first token, 0 until one was sent
+	firstToken time.Duration
+}
+
+func newChatTimer(containerName string) *chatTimer {
+	return &chatTimer{received: time.Now(), model: services.ModelForContainer(containerName)}
+}
+
+// tokenSent records that a streamed chat sent a token, timing the first one
+func (t *chatTimer) tokenSent(c *gin.Context) {
+	middleware.MarkFirstToken(c)
+	if t.firstToken == 0 {
+		t.firstToken = time.Since(t.received)
+		firstTokenLatency.Observe(t.firstToken.Seconds(), t.model)
+	}
+}
+
+// streamDone records a completed stream and returns a copy of its stats with
+// the time to first token added. Requests sharing a generation share its
+// stats, so they aren't changed in place.
+func (t *chatTimer) streamDone(stats *models.GenerationStats) *models.GenerationStats {
+	chatLatency.Observe(time.Since(t.received).Seconds(), t.model, "true")
+	timed := models.GenerationStats{}
+	if stats != nil {
+		timed = *stats
+	}
+	timed.TimeToFirstToken = t.firstToken.Nanoseconds()
+	return &timed
+}
+
+// answered records a completed non-streamed chat, reporting its total time
+// in the Server-Timing header, and returns that time in milliseconds
+func (t *chatTimer) answered(c *gin.Context) float64 {
+	total := time.Since(t.received)
+	chatLatency.Observe(total.Seconds(), t.model, "false")
+	ms := float64(total) / float64(time.Millisecond)
+	c.Header("Server-Timing", fmt.Sprintf("total;dur=%.1f", ms))
+	return ms
+}
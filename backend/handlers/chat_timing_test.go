@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/metrics"
+	"owngpt/models"
+)
+
+func TestChatTiming(t *testing.T) {
+	startFakeOllama(t, "Hello", " there.")
+	ch := NewChatHandler()
+
+	w := chat(ch.SendMessage, `{"message":"hi"}`)
+	var resp models.ChatResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.TotalMs <= 0 {
+		t.Errorf("total_ms = %v, want the time taken", resp.TotalMs)
+	}
+	if timing := w.Header().Get("Server-Timing"); !strings.HasPrefix(timing, "total;dur=") {
+		t.Errorf("Server-Timing = %q, want the total", timing)
+	}
+
+	chunks := ndjsonLines(t, chat(ch.SendMessageStream, `{"message":"hi"}`, "Accept: application/x-ndjson").Body.String())
+	final := chunks[len(chunks)-1]
+	if !final.Done || final.Stats == nil || final.Stats.TimeToFirstToken <= 0 {
+		t.Errorf("final chunk = %+v, want the time to first token in its stats", final)
+	}
+
+	exported := serve(http.MethodGet, "/metrics", "/metrics", "", metrics.Handler).Body.String()
+	for _, series := range []string{
+		`owngpt_chat_time_to_first_token_seconds_count{model="llama2"}`,
+		`owngpt_chat_duration_seconds_count{model="llama2",stream="false"}`,
+		`owngpt_chat_duration_seconds_count{model="llama2",stream="true"}`,
+	} {
+		if !strings.Contains(exported, series) {
+			t.Errorf("/metrics is missing %s", series)
+		}
+	}
+}
+
+func TestStreamDoneCopiesStats(t *testing.T) {
+	shared := &models.GenerationStats{EvalCount: 3}
+	timer := &chatTimer{model: "llama2", firstToken: 42}
+	timed := timer.streamDone(shared)
+	if timed == shared || shared.TimeToFirstToken != 0 {
+		t.Errorf("streamDone changed the shared stats to %+v", shared)
+	}
+	if timed.EvalCount != 3 || timed.TimeToFirstToken != 42 {
+		t.Errorf("timed stats = %+v, want the eval count and time to first token", timed)
+	}
+	if timed := timer.streamDone(nil); timed == nil || timed.TimeToFirstToken != 42 {
+		t.Errorf("streamDone(nil) = %+v", timed)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/models"
+)
+
+const weatherTool = `{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}`
+
+func TestChatToolCalls(t *testing.T) {
+	fake := startFakeOllama(t)
+	fake.toolCalls = []models.ToolCall{{Function: models.ToolCallFunction{Name: "get_weather", Arguments: map[string]interface{}{"city": "Paris"}}}}
+
+	w := chat(NewChatHandler().SendMessage, `{"message":"weather in Paris?","tools":[`+weatherTool+`]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp models.ChatResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !reflect.DeepEqual(resp.ToolCalls, fake.toolCalls) {
+		t.Errorf("tool calls = %+v, want %+v", resp.ToolCalls, fake.toolCalls)
+	}
+
+	// The tools went to Ollama's chat API as given
+	generations := fake.generations()
+	if len(generations) != 1 {
+		t.Fatalf("%d generations, want 1", len(generations))
+	}
+	sent, _ := json.Marshal(generations[0]["tools"])
+	var want interface{}
+	json.Unmarshal([]byte(`[`+weatherTool+`]`), &want)
+	wantJSON, _ := json.Marshal(want)
+	if string(sent) != string(wantJSON) {
+		t.Errorf("sent tools %s, want %s", sent, wantJSON)
+	}
+}
+
+func TestChatToolsRejected(t *testing.T) {
+	fake := startFakeOllama(t, "Hi")
+	ch := NewChatHandler()
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		tools   string
+		message string
+	}{
+		{"wrong type", ch.SendMessage, `{"type":"retrieval"}`, "tool 1 must have type"},
+		{"no name", ch.SendMessage, `{"type":"function","function":{}}`, "tool 1 is missing function.name"},
+		{"bad parameters", ch.SendMessage, `{"type":"function","function":{"name":"f","parameters":[1]}}`, "function.parameters must be a JSON schema object"},
+		{"not an object", ch.SendMessage, `"get_weather"`, "tool 1 is not a valid JSON object"},
+		{"streaming", ch.SendMessageStream, weatherTool, "Tools are not supported on streaming requests"},
+	}
+	for _, tt := range tests {
+		w := chat(tt.handler, `{"message":"hi","tools":[`+tt.tools+`]}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.message) {
+			t.Errorf("%s: status %d: %s, want 400 with %q", tt.name, w.Code, w.Body, tt.message)
+		}
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("a rejected request was generated")
+	}
+}
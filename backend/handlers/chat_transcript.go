@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/sessions"
+	"owngpt/utils"
+)
+
+// ExportSession returns a session's whole conversation as a transcript, which
+// ImportSession can resume later or on another server
+func (ch *ChatHandler) ExportSession(c *gin.Context) {
+	id := c.Param("id")
+	transcript, ok := sessions.Export(id)
+	if !ok {
+		respondErrorCode(c, http.StatusNotFound, "SESSION_NOT_FOUND", fmt.Sprintf("Session %s does not exist or has expired", id))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="session-%s.json"`, id))
+	respond(c, http.StatusOK, transcript)
+}
+
+// ImportSession starts a new session from a transcript, keeping its last
+// OWNGPT_SESSION_MAX_TURNS turns. The transcript's session ID and times are
+// ignored; the new session gets its own.
+func (ch *ChatHandler) ImportSession(c *gin.Context) {
+	var req models.ChatTranscript
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateTranscript(req.Messages); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, "INVALID_TRANSCRIPT", err.Error())
+		return
+	}
+
+	messages, trimmed := utils.KeepTurns(req.Messages, config.Get().SessionMaxTurns)
+	session := sessions.Create(messages...)
+	if trimmed > 0 {
+		log.Printf("Dropped the oldest %d turns of the transcript imported as session %s", trimmed, session.ID)
+		session.TrimmedTurns = trimmed
+	}
+	respond(c, http.StatusCreated, session)
+}
+
+// validateTranscript checks an imported conversation is one a session could
+// have held: known roles, images only from the user, tool calls only from the
+// assistant and tool results only after them, and no empty messages
+func validateTranscript(messages []models.OllamaChatMessage) error {
+	for i, message := range messages {
+		n := i + 1
+		switch message.Role {
+		case "system", "user", "assistant", "tool":
+		default:
+			return fmt.Errorf("message %d has role %q, expected system, user, assistant or tool", n, message.Role)
+		}
+		if len(message.Images) > 0 && message.Role != "user" {
+			return fmt.Errorf("message %d is from the %s, only user messages may have images", n, message.Role)
+		}
+		if len(message.ToolCalls) > 0 && message.Role != "assistant" {
+			return fmt.Errorf("message %d is from the %s, only assistant messages may have tool calls", n, message.Role)
+		}
+		if message.Role == "tool" && (i == 0 || !(len(messages[i-1].ToolCalls) > 0 || messages[i-1].Role == "tool")) {
+			return fmt.Errorf("message %d is a tool result that doesn't follow an assistant message with tool calls", n)
+		}
+		if message.Content == "" && len(message.Images) == 0 && len(message.ToolCalls) == 0 {
+			return fmt.Errorf("message %d is empty", n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/sessions"
+)
+
+func TestSessionTranscriptRoundTrip(t *testing.T) {
+	startFakeOllama(t, "Nice to meet you.")
+	welcomeWith(t, "")
+	ch := NewChatHandler()
+	_, session := createSession(context.Background())
+	chat(ch.SendMessage, `{"message":"I'm Ada","session_id":"`+session.ID+`"}`)
+
+	w := serve(http.MethodGet, "/chat/session/:id/export", "/chat/session/"+session.ID+"/export", "", ch.ExportSession)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="session-`+session.ID+`.json"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	exported := w.Body.String()
+
+	w = serve(http.MethodPost, "/chat/sessions/import", "/chat/sessions/import", exported, ch.ImportSession)
+	var imported models.ChatSession
+	json.Unmarshal(w.Body.Bytes(), &imported)
+	if w.Code != http.StatusCreated || imported.ID == "" || imported.ID == session.ID || imported.Turns != 1 || imported.TrimmedTurns != 0 {
+		t.Fatalf("import: status %d: %s, want a new session with the turn", w.Code, w.Body)
+	}
+	original, _ := sessions.History(session.ID)
+	if history, _ := sessions.History(imported.ID); !reflect.DeepEqual(history, original) {
+		t.Errorf("imported %v, want %v", history, original)
+	}
+
+	w = serve(http.MethodGet, "/chat/session/:id/export", "/chat/session/missing/export", "", ch.ExportSession)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "SESSION_NOT_FOUND") {
+		t.Errorf("unknown session: status %d: %s, want 404 SESSION_NOT_FOUND", w.Code, w.Body)
+	}
+}
+
+func TestImportSessionKeepsLastTurns(t *testing.T) {
+	cfg := config.Get()
+	maxTurns := cfg.SessionMaxTurns
+	cfg.SessionMaxTurns = 1
+	t.Cleanup(func() { cfg.SessionMaxTurns = maxTurns })
+
+	body := `{"messages":[{"role":"system","content":"rule"},{"role":"user","content":"q1"},{"role":"assistant","content":"a1"},{"role":"user","content":"q2"},{"role":"assistant","content":"a2"}]}`
+	w := serve(http.MethodPost, "/chat/sessions/import", "/chat/sessions/import", body, NewChatHandler().ImportSession)
+	var imported models.ChatSession
+	json.Unmarshal(w.Body.Bytes(), &imported)
+	if w.Code != http.StatusCreated || imported.TrimmedTurns != 1 {
+		t.Fatalf("status %d: %s, want one turn dropped", w.Code, w.Body)
+	}
+	history, _ := sessions.History(imported.ID)
+	var contents []string
+	for _, message := range history {
+		contents = append(contents, message.Content)
+	}
+	if want := []string{"rule", "q2", "a2"}; !reflect.DeepEqual(contents, want) {
+		t.Errorf("kept %q, want %q", contents, want)
+	}
+}
+
+func TestImportSessionInvalid(t *testing.T) {
+	call := `{"role":"assistant","content":"","tool_calls":[{"function":{"name":"time","arguments":{}}}]}`
+	tests := map[string]string{
+		"unknown role":      `[{"role":"narrator","content":"once"}]`,
+		"assistant image":   `[{"role":"assistant","content":"look","images":["aGk="]}]`,
+		"user tool call":    `[{"role":"user","content":"","tool_calls":[{"function":{"name":"time","arguments":{}}}]}]`,
+		"stray tool result": `[{"role":"user","content":"hi"},{"role":"tool","content":"12:00"}]`,
+		"empty message":     `[{"role":"user","content":""}]`,
+	}
+	for name, messages := range tests {
+		w := serve(http.MethodPost, "/chat/sessions/import", "/chat/sessions/import", `{"messages":`+messages+`}`, NewChatHandler().ImportSession)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "INVALID_TRANSCRIPT") {
+			t.Errorf("%s: status %d: %s, want 400 INVALID_TRANSCRIPT", name, w.Code, w.Body)
+		}
+	}
+
+	for _, body := range []string{`{}`, `{"messages":[]}`} {
+		if w := serve(http.MethodPost, "/chat/sessions/import", "/chat/sessions/import", body, NewChatHandler().ImportSession); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+
+	// Tool results may follow the call and each other
+	valid := `{"messages":[{"role":"user","content":"time?"},` + call + `,{"role":"tool","content":"12:00"},{"role":"tool","content":"UTC"},{"role":"assistant","content":"Noon."}]}`
+	if w := serve(http.MethodPost, "/chat/sessions/import", "/chat/sessions/import", valid, NewChatHandler().ImportSession); w.Code != http.StatusCreated {
+		t.Errorf("tool results: status %d: %s, want 201", w.Code, w.Body)
+	}
+}
@@ -5,7 +5,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"owngpt/config"
+	"owngpt/lifecycle"
 	"owngpt/models"
+	"owngpt/selfcheck"
+	"owngpt/services"
 )
 
 type HealthHandler struct{}
@@ -19,9 +23,75 @@ func (hh *HealthHandler) CheckHealth(c *gin.Context) {
 	models.ModelMutex.RLock()
 	defer models.ModelMutex.RUnlock()
 
+	modelName := ""
+	if models.CurrentModel.Name != "" {
+		modelName = services.ModelForContainer(models.CurrentModel.Name)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":        "healthy",
 		"model_running": models.CurrentModel.IsRunning,
 		"model_name":    models.CurrentModel.Name,
+		"model":         modelName,
+	})
+}
+
+// CheckReady returns the startup self-check result, with 503 if a check
+// failed, along with the status of the background tasks
+func (hh *HealthHandler) CheckReady(c *gin.Context) {
+	result := selfcheck.Last()
+	result.BackgroundTasks = lifecycle.Tasks()
+	status := http.StatusOK
+	if !result.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, result)
+}
+
+// GetVersion reports the Ollama image version model containers are built from
+func (hh *HealthHandler) GetVersion(c *gin.Context) {
+	cfg := config.Get()
+	c.JSON(http.StatusOK, gin.H{
+		"ollama_version": cfg.OllamaVersion,
+		"ollama_image":   services.BaseImage(),
+	})
+}
+
+// GetCapabilities reports which features this server has enabled and their
+// limits, so clients can adapt before authenticating
+func (hh *HealthHandler) GetCapabilities(c *gin.Context) {
+	cfg := config.Get()
+	c.JSON(http.StatusOK, gin.H{
+		"features": gin.H{
+			"streaming":           true,
+			"stream_formats":      []string{"sse", "ndjson"},
+			"tools":               true,
+			"multimodal":          cfg.MaxImages > 0,
+			"sessions":            true,
+			"token_counting":      true,
+			"admin":               cfg.AdminToken != "" && !cfg.ReadOnly,
+			"read_only":           cfg.ReadOnly,
+			"model_verification":  cfg.VerifyModels,
+			"external_containers": cfg.DiscoverExternal && cfg.Mode != "local",
+		},
+		"mode": cfg.Mode,
+		"limits": gin.H{
+			"num_ctx":               currentContextWindow(),
+			"max_images":            cfg.MaxImages,
+			"max_image_bytes":       cfg.MaxImageBytes,
+			"session_ttl":           cfg.SessionTTL.String(),
+			"generation_timeout":    cfg.GenerationTimeout.String(),
+			"max_concurrent_builds": cfg.MaxConcurrentBuilds,
+		},
+		"defaults": gin.H{
+			"num_predict":    cfg.Sampling.NumPredict,
+			"temperature":    cfg.Sampling.Temperature,
+			"top_p":          cfg.Sampling.TopP,
+			"top_k":          cfg.Sampling.TopK,
+			"repeat_penalty": cfg.Sampling.RepeatPenalty,
+			"tfs_z":          cfg.Sampling.TfsZ,
+		},
+		"model_policy":   cfg.ModelPolicy,
+		"ollama_version": cfg.OllamaVersion,
 	})
 }
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"owngpt/config"
+	"owngpt/lifecycle"
+	"owngpt/models"
+)
+
+func TestGetVersion(t *testing.T) {
+	cfg := config.Get()
+	previousVersion, previousImage := cfg.OllamaVersion, cfg.BaseImage
+	cfg.OllamaVersion, cfg.BaseImage = "0.1.32", "mirror.local/ollama"
+	t.Cleanup(func() { cfg.OllamaVersion, cfg.BaseImage = previousVersion, previousImage })
+
+	w := serve(http.MethodGet, "/version", "/version", "", NewHealthHandler().GetVersion)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	var body struct {
+		OllamaVersion string `json:"ollama_version"`
+		OllamaImage   string `json:"ollama_image"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	if body.OllamaVersion != "0.1.32" || body.OllamaImage != "mirror.local/ollama:0.1.32" {
+		t.Errorf("/version = %+v, want the pinned mirror image", body)
+	}
+}
+
+func TestCheckReadyListsBackgroundTasks(t *testing.T) {
+	lifecycle.Every("ready_test_task", time.Hour, func(context.Context) error { return nil })
+
+	w := serve(http.MethodGet, "/health/ready", "/health/ready", "", NewHealthHandler().CheckReady)
+	var body models.SelfCheckResult
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	for _, task := range body.BackgroundTasks {
+		if task.Name == "ready_test_task" {
+			if task.IntervalSeconds != 3600 || task.Runs != 0 || task.Stale {
+				t.Errorf("task = %+v, want a fresh hourly task", task)
+			}
+			return
+		}
+	}
+	t.Errorf("background_tasks = %+v, want ready_test_task listed", body.BackgroundTasks)
+}
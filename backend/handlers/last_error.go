@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/models"
+	"owngpt/registry"
+	"owngpt/services"
+)
+
+// GetLastError returns the model's most recent build, run or chat failure,
+// with last_error null when the last operation on it succeeded
+func (mh *ModelHandler) GetLastError(c *gin.Context) {
+	modelName := c.Param("name")
+	respond(c, http.StatusOK, gin.H{
+		"model":      modelName,
+		"last_error": registry.Get(modelName).LastError,
+	})
+}
+
+// recordChatFailure explains a generation that started at start and failed,
+// e.g. by the container running out of memory, and records it as the model's last error.
+// Cancellations by an operator or the client are not the model's failures and
+// aren't recorded.
+func (ch *ChatHandler) recordChatFailure(containerName string, start time.Time, err error) error {
+	err = ch.dockerService.ExplainFailure(containerName, start, err)
+	if errors.Is(err, services.ErrGenerationCancelled) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	registry.RecordError(services.ModelForContainer(containerName), models.ModelError{
+		Phase:   models.PhaseChat,
+		Code:    generationErrorCode(err),
+		Message: err.Error(),
+		Time:    time.Now().UTC(),
+	})
+	return err
+}
+
+// recordCreateOutcome records a failed creation, update or start in the given
+// phase as the model's last error, and clears it on success. Requests the
+// server rejected up front, such as an unknown model name, leave it alone.
+func recordCreateOutcome(model, phase string, cerr *createError) {
+	if cerr == nil {
+		registry.ClearError(model)
+		return
+	}
+	if cerr.status < http.StatusInternalServerError && cerr.status != http.StatusConflict {
+		return
+	}
+	registry.RecordError(model, models.ModelError{
+		Phase:   phase,
+		Code:    cerr.code,
+		Message: cerr.message,
+		Time:    time.Now().UTC(),
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+func TestRecordCreateOutcome(t *testing.T) {
+	const model = "last-error-test"
+	t.Cleanup(func() { registry.Delete(model) })
+
+	tests := []struct {
+		name   string
+		cerr   *createError
+		phase  string
+		record bool
+	}{
+		{"rejected up front", &createError{http.StatusBadRequest, "INVALID_MODEL", "bad name"}, models.PhaseBuild, false},
+		{"build failed", &createError{http.StatusInternalServerError, "", "build failed"}, models.PhaseBuild, true},
+		{"port taken", &createError{http.StatusConflict, "PORT_IN_USE", "port taken"}, models.PhaseRun, true},
+	}
+	for _, tt := range tests {
+		registry.ClearError(model)
+		recordCreateOutcome(model, tt.phase, tt.cerr)
+		lastErr := registry.Get(model).LastError
+		if !tt.record {
+			if lastErr != nil {
+				t.Errorf("%s: recorded %+v", tt.name, lastErr)
+			}
+			continue
+		}
+		if lastErr == nil || lastErr.Phase != tt.phase || lastErr.Code != tt.cerr.code || lastErr.Message != tt.cerr.message || lastErr.Time.IsZero() {
+			t.Errorf("%s: last error = %+v, want %+v in %s", tt.name, lastErr, tt.cerr, tt.phase)
+		}
+	}
+
+	recordCreateOutcome(model, models.PhaseRun, nil)
+	if lastErr := registry.Get(model).LastError; lastErr != nil {
+		t.Errorf("last error = %+v after a success, want it cleared", lastErr)
+	}
+}
+
+func TestGetLastErrorAfterChat(t *testing.T) {
+	startFakeOllama(t, "Hello")
+	t.Cleanup(func() { registry.Delete("llama2") })
+	get := func() *models.ModelError {
+		w := serve(http.MethodGet, "/models/:name/last-error", "/models/llama2/last-error", "", NewModelHandler().GetLastError)
+		var body struct {
+			Model     string             `json:"model"`
+			LastError *models.ModelError `json:"last_error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Model != "llama2" {
+			t.Fatalf("last-error = %s: %v", w.Body, err)
+		}
+		return body.LastError
+	}
+
+	if lastErr := get(); lastErr != nil {
+		t.Errorf("last error = %+v before any failure", lastErr)
+	}
+
+	// Nothing listens here, so the generation fails; startFakeOllama restores it
+	config.Get().OllamaURL = "http://127.0.0.1:1"
+	chat(NewChatHandler().SendMessage, `{"message":"hi"}`)
+	if lastErr := get(); lastErr == nil || lastErr.Phase != models.PhaseChat || lastErr.Message == "" {
+		t.Errorf("last error = %+v, want the failed chat", lastErr)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+)
+
+// maxListingVersions bounds how many listing ETags are remembered with the
+// time they were first served
+const maxListingVersions = 1024
+
+var (
+	// modelSetVersion changes whenever models are created, updated, adopted or
+	// deleted, so listings get a new ETag even if they happen to look the same
+	modelSetVersion atomic.Uint64
+
+	listingMu sync.Mutex
+	// listingSince is when each listing ETag was first served, its Last-Modified
+	listingSince = make(map[string]time.Time)
+)
+
+// modelsChanged invalidates the ETags of the model listings
+func modelsChanged() {
+	modelSetVersion.Add(1)
+}
+
+// respondListing responds with a model listing that clients poll, along with
+// its ETag, Last-Modified and OWNGPT_LISTING_MAX_AGE's Cache-Control. A client
+// whose If-None-Match or If-Modified-Since shows it already has the listing
+// gets 304 Not Modified without a body.
+func respondListing(c *gin.Context, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		respond(c, http.StatusOK, data)
+		return
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d:%t:", modelSetVersion.Load(), wantsEnvelope(c))
+	hash.Write(body)
+	etag := `"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+
+	listingMu.Lock()
+	since, ok := listingSince[etag]
+	if !ok {
+		if len(listingSince) >= maxListingVersions {
+			listingSince = make(map[string]time.Time)
+		}
+		since = time.Now().UTC().Truncate(time.Second)
+		listingSince[etag] = since
+	}
+	listingMu.Unlock()
+
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", since.Format(http.TimeFormat))
+	// The envelope is a different representation of the same listing
+	c.Header("Vary", "Accept")
+	if maxAge := config.Get().ListingMaxAge; maxAge > 0 {
+		c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+
+	if notModified(c, etag, since) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	respond(c, http.StatusOK, data)
+}
+
+// notModified reports whether the client's conditional headers show it holds
+// the current listing. If-None-Match wins over If-Modified-Since, as in RFC 9110.
+func notModified(c *gin.Context, etag string, since time.Time) bool {
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	modifiedSince, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	return err == nil && !since.After(modifiedSince)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+)
+
+// listModels gets /models with the given "Name: value" headers
+func listModels(handler gin.HandlerFunc, headers ...string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/models", handler)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/models", nil)
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ": ")
+		req.Header.Set(name, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestListingNotModified(t *testing.T) {
+	startFakeOllama(t)
+	list := NewModelHandler().GetInstalledModels
+
+	w := listModels(list)
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("status %d, ETag %q, Last-Modified %q", w.Code, etag, lastModified)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("Vary = %q, want Accept", got)
+	}
+
+	tests := []struct {
+		name    string
+		headers []string
+		want    int
+	}{
+		{"same ETag", []string{"If-None-Match: " + etag}, http.StatusNotModified},
+		{"weak ETag in a list", []string{`If-None-Match: "other", W/` + etag}, http.StatusNotModified},
+		{"any", []string{"If-None-Match: *"}, http.StatusNotModified},
+		{"other ETag", []string{`If-None-Match: "other"`}, http.StatusOK},
+		{"not modified since", []string{"If-Modified-Since: " + lastModified}, http.StatusNotModified},
+		{"modified since", []string{"If-Modified-Since: " + time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}, http.StatusOK},
+		// If-None-Match wins over If-Modified-Since
+		{"other ETag, not modified since", []string{`If-None-Match: "other"`, "If-Modified-Since: " + lastModified}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := listModels(list, tt.headers...)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() > 0 || w.Header().Get("ETag") != etag) {
+			t.Errorf("%s: 304 with body %q and ETag %q", tt.name, w.Body, w.Header().Get("ETag"))
+		}
+	}
+
+	// The envelope is a different representation
+	if got := listModels(list, "Accept: application/vnd.owngpt.v2+json").Header().Get("ETag"); got == etag {
+		t.Error("the envelope has the plain listing's ETag")
+	}
+}
+
+func TestListingChanged(t *testing.T) {
+	fake := startFakeOllama(t)
+	list := NewModelHandler().GetInstalledModels
+	etag := listModels(list).Header().Get("ETag")
+
+	// A changed model set gets a new ETag even if the listing looks the same
+	modelsChanged()
+	w := listModels(list, "If-None-Match: "+etag)
+	changed := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || changed == etag {
+		t.Errorf("after a change: status %d, ETag %q, want 200 with a new ETag", w.Code, changed)
+	}
+
+	// So does a changed listing
+	fake.mu.Lock()
+	fake.installed = append(fake.installed, "mistral:latest")
+	fake.mu.Unlock()
+	if w := listModels(list, "If-None-Match: "+changed); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "mistral") {
+		t.Errorf("new model: status %d: %s, want the new listing", w.Code, w.Body)
+	}
+}
+
+func TestListingMaxAge(t *testing.T) {
+	startFakeOllama(t)
+	cfg := config.Get()
+	maxAge := cfg.ListingMaxAge
+	cfg.ListingMaxAge = 30 * time.Second
+	t.Cleanup(func() { cfg.ListingMaxAge = maxAge })
+
+	if got := listModels(NewModelHandler().GetInstalledModels).Header().Get("Cache-Control"); got != "private, max-age=30" {
+		t.Errorf("Cache-Control = %q, want private, max-age=30", got)
+	}
+}
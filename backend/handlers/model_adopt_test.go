@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"owngpt/config"
+	"owngpt/services"
+)
+
+func TestAdoptModelWaitsForModelLock(t *testing.T) {
+	cfg := config.Get()
+	discover := cfg.DiscoverExternal
+	cfg.DiscoverExternal = true
+	t.Cleanup(func() { cfg.DiscoverExternal = discover })
+	mh, _ := fakeDockerHandler(t)
+	mh.dockerService = services.NewDockerServiceWithRunner(func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		if len(args) > 0 && args[0] == "ps" {
+			return exec.CommandContext(ctx, "printf", "%s", "adopt-test-ollama\tollama/ollama:latest\tUp 5 minutes\t11434/tcp\n")
+		}
+		return exec.CommandContext(ctx, "true")
+	})
+
+	// A create, update or delete of the model is under way
+	unlock := modelLocks.Lock("llama2")
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(http.MethodPost, "/models/adopt", "/models/adopt", `{"container_name":"adopt-test-ollama","model":"llama2"}`, mh.AdoptModel)
+	}()
+
+	select {
+	case w := <-done:
+		unlock()
+		t.Fatalf("adopted while the model was locked: %s", w.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if name, _ := currentContainer(); name == "adopt-test-ollama" {
+		t.Error("the container became the current model while the model was locked")
+	}
+
+	unlock()
+	if w := <-done; w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s, want the container adopted once the lock was free", w.Code, w.Body)
+	}
+	if name, _ := currentContainer(); name != "adopt-test-ollama" {
+		t.Errorf("current model = %s, want the adopted container", name)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/middleware"
+	"owngpt/models"
+	"owngpt/utils"
+)
+
+// GetModelSupports reports whether the model supports a capability given as
+// ?capability=embeddings|tools|vision, with the reason, so clients can offer
+// a feature only for models that have it. The model has to be running to be
+// inspected the first time; its answers are kept after that.
+func (mh *ModelHandler) GetModelSupports(c *gin.Context) {
+	modelName := c.Param("name")
+	middleware.SetModel(c, modelName)
+
+	capability := c.Query("capability")
+	switch capability {
+	case models.CapabilityEmbeddings, models.CapabilityTools, models.CapabilityVision:
+	default:
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid capability %q, expected %s, %s or %s", capability, models.CapabilityEmbeddings, models.CapabilityTools, models.CapabilityVision))
+		return
+	}
+
+	installed, err := mh.findInstalledModel(modelName)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+		return
+	}
+	if installed == nil {
+		respondErrorCode(c, http.StatusNotFound, "MODEL_NOT_FOUND", fmt.Sprintf("Model %s is not installed", modelName))
+		return
+	}
+
+	support, err := mh.ollamaService.Supports(utils.ContainerName(modelName), capability)
+	if err != nil {
+		if !installed.IsRunning {
+			respondError(c, http.StatusConflict, fmt.Sprintf("Model %s is not running, start it to inspect its capabilities", modelName))
+			return
+		}
+		respondErrorCode(c, http.StatusBadGateway, "MODEL_UNREACHABLE", fmt.Sprintf("Failed to inspect the capabilities of %s: %v", modelName, err))
+		return
+	}
+	respond(c, http.StatusOK, support)
+}
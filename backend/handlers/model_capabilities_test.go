@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"owngpt/models"
+	"owngpt/services"
+)
+
+func TestGetModelSupports(t *testing.T) {
+	fake := startFakeOllama(t)
+	fake.capabilities = []string{"completion", "tools"}
+	services.ForgetCapabilities("llama2")
+	t.Cleanup(func() { services.ForgetCapabilities("llama2") })
+	mh := NewModelHandler()
+	supports := func(path string) *httptest.ResponseRecorder {
+		return serve(http.MethodGet, "/models/:name/supports", path, "", mh.GetModelSupports)
+	}
+
+	for capability, want := range map[string]bool{"tools": true, "vision": false, "embeddings": false} {
+		w := supports("/models/llama2/supports?capability=" + capability)
+		var support models.CapabilitySupport
+		json.Unmarshal(w.Body.Bytes(), &support)
+		if w.Code != http.StatusOK || support.Model != "llama2" || support.Capability != capability || support.Supported != want || support.Reason == "" {
+			t.Errorf("%s: status %d: %s, want supported %v", capability, w.Code, w.Body, want)
+		}
+	}
+
+	for _, capability := range []string{"", "audio"} {
+		if w := supports("/models/llama2/supports?capability=" + capability); w.Code != http.StatusBadRequest {
+			t.Errorf("capability %q: status %d, want 400", capability, w.Code)
+		}
+	}
+	w := supports("/models/mistral/supports?capability=tools")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "MODEL_NOT_FOUND") {
+		t.Errorf("not installed: status %d: %s, want 404 MODEL_NOT_FOUND", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/services"
+	"owngpt/utils"
+)
+
+// buildLogTail is how many of the last build output lines are searched for
+// the cause of a failed build
+const buildLogTail = 20
+
+// permanentFailures are signs in an error or build output that creating the
+// model would fail the same way again, mostly a model, tag or image that
+// doesn't exist. A bare "not found" isn't one: a missing network or container
+// may be back on the next attempt.
+var permanentFailures = []*regexp.Regexp{
+	regexp.MustCompile(`file does not exist`),
+	regexp.MustCompile(`model ["']?[^"'\s]+["']? not found`),
+	regexp.MustCompile(`manifest unknown`),
+	regexp.MustCompile(`no matching manifest`),
+	regexp.MustCompile(`pull access denied`),
+	regexp.MustCompile(`invalid reference format`),
+}
+
+// retryCreate makes attempts at creating the model until one succeeds, one
+// fails in a way that would happen again or OWNGPT_CREATE_ATTEMPTS are used
+// up. The failed container is removed before each retry, after a backoff
+// that doubles each time. No retry is made once ctx is done. It returns the
+// phase the last attempt got to.
+func (mh *ModelHandler) retryCreate(ctx context.Context, model, containerName string, progress createProgress, attempt func() (phase string, retry bool, cerr *createError)) (string, *createError) {
+	var failures []string
+	attempts := config.Get().CreateAttempts
+	for n := 1; ; n++ {
+		phase, retry, cerr := attempt()
+		if cerr == nil {
+			return phase, nil
+		}
+		failures = append(failures, fmt.Sprintf("attempt %d: %s", n, cerr.message))
+		if retry && n < attempts && ctx.Err() == nil {
+			backoff := config.Get().CreateRetryBackoff << (n - 1)
+			log.Printf("Creating %s failed on attempt %d of %d, retrying in %v: %s", model, n, attempts, backoff, cerr.message)
+			mh.removeFailedContainer(containerName)
+			progress("retrying_create", gin.H{"attempt": n + 1, "attempts": attempts, "error": cerr.message})
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+				log.Printf("Not retrying %s, the request went away", model)
+			}
+		}
+
+		// The failed container is kept for its logs, but isn't the current model
+		clearCurrentModel(containerName)
+		if len(failures) > 1 {
+			cerr.message = fmt.Sprintf("Model creation failed after %d attempts: %s", n, strings.Join(failures, "; "))
+		}
+		return phase, cerr
+	}
+}
+
+// buildAndStart builds the model's image from the Dockerfile in buildDir, runs
+// its container and waits for the model to be ready, making it the current
+// model. numParallel is the OLLAMA_NUM_PARALLEL the Dockerfile sets. It returns
+// the phase it got to and, on failure, whether another attempt might succeed.
+func (mh *ModelHandler) buildAndStart(req models.CreateDockerfileRequest, buildDir, containerName, port string, numParallel int, progress createProgress) (phase string, retry bool, cerr *createError) {
+	imageName := utils.ImageName(req.Model)
+
+	// docker build only exits with a status, the reason is in its output
+	progress("building", nil)
+	var tail []string
+	err := mh.dockerService.BuildDockerImageWithLogs(buildDir, imageName, buildOptions(req), func(line string) {
+		if tail = append(tail, line); len(tail) > buildLogTail {
+			tail = tail[1:]
+		}
+		progress("building", gin.H{"log": line})
+	})
+	if err != nil {
+		if cerr := diskSpaceError(err); cerr != nil {
+			return models.PhaseBuild, false, cerr
+		}
+		message := fmt.Sprintf("Failed to build Docker image: %v", err)
+		if len(tail) > 0 {
+			message += ": " + strings.TrimSpace(tail[len(tail)-1])
+		}
+		return models.PhaseBuild, !permanentFailure(err.Error(), tail...),
+			&createError{status: http.StatusInternalServerError, message: message}
+	}
+
+	progress("starting", nil)
+	if err := mh.dockerService.RunDockerContainer(imageName, containerName, port, platformFor(req), containerLabels(config.Get().Labels, req.Labels)); err != nil {
+		var portErr *services.PortInUseError
+		if errors.As(err, &portErr) {
+			return models.PhaseRun, false, &createError{http.StatusConflict, "PORT_IN_USE", fmt.Sprintf("Failed to run Docker container: %v", err)}
+		}
+		return models.PhaseRun, !permanentFailure(err.Error()),
+			&createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to run Docker container: %v", err)}
+	}
+	recordNumParallel(req.Model, numParallel)
+
+	models.ModelMutex.Lock()
+	models.CurrentModel = models.ModelContainer{
+		Name:      containerName,
+		Port:      port,
+		IsRunning: true,
+	}
+	models.ModelMutex.Unlock()
+
+	// A model that runs out of memory will again; a pull that stalled may not
+	timeouts := mh.dockerService.ReadyTimeoutsFor(req.Model)
+	if err := mh.dockerService.WaitForModelReadyProgress(containerName, timeouts, pullProgress(progress)); err != nil {
+		var oomErr *services.OOMError
+		return models.PhaseRun, !errors.As(err, &oomErr) && !permanentFailure(err.Error()), readyError(err)
+	}
+	return models.PhaseRun, false, nil
+}
+
+// diskSpaceError is the 507 INSUFFICIENT_STORAGE a build refused for lack of
+// disk space gets, or nil for other build errors. Retrying doesn't free space.
+func diskSpaceError(err error) *createError {
+	var diskErr *services.DiskSpaceError
+	if !errors.As(err, &diskErr) {
+		return nil
+	}
+	return &createError{http.StatusInsufficientStorage, "INSUFFICIENT_STORAGE", fmt.Sprintf("Failed to build Docker image: %v", err)}
+}
+
+// permanentFailure reports whether the error, or the output leading up to it,
+// shows the failure would happen again
+func permanentFailure(message string, output ...string) bool {
+	text := strings.ToLower(message + "\n" + strings.Join(output, "\n"))
+	for _, sign := range permanentFailures {
+		if sign.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFailedContainer removes what a failed attempt left of the model's
+// container, so the next attempt starts clean and nothing points at it
+func (mh *ModelHandler) removeFailedContainer(containerName string) {
+	clearCurrentModel(containerName)
+	if err := mh.dockerService.RemoveContainer(containerName); err != nil {
+		log.Printf("Failed to remove container %s after a failed attempt: %v", containerName, err)
+	}
+}
+
+// clearCurrentModel stops pointing at the container as the current model
+func clearCurrentModel(containerName string) {
+	models.ModelMutex.Lock()
+	defer models.ModelMutex.Unlock()
+	if models.CurrentModel.Name == containerName {
+		models.CurrentModel = models.ModelContainer{}
+	}
+}
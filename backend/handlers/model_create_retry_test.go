@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/services"
+)
+
+// fakeDockerHandler returns a ModelHandler whose docker commands all succeed
+// without running, recording their command lines
+func fakeDockerHandler(t *testing.T) (*ModelHandler, func() []string) {
+	var mu sync.Mutex
+	var calls []string
+	runner := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		mu.Lock()
+		calls = append(calls, strings.Join(append([]string{name}, args...), " "))
+		mu.Unlock()
+		return exec.CommandContext(ctx, "true")
+	}
+
+	models.ModelMutex.Lock()
+	current := models.CurrentModel
+	models.ModelMutex.Unlock()
+	t.Cleanup(func() {
+		models.ModelMutex.Lock()
+		models.CurrentModel = current
+		models.ModelMutex.Unlock()
+	})
+
+	mh := &ModelHandler{dockerService: services.NewDockerServiceWithRunner(runner)}
+	return mh, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+// setCreateRetries sets OWNGPT_CREATE_ATTEMPTS and OWNGPT_CREATE_RETRY_BACKOFF for the test
+func setCreateRetries(t *testing.T, attempts int, backoff time.Duration) {
+	cfg := config.Get()
+	previousAttempts, previousBackoff := cfg.CreateAttempts, cfg.CreateRetryBackoff
+	cfg.CreateAttempts, cfg.CreateRetryBackoff = attempts, backoff
+	t.Cleanup(func() { cfg.CreateAttempts, cfg.CreateRetryBackoff = previousAttempts, previousBackoff })
+}
+
+// failingAttempts returns an attempt that starts the container and then fails
+// with each message in turn, succeeding once they run out, and a count of the
+// attempts made
+func failingAttempts(containerName string, messages ...string) (func() (string, bool, *createError), *int) {
+	made := 0
+	return func() (string, bool, *createError) {
+		made++
+		models.ModelMutex.Lock()
+		models.CurrentModel = models.ModelContainer{Name: containerName, IsRunning: true}
+		models.ModelMutex.Unlock()
+		if made > len(messages) {
+			return models.PhaseRun, false, nil
+		}
+		message := messages[made-1]
+		return models.PhaseRun, !permanentFailure(message), &createError{status: http.StatusInternalServerError, message: message}
+	}, &made
+}
+
+func TestRetryCreateTransientThenSuccess(t *testing.T) {
+	mh, calls := fakeDockerHandler(t)
+	setCreateRetries(t, 3, time.Millisecond)
+	containerName := "ollama-llama2-container"
+
+	var stages []string
+	attempt, made := failingAttempts(containerName, "Failed to run Docker container: network owngpt not found")
+	phase, cerr := mh.retryCreate(context.Background(), "llama2", containerName, func(stage string, _ gin.H) {
+		stages = append(stages, stage)
+	}, attempt)
+	if cerr != nil {
+		t.Fatalf("retryCreate failed: %s", cerr.message)
+	}
+	if phase != models.PhaseRun || *made != 2 {
+		t.Errorf("phase %s after %d attempts, want %s after 2", phase, *made, models.PhaseRun)
+	}
+	if len(stages) != 1 || stages[0] != "retrying_create" {
+		t.Errorf("stages = %v, want one retrying_create", stages)
+	}
+	if removed := calls(); len(removed) != 1 || removed[0] != "docker rm -f "+containerName {
+		t.Errorf("docker commands = %v, want the failed container removed once", removed)
+	}
+	if name, running := currentContainer(); name != containerName || !running {
+		t.Errorf("current model = %s, want %s", name, containerName)
+	}
+}
+
+func TestRetryCreatePermanentFailure(t *testing.T) {
+	mh, calls := fakeDockerHandler(t)
+	setCreateRetries(t, 3, time.Millisecond)
+	containerName := "ollama-llama9-container"
+
+	attempt, made := failingAttempts(containerName, "Failed to build Docker image: pull model manifest: file does not exist")
+	_, cerr := mh.retryCreate(context.Background(), "llama9", containerName, func(string, gin.H) {}, attempt)
+	if cerr == nil {
+		t.Fatal("retryCreate succeeded")
+	}
+	if *made != 1 || len(calls()) != 0 {
+		t.Errorf("made %d attempts and ran %v, want one attempt and no retry", *made, calls())
+	}
+	if strings.Contains(cerr.message, "attempts") {
+		t.Errorf("message = %q, want the single failure", cerr.message)
+	}
+	if name, _ := currentContainer(); name == containerName {
+		t.Error("failed container left as the current model")
+	}
+}
+
+func TestRetryCreateGivesUp(t *testing.T) {
+	mh, _ := fakeDockerHandler(t)
+	setCreateRetries(t, 2, time.Millisecond)
+	containerName := "ollama-llama2-container"
+
+	attempt, made := failingAttempts(containerName, "stalled pull", "stalled pull again")
+	_, cerr := mh.retryCreate(context.Background(), "llama2", containerName, func(string, gin.H) {}, attempt)
+	if cerr == nil || *made != 2 {
+		t.Fatalf("made %d attempts, error %v, want 2 failed attempts", *made, cerr)
+	}
+	want := "Model creation failed after 2 attempts: attempt 1: stalled pull; attempt 2: stalled pull again"
+	if cerr.message != want {
+		t.Errorf("message = %q, want %q", cerr.message, want)
+	}
+	if name, _ := currentContainer(); name == containerName {
+		t.Error("failed container left as the current model")
+	}
+}
+
+func TestRetryCreateStopsWhenRequestGoes(t *testing.T) {
+	mh, _ := fakeDockerHandler(t)
+	setCreateRetries(t, 3, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempt, made := failingAttempts("ollama-llama2-container", "stalled pull", "stalled pull")
+	done := make(chan *createError)
+	go func() {
+		_, cerr := mh.retryCreate(ctx, "llama2", "ollama-llama2-container", func(stage string, _ gin.H) {
+			if stage == "retrying_create" {
+				cancel()
+			}
+		}, attempt)
+		done <- cerr
+	}()
+
+	select {
+	case cerr := <-done:
+		if cerr == nil || *made != 1 {
+			t.Errorf("made %d attempts, error %v, want one failed attempt", *made, cerr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retryCreate kept waiting after the request went away")
+	}
+}
+
+func TestPermanentFailure(t *testing.T) {
+	tests := []struct {
+		message   string
+		permanent bool
+	}{
+		{"pull model manifest: file does not exist", true},
+		{`Error: model "llama9" not found, try pulling it first`, true},
+		{"manifest for ollama/ollama:0.0.0 not found: manifest unknown", true},
+		{"pull access denied for nope, repository does not exist", true},
+		{"Error response from daemon: network owngpt not found", false},
+		{"Error: No such container: container not found", false},
+		{"connection reset by peer", false},
+	}
+	for _, tt := range tests {
+		if got := permanentFailure(tt.message); got != tt.permanent {
+			t.Errorf("permanentFailure(%q) = %v, want %v", tt.message, got, tt.permanent)
+		}
+	}
+}
+
+func TestBuildAndStartInsufficientStorage(t *testing.T) {
+	cfg := config.Get()
+	minFree, path := cfg.MinFreeDisk, cfg.BuildDiskPath
+	cfg.MinFreeDisk, cfg.BuildDiskPath = 1<<62, t.TempDir()
+	t.Cleanup(func() { cfg.MinFreeDisk, cfg.BuildDiskPath = minFree, path })
+	mh, calls := fakeDockerHandler(t)
+
+	req := models.CreateDockerfileRequest{Model: "llama2"}
+	phase, retry, cerr := mh.buildAndStart(req, t.TempDir(), "ollama-llama2-container", "11434", 1, func(string, gin.H) {})
+	if cerr == nil || cerr.status != http.StatusInsufficientStorage || cerr.code != "INSUFFICIENT_STORAGE" {
+		t.Fatalf("err = %+v, want 507 INSUFFICIENT_STORAGE", cerr)
+	}
+	if phase != models.PhaseBuild || retry {
+		t.Errorf("phase %s, retry %v, want a build failure that isn't retried", phase, retry)
+	}
+	for _, call := range calls() {
+		if strings.HasPrefix(call, "docker build") || strings.HasPrefix(call, "docker run") {
+			t.Errorf("ran %q without the disk space", call)
+		}
+	}
+}
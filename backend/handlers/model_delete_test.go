@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+func TestDeleteRunningModelNeedsForce(t *testing.T) {
+	mh, calls := fakeDockerHandler(t)
+	cfg := config.Get()
+	mode, requireForce := cfg.Mode, cfg.DeleteRequiresForce
+	cfg.Mode, cfg.DeleteRequiresForce = "", true
+	t.Cleanup(func() { cfg.Mode, cfg.DeleteRequiresForce = mode, requireForce })
+
+	models.ModelMutex.Lock()
+	models.CurrentModel = models.ModelContainer{Name: "ollama-llama2-container", IsRunning: true}
+	models.ModelMutex.Unlock()
+	remove := func(query string) *httptest.ResponseRecorder {
+		return serve(http.MethodDelete, "/models/:name", "/models/llama2"+query, "", mh.DeleteModel)
+	}
+
+	if w := remove(""); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "MODEL_RUNNING") {
+		t.Errorf("status = %d: %s, want 409 MODEL_RUNNING", w.Code, w.Body)
+	}
+	if w := remove("?force=maybe"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid force: status = %d, want 400", w.Code)
+	}
+	for _, call := range calls() {
+		if strings.HasPrefix(call, "docker rm") {
+			t.Fatalf("refused deletes ran %q", call)
+		}
+	}
+
+	if w := remove("?force=true"); w.Code != http.StatusOK {
+		t.Fatalf("forced delete: status = %d: %s", w.Code, w.Body)
+	}
+	if _, running := currentContainer(); running {
+		t.Error("the deleted model is still the current model")
+	}
+
+	// With the check turned off a running model is deleted without force
+	models.ModelMutex.Lock()
+	models.CurrentModel = models.ModelContainer{Name: "ollama-llama2-container", IsRunning: true}
+	models.ModelMutex.Unlock()
+	cfg.DeleteRequiresForce = false
+	if w := remove(""); w.Code != http.StatusOK {
+		t.Errorf("OWNGPT_DELETE_REQUIRES_FORCE=false: status = %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/models"
+	"owngpt/registry"
+	"owngpt/utils"
+)
+
+// pinDigest splits a digest given as model@sha256:... off the request's model
+// into its Digest field, responding 400 and returning false when the digest
+// is malformed or contradicts the one in the request
+func pinDigest(c *gin.Context, req *models.CreateDockerfileRequest) bool {
+	model, digest := utils.SplitModelDigest(req.Model)
+	if digest != "" {
+		if req.Digest != "" && req.Digest != digest {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Model %s is pinned to %s, but digest is %s", model, digest, req.Digest))
+			return false
+		}
+		req.Model, req.Digest = model, digest
+	}
+	if req.Digest == "" {
+		return true
+	}
+	if err := utils.CheckDigest(req.Digest); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// forceParam reads the ?force= query flag, responding 400 and returning
+// false as its second result when it isn't a boolean
+func forceParam(c *gin.Context) (force bool, ok bool) {
+	value := c.Query("force")
+	if value == "" {
+		return false, true
+	}
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid force value %q, expected true or false", value))
+		return false, false
+	}
+	return force, true
+}
+
+// digestMismatch is the error for a model whose weights aren't at the digest
+// it is pinned to
+func digestMismatch(model, digest, pin string) *createError {
+	return &createError{http.StatusConflict, "DIGEST_MISMATCH", fmt.Sprintf("Model %s is at digest %s, not the pinned %s", model, digest, pin)}
+}
+
+// installedDigest returns the digest of the model as installed, read from its
+// Ollama server when that is up and from its registry record otherwise, or
+// empty when neither knows
+func (mh *ModelHandler) installedDigest(containerName, model string) string {
+	if digest, err := mh.ollamaService.ModelDigest(containerName, model); err == nil {
+		return utils.NormalizeDigest(digest)
+	}
+	return registry.Get(model).Digest
+}
+
+// resolveDigest reads the digest the model's weights resolved to in the
+// container and checks it against the pin. Without a pin, failing to read it
+// is only logged, since nothing depends on it.
+func (mh *ModelHandler) resolveDigest(containerName, model, pin string) (string, *createError) {
+	digest, err := mh.ollamaService.ModelDigest(containerName, model)
+	if err != nil {
+		if pin == "" {
+			log.Printf("Failed to read the digest of %s: %v", model, err)
+			return "", nil
+		}
+		return "", &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to read the model's digest to check its pin: %v", err)}
+	}
+	digest = utils.NormalizeDigest(digest)
+	if pin != "" && digest != pin {
+		return digest, digestMismatch(model, digest, pin)
+	}
+	return digest, nil
+}
+
+// recordDigest stores the model's resolved digest and pin in its registry record
+func recordDigest(model, digest, pin string) {
+	registry.Update(model, func(record *models.ModelRecord) {
+		if digest != "" {
+			record.Digest = digest
+		}
+		record.PinnedDigest = pin
+	})
+}
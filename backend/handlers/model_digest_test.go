@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/registry"
+)
+
+const (
+	digestA = "sha256:8934d96d3f08982e95922b2b7a2c626a1fe873d7c3b06e8e56d7bc0a1fef9246"
+	digestB = "sha256:78e26419b4469263f75331927a00a0284ef6544c1975b826b15abdaef17bb962"
+)
+
+func TestCreateModelPinned(t *testing.T) {
+	fake := startFakeOllama(t)
+	fake.digest = strings.TrimPrefix(digestA, "sha256:")
+	t.Cleanup(func() { registry.Delete("llama2") })
+	mh := NewModelHandler()
+
+	w := serve(http.MethodPost, "/models", "/models", `{"model":"llama2@`+digestA+`"}`, mh.CreateModel)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"digest":"`+digestA+`"`) {
+		t.Fatalf("status %d: %s, want the model at its pinned digest", w.Code, w.Body)
+	}
+	if record := registry.Get("llama2"); record.PinnedDigest != digestA || record.Digest != digestA {
+		t.Errorf("record = %+v, want it pinned to %s", record, digestA)
+	}
+
+	// A different pin isn't applied over the installed weights unless forced
+	w = serve(http.MethodPost, "/models", "/models", `{"model":"llama2","digest":"`+digestB+`"}`, mh.CreateModel)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "DIGEST_MISMATCH") {
+		t.Errorf("status %d: %s, want 409 DIGEST_MISMATCH", w.Code, w.Body)
+	}
+	if pin := registry.Get("llama2").PinnedDigest; pin != digestA {
+		t.Errorf("a refused pin changed the record to %s", pin)
+	}
+
+	fake.pulledDigest = digestB
+	w = serve(http.MethodPost, "/models", "/models", `{"model":"llama2","digest":"`+digestB+`","force":true}`, mh.CreateModel)
+	if w.Code != http.StatusOK || registry.Get("llama2").PinnedDigest != digestB {
+		t.Errorf("forced: status %d: %s, want the model repinned to %s", w.Code, w.Body, digestB)
+	}
+}
+
+func TestCreateModelBadDigest(t *testing.T) {
+	mh, calls := fakeDockerHandler(t)
+	for _, body := range []string{
+		`{"model":"llama2@sha256:abc"}`,
+		`{"model":"llama2","digest":"latest"}`,
+		`{"model":"llama2@` + digestA + `","digest":"` + digestB + `"}`,
+	} {
+		if w := serve(http.MethodPost, "/models", "/models", body, mh.CreateModel); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+	if len(calls()) > 0 {
+		t.Errorf("bad digests ran %q", calls())
+	}
+}
@@ -1,65 +1,246 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 
+	"owngpt/config"
+	"owngpt/middleware"
 	"owngpt/models"
+	"owngpt/registry"
 	"owngpt/services"
+	"owngpt/usage"
 	"owngpt/utils"
 )
 
 type ModelHandler struct {
-	dockerService *services.DockerService
-	ollamaService *services.OllamaService
+	dockerService  *services.DockerService
+	ollamaService  *services.OllamaService
+	libraryService *services.LibraryService
+	localOllama    *services.LocalOllama
 }
 
 func NewModelHandler() *ModelHandler {
 	return &ModelHandler{
-		dockerService: services.NewDockerService(),
-		ollamaService: services.NewOllamaService(),
+		dockerService:  services.NewDockerService(),
+		ollamaService:  services.NewOllamaService(),
+		libraryService: services.NewLibraryService(),
+		localOllama:    services.NewLocalOllama(),
 	}
 }
 
+// createProgress receives the stages of model creation as they happen
+type createProgress func(stage string, detail gin.H)
+
+// createError is a failed model creation with the status and code to respond with
+type createError struct {
+	status  int
+	code    string
+	message string
+}
+
 // CreateModel handles model creation requests
 func (mh *ModelHandler) CreateModel(c *gin.Context) {
 	var req models.CreateDockerfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !pinDigest(c, &req) {
+		return
+	}
+	middleware.SetModel(c, req.Model)
+	if !allowModel(c, req.Model) || !authorizeTemplate(c, req) || !validLabels(c, req) || !validNumParallel(c, req.NumParallel) || !validPlatform(c, req.Platform) {
+		return
+	}
+
+	result, cerr := mh.createModel(c.Request.Context(), req, func(string, gin.H) {})
+	if cerr != nil {
+		respondErrorCode(c, cerr.status, cerr.code, cerr.message)
+		return
+	}
+	respond(c, http.StatusOK, result)
+}
+
+// CreateModelStream creates a model like CreateModel, streaming each stage as
+// a Server-Sent Event and finishing with a result or error event
+func (mh *ModelHandler) CreateModelStream(c *gin.Context) {
+	var req models.CreateDockerfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !pinDigest(c, &req) {
+		return
+	}
+	middleware.SetModel(c, req.Model)
+	if !allowModel(c, req.Model) || !authorizeTemplate(c, req) || !validLabels(c, req) || !validNumParallel(c, req.NumParallel) || !validPlatform(c, req.Platform) {
 		return
 	}
 
+	closeStream, ok := openStream(c, "")
+	if !ok {
+		return
+	}
+	defer closeStream()
+
+	streamHeaders(c, "text/event-stream")
+
+	// Build logs arrive from the command's output goroutine
+	var mu sync.Mutex
+	send := func(event string, data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+
+	// The attempt under way carries on if the client disconnects, but isn't
+	// retried; later events are dropped
+	result, cerr := mh.createModel(c.Request.Context(), req, func(stage string, detail gin.H) {
+		event := gin.H{"stage": stage}
+		for k, v := range detail {
+			event[k] = v
+		}
+		send("stage", event)
+	})
+	if cerr != nil {
+		event := gin.H{"error": cerr.message, "status": cerr.status}
+		if cerr.code != "" {
+			event["code"] = cerr.code
+		}
+		send("error", event)
+		return
+	}
+	send("result", result)
+}
+
+// allowModel responds 403 MODEL_NOT_ALLOWED and returns false when the
+// operator's model policy doesn't allow creating the model
+func allowModel(c *gin.Context, model string) bool {
+	if err := config.Get().ModelPolicy.Check(model); err != nil {
+		respondErrorCode(c, http.StatusForbidden, "MODEL_NOT_ALLOWED", err.Error())
+		return false
+	}
+	return true
+}
+
+// validLabels responds 400 and returns false when the request's custom
+// container labels are invalid, or given in local mode, which has no containers
+func validLabels(c *gin.Context, req models.CreateDockerfileRequest) bool {
+	if len(req.Labels) == 0 {
+		return true
+	}
+	if services.LocalMode() {
+		respondError(c, http.StatusBadRequest, "Labels are put on model containers, which local mode doesn't use")
+		return false
+	}
+	if err := config.CheckLabels(containerLabels(config.Get().Labels, req.Labels)); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// containerLabels merges sets of custom container labels, later sets
+// overriding earlier ones for the same key
+func containerLabels(sets ...map[string]string) map[string]string {
+	labels := make(map[string]string)
+	for _, set := range sets {
+		for key, value := range set {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// authorizeTemplate requires the admin token from requests that bring their
+// own Dockerfile template, since it runs arbitrary build steps on the daemon
+func authorizeTemplate(c *gin.Context, req models.CreateDockerfileRequest) bool {
+	if req.DockerfileTemplate == "" {
+		return true
+	}
+	middleware.AdminAuth(config.Get().AdminToken)(c)
+	return !c.IsAborted()
+}
+
+// createModel builds and starts the model container, reporting each stage to
+// progress and recording a failure as the model's last error. Failed attempts
+// aren't retried once ctx is done.
+func (mh *ModelHandler) createModel(ctx context.Context, req models.CreateDockerfileRequest, progress createProgress) (result gin.H, cerr *createError) {
+	unlock := modelLocks.Lock(req.Model)
+	defer unlock()
+
 	log.Printf("Creating model: %s", req.Model)
+	phase := models.PhaseBuild
+	defer func() { recordCreateOutcome(req.Model, phase, cerr) }()
+	defer modelsChanged()
+
+	containerName := utils.ContainerName(req.Model)
+
+	// A model keeps its pin unless the request gives another; one installed at
+	// a different digest than the pin is only replaced when forced
+	if req.Digest == "" {
+		req.Digest = registry.Get(req.Model).PinnedDigest
+	}
+	replace := false
+	if req.Digest != "" {
+		if digest := mh.installedDigest(containerName, req.Model); digest != "" && digest != req.Digest {
+			if !req.Force {
+				cerr := digestMismatch(req.Model, digest, req.Digest)
+				cerr.message += "; set force to replace it"
+				return nil, cerr
+			}
+			log.Printf("Replacing %s at digest %s with the pinned %s", req.Model, digest, req.Digest)
+			replace = true
+		}
+	}
 
 	// Check if model is already running
 	models.ModelMutex.RLock()
-	if models.CurrentModel.IsRunning && strings.Contains(models.CurrentModel.Name, strings.ToLower(req.Model)) {
-		models.ModelMutex.RUnlock()
-		c.JSON(http.StatusOK, gin.H{
+	if !replace && models.CurrentModel.IsRunning && models.CurrentModel.Name == containerName {
+		result := gin.H{
 			"message":        "Model is already running and ready",
 			"model":          req.Model,
 			"container_name": models.CurrentModel.Name,
 			"port":           models.CurrentModel.Port,
 			"already_exists": true,
-		})
-		return
+		}
+		models.ModelMutex.RUnlock()
+		digest, cerr := mh.resolveDigest(containerName, req.Model, req.Digest)
+		if cerr != nil {
+			return nil, cerr
+		}
+		recordDigest(req.Model, digest, req.Digest)
+		progress("ready", nil)
+		return withDigest(result, digest), nil
 	}
 	models.ModelMutex.RUnlock()
 
+	if services.LocalMode() {
+		if req.DockerfileTemplate != "" {
+			return nil, &createError{status: http.StatusBadRequest, message: "Dockerfile templates are not used in local mode, models are pulled into the Ollama server"}
+		}
+		return mh.createLocalModel(req, progress)
+	}
+
 	// Check if model container already exists but stopped
-	// Replace colons and other invalid characters in container names
-	safeModelName := strings.ReplaceAll(strings.ToLower(req.Model), ":", "-")
-	safeModelName = strings.ReplaceAll(safeModelName, "/", "-")
-	containerName := fmt.Sprintf("ollama-%s-container", safeModelName)
-	if mh.dockerService.ContainerExists(containerName) {
+	if !replace && mh.dockerService.ContainerExists(containerName) {
 		log.Printf("Container %s already exists, starting it", containerName)
+		progress("starting", gin.H{"existing": true})
+		phase = models.PhaseRun
 		if err := mh.dockerService.StartExistingContainer(containerName); err == nil {
 			models.ModelMutex.Lock()
 			models.CurrentModel = models.ModelContainer{
@@ -69,132 +250,695 @@ func (mh *ModelHandler) CreateModel(c *gin.Context) {
 			}
 			models.ModelMutex.Unlock()
 
-			if err := mh.dockerService.WaitForModelReady(containerName, 30*time.Second); err == nil {
-				c.JSON(http.StatusOK, gin.H{
-					"message":        "Existing model container started successfully",
-					"model":          req.Model,
-					"container_name": containerName,
-					"port":           "11434",
-					"already_exists": true,
-				})
-				return
+			// The image is already built, so a quick pull is expected
+			timeouts := mh.dockerService.ReadyTimeoutsFor(req.Model)
+			timeouts.Pull = timeouts.ServerUp
+			if err := mh.dockerService.WaitForModelReadyProgress(containerName, timeouts, pullProgress(progress)); err == nil {
+				// An image built before the model was pinned may hold other weights
+				digest, cerr := mh.resolveDigest(containerName, req.Model, req.Digest)
+				if cerr == nil {
+					recordDigest(req.Model, digest, req.Digest)
+					progress("ready", nil)
+					return withDigest(gin.H{
+						"message":        "Existing model container started successfully",
+						"model":          req.Model,
+						"container_name": containerName,
+						"port":           "11434",
+						"already_exists": true,
+					}, digest), nil
+				}
+				if !req.Force {
+					mh.stopCurrentModel()
+					cerr.message += "; set force to rebuild it"
+					return nil, cerr
+				}
+				log.Printf("Rebuilding %s at the pinned digest: %s", req.Model, cerr.message)
 			}
 		}
 	}
 
+	// Catch typos before a long build that would only fail at pull time
+	phase = models.PhaseBuild
+	if cerr := mh.verifyModel(req.Model); cerr != nil {
+		return nil, cerr
+	}
+
+	// Render the Dockerfile before stopping anything, so a broken template
+	// leaves the current model running
+	dockerfileContent, numParallel, cerr := dockerfileFor(req)
+	if cerr != nil {
+		return nil, cerr
+	}
+
 	// Stop current model if running
 	mh.stopCurrentModel()
 
-	// Generate Dockerfile content
-	dockerfileContent := utils.GenerateDockerfile(req.Model)
+	progress("writing_dockerfile", nil)
 
-	// Create models directory if it doesn't exist
-	modelsDir := "/app/models"
-	if err := os.MkdirAll(modelsDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create models directory"})
-		return
+	// Each image gets its own build context so concurrent builds don't
+	// overwrite each other's Dockerfile
+	imageName := utils.ImageName(req.Model)
+	buildDir := filepath.Join(utils.ModelsDir, imageName)
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		return nil, &createError{status: http.StatusInternalServerError, message: "Failed to create models directory"}
 	}
 
 	// Write Dockerfile
-	dockerfilePath := filepath.Join(modelsDir, "Dockerfile")
+	dockerfilePath := filepath.Join(buildDir, "Dockerfile")
 	if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0644); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write Dockerfile"})
-		return
+		return nil, &createError{status: http.StatusInternalServerError, message: "Failed to write Dockerfile"}
 	}
 
-	// Build Docker image
-	imageName := fmt.Sprintf("ollama-%s", safeModelName)
-	if err := mh.dockerService.BuildDockerImage(modelsDir, imageName); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to build Docker image: %v", err)})
-		return
+	// Each model gets a host port of its own, so models created one after
+	// another can run side by side
+	port, err := mh.dockerService.FreeHostPort(containerName)
+	if err != nil {
+		return nil, &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to find a host port for the container: %v", err)}
 	}
 
-	// Run Docker container
-	containerName = fmt.Sprintf("%s-container", imageName)
-	port := "11434"
-	if err := mh.dockerService.RunDockerContainer(imageName, containerName, port); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to run Docker container: %v", err)})
-		return
+	// Build, run and wait for the model, trying again after failures that may pass
+	phase, cerr = mh.retryCreate(ctx, req.Model, containerName, progress, func() (string, bool, *createError) {
+		return mh.buildAndStart(req, buildDir, containerName, port, numParallel, progress)
+	})
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	digest, cerr := mh.resolveDigest(containerName, req.Model, req.Digest)
+	if cerr != nil {
+		// Don't serve weights other than the ones pinned
+		mh.stopCurrentModel()
+		return nil, cerr
+	}
+	recordDigest(req.Model, digest, req.Digest)
+
+	progress("ready", nil)
+	return withDigest(gin.H{
+		"message":        "Model created and container started successfully",
+		"model":          req.Model,
+		"container_name": containerName,
+		"port":           port,
+	}, digest), nil
+}
+
+// withDigest adds the model's resolved digest, when known, to a create result
+func withDigest(result gin.H, digest string) gin.H {
+	if digest != "" {
+		result["digest"] = digest
+	}
+	return result
+}
+
+// dockerfileFor renders the model's Dockerfile from the request's template,
+// the OWNGPT_DOCKERFILE_TEMPLATE file or, without either, the built-in generator.
+// It also returns the OLLAMA_NUM_PARALLEL the Dockerfile sets, 0 for a
+// template that doesn't use {{.NumParallel}} and so leaves it unknown.
+func dockerfileFor(req models.CreateDockerfileRequest) (string, int, *createError) {
+	cfg := config.Get()
+	opts := utils.DockerfileOptions{
+		SkipPreload:    cfg.SkipPreload,
+		OllamaVersion:  cfg.OllamaVersion,
+		BaseImage:      cfg.BaseImage,
+		PullAttempts:   cfg.PullAttempts,
+		PullRetryDelay: cfg.PullRetryBackoff,
+		Digest:         req.Digest,
+		NumParallel:    req.NumParallel,
+	}
+	if req.SkipPreload != nil {
+		opts.SkipPreload = *req.SkipPreload
+	}
+
+	// A bad template in the request is the client's to fix; a bad one on disk is ours
+	tmpl, status := req.DockerfileTemplate, http.StatusBadRequest
+	if tmpl == "" && cfg.DockerfileTemplate != "" {
+		data, err := os.ReadFile(cfg.DockerfileTemplate)
+		if err != nil {
+			return "", 0, &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to read Dockerfile template: %v", err)}
+		}
+		tmpl, status = string(data), http.StatusInternalServerError
+	}
+	if tmpl == "" {
+		return utils.GenerateDockerfile(req.Model, opts), utils.NumParallel(req.NumParallel), nil
+	}
+
+	dockerfile, err := utils.RenderDockerfile(tmpl, req.Model, opts)
+	if err == nil {
+		err = utils.ValidateDockerfile(dockerfile, cfg.OllamaPort)
+	}
+	if err != nil {
+		return "", 0, &createError{status, "INVALID_DOCKERFILE", err.Error()}
+	}
+	numParallel := 0
+	if utils.TemplateUsesNumParallel(tmpl, req.Model, opts) {
+		numParallel = utils.NumParallel(req.NumParallel)
+	}
+	return dockerfile, numParallel, nil
+}
+
+// buildOptions returns the build settings for the model's image:
+// OWNGPT_BUILD_NO_CACHE and OWNGPT_BUILD_INLINE_CACHE unless the request
+// overrides them, with the model's current image as the cache source, for
+// the request's platform
+func buildOptions(req models.CreateDockerfileRequest) services.BuildOptions {
+	cfg := config.Get()
+	opts := services.BuildOptions{
+		NoCache:     cfg.BuildNoCache,
+		InlineCache: cfg.BuildInlineCache,
+		CacheFrom:   utils.ImageName(req.Model),
+		Platform:    platformFor(req),
+	}
+	if req.NoCache != nil {
+		opts.NoCache = *req.NoCache
+	}
+	if req.InlineCache != nil {
+		opts.InlineCache = *req.InlineCache
+	}
+	return opts
+}
+
+// verifyModel checks the model exists in the Ollama library when
+// OWNGPT_VERIFY_MODELS is set, carrying on if the library can't be reached
+func (mh *ModelHandler) verifyModel(model string) *createError {
+	if !config.Get().VerifyModels {
+		return nil
+	}
+	exists, err := mh.libraryService.ModelExists(model)
+	if err != nil {
+		log.Printf("Could not verify model %s against the registry, continuing: %v", model, err)
+	} else if !exists {
+		return &createError{http.StatusNotFound, "MODEL_NOT_FOUND", fmt.Sprintf("Model %s was not found in the Ollama library", model)}
+	}
+	return nil
+}
+
+// createLocalModel pulls the model into the local Ollama server and loads it,
+// which is all local mode needs instead of an image and a container
+func (mh *ModelHandler) createLocalModel(req models.CreateDockerfileRequest, progress createProgress) (gin.H, *createError) {
+	containerName := utils.ContainerName(req.Model)
+	if cerr := mh.verifyModel(req.Model); cerr != nil {
+		return nil, cerr
+	}
+
+	timeouts := mh.dockerService.ReadyTimeoutsFor(req.Model)
+	if err := mh.localOllama.Pull(utils.PullReference(req.Model, req.Digest), timeouts.Pull, pullProgress(progress)); err != nil {
+		return nil, readyError(err)
+	}
+	digest, cerr := mh.resolveDigest(containerName, req.Model, req.Digest)
+	if cerr != nil {
+		return nil, cerr
+	}
+	recordDigest(req.Model, digest, req.Digest)
+
+	skipPreload := config.Get().SkipPreload
+	if req.SkipPreload != nil {
+		skipPreload = *req.SkipPreload
+	}
+	if !skipPreload {
+		progress("warming_up", nil)
+		if err := mh.localOllama.Load(req.Model, timeouts.Load); err != nil {
+			return nil, readyError(err)
+		}
 	}
 
-	// Update current model
 	models.ModelMutex.Lock()
 	models.CurrentModel = models.ModelContainer{
 		Name:      containerName,
-		Port:      port,
+		Port:      services.LocalPort(),
 		IsRunning: true,
 	}
 	models.ModelMutex.Unlock()
 
-	// Wait for the model to be ready
-	if err := mh.dockerService.WaitForModelReady(containerName, 300*time.Second); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Model failed to start: %v", err)})
+	progress("ready", nil)
+	return withDigest(gin.H{
+		"message":        "Model pulled into the local Ollama server successfully",
+		"model":          req.Model,
+		"container_name": containerName,
+		"base_url":       services.OllamaBaseURL(containerName),
+	}, digest), nil
+}
+
+// readyError turns a model that failed to become ready, in a container or
+// in the local Ollama server, into a createError
+func readyError(err error) *createError {
+	var timeoutErr *services.ReadyTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return &createError{http.StatusGatewayTimeout, "READY_TIMEOUT", fmt.Sprintf("Model failed to start: %v", err)}
+	}
+	var oomErr *services.OOMError
+	if errors.As(err, &oomErr) {
+		return &createError{http.StatusServiceUnavailable, "MODEL_OOM", fmt.Sprintf("Model failed to start: %v", err)}
+	}
+	return &createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Model failed to start: %v", err)}
+}
+
+// pullProgress turns the container's startup status into pulling and warming_up stages
+func pullProgress(progress createProgress) func(status string, percent int) {
+	return func(status string, percent int) {
+		switch status {
+		case "pulling":
+			detail := gin.H{}
+			if percent >= 0 {
+				detail["percent"] = percent
+			}
+			progress("pulling", detail)
+		case "warming_up":
+			progress("warming_up", nil)
+		default:
+			if attempt, attempts, ok := services.ParsePullRetry(status); ok {
+				progress("retrying", gin.H{"attempt": attempt, "attempts": attempts})
+			}
+		}
+	}
+}
+
+// ValidateModelfile checks a Modelfile's syntax without building it
+func (mh *ModelHandler) ValidateModelfile(c *gin.Context) {
+	var req models.ModelfileValidateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":        "Model created and container started successfully",
-		"model":          req.Model,
-		"container_name": containerName,
-		"port":           port,
+	issues := utils.ValidateModelfile(req.Modelfile)
+	if issues == nil {
+		issues = []models.ModelfileIssue{}
+	}
+	respond(c, http.StatusOK, models.ModelfileValidation{
+		Valid:  len(issues) == 0,
+		Errors: issues,
 	})
 }
 
-// GetInstalledModels returns list of installed models
+// GetInstalledModels returns the installed models with their tags, filtered by
+// any ?tag= and ?label= parameters
 func (mh *ModelHandler) GetInstalledModels(c *gin.Context) {
 	installedModels, err := mh.dockerService.GetInstalledModels()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list installed models"})
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"models": installedModels})
+	if config.Get().DiscoverExternal && !services.LocalMode() {
+		external, err := mh.dockerService.GetExternalContainers()
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to list external containers")
+			return
+		}
+		installedModels = append(installedModels, external...)
+	}
+
+	// ?tag=env:prod lists only models with that tag, and ?label=team:ml only
+	// containers with that label; repeated filters must all match
+	filters, labelFilters := c.QueryArray("tag"), c.QueryArray("label")
+	listed := make([]models.InstalledModel, 0, len(installedModels))
+	for _, model := range installedModels {
+		model.Tags = registry.Get(model.Name).Tags
+		if matchesTags(model.Tags, filters) && matchesTags(model.Labels, labelFilters) {
+			listed = append(listed, model)
+		}
+	}
+
+	respondListing(c, gin.H{"models": listed})
+}
+
+// AdoptModel makes an Ollama container created outside OWNGPT the current model
+func (mh *ModelHandler) AdoptModel(c *gin.Context) {
+	if services.LocalMode() {
+		respondError(c, http.StatusBadRequest, "Adopting containers is not available in local mode")
+		return
+	}
+	if !config.Get().DiscoverExternal {
+		respondError(c, http.StatusForbidden, "Adopting external containers is disabled, set OWNGPT_DISCOVER_EXTERNAL to enable it")
+		return
+	}
+
+	var req models.AdoptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	external, err := mh.dockerService.GetExternalContainers()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list external containers")
+		return
+	}
+	var container *models.InstalledModel
+	for i := range external {
+		if external[i].ContainerName == req.ContainerName {
+			container = &external[i]
+			break
+		}
+	}
+	if container == nil {
+		respondErrorCode(c, http.StatusNotFound, "CONTAINER_NOT_FOUND", fmt.Sprintf("No external Ollama container named %s", req.ContainerName))
+		return
+	}
+	if !container.IsRunning {
+		respondError(c, http.StatusConflict, fmt.Sprintf("Container %s is not running", req.ContainerName))
+		return
+	}
+
+	if err := mh.dockerService.ConnectToModelNetwork(req.ContainerName); err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Without an explicit model, use the container's only pulled model
+	model := req.Model
+	if model == "" {
+		pulled, err := mh.ollamaService.ListModels(req.ContainerName)
+		if err != nil {
+			respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to list models in %s: %v", req.ContainerName, err))
+			return
+		}
+		if len(pulled) != 1 {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Container %s has %d models pulled, specify one with \"model\"", req.ContainerName, len(pulled)))
+			return
+		}
+		model = pulled[0]
+	}
+
+	// Wait for any create, update or delete of the model to finish first
+	unlock := modelLocks.Lock(model)
+	defer unlock()
+	services.AdoptContainer(req.ContainerName, model)
+	models.ModelMutex.Lock()
+	models.CurrentModel = models.ModelContainer{
+		Name:      req.ContainerName,
+		Port:      strconv.Itoa(config.Get().OllamaPort),
+		IsRunning: true,
+	}
+	currentModel := models.CurrentModel
+	models.ModelMutex.Unlock()
+
+	modelsChanged()
+	log.Printf("Adopted external container %s serving %s", req.ContainerName, model)
+	respond(c, http.StatusOK, gin.H{
+		"message":       fmt.Sprintf("Container %s adopted as the current model", req.ContainerName),
+		"model":         model,
+		"current_model": currentModel,
+	})
 }
 
 // GetAvailableModels returns list of available models
 func (mh *ModelHandler) GetAvailableModels(c *gin.Context) {
 	availableModels, err := mh.dockerService.GetAvailableModels()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get available models"})
+		respondError(c, http.StatusInternalServerError, "Failed to get available models")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"available_models": availableModels})
+	respondListing(c, gin.H{"available_models": availableModels})
+}
+
+// GetBuildQueue returns running and pending image builds with queue positions
+func (mh *ModelHandler) GetBuildQueue(c *gin.Context) {
+	respond(c, http.StatusOK, mh.dockerService.GetBuildQueue())
 }
 
-// DeleteModel deletes a model and its container
+// DeleteModel deletes a model and its container. A running model is only
+// deleted with ?force=true, unless OWNGPT_DELETE_REQUIRES_FORCE is turned off.
 func (mh *ModelHandler) DeleteModel(c *gin.Context) {
 	modelName := c.Param("name")
 	if modelName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Model name is required"})
+		respondError(c, http.StatusBadRequest, "Model name is required")
 		return
 	}
 
-	if err := mh.dockerService.DeleteModel(modelName); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	force, ok := forceParam(c)
+	if !ok {
+		return
+	}
+
+	// Wait for any create, start or update of the model to finish first
+	unlock := modelLocks.Lock(modelName)
+	defer unlock()
+	if !force && config.Get().DeleteRequiresForce {
+		running, err := mh.modelRunning(modelName)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+			return
+		}
+		if running {
+			respondErrorCode(c, http.StatusConflict, "MODEL_RUNNING", fmt.Sprintf("Model %s is running. Stop it first, or pass ?force=true to delete it anyway", modelName))
+			return
+		}
+	}
+
+	var notes []string
+	var err error
+	if services.LocalMode() {
+		var found bool
+		if found, err = mh.localOllama.Delete(modelName); err == nil && !found {
+			notes = append(notes, fmt.Sprintf("Model %s was not in the local Ollama server", modelName))
+		}
+	} else {
+		notes, err = mh.dockerService.DeleteModel(modelName)
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	// Update current model if it was the deleted one
-	safeModelName := strings.ReplaceAll(strings.ToLower(modelName), ":", "-")
-	safeModelName = strings.ReplaceAll(safeModelName, "/", "-")
-	containerName := fmt.Sprintf("ollama-%s-container", safeModelName)
+	containerName := utils.ContainerName(modelName)
 	models.ModelMutex.Lock()
 	if models.CurrentModel.Name == containerName {
 		models.CurrentModel = models.ModelContainer{}
 	}
 	models.ModelMutex.Unlock()
+	registry.Delete(modelName)
+	usage.ForgetHistory(modelName)
+	modelsChanged()
+	services.ForgetCapabilities(modelName)
+
+	body := gin.H{"message": fmt.Sprintf("Model %s deleted successfully", modelName)}
+	if len(notes) > 0 {
+		body["notes"] = notes
+	}
+	respond(c, http.StatusOK, body)
+}
+
+// modelRunning reports whether the model is serving chats: it is the current
+// model or, in docker mode, its container is up. Local models are all pulled
+// into the one server, so there only the current model counts.
+func (mh *ModelHandler) modelRunning(modelName string) (bool, error) {
+	if containerName, ok := currentContainer(); ok && containerName == utils.ContainerName(modelName) {
+		return true, nil
+	}
+	if services.LocalMode() {
+		return false, nil
+	}
+	installed, err := mh.findInstalledModel(modelName)
+	if err != nil {
+		return false, err
+	}
+	return installed != nil && utils.ContainerUp(installed.State), nil
+}
+
+// GetModelInfo returns a model's container state, configuration and effective timeout
+func (mh *ModelHandler) GetModelInfo(c *gin.Context) {
+	modelName := c.Param("name")
+
+	record := registry.Get(modelName)
+	info := models.ModelInfo{
+		Name:             modelName,
+		Config:           record.Config,
+		EffectiveTimeout: services.GenerationTimeout(modelName).String(),
+		BaseURL:          services.OllamaBaseURL(utils.ContainerName(modelName)),
+		LastError:        record.LastError,
+		Digest:           record.Digest,
+		PinnedDigest:     record.PinnedDigest,
+		NumParallel:      record.NumParallel,
+		ChatSlots:        services.ChatSlots(utils.ContainerName(modelName)),
+	}
+
+	installed, err := mh.findInstalledModel(modelName)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+		return
+	}
+	info.Installed = installed
+	if installed != nil {
+		installed.Tags = record.Tags
+		if oom := mh.dockerService.OOMKilled(installed.ContainerName, time.Time{}); oom != nil {
+			info.OOMKilled, info.OOMError = true, oom.Error()
+		}
+	}
+
+	respond(c, http.StatusOK, info)
+}
+
+// UpdateModelConfig sets per-model overrides such as the generation timeout.
+// Only the fields in the body change; the others keep their values.
+func (mh *ModelHandler) UpdateModelConfig(c *gin.Context) {
+	modelName := c.Param("name")
+
+	var cfg models.ModelConfig
+	var fields map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&cfg, binding.JSON); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if cfg.TimeoutSeconds < 0 {
+		respondError(c, http.StatusBadRequest, "timeout_seconds must not be negative")
+		return
+	}
+	if cfg.Scheme != "" && cfg.Scheme != "http" && cfg.Scheme != "https" {
+		respondError(c, http.StatusBadRequest, "scheme must be http or https")
+		return
+	}
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		respondError(c, http.StatusBadRequest, "port must be between 1 and 65535")
+		return
+	}
+	if cfg.Weight != nil && *cfg.Weight < 0 {
+		respondError(c, http.StatusBadRequest, "weight must not be negative")
+		return
+	}
+	if cfg.NumCtx != 0 {
+		if err := config.CheckNumCtx(cfg.NumCtx); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if cfg.MaxTokens != 0 {
+		if err := config.CheckMaxTokens(cfg.MaxTokens); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	record := registry.Update(modelName, func(record *models.ModelRecord) {
+		mergeModelConfig(&record.Config, cfg, fields)
+	})
 
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Model %s deleted successfully", modelName)})
+	respond(c, http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Configuration for %s updated", modelName),
+		"config":  record.Config,
+	})
+}
+
+// mergeModelConfig copies the fields of cfg that were present in the request
+// body into current. A field given as 0, "" or null goes back to its default.
+func mergeModelConfig(current *models.ModelConfig, cfg models.ModelConfig, fields map[string]json.RawMessage) {
+	if _, ok := fields["timeout_seconds"]; ok {
+		current.TimeoutSeconds = cfg.TimeoutSeconds
+	}
+	if _, ok := fields["scheme"]; ok {
+		current.Scheme = cfg.Scheme
+	}
+	if _, ok := fields["port"]; ok {
+		current.Port = cfg.Port
+	}
+	if _, ok := fields["weight"]; ok {
+		current.Weight = cfg.Weight
+	}
+	if _, ok := fields["num_ctx"]; ok {
+		current.NumCtx = cfg.NumCtx
+	}
+	if _, ok := fields["max_tokens"]; ok {
+		current.MaxTokens = cfg.MaxTokens
+	}
+}
+
+// defaultBenchmarkPrompt is the same for every model so results are comparable
+const defaultBenchmarkPrompt = "Explain in three short paragraphs how a refrigerator keeps food cold."
+
+// BenchmarkModel measures a running model's tokens per second
+func (mh *ModelHandler) BenchmarkModel(c *gin.Context) {
+	modelName := c.Param("name")
+
+	req := models.BenchmarkRequest{Prompt: defaultBenchmarkPrompt, Iterations: 3}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Prompt == "" {
+		req.Prompt = defaultBenchmarkPrompt
+	}
+	if req.Iterations <= 0 {
+		req.Iterations = 3
+	}
+	if req.Iterations > 10 {
+		respondError(c, http.StatusBadRequest, "iterations must be at most 10")
+		return
+	}
+
+	installed, err := mh.findInstalledModel(modelName)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+		return
+	}
+	if installed == nil {
+		respondError(c, http.StatusNotFound, fmt.Sprintf("Model %s is not installed", modelName))
+		return
+	}
+	if !installed.IsRunning {
+		respondError(c, http.StatusConflict, fmt.Sprintf("Model %s is not running", modelName))
+		return
+	}
+
+	result, err := mh.ollamaService.Benchmark(installed.ContainerName, req.Prompt, req.Iterations)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Benchmark failed: %v", err))
+		return
+	}
+
+	respond(c, http.StatusOK, result)
+}
+
+// PingModel checks a model's container is reachable without generating
+func (mh *ModelHandler) PingModel(c *gin.Context) {
+	modelName := c.Param("name")
+	containerName := utils.ContainerName(modelName)
+
+	latency, err := mh.ollamaService.Ping(containerName, 2*time.Second)
+	if err != nil {
+		respondErrorData(c, http.StatusServiceUnavailable, "MODEL_UNREACHABLE", err.Error(), gin.H{
+			"model":     modelName,
+			"reachable": false,
+		})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"model":      modelName,
+		"reachable":  true,
+		"latency_ms": float64(latency) / float64(time.Millisecond),
+	})
+}
+
+// findInstalledModel returns the model's container, or nil if it isn't installed
+func (mh *ModelHandler) findInstalledModel(modelName string) (*models.InstalledModel, error) {
+	installedModels, err := mh.dockerService.GetInstalledModels()
+	if err != nil {
+		return nil, err
+	}
+	containerName := utils.ContainerName(modelName)
+	for i := range installedModels {
+		if installedModels[i].ContainerName == containerName {
+			return &installedModels[i], nil
+		}
+	}
+	return nil, nil
 }
 
 // GetSystemInfo returns system information including GPU availability
 func (mh *ModelHandler) GetSystemInfo(c *gin.Context) {
 	gpuAvailable := mh.dockerService.IsGPUAvailable()
 
-	c.JSON(http.StatusOK, gin.H{
+	respond(c, http.StatusOK, gin.H{
 		"gpu_available": gpuAvailable,
 		"memory_limit":  "4GB",
+		"num_ctx":       currentContextWindow(),
 		"message": func() string {
 			if gpuAvailable {
 				return "GPU acceleration available - models will use GPU with 4GB memory limit"
@@ -204,11 +948,47 @@ func (mh *ModelHandler) GetSystemInfo(c *gin.Context) {
 	})
 }
 
+// PrepareSystem pulls the Ollama base image ahead of the first model build,
+// streaming docker pull's output as progress events and finishing with a
+// result event that says whether the image was already present
+func (mh *ModelHandler) PrepareSystem(c *gin.Context) {
+	if services.LocalMode() {
+		respondError(c, http.StatusBadRequest, "Local mode builds no images, so there is no base image to prepare")
+		return
+	}
+
+	closeStream, ok := openStream(c, "")
+	if !ok {
+		return
+	}
+	defer closeStream()
+
+	streamHeaders(c, "text/event-stream")
+
+	// Pull output arrives from the command's output goroutine
+	var mu sync.Mutex
+	send := func(event string, data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+
+	present, err := mh.dockerService.PullBaseImage(func(line string) {
+		send("progress", gin.H{"log": line})
+	})
+	if err != nil {
+		send("error", gin.H{"error": err.Error()})
+		return
+	}
+	send("result", gin.H{"image": services.BaseImage(), "already_present": present})
+}
+
 // RefreshCurrentModel refreshes the current model state by detecting running containers
 func (mh *ModelHandler) RefreshCurrentModel(c *gin.Context) {
 	installedModels, err := mh.dockerService.GetInstalledModels()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh model state"})
+		respondError(c, http.StatusInternalServerError, "Failed to refresh model state")
 		return
 	}
 
@@ -229,12 +1009,12 @@ func (mh *ModelHandler) RefreshCurrentModel(c *gin.Context) {
 	models.ModelMutex.Unlock()
 
 	if currentModel.IsRunning {
-		c.JSON(http.StatusOK, gin.H{
+		respond(c, http.StatusOK, gin.H{
 			"message":       "Current model refreshed successfully",
 			"current_model": currentModel,
 		})
 	} else {
-		c.JSON(http.StatusOK, gin.H{
+		respond(c, http.StatusOK, gin.H{
 			"message":       "No running models found",
 			"current_model": nil,
 		})
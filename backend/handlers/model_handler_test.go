@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs one request through a router with the handler on the route
+func serve(method, route, path, body string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, route, handler)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateModelConfigMergesFields(t *testing.T) {
+	const model = "config-merge-test"
+	t.Cleanup(func() { registry.Delete(model) })
+	mh := NewModelHandler()
+	put := func(body string) int {
+		return serve(http.MethodPut, "/models/:name/config", "/models/"+model+"/config", body, mh.UpdateModelConfig).Code
+	}
+
+	if code := put(`{"num_ctx":4096,"weight":2,"timeout_seconds":60}`); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if code := put(`{"max_tokens":100}`); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	cfg := registry.Get(model).Config
+	if cfg.MaxTokens != 100 || cfg.NumCtx != 4096 || cfg.TimeoutSeconds != 60 || cfg.Weight == nil || *cfg.Weight != 2 {
+		t.Errorf("config after a partial update = %+v, want the earlier fields kept", cfg)
+	}
+
+	if code := put(`{"weight":null,"num_ctx":0}`); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	cfg = registry.Get(model).Config
+	if cfg.Weight != nil || cfg.NumCtx != 0 || cfg.MaxTokens != 100 {
+		t.Errorf("config after clearing = %+v, want weight and num_ctx cleared only", cfg)
+	}
+}
+
+func TestUpdateModelConfigRejectsInvalid(t *testing.T) {
+	const model = "config-invalid-test"
+	t.Cleanup(func() { registry.Delete(model) })
+	mh := NewModelHandler()
+
+	for _, body := range []string{`{"max_tokens":-1}`, `{"max_tokens":2000000}`, `{"num_ctx":1}`, `{"scheme":"ftp"}`, `{"port":-1}`, `{"port":70000}`, `{"weight":-1}`, `not json`} {
+		w := serve(http.MethodPut, "/models/:name/config", "/models/"+model+"/config", body, mh.UpdateModelConfig)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+	if cfg := registry.Get(model).Config; cfg.MaxTokens != 0 || cfg.NumCtx != 0 {
+		t.Errorf("invalid update changed the config to %+v", cfg)
+	}
+}
+
+func TestDockerfileForSkipPreload(t *testing.T) {
+	cfg := config.Get()
+	previous := cfg.SkipPreload
+	t.Cleanup(func() { cfg.SkipPreload = previous })
+
+	yes, no := true, false
+	tests := []struct {
+		configured bool
+		requested  *bool
+		preload    bool
+	}{
+		{false, nil, true},
+		{true, nil, false},
+		{true, &no, true},
+		{false, &yes, false},
+	}
+	for _, tt := range tests {
+		cfg.SkipPreload = tt.configured
+		dockerfile, _, cerr := dockerfileFor(models.CreateDockerfileRequest{Model: "llama2", SkipPreload: tt.requested})
+		if cerr != nil {
+			t.Fatal(cerr.message)
+		}
+		if preload := strings.Contains(dockerfile, "/api/generate"); preload != tt.preload {
+			t.Errorf("OWNGPT_SKIP_PRELOAD=%v, skip_preload %v: preload %v, want %v", tt.configured, tt.requested, preload, tt.preload)
+		}
+	}
+}
+
+func TestDockerfileForTemplate(t *testing.T) {
+	const valid = "FROM {{.BaseImage}}:{{.OllamaVersion}}\nEXPOSE 11434\nCMD [\"serve\"]\n"
+	file := filepath.Join(t.TempDir(), "Dockerfile.tmpl")
+	os.WriteFile(file, []byte("FROM custom/ollama\nEXPOSE 11434\nCMD [\"serve\"]\n"), 0644)
+
+	cfg := config.Get()
+	previous := cfg.DockerfileTemplate
+	t.Cleanup(func() { cfg.DockerfileTemplate = previous })
+
+	tests := []struct {
+		name       string
+		configured string
+		requested  string
+		wantFrom   string
+		wantStatus int
+	}{
+		{"built in", "", "", "FROM ollama/ollama", 0},
+		{"configured", file, "", "FROM custom/ollama", 0},
+		{"requested over configured", file, valid, "FROM ollama/ollama", 0},
+		{"invalid request", "", "FROM x\nCMD serve", "", http.StatusBadRequest},
+		{"unreadable file", filepath.Join(t.TempDir(), "missing"), "", "", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		cfg.DockerfileTemplate = tt.configured
+		dockerfile, _, cerr := dockerfileFor(models.CreateDockerfileRequest{Model: "llama2", DockerfileTemplate: tt.requested})
+		if tt.wantStatus != 0 {
+			if cerr == nil || cerr.status != tt.wantStatus {
+				t.Errorf("%s: err = %+v, want status %d", tt.name, cerr, tt.wantStatus)
+			}
+			continue
+		}
+		if cerr != nil {
+			t.Errorf("%s: %s", tt.name, cerr.message)
+		} else if !strings.HasPrefix(dockerfile, tt.wantFrom) {
+			t.Errorf("%s: Dockerfile starts %q, want %q", tt.name, strings.SplitN(dockerfile, "\n", 2)[0], tt.wantFrom)
+		}
+	}
+
+	// A broken template on disk is the server's fault, not the client's
+	os.WriteFile(file, []byte("FROM x\nCMD serve"), 0644)
+	cfg.DockerfileTemplate = file
+	if _, _, cerr := dockerfileFor(models.CreateDockerfileRequest{Model: "llama2"}); cerr == nil || cerr.status != http.StatusInternalServerError || cerr.code != "INVALID_DOCKERFILE" {
+		t.Errorf("invalid configured template: err = %+v, want 500 INVALID_DOCKERFILE", cerr)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/usage"
+)
+
+// GetModelHistory returns the model's most recent generations, newest first,
+// with ?limit=N returning only the last N. The history is kept in memory, so
+// it starts empty after a restart.
+func (mh *ModelHandler) GetModelHistory(c *gin.Context) {
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("limit must be a positive integer, got %q", value))
+			return
+		}
+		limit = parsed
+	}
+
+	modelName := c.Param("name")
+	respond(c, http.StatusOK, models.ModelHistory{
+		Model:       modelName,
+		Size:        max(config.Get().GenerationHistory, 0),
+		Generations: usage.History(modelName, limit),
+	})
+}
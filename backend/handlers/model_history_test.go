@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/usage"
+)
+
+func TestGetModelHistory(t *testing.T) {
+	startFakeOllama(t, "Hello", " there.")
+	cfg := config.Get()
+	size, logPrompts := cfg.GenerationHistory, cfg.LogPrompts
+	cfg.GenerationHistory, cfg.LogPrompts = 10, false
+	t.Cleanup(func() {
+		cfg.GenerationHistory, cfg.LogPrompts = size, logPrompts
+		usage.ForgetHistory("llama2")
+	})
+	usage.ForgetHistory("llama2")
+	mh := NewModelHandler()
+
+	chat(NewChatHandler().SendMessage, `{"message":"hi there"}`)
+	chat(NewChatHandler().SendMessageStream, `{"message":"and again"}`)
+
+	w := serve(http.MethodGet, "/models/:name/history", "/models/llama2/history?limit=1", "", mh.GetModelHistory)
+	var history models.ModelHistory
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if w.Code != http.StatusOK || history.Model != "llama2" || history.Size != 10 || len(history.Generations) != 1 {
+		t.Fatalf("status %d: %s, want the newest generation", w.Code, w.Body)
+	}
+	newest := history.Generations[0]
+	if newest.PromptChars != len("and again") || newest.CompletionTokens != 2 || newest.FinishReason != models.FinishEnd || newest.Prompt != "" {
+		t.Errorf("newest generation = %+v, want the streamed chat without its prompt", newest)
+	}
+
+	for _, limit := range []string{"0", "-1", "many"} {
+		if w := serve(http.MethodGet, "/models/:name/history", "/models/llama2/history?limit="+limit, "", mh.GetModelHistory); w.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: status %d, want 400", limit, w.Code)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/services"
+)
+
+func TestCreateModelLabels(t *testing.T) {
+	cfg := config.Get()
+	labels := cfg.Labels
+	cfg.Labels = map[string]string{"team": "ml"}
+	t.Cleanup(func() { cfg.Labels = labels })
+	mh, calls := fakeDockerHandler(t)
+
+	for _, body := range []string{
+		`{"model":"llama2","labels":{"owngpt.model":"mistral"}}`,
+		`{"model":"llama2","labels":{"Team":"ml"}}`,
+		`{"model":"llama2","labels":{"notes":"a,b"}}`,
+	} {
+		if w := serve(http.MethodPost, "/models", "/models", body, mh.CreateModel); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+	if len(calls()) > 0 {
+		t.Errorf("invalid labels ran %q", calls())
+	}
+
+	// Local mode has no containers to put them on
+	startFakeOllama(t)
+	w := serve(http.MethodPost, "/models", "/models", `{"model":"llama2","labels":{"team":"ml"}}`, NewModelHandler().CreateModel)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "local mode") {
+		t.Errorf("local mode: status %d: %s, want 400", w.Code, w.Body)
+	}
+}
+
+func TestInstalledModelsLabelFilter(t *testing.T) {
+	ps := "ollama-llama2-container\tUp 5 minutes\t\tllama2\towngpt.labels=team;env,team=ml,env=prod\n" +
+		"ollama-mistral-container\tUp 5 minutes\t\tmistral\towngpt.labels=team,team=web\n" +
+		"ollama-phi-container\tUp 5 minutes\t\tphi\t\n"
+	runner := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		if len(args) > 0 && args[0] == "ps" {
+			return exec.CommandContext(ctx, "printf", "%s", ps)
+		}
+		return exec.CommandContext(ctx, "true")
+	}
+	mh := &ModelHandler{dockerService: services.NewDockerServiceWithRunner(runner)}
+
+	tests := map[string]string{
+		"/models/installed":                            "llama2,mistral,phi",
+		"/models/installed?label=team":                 "llama2,mistral",
+		"/models/installed?label=team:ml":              "llama2",
+		"/models/installed?label=team:ml&label=env:qa": "",
+		"/models/installed?label=maintainer":           "",
+	}
+	for path, want := range tests {
+		w := serve(http.MethodGet, "/models/installed", path, "", mh.GetInstalledModels)
+		var resp struct {
+			Models []models.InstalledModel `json:"models"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var names []string
+		for _, model := range resp.Models {
+			names = append(names, model.Name)
+		}
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("%s lists %q, want %q", path, got, want)
+		}
+	}
+}
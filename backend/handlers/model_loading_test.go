@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owngpt/services"
+)
+
+// startLoading waits on the current model's container the way a model
+// create does, with its startup script reporting pulling until the test ends
+func startLoading(t *testing.T) {
+	var pulled atomic.Bool
+	runner := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		switch {
+		case len(args) > 0 && args[0] == "inspect":
+			return exec.CommandContext(ctx, "echo", "running")
+		case len(args) > 0 && args[0] == "exec" && !pulled.Load():
+			return exec.CommandContext(ctx, "echo", "pulling")
+		}
+		return exec.CommandContext(ctx, "echo", "success")
+	}
+	ds := services.NewDockerServiceWithRunner(runner)
+	timeouts := services.ReadyTimeouts{ServerUp: time.Minute, Pull: time.Minute, Load: time.Minute}
+	done := make(chan error, 1)
+	go func() { done <- ds.WaitForModelReadyProgress("ollama-llama2-container", timeouts, nil) }()
+	t.Cleanup(func() {
+		pulled.Store(true)
+		<-done
+	})
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if status, loading := services.ModelLoading("ollama-llama2-container"); loading && status.Status == "pulling" {
+			return
+		}
+	}
+	t.Fatal("the model never started pulling")
+}
+
+func TestChatModelLoading(t *testing.T) {
+	fake := startFakeOllama(t, "Hi")
+	startLoading(t)
+
+	ch := NewChatHandler()
+
+	w := chat(ch.SendMessage, `{"message":"hi"}`)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"code":"MODEL_LOADING"`) {
+		t.Fatalf("status %d: %s, want 503 MODEL_LOADING", w.Code, w.Body)
+	}
+	if retry := w.Header().Get("Retry-After"); retry == "" || retry == "0" {
+		t.Errorf("Retry-After = %q, want seconds to wait", retry)
+	}
+	if !strings.Contains(w.Body.String(), `"status":"pulling"`) {
+		t.Errorf("body = %s, want the startup status", w.Body)
+	}
+	if w := chat(ch.SendMessageStream, `{"message":"hi"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("stream: status %d, want 503", w.Code)
+	}
+	if w := chat(ch.Embed, `{"input":["hi"]}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("embed: status %d, want 503", w.Code)
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("a chat for a loading model was generated")
+	}
+}
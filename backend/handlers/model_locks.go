@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"sync"
+
+	"owngpt/utils"
+)
+
+// modelLocks serializes the operations that create, start, update, pull,
+// adopt or remove a model's container, so a delete can't remove a container a
+// create is starting. Operations on different models don't wait for each other.
+var modelLocks = &keyedMutex{locks: make(map[string]*keyedLock)}
+
+// keyedMutex is a set of mutexes created on demand, one per key
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is one key's mutex, counting the holders and waiters that still
+// need it so it can be dropped once nobody does
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock waits for the model's lock and returns the function that releases it
+func (km *keyedMutex) Lock(model string) (unlock func()) {
+	key := utils.ContainerName(model)
+
+	km.mu.Lock()
+	lock, ok := km.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		km.locks[key] = lock
+	}
+	lock.refs++
+	km.mu.Unlock()
+
+	lock.Lock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lock.Unlock()
+			km.mu.Lock()
+			if lock.refs--; lock.refs == 0 {
+				delete(km.locks, key)
+			}
+			km.mu.Unlock()
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexSerializesOneModel(t *testing.T) {
+	km := &keyedMutex{locks: make(map[string]*keyedLock)}
+
+	var holders, most atomic.Int32
+	counter := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Names that differ only in case are the same model
+			model := "llama2"
+			if i%2 == 1 {
+				model = "LLaMA2"
+			}
+			unlock := km.Lock(model)
+			defer unlock()
+
+			if n := holders.Add(1); n > most.Load() {
+				most.Store(n)
+			}
+			counter++
+			time.Sleep(100 * time.Microsecond)
+			holders.Add(-1)
+		}(i)
+	}
+	wg.Wait()
+
+	if most.Load() != 1 || counter != 50 {
+		t.Errorf("%d held the lock at once, counter = %d", most.Load(), counter)
+	}
+	if len(km.locks) != 0 {
+		t.Errorf("%d locks left after every holder released", len(km.locks))
+	}
+}
+
+func TestKeyedMutexModelsDontWait(t *testing.T) {
+	km := &keyedMutex{locks: make(map[string]*keyedLock)}
+	unlock := km.Lock("llama2")
+
+	done := make(chan struct{})
+	go func() {
+		km.Lock("mistral")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("locking another model waited for llama2")
+	}
+
+	waiting := make(chan struct{})
+	go func() {
+		km.Lock("llama2")()
+		close(waiting)
+	}()
+	select {
+	case <-waiting:
+		t.Fatal("a second lock of llama2 didn't wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Unlocking twice releases once, handing the lock to the waiter
+	unlock()
+	unlock()
+	<-waiting
+	if len(km.locks) != 0 {
+		t.Errorf("%d locks left", len(km.locks))
+	}
+}
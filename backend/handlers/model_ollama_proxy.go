@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/middleware"
+	"owngpt/services"
+)
+
+// maxProxyRequestBytes caps the body passed through to Ollama
+const maxProxyRequestBytes = 1 << 20
+
+// ProxyOllama passes a call to one of a few Ollama API endpoints OWNGPT
+// doesn't wrap, such as copy or delete, through to the model's Ollama server
+// and returns Ollama's response as is. Endpoints outside the allowlist give
+// 403 ENDPOINT_NOT_ALLOWED. The route requires the admin token.
+func (mh *ModelHandler) ProxyOllama(c *gin.Context) {
+	modelName := c.Param("name")
+	endpoint := c.Param("endpoint")
+	middleware.SetModel(c, modelName)
+
+	if !services.ProxyAllowed(endpoint) {
+		respondErrorData(c, http.StatusForbidden, "ENDPOINT_NOT_ALLOWED",
+			fmt.Sprintf("Ollama endpoint %q can't be called through OWNGPT", endpoint),
+			gin.H{"allowed": services.ProxyEndpoints()})
+		return
+	}
+
+	installed, err := mh.findInstalledModel(modelName)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+		return
+	}
+	if installed == nil {
+		respondErrorCode(c, http.StatusNotFound, "MODEL_NOT_FOUND", fmt.Sprintf("Model %s is not installed", modelName))
+		return
+	}
+	if !installed.IsRunning {
+		respondError(c, http.StatusConflict, fmt.Sprintf("Model %s is not running", modelName))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxProxyRequestBytes+1))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Failed to read the request body: %v", err))
+		return
+	}
+	if len(body) > maxProxyRequestBytes {
+		respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxProxyRequestBytes))
+		return
+	}
+
+	log.Printf("Passing /api/%s through to %s", endpoint, installed.ContainerName)
+	resp, err := mh.ollamaService.ProxyOllama(c.Request.Context(), installed.ContainerName, endpoint, body)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to reach the model's Ollama server: %v", err))
+		return
+	}
+	if resp.ContentType == "" {
+		resp.ContentType = "application/octet-stream"
+	}
+	c.Data(resp.Status, resp.ContentType, resp.Body)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProxyOllama(t *testing.T) {
+	fake := startFakeOllama(t)
+	fake.system = "You are terse."
+	mh := NewModelHandler()
+	const route = "/models/:name/ollama/:endpoint"
+
+	w := serve(http.MethodPost, route, "/models/llama2/ollama/show", `{"model":"llama2"}`, mh.ProxyOllama)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"system":"You are terse."`) {
+		t.Errorf("show: status %d: %s, want Ollama's reply as is", w.Code, w.Body)
+	}
+
+	serve(http.MethodPost, route, "/models/llama2/ollama/copy", `{"source":"llama2","destination":"llama2-backup"}`, mh.ProxyOllama)
+	fake.mu.Lock()
+	last := fake.payloads[len(fake.payloads)-1]
+	fake.mu.Unlock()
+	if last["destination"] != "llama2-backup" {
+		t.Errorf("copy sent %v to Ollama, want the request body", last)
+	}
+}
+
+func TestProxyOllamaRejected(t *testing.T) {
+	startFakeOllama(t)
+	mh := NewModelHandler()
+	const route = "/models/:name/ollama/:endpoint"
+
+	for _, endpoint := range []string{"pull", "push", "create", "generate"} {
+		w := serve(http.MethodPost, route, "/models/llama2/ollama/"+endpoint, `{}`, mh.ProxyOllama)
+		var resp struct {
+			Code    string   `json:"code"`
+			Allowed []string `json:"allowed"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusForbidden || resp.Code != "ENDPOINT_NOT_ALLOWED" || len(resp.Allowed) == 0 {
+			t.Errorf("%s: status %d: %s, want 403 ENDPOINT_NOT_ALLOWED with the allowlist", endpoint, w.Code, w.Body)
+		}
+	}
+
+	w := serve(http.MethodPost, route, "/models/mistral/ollama/show", `{}`, mh.ProxyOllama)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "MODEL_NOT_FOUND") {
+		t.Errorf("uninstalled model: status %d: %s, want 404 MODEL_NOT_FOUND", w.Code, w.Body)
+	}
+
+	big := `{"model":"` + strings.Repeat("x", maxProxyRequestBytes) + `"}`
+	if w := serve(http.MethodPost, route, "/models/llama2/ollama/show", big, mh.ProxyOllama); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: status %d, want 413", w.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/models"
+	"owngpt/registry"
+	"owngpt/services"
+)
+
+// maxNumParallel bounds num_parallel, as Ollama sets aside context memory for
+// each request it serves in parallel
+const maxNumParallel = 32
+
+// validNumParallel checks the request's num_parallel, responding 400 and
+// returning false when it is out of range or the model has no container to
+// set it on
+func validNumParallel(c *gin.Context, numParallel int) bool {
+	if numParallel == 0 {
+		return true
+	}
+	if services.LocalMode() {
+		respondError(c, http.StatusBadRequest, "num_parallel is set on model containers, which local mode doesn't use")
+		return false
+	}
+	if numParallel < 0 || numParallel > maxNumParallel {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid num_parallel %d, expected 1 to %d", numParallel, maxNumParallel))
+		return false
+	}
+	return true
+}
+
+// recordNumParallel stores the OLLAMA_NUM_PARALLEL the model's container was
+// started with in its registry record, where the chat queue picks it up. 0
+// means it isn't known, leaving only OWNGPT_CHAT_CONCURRENCY to limit chats.
+func recordNumParallel(model string, numParallel int) {
+	registry.Update(model, func(record *models.ModelRecord) {
+		record.NumParallel = numParallel
+	})
+}
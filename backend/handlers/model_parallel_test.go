@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/registry"
+	"owngpt/services"
+	"owngpt/utils"
+)
+
+func TestDockerfileForNumParallel(t *testing.T) {
+	port := config.Get().OllamaPort
+	withParallel := fmt.Sprintf("FROM ollama/ollama\nENV OLLAMA_NUM_PARALLEL={{.NumParallel}}\nEXPOSE %d\nENTRYPOINT [\"ollama\", \"serve\"]\n", port)
+	withoutParallel := fmt.Sprintf("FROM ollama/ollama\nENV OLLAMA_NUM_PARALLEL=8\nEXPOSE %d\nENTRYPOINT [\"ollama\", \"serve\"]\n", port)
+
+	tests := []struct {
+		name        string
+		template    string
+		numParallel int
+		want        int
+	}{
+		{"built-in", "", 4, 4},
+		{"built-in default", "", 0, utils.DefaultNumParallel},
+		{"template using it", withParallel, 4, 4},
+		{"template using the default", withParallel, 0, utils.DefaultNumParallel},
+		{"template ignoring it", withoutParallel, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got, cerr := dockerfileFor(models.CreateDockerfileRequest{Model: "llama2", DockerfileTemplate: tt.template, NumParallel: tt.numParallel})
+			if cerr != nil {
+				t.Fatalf("dockerfileFor: %s", cerr.message)
+			}
+			if got != tt.want {
+				t.Errorf("num_parallel = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordedNumParallelLimitsChats(t *testing.T) {
+	cfg := config.Get()
+	previousConcurrency, previousDepth := cfg.ChatConcurrency, cfg.ChatQueueDepth
+	cfg.ChatConcurrency, cfg.ChatQueueDepth = 0, 4
+	t.Cleanup(func() { cfg.ChatConcurrency, cfg.ChatQueueDepth = previousConcurrency, previousDepth })
+
+	model := "parallel-model"
+	containerName := utils.ContainerName(model)
+	t.Cleanup(func() { registry.Delete(model) })
+
+	// acquire takes a chat slot, failing if none frees up quickly
+	acquire := func() (func(), error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return services.AcquireChat(ctx, containerName, "")
+	}
+
+	recordNumParallel(model, 2)
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := acquire()
+		if err != nil {
+			t.Fatalf("chat %d: %v", i+1, err)
+		}
+		releases = append(releases, release)
+	}
+	if _, err := acquire(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("third chat got %v, want it to wait", err)
+	}
+	releases[0]()
+	if release, err := acquire(); err != nil {
+		t.Errorf("chat after a release: %v", err)
+	} else {
+		release()
+	}
+	releases[1]()
+
+	// Without a known parallelism nothing limits the model's chats
+	recordNumParallel(model, 0)
+	for i := 0; i < 3; i++ {
+		release, err := acquire()
+		if err != nil {
+			t.Fatalf("unlimited chat %d: %v", i+1, err)
+		}
+		defer release()
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+)
+
+// ping gets /models/llama2/ping with the given Accept header
+func ping(accept string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/models/:name/ping", NewModelHandler().PingModel)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/models/llama2/ping", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPingModel(t *testing.T) {
+	startFakeOllama(t)
+	var body map[string]interface{}
+	w := ping("")
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusOK || body["reachable"] != true || body["model"] != "llama2" {
+		t.Errorf("status %d: %s, want llama2 reachable", w.Code, w.Body)
+	}
+
+	// Nothing listens on the port
+	cfg := config.Get()
+	url := cfg.OllamaURL
+	cfg.OllamaURL = "http://127.0.0.1:1"
+	t.Cleanup(func() { cfg.OllamaURL = url })
+
+	body = nil
+	w = ping("")
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusServiceUnavailable || body["code"] != "MODEL_UNREACHABLE" || body["reachable"] != false || body["model"] != "llama2" || body["error"] == "" {
+		t.Errorf("status %d: %s, want 503 MODEL_UNREACHABLE", w.Code, w.Body)
+	}
+
+	var envelope struct {
+		Envelope
+		Data map[string]interface{} `json:"data"`
+	}
+	w = ping("application/vnd.owngpt.v2+json")
+	json.Unmarshal(w.Body.Bytes(), &envelope)
+	if w.Code != http.StatusServiceUnavailable || envelope.Success || envelope.Code != "MODEL_UNREACHABLE" || envelope.Data["reachable"] != false {
+		t.Errorf("enveloped: status %d: %s, want 503 MODEL_UNREACHABLE in the envelope", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/services"
+)
+
+// validPlatform checks the request's platform, responding 400 and returning
+// false when it isn't one images are published for or the model has no image
+// to build for it
+func validPlatform(c *gin.Context, platform string) bool {
+	if platform == "" {
+		return true
+	}
+	if services.LocalMode() {
+		respondError(c, http.StatusBadRequest, "platform is set on model images, which local mode doesn't build")
+		return false
+	}
+	if err := config.CheckPlatform(platform); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// platformFor returns the platform the model's image is built and run for:
+// the request's, otherwise OWNGPT_PLATFORM
+func platformFor(req models.CreateDockerfileRequest) string {
+	if req.Platform != "" {
+		return req.Platform
+	}
+	return config.Get().Platform
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+func TestCreateModelPlatform(t *testing.T) {
+	mh, calls := fakeDockerHandler(t)
+	w := serve(http.MethodPost, "/models", "/models", `{"model":"llama2","platform":"windows/amd64"}`, mh.CreateModel)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unsupported platform") {
+		t.Errorf("status %d: %s, want 400", w.Code, w.Body)
+	}
+	if len(calls()) > 0 {
+		t.Errorf("an unsupported platform ran %q", calls())
+	}
+
+	// Local mode has no image to build for it
+	startFakeOllama(t)
+	w = serve(http.MethodPost, "/models", "/models", `{"model":"llama2","platform":"linux/arm64"}`, NewModelHandler().CreateModel)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "local mode") {
+		t.Errorf("local mode: status %d: %s, want 400", w.Code, w.Body)
+	}
+}
+
+func TestPlatformFor(t *testing.T) {
+	cfg := config.Get()
+	platform := cfg.Platform
+	cfg.Platform = "linux/amd64"
+	t.Cleanup(func() { cfg.Platform = platform })
+
+	if got := platformFor(models.CreateDockerfileRequest{Model: "llama2"}); got != "linux/amd64" {
+		t.Errorf("platformFor = %q, want OWNGPT_PLATFORM's", got)
+	}
+	if got := platformFor(models.CreateDockerfileRequest{Model: "llama2", Platform: "linux/arm64"}); got != "linux/arm64" {
+		t.Errorf("platformFor = %q, want the request's", got)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+)
+
+func TestCreateModelPolicy(t *testing.T) {
+	cfg := config.Get()
+	policy := cfg.ModelPolicy
+	cfg.ModelPolicy = config.ModelPolicy{Allow: []string{"llama3*"}, Deny: []string{"*:70b"}}
+	t.Cleanup(func() { cfg.ModelPolicy = policy })
+	mh, calls := fakeDockerHandler(t)
+
+	for _, model := range []string{"mistral", "llama3:70b"} {
+		body := `{"model":"` + model + `"}`
+		for _, handler := range []gin.HandlerFunc{mh.CreateModel, mh.CreateModelStream} {
+			if w := serve(http.MethodPost, "/models", "/models", body, handler); w.Code != http.StatusForbidden {
+				t.Errorf("creating %s: status %d, want 403", model, w.Code)
+			}
+		}
+	}
+	if len(calls()) > 0 {
+		t.Errorf("refused models ran %q", calls())
+	}
+
+	w := serve(http.MethodPost, "/models", "/models", `{"model":"phi3"}`, mh.CreateModel)
+	if !strings.Contains(w.Body.String(), "MODEL_NOT_ALLOWED") || !strings.Contains(w.Body.String(), "only allows llama3*") {
+		t.Errorf("body = %s, want MODEL_NOT_ALLOWED naming the allowlist", w.Body)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/lifecycle"
+	"owngpt/middleware"
+	"owngpt/models"
+	"owngpt/services"
+	"owngpt/utils"
+)
+
+// psPollInterval is how often GET /models/:name/ps?follow=true polls Ollama
+const psPollInterval = 2 * time.Second
+
+// GetModelPS reports which models the model's Ollama server holds in memory,
+// their size and when keep-alive unloads them. With ?follow=true it streams
+// the status as Server-Sent Events, sending a ps event whenever it changes.
+func (mh *ModelHandler) GetModelPS(c *gin.Context) {
+	modelName := c.Param("name")
+	middleware.SetModel(c, modelName)
+	containerName := utils.ContainerName(modelName)
+
+	follow := false
+	if value := c.Query("follow"); value != "" {
+		var err error
+		if follow, err = strconv.ParseBool(value); err != nil {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid follow value %q, expected true or false", value))
+			return
+		}
+	}
+
+	ps, err := mh.modelPS(modelName, containerName)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadGateway, "MODEL_UNREACHABLE", fmt.Sprintf("Failed to read the loaded models of %s: %v", modelName, err))
+		return
+	}
+	if !follow {
+		respond(c, http.StatusOK, ps)
+		return
+	}
+
+	closeStream, ok := openStream(c, "")
+	if !ok {
+		return
+	}
+	defer closeStream()
+
+	streamHeaders(c, "text/event-stream")
+
+	last, _ := json.Marshal(ps)
+	c.SSEvent("ps", ps)
+	c.Writer.Flush()
+
+	// An error is sent once per failure, and the status again once it recovers
+	failing := false
+	ticker := time.NewTicker(psPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.Request.Context().Done():
+			return
+		case <-lifecycle.Draining().Done():
+			return
+		}
+
+		ps, err := mh.modelPS(modelName, containerName)
+		if err != nil {
+			if !failing {
+				failing = true
+				c.SSEvent("error", gin.H{"error": err.Error()})
+				c.Writer.Flush()
+			}
+			continue
+		}
+		current, _ := json.Marshal(ps)
+		if !failing && string(current) == string(last) {
+			continue
+		}
+		failing, last = false, current
+		c.SSEvent("ps", ps)
+		c.Writer.Flush()
+	}
+}
+
+// modelPS reads the loaded models of the model's Ollama server
+func (mh *ModelHandler) modelPS(modelName, containerName string) (models.ModelPS, error) {
+	loaded, err := mh.ollamaService.LoadedModels(containerName)
+	if err != nil {
+		return models.ModelPS{}, err
+	}
+	ps := models.ModelPS{Model: modelName, Models: loaded}
+	for _, model := range loaded {
+		if services.SameModel(model.Name, modelName) {
+			ps.Loaded = true
+		}
+	}
+	return ps, nil
+}
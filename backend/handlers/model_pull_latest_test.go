@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+func TestPullLatest(t *testing.T) {
+	fake := startFakeOllama(t)
+	fake.digest, fake.pulledDigest = "sha256:old", "sha256:new"
+	t.Cleanup(func() { registry.Delete("llama2") })
+	mh := NewModelHandler()
+
+	w := serve(http.MethodPost, "/models/:name/pull-latest", "/models/llama2/pull-latest", "", mh.PullLatest)
+	events := sseEvents(w.Body.String())
+	want := `result: {"changed":true,"digest":"sha256:new","model":"llama2","previous_digest":"sha256:old"}`
+	if len(events) == 0 || events[len(events)-1] != want {
+		t.Fatalf("events = %q, want %s last", events, want)
+	}
+	if digest := registry.Get("llama2").Digest; digest != "sha256:new" {
+		t.Errorf("recorded digest %q, want sha256:new", digest)
+	}
+
+	// Pulling again finds nothing new
+	w = serve(http.MethodPost, "/models/:name/pull-latest", "/models/llama2/pull-latest", "", mh.PullLatest)
+	if events := sseEvents(w.Body.String()); !strings.Contains(events[len(events)-1], `"changed":false`) {
+		t.Errorf("events = %q, want the model unchanged", events)
+	}
+}
+
+func TestPullLatestPinned(t *testing.T) {
+	fake := startFakeOllama(t)
+	fake.digest = "sha256:old"
+	registry.Update("llama2", func(record *models.ModelRecord) { record.PinnedDigest = "sha256:old" })
+	t.Cleanup(func() { registry.Delete("llama2") })
+	mh := NewModelHandler()
+
+	w := serve(http.MethodPost, "/models/:name/pull-latest", "/models/llama2/pull-latest", "", mh.PullLatest)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "MODEL_PINNED") {
+		t.Errorf("status = %d: %s, want 409 MODEL_PINNED", w.Code, w.Body)
+	}
+
+	// Forcing the pull unpins the model
+	serve(http.MethodPost, "/models/:name/pull-latest", "/models/llama2/pull-latest?force=true", "", mh.PullLatest)
+	if pin := registry.Get("llama2").PinnedDigest; pin != "" {
+		t.Errorf("still pinned to %q after a forced pull", pin)
+	}
+}
+
+func TestPullLatestNotInstalled(t *testing.T) {
+	startFakeOllama(t)
+	w := serve(http.MethodPost, "/models/:name/pull-latest", "/models/mistral/pull-latest", "", NewModelHandler().PullLatest)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d: %s, want 404", w.Code, w.Body)
+	}
+}
+
+func TestPullLatestWaitsForModelLock(t *testing.T) {
+	fake := startFakeOllama(t)
+	fake.digest, fake.pulledDigest = "sha256:old", "sha256:new"
+	t.Cleanup(func() { registry.Delete("llama2") })
+
+	// A create, update or delete of the model is under way
+	unlock := modelLocks.Lock("llama2")
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(http.MethodPost, "/models/:name/pull-latest", "/models/llama2/pull-latest", "", NewModelHandler().PullLatest)
+	}()
+
+	select {
+	case w := <-done:
+		unlock()
+		t.Fatalf("pulled while the model was locked: %s", w.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if digest := registry.Get("llama2").Digest; digest != "" {
+		t.Errorf("recorded digest %q while the model was locked", digest)
+	}
+
+	unlock()
+	w := <-done
+	if events := sseEvents(w.Body.String()); len(events) == 0 || !strings.Contains(events[len(events)-1], `"changed":true`) {
+		t.Errorf("events = %q, want the pull once the lock was free", events)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+// Limits on model tags, which are meant for labels and short notes
+const (
+	maxTags          = 32
+	maxTagValueBytes = 1024
+)
+
+// tagKeyPattern keeps keys usable in ?tag=key:value filters
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// SetModelTags replaces a model's free-form key/value tags
+func (mh *ModelHandler) SetModelTags(c *gin.Context) {
+	modelName := c.Param("name")
+
+	var req models.ModelTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateTags(req.Tags); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	record := registry.SetTags(modelName, req.Tags)
+	respond(c, http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Tags for %s updated", modelName),
+		"tags":    record.Tags,
+	})
+}
+
+// validateTags checks tag keys are usable in filters and values are short
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("a model can have at most %d tags", maxTags)
+	}
+	for key, value := range tags {
+		if !tagKeyPattern.MatchString(key) {
+			return fmt.Errorf("tag key %q must be 1-64 letters, digits, '.', '_' or '-'", key)
+		}
+		if len(value) > maxTagValueBytes {
+			return fmt.Errorf("tag %s is longer than %d bytes", key, maxTagValueBytes)
+		}
+	}
+	return nil
+}
+
+// matchesTags reports whether tags satisfy every filter, each either "key"
+// (the tag is set) or "key:value" (it is set to that value)
+func matchesTags(tags map[string]string, filters []string) bool {
+	for _, filter := range filters {
+		key, value, hasValue := strings.Cut(filter, ":")
+		actual, ok := tags[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
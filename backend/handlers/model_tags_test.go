@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/registry"
+)
+
+func TestMatchesTags(t *testing.T) {
+	tags := map[string]string{"env": "prod", "team": "ml", "note": "a:b"}
+	tests := []struct {
+		filters []string
+		want    bool
+	}{
+		{nil, true},
+		{[]string{"env"}, true},
+		{[]string{"env:prod"}, true},
+		{[]string{"env:dev"}, false},
+		{[]string{"owner"}, false},
+		{[]string{"env:prod", "team:ml"}, true},
+		{[]string{"env:prod", "team:data"}, false},
+		{[]string{"note:a:b"}, true},
+		{[]string{"env:"}, false},
+	}
+	for _, tt := range tests {
+		if got := matchesTags(tags, tt.filters); got != tt.want {
+			t.Errorf("matchesTags(%v) = %v, want %v", tt.filters, got, tt.want)
+		}
+	}
+	if matchesTags(nil, []string{"env"}) {
+		t.Error("a model without tags matched a filter")
+	}
+}
+
+func TestSetModelTags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/models/:name/tags", (&ModelHandler{}).SetModelTags)
+	t.Cleanup(func() { registry.SetTags("tagged-model", nil) })
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"tags":{"env":"prod"}}`, http.StatusOK},
+		{`{"tags":{"bad key":"x"}}`, http.StatusBadRequest},
+		{`{"tags":{"env":"` + strings.Repeat("x", maxTagValueBytes+1) + `"}}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/models/tagged-model/tags", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%.40s: status %d, want %d: %s", tt.body, w.Code, tt.status, w.Body)
+		}
+	}
+
+	// Rejected updates leave the last good tags in place
+	if got := registry.Get("tagged-model").Tags; got["env"] != "prod" || len(got) != 1 {
+		t.Errorf("model has tags %v", got)
+	}
+}
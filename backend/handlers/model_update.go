@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/middleware"
+	"owngpt/models"
+	"owngpt/registry"
+	"owngpt/services"
+	"owngpt/utils"
+)
+
+var (
+	updatesMu sync.Mutex
+	// updating holds the containers with a rolling update in progress
+	updating = make(map[string]bool)
+)
+
+// UpdateModel rebuilds a model's image and replaces its container without
+// downtime: the new container starts next to the old one, which keeps serving
+// until the new one is ready and stays in place if it never gets there
+func (mh *ModelHandler) UpdateModel(c *gin.Context) {
+	modelName := c.Param("name")
+	middleware.SetModel(c, modelName)
+
+	var req models.UpdateModelRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	createReq := models.CreateDockerfileRequest{
+		Model:              modelName,
+		SkipPreload:        req.SkipPreload,
+		DockerfileTemplate: req.DockerfileTemplate,
+		NoCache:            req.NoCache,
+		InlineCache:        req.InlineCache,
+		// The rebuilt image pulls the same digest the model is pinned to
+		Digest:      registry.Get(modelName).PinnedDigest,
+		NumParallel: req.NumParallel,
+		Platform:    req.Platform,
+	}
+	if createReq.NumParallel == 0 {
+		createReq.NumParallel = registry.Get(modelName).NumParallel
+	}
+	if !authorizeTemplate(c, createReq) || !validNumParallel(c, req.NumParallel) || !validPlatform(c, req.Platform) {
+		return
+	}
+	if services.LocalMode() {
+		respondError(c, http.StatusBadRequest, "Rolling updates replace model containers, which local mode doesn't use")
+		return
+	}
+
+	containerName := utils.ContainerName(modelName)
+	updatesMu.Lock()
+	if updating[containerName] {
+		updatesMu.Unlock()
+		respondErrorCode(c, http.StatusConflict, "UPDATE_IN_PROGRESS", fmt.Sprintf("Model %s is already being updated", modelName))
+		return
+	}
+	updating[containerName] = true
+	updatesMu.Unlock()
+	defer func() {
+		updatesMu.Lock()
+		delete(updating, containerName)
+		updatesMu.Unlock()
+	}()
+
+	// Wait for any create or delete of the model to finish first
+	unlock := modelLocks.Lock(modelName)
+	defer unlock()
+
+	installed, err := mh.findInstalledModel(modelName)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+		return
+	}
+	if installed == nil {
+		respondErrorCode(c, http.StatusNotFound, "MODEL_NOT_FOUND", fmt.Sprintf("Model %s is not installed", modelName))
+		return
+	}
+
+	result, cerr := mh.updateModel(createReq, *installed)
+	if cerr != nil {
+		respondErrorCode(c, cerr.status, cerr.code, cerr.message)
+		return
+	}
+	respond(c, http.StatusOK, result)
+}
+
+// updateModel builds the new image, starts it on a free host port and swaps
+// it in once ready. Any failure before the swap removes the new container and
+// image, leaving the old container serving, and is recorded as the model's
+// last error.
+func (mh *ModelHandler) updateModel(req models.CreateDockerfileRequest, installed models.InstalledModel) (result gin.H, cerr *createError) {
+	phase := models.PhaseBuild
+	defer func() { recordCreateOutcome(req.Model, phase, cerr) }()
+	defer modelsChanged()
+
+	containerName := installed.ContainerName
+	updateName := utils.UpdateContainerName(req.Model)
+	abort := func(cerr *createError) (gin.H, *createError) {
+		mh.dockerService.AbortUpdate(req.Model)
+		cerr.message += "; the old container is still serving"
+		return nil, cerr
+	}
+
+	// The new image is built for the platform the old one was, unless asked otherwise
+	if req.Platform == "" {
+		req.Platform = installed.Platform
+	}
+
+	dockerfileContent, numParallel, cerr := dockerfileFor(req)
+	if cerr != nil {
+		return nil, cerr
+	}
+	buildDir := filepath.Join(utils.ModelsDir, utils.ImageName(req.Model))
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		return nil, &createError{status: http.StatusInternalServerError, message: "Failed to create models directory"}
+	}
+	if err := os.WriteFile(filepath.Join(buildDir, "Dockerfile"), []byte(dockerfileContent), 0644); err != nil {
+		return nil, &createError{status: http.StatusInternalServerError, message: "Failed to write Dockerfile"}
+	}
+
+	log.Printf("Updating %s: building the new image", req.Model)
+	if err := mh.dockerService.BuildDockerImage(buildDir, services.UpdateImageName(req.Model), buildOptions(req)); err != nil {
+		if cerr := diskSpaceError(err); cerr != nil {
+			return abort(cerr)
+		}
+		return abort(&createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to build Docker image: %v", err)})
+	}
+
+	phase = models.PhaseRun
+	port, err := mh.dockerService.FreeHostPort(updateName)
+	if err != nil {
+		return abort(&createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to find a port for the new container: %v", err)})
+	}
+	log.Printf("Updating %s: starting %s on port %s", req.Model, updateName, port)
+	// The new container keeps the old one's labels, picking up any added to OWNGPT_LABELS since
+	labels := containerLabels(config.Get().Labels, installed.Labels)
+	if err := mh.dockerService.RunDockerContainer(services.UpdateImageName(req.Model), updateName, port, platformFor(req), labels); err != nil {
+		return abort(&createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to run Docker container: %v", err)})
+	}
+	if err := mh.dockerService.WaitForModelReady(updateName, mh.dockerService.ReadyTimeoutsFor(req.Model)); err != nil {
+		return abort(readyError(err))
+	}
+	digest, cerr := mh.resolveDigest(updateName, req.Model, req.Digest)
+	if cerr != nil {
+		return abort(cerr)
+	}
+
+	if err := mh.dockerService.SwapUpdateContainer(req.Model); err != nil {
+		return abort(&createError{status: http.StatusInternalServerError, message: fmt.Sprintf("Failed to swap in the new container: %v", err)})
+	}
+	log.Printf("Updating %s: the new container took over %s", req.Model, containerName)
+	recordDigest(req.Model, digest, req.Digest)
+	recordNumParallel(req.Model, numParallel)
+	services.ForgetCapabilities(req.Model)
+
+	// The container keeps its name, so only the published port changes
+	models.ModelMutex.Lock()
+	if models.CurrentModel.Name == containerName {
+		models.CurrentModel.Port = port
+	}
+	models.ModelMutex.Unlock()
+
+	// A model that was stopped stays stopped, with the new image ready to start
+	if !utils.ContainerUp(installed.State) {
+		if err := mh.dockerService.StopContainer(containerName); err != nil {
+			log.Printf("Failed to stop the updated container %s: %v", containerName, err)
+		}
+	}
+
+	return withDigest(gin.H{
+		"message":        fmt.Sprintf("Model %s updated", req.Model),
+		"model":          req.Model,
+		"container_name": containerName,
+		"port":           port,
+	}, digest), nil
+}
+
+// PullLatest re-pulls a running model inside its container (or the local
+// Ollama server) to fetch weights updated upstream, streaming the pull's
+// progress as Server-Sent Events. The result event reports whether the
+// model's digest changed. A model pinned to a digest is only re-pulled with
+// ?force=true, which unpins it.
+func (mh *ModelHandler) PullLatest(c *gin.Context) {
+	modelName := c.Param("name")
+	middleware.SetModel(c, modelName)
+
+	force, ok := forceParam(c)
+	if !ok {
+		return
+	}
+
+	// Wait for any create, update or delete of the model to finish first
+	unlock := modelLocks.Lock(modelName)
+	defer unlock()
+	if pin := registry.Get(modelName).PinnedDigest; pin != "" && !force {
+		respondErrorCode(c, http.StatusConflict, "MODEL_PINNED", fmt.Sprintf("Model %s is pinned to %s. Pass ?force=true to pull the latest weights and unpin it", modelName, pin))
+		return
+	}
+
+	installed, err := mh.findInstalledModel(modelName)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list installed models")
+		return
+	}
+	if installed == nil {
+		respondErrorCode(c, http.StatusNotFound, "MODEL_NOT_FOUND", fmt.Sprintf("Model %s is not installed", modelName))
+		return
+	}
+	if !installed.IsRunning {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Model %s is not running, start it before pulling updates", modelName))
+		return
+	}
+	model := services.ModelForContainer(installed.ContainerName)
+
+	previous, err := mh.ollamaService.ModelDigest(installed.ContainerName, model)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to read the model's digest: %v", err))
+		return
+	}
+
+	closeStream, ok := openStream(c, "")
+	if !ok {
+		return
+	}
+	defer closeStream()
+
+	streamHeaders(c, "text/event-stream")
+
+	// Pull output arrives from the command's output goroutine
+	var mu sync.Mutex
+	send := func(event string, data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+
+	if services.LocalMode() {
+		err = mh.localOllama.Pull(model, config.Get().PullTimeout, func(status string, percent int) {
+			event := gin.H{"status": status}
+			if percent >= 0 {
+				event["percent"] = percent
+			}
+			if attempt, attempts, ok := services.ParsePullRetry(status); ok {
+				event = gin.H{"status": "retrying", "attempt": attempt, "attempts": attempts}
+			}
+			send("progress", event)
+		})
+	} else {
+		err = mh.dockerService.PullModelInContainer(c.Request.Context(), installed.ContainerName, model, func(line string) {
+			send("progress", gin.H{"log": line})
+		})
+	}
+	if err != nil {
+		send("error", gin.H{"error": err.Error()})
+		return
+	}
+
+	digest, err := mh.ollamaService.ModelDigest(installed.ContainerName, model)
+	if err != nil {
+		send("error", gin.H{"error": fmt.Sprintf("Pulled, but failed to read the new digest: %v", err)})
+		return
+	}
+	if digest == previous {
+		log.Printf("Model %s is already up to date (%s)", model, digest)
+	} else {
+		log.Printf("Model %s updated from %s to %s", model, previous, digest)
+		services.ForgetCapabilities(modelName)
+	}
+	recordDigest(modelName, utils.NormalizeDigest(digest), "")
+	send("result", gin.H{
+		"model":           model,
+		"changed":         digest != previous,
+		"previous_digest": previous,
+		"digest":          digest,
+	})
+}
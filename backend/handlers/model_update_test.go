@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"owngpt/config"
+)
+
+func TestUpdateModelRejected(t *testing.T) {
+	mh, calls := fakeDockerHandler(t)
+	update := func() int {
+		return serve(http.MethodPost, "/models/:name/update", "/models/llama2/update", "", mh.UpdateModel).Code
+	}
+
+	// An update already running for the model turns a second one away
+	updatesMu.Lock()
+	updating["ollama-llama2-container"] = true
+	updatesMu.Unlock()
+	code := update()
+	updatesMu.Lock()
+	delete(updating, "ollama-llama2-container")
+	updatesMu.Unlock()
+	if code != http.StatusConflict {
+		t.Errorf("concurrent update: status = %d, want 409", code)
+	}
+
+	cfg := config.Get()
+	mode := cfg.Mode
+	cfg.Mode = "local"
+	t.Cleanup(func() { cfg.Mode = mode })
+	if code := update(); code != http.StatusBadRequest {
+		t.Errorf("local mode: status = %d, want 400", code)
+	}
+
+	if len(calls()) != 0 {
+		t.Errorf("rejected updates ran %q", calls())
+	}
+}
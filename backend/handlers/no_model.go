@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/middleware"
+	"owngpt/models"
+	"owngpt/services"
+	"owngpt/utils"
+)
+
+// autostartMu makes concurrent chats that find no model running start it once
+var autostartMu sync.Mutex
+
+// currentContainer returns the running model's container, if any
+func currentContainer() (string, bool) {
+	models.ModelMutex.RLock()
+	defer models.ModelMutex.RUnlock()
+	return models.CurrentModel.Name, models.CurrentModel.IsRunning
+}
+
+// currentContextWindow returns the context window of the running model, its
+// num_ctx if set, or OWNGPT_NUM_CTX when no model is running
+func currentContextWindow() int {
+	if containerName, ok := currentContainer(); ok {
+		return services.ModelContextWindow(services.ModelForContainer(containerName))
+	}
+	return services.ContextWindow()
+}
+
+// runningModel returns the container of the running model, recording its
+// model for request logging. When none is running it applies
+// OWNGPT_NO_MODEL_POLICY: with autostart set it starts the default model and
+// waits for it, otherwise it writes a NO_MODEL error that lists the installed
+// models the client could start and reports false.
+func (ch *ChatHandler) runningModel(c *gin.Context, autostart bool) (string, bool) {
+	if containerName, ok := currentContainer(); ok {
+		middleware.SetModel(c, services.ModelForContainer(containerName))
+		return containerName, true
+	}
+
+	installed, err := ch.dockerService.GetInstalledModels()
+	if err != nil {
+		log.Printf("Failed to list installed models: %v", err)
+	}
+	stopped := []string{}
+	for _, model := range installed {
+		// Local models are all ready to serve, so any of them could be started
+		if !model.IsRunning || services.LocalMode() {
+			stopped = append(stopped, model.Name)
+		}
+	}
+
+	if autostart && config.Get().NoModelPolicy == "autostart" {
+		if model, ok := autostartModel(installed); ok {
+			containerName, err := ch.startModel(model)
+			recordCreateOutcome(model.Name, models.PhaseRun, startError(err))
+			if err == nil {
+				c.Header("X-Model-Autostarted", model.Name)
+				middleware.SetModel(c, services.ModelForContainer(containerName))
+				return containerName, true
+			}
+			respondErrorData(c, http.StatusServiceUnavailable, "NO_MODEL", fmt.Sprintf("Failed to start model %s: %v", model.Name, err), gin.H{"installed": stopped})
+			return "", false
+		}
+	}
+
+	respondErrorData(c, http.StatusBadRequest, "NO_MODEL", "No model is currently running. Please create a model first.", gin.H{"installed": stopped})
+	return "", false
+}
+
+// autostartModel picks the installed model to start: OWNGPT_DEFAULT_MODEL, or
+// the only installed model when no default is set
+func autostartModel(installed []models.InstalledModel) (models.InstalledModel, bool) {
+	if defaultModel := config.Get().DefaultModel; defaultModel != "" {
+		for _, model := range installed {
+			if model.ContainerName == utils.ContainerName(defaultModel) {
+				return model, true
+			}
+		}
+		log.Printf("Default model %s is not installed, not starting it", defaultModel)
+		return models.InstalledModel{}, false
+	}
+	if len(installed) == 1 {
+		return installed[0], true
+	}
+	return models.InstalledModel{}, false
+}
+
+// startError is a failed autostart as a createError, or nil when it succeeded
+func startError(err error) *createError {
+	if err == nil {
+		return nil
+	}
+	return readyError(err)
+}
+
+// startModel starts an installed model's container, makes it the current
+// model and waits until it can answer
+func (ch *ChatHandler) startModel(model models.InstalledModel) (string, error) {
+	autostartMu.Lock()
+	defer autostartMu.Unlock()
+
+	// Another request may have started a model while this one waited
+	if containerName, ok := currentContainer(); ok {
+		return containerName, nil
+	}
+
+	unlock := modelLocks.Lock(model.Name)
+	defer unlock()
+
+	log.Printf("No model is running, starting %s (OWNGPT_NO_MODEL_POLICY=autostart)", model.Name)
+	port := "11434"
+	if services.LocalMode() {
+		if err := services.NewLocalOllama().Load(model.Name, config.Get().LoadTimeout); err != nil {
+			return "", err
+		}
+		port = services.LocalPort()
+	} else {
+		if err := ch.dockerService.StartExistingContainer(model.ContainerName); err != nil {
+			return "", err
+		}
+
+		// The image is already built, so a quick pull is expected
+		timeouts := ch.dockerService.ReadyTimeoutsFor(model.Name)
+		timeouts.Pull = timeouts.ServerUp
+		if err := ch.dockerService.WaitForModelReadyProgress(model.ContainerName, timeouts, nil); err != nil {
+			return "", err
+		}
+	}
+
+	models.ModelMutex.Lock()
+	models.CurrentModel = models.ModelContainer{
+		Name:      model.ContainerName,
+		Port:      port,
+		IsRunning: true,
+	}
+	models.ModelMutex.Unlock()
+	return model.ContainerName, nil
+}
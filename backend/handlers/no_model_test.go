@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// noModelPolicy stops the current model and sets OWNGPT_NO_MODEL_POLICY and
+// OWNGPT_DEFAULT_MODEL for the test
+func noModelPolicy(t *testing.T, policy, defaultModel string) {
+	models.ModelMutex.Lock()
+	models.CurrentModel = models.ModelContainer{}
+	models.ModelMutex.Unlock()
+
+	cfg := config.Get()
+	previousPolicy, previousDefault := cfg.NoModelPolicy, cfg.DefaultModel
+	cfg.NoModelPolicy, cfg.DefaultModel = policy, defaultModel
+	t.Cleanup(func() { cfg.NoModelPolicy, cfg.DefaultModel = previousPolicy, previousDefault })
+}
+
+func TestNoModelError(t *testing.T) {
+	fake := startFakeOllama(t, "Hi")
+	noModelPolicy(t, "error", "")
+
+	w := chat(NewChatHandler().SendMessage, `{"message":"hi"}`)
+	var body struct {
+		Code      string   `json:"code"`
+		Installed []string `json:"installed"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || body.Code != "NO_MODEL" {
+		t.Fatalf("status = %d: %s, want 400 NO_MODEL", w.Code, w.Body)
+	}
+	if len(body.Installed) != 1 || body.Installed[0] != "llama2" {
+		t.Errorf("installed = %q, want the model that could be started", body.Installed)
+	}
+	if len(fake.generations()) != 0 {
+		t.Error("a chat was generated with no model running")
+	}
+}
+
+func TestNoModelAutostart(t *testing.T) {
+	startFakeOllama(t, "Hi")
+	noModelPolicy(t, "autostart", "")
+
+	w := chat(NewChatHandler().SendMessage, `{"message":"hi"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("X-Model-Autostarted"); got != "llama2" {
+		t.Errorf("X-Model-Autostarted = %q, want llama2", got)
+	}
+	if containerName, running := currentContainer(); !running || containerName != "ollama-llama2-container" {
+		t.Errorf("current model = %q, %v, want the autostarted model", containerName, running)
+	}
+}
+
+func TestNoModelAutostartDefaultMissing(t *testing.T) {
+	startFakeOllama(t, "Hi")
+	noModelPolicy(t, "autostart", "mistral")
+
+	if w := chat(NewChatHandler().SendMessage, `{"message":"hi"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d: %s, want 400 when the default model isn't installed", w.Code, w.Body)
+	}
+	if _, running := currentContainer(); running {
+		t.Error("a model other than the default was started")
+	}
+}
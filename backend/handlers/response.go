@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// envelopeMIME is the Accept type clients send to opt in to the response envelope
+const envelopeMIME = "application/vnd.owngpt.v2+json"
+
+// Envelope wraps every response body in a uniform shape for clients that opt in
+type Envelope struct {
+	Success   bool        `json:"success"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Code      string      `json:"code,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// wantsEnvelope reports whether the client asked for enveloped responses.
+// Existing clients keep getting the original response bodies.
+func wantsEnvelope(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEJSON, envelopeMIME) == envelopeMIME
+}
+
+// respond writes a successful response, enveloped when the client opted in
+func respond(c *gin.Context, status int, data interface{}) {
+	if wantsEnvelope(c) {
+		c.JSON(status, Envelope{Success: true, Data: data, Timestamp: time.Now().UTC()})
+		return
+	}
+	c.JSON(status, data)
+}
+
+// respondError writes an error response, enveloped when the client opted in
+func respondError(c *gin.Context, status int, message string) {
+	respondErrorCode(c, status, "", message)
+}
+
+// respondErrorCode writes an error response carrying a machine-readable code
+func respondErrorCode(c *gin.Context, status int, code, message string) {
+	respondErrorData(c, status, code, message, nil)
+}
+
+// respondErrorData writes an error response with details that help the client
+// recover. They are the envelope's data, or extra fields of the plain body.
+func respondErrorData(c *gin.Context, status int, code, message string, data gin.H) {
+	if wantsEnvelope(c) {
+		envelope := Envelope{Success: false, Error: message, Code: code, Timestamp: time.Now().UTC()}
+		if data != nil {
+			envelope.Data = data
+		}
+		c.JSON(status, envelope)
+		return
+	}
+
+	body := gin.H{"error": message}
+	if code != "" {
+		body["code"] = code
+	}
+	for k, v := range data {
+		body[k] = v
+	}
+	c.JSON(status, body)
+}
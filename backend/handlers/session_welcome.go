@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/moderation"
+	"owngpt/registry"
+	"owngpt/services"
+)
+
+// welcomeFor returns the welcome message settings for sessions started on the
+// model: its profile's when it has them, otherwise OWNGPT_WELCOME_MESSAGE or
+// OWNGPT_WELCOME_PROMPT
+func welcomeFor(model string) config.Welcome {
+	if profile, ok := registry.Profile(model); ok && profile.Welcome != nil {
+		return *profile.Welcome
+	}
+	return config.Get().Welcome
+}
+
+// welcomeMessage returns the opening message for a new session, generating it
+// with the running model when a welcome prompt is configured. The generation
+// waits its turn for a chat slot like any chat and is given up when the
+// request goes away. A greeting that can't be generated is left out rather
+// than failing the session.
+func (ch *ChatHandler) welcomeMessage(ctx context.Context) string {
+	containerName, running := currentContainer()
+	model := ""
+	if running {
+		model = services.ModelForContainer(containerName)
+	}
+
+	welcome := welcomeFor(model)
+	if welcome.Message != "" || welcome.Prompt == "" {
+		return welcome.Message
+	}
+	if !running {
+		log.Printf("No model is running to generate the welcome message, starting the session without it")
+		return ""
+	}
+
+	release, err := services.AcquireChat(ctx, containerName, "")
+	if err != nil {
+		log.Printf("No chat slot on %s for the welcome message, starting the session without it: %v", model, err)
+		return ""
+	}
+	defer release()
+
+	req := models.ChatRequest{Message: welcome.Prompt}
+	resp, err := ch.ollamaService.Generate(ctx, req, containerName)
+	if err != nil {
+		log.Printf("Failed to generate the welcome message with %s, starting the session without it: %v", model, err)
+		return ""
+	}
+	text, _ := finishReply(req, resp.Response, resp.FinishReason)
+	if cerr := moderate(ctx, moderation.Response, text); cerr != nil {
+		log.Printf("Leaving the welcome message generated with %s out of the session: %s", model, cerr.message)
+		return ""
+	}
+	return text
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/services"
+	"owngpt/sessions"
+)
+
+// welcomeWith sets the welcome prompt for the test
+func welcomeWith(t *testing.T, prompt string) {
+	cfg := config.Get()
+	previous := cfg.Welcome
+	cfg.Welcome = config.Welcome{Prompt: prompt}
+	t.Cleanup(func() { cfg.Welcome = previous })
+}
+
+// createSession posts to the CreateSession handler with the given context
+func createSession(ctx context.Context) (*httptest.ResponseRecorder, models.ChatSession) {
+	router := gin.New()
+	router.POST("/sessions", NewChatHandler().CreateSession)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sessions", nil).WithContext(ctx))
+	var session models.ChatSession
+	json.Unmarshal(w.Body.Bytes(), &session)
+	return w, session
+}
+
+func TestCreateSessionGreetingInHistory(t *testing.T) {
+	startFakeOllama(t, "Welcome ", "aboard.")
+	welcomeWith(t, "Greet the user")
+
+	w, session := createSession(context.Background())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if session.Welcome != "Welcome aboard." {
+		t.Errorf("welcome = %q, want the generated greeting", session.Welcome)
+	}
+	history, _ := sessions.History(session.ID)
+	if len(history) != 1 || history[0].Role != "assistant" || history[0].Content != "Welcome aboard." {
+		t.Errorf("history = %+v, want the greeting as the first assistant message", history)
+	}
+}
+
+func TestCreateSessionGreetingWaitsForChatSlot(t *testing.T) {
+	fake := startFakeOllama(t, "Welcome.")
+	welcomeWith(t, "Greet the user")
+	cfg := config.Get()
+	concurrency := cfg.ChatConcurrency
+	cfg.ChatConcurrency = 1
+	t.Cleanup(func() { cfg.ChatConcurrency = concurrency })
+
+	// A chat holds the model's only slot until the session request gives up
+	release, err := services.AcquireChat(context.Background(), "ollama-llama2-container", "")
+	if err != nil {
+		t.Fatalf("AcquireChat: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	w, session := createSession(ctx)
+	if w.Code != http.StatusCreated || session.Welcome != "" {
+		t.Errorf("status %d, welcome %q, want the session without a greeting", w.Code, session.Welcome)
+	}
+	if generations := fake.generations(); len(generations) != 0 {
+		t.Errorf("generated %d greetings while the model was busy", len(generations))
+	}
+}
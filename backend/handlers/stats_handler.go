@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/usage"
+)
+
+type StatsHandler struct{}
+
+func NewStatsHandler() *StatsHandler {
+	return &StatsHandler{}
+}
+
+// GetStats returns request, token and latency totals with a per-model and a
+// per-client breakdown. With ?client= only that client's requests are counted.
+func (sh *StatsHandler) GetStats(c *gin.Context) {
+	if client := c.Query("client"); client != "" {
+		respond(c, http.StatusOK, usage.ClientSnapshot(client))
+		return
+	}
+	respond(c, http.StatusOK, usage.Snapshot())
+}
+
+// ResetStats clears all usage statistics
+func (sh *StatsHandler) ResetStats(c *gin.Context) {
+	usage.Reset()
+	respond(c, http.StatusOK, gin.H{"message": "Usage statistics reset"})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/middleware"
+	"owngpt/models"
+	"owngpt/usage"
+)
+
+func TestStatsByClient(t *testing.T) {
+	startFakeOllama(t, "Hello", " there.")
+	usage.Reset()
+	t.Cleanup(usage.Reset)
+
+	router := gin.New()
+	router.Use(middleware.Client("secret"))
+	router.POST("/chat", NewChatHandler().SendMessage)
+	router.GET("/stats", NewStatsHandler().GetStats)
+	send := func(method, path, body, auth string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	stats := func(path string) models.UsageStats {
+		t.Helper()
+		w := send(http.MethodGet, path, "", "")
+		var got models.UsageStats
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v: %s", path, err, w.Body)
+		}
+		return got
+	}
+
+	for _, auth := range []string{"Bearer secret", "", "Bearer wrong"} {
+		if w := send(http.MethodPost, "/chat", `{"message":"hi"}`, auth); w.Code != http.StatusOK {
+			t.Fatalf("chat with %q: status = %d: %s", auth, w.Code, w.Body)
+		}
+	}
+
+	all := stats("/stats")
+	if all.TotalRequests != 3 || len(all.Clients) != 2 {
+		t.Fatalf("stats = %+v, want 3 requests from 2 clients", all)
+	}
+	if admin := all.Clients[middleware.AdminClient]; admin == nil || admin.Requests != 1 {
+		t.Errorf("admin usage = %+v, want the chat made with the admin token", admin)
+	}
+	if anonymous := all.Clients["192.0.2.1"]; anonymous == nil || anonymous.Requests != 2 {
+		t.Errorf("192.0.2.1 usage = %+v, want both chats without the admin token", anonymous)
+	}
+	if strings.Contains(send(http.MethodGet, "/stats", "", "").Body.String(), "secret") {
+		t.Error("the admin token shows up in the stats")
+	}
+
+	if admin := stats("/stats?client=admin"); admin.TotalRequests != 1 || admin.Clients != nil {
+		t.Errorf("?client=admin = %+v, want its chat alone", admin)
+	}
+	if unknown := stats("/stats?client=198.51.100.7"); unknown.TotalRequests != 0 {
+		t.Errorf("?client= for an unknown client = %+v, want empty stats", unknown)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+	"owngpt/sessions"
+)
+
+// streamHeaders starts a streaming response of the content type: uncached,
+// kept alive on HTTP/1.1 with OWNGPT_STREAM_KEEP_ALIVE, where HTTP/2 forbids
+// the header, and unbuffered by nginx with OWNGPT_STREAM_NO_BUFFERING. CORS
+// headers are set by the CORS middleware, from OWNGPT_CORS_ORIGINS.
+func streamHeaders(c *gin.Context, contentType string) {
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "no-cache")
+	if config.Get().StreamKeepAlive && c.Request.ProtoMajor == 1 {
+		c.Header("Connection", "keep-alive")
+	}
+	if config.Get().StreamNoBuffering {
+		c.Header("X-Accel-Buffering", "no")
+	}
+}
+
+// openStream counts a streaming response against OWNGPT_MAX_STREAMS and
+// OWNGPT_MAX_STREAMS_PER_SESSION, keyed by its chat session or, without one,
+// the client's address. It responds 429 TOO_MANY_STREAMS and returns false
+// when a limit is reached; otherwise call close once the stream ends.
+func openStream(c *gin.Context, sessionID string) (close func(), ok bool) {
+	key := sessionID
+	if key == "" {
+		key = "client:" + c.ClientIP()
+	}
+	close, err := sessions.OpenStream(key)
+	if err != nil {
+		respondErrorCode(c, http.StatusTooManyRequests, "TOO_MANY_STREAMS", err.Error())
+		return nil, false
+	}
+	return close, true
+}
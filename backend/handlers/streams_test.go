@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"owngpt/config"
+)
+
+// streamCodes opens a stream without a session for each X-Forwarded-For,
+// from the same connecting address, keeping them all open, and returns the
+// status of each
+func streamCodes(t *testing.T, trustedProxies []string, forwardedFor ...string) []int {
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	var closes []func()
+	router.GET("/stream", func(c *gin.Context) {
+		if close, ok := openStream(c, ""); ok {
+			closes = append(closes, close)
+			c.Status(http.StatusOK)
+		}
+	})
+	defer func() {
+		for _, close := range closes {
+			close()
+		}
+	}()
+
+	var codes []int
+	for _, ip := range forwardedFor {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+		req.RemoteAddr = "192.0.2.1:40000"
+		req.Header.Set("X-Forwarded-For", ip)
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	return codes
+}
+
+func TestOpenStreamIgnoresUntrustedForwardedFor(t *testing.T) {
+	cfg := config.Get()
+	previous := cfg.MaxStreamsPerSession
+	cfg.MaxStreamsPerSession = 2
+	t.Cleanup(func() { cfg.MaxStreamsPerSession = previous })
+
+	// Rotating the header doesn't get a client past its cap
+	codes := streamCodes(t, nil, "198.51.100.1", "198.51.100.2", "198.51.100.3")
+	if codes[2] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want the third refused", codes)
+	}
+
+	// Behind a trusted proxy each forwarded client has its own cap
+	codes = streamCodes(t, []string{"192.0.2.0/24"}, "198.51.100.1", "198.51.100.2", "198.51.100.3")
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("stream %d through the proxy: status %d, want 200", i+1, code)
+		}
+	}
+}
+
+func TestStreamHeaders(t *testing.T) {
+	cfg := config.Get()
+	keepAlive, noBuffering := cfg.StreamKeepAlive, cfg.StreamNoBuffering
+	t.Cleanup(func() { cfg.StreamKeepAlive, cfg.StreamNoBuffering = keepAlive, noBuffering })
+
+	tests := []struct {
+		name                   string
+		keepAlive, noBuffering bool
+		protoMajor             int
+		wantConnection         string
+		wantBuffering          string
+	}{
+		{"HTTP/1.1", true, true, 1, "keep-alive", "no"},
+		{"HTTP/2", true, true, 2, "", "no"},
+		{"turned off", false, false, 1, "", ""},
+	}
+	for _, tt := range tests {
+		cfg.StreamKeepAlive, cfg.StreamNoBuffering = tt.keepAlive, tt.noBuffering
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/chat/stream", nil)
+		c.Request.ProtoMajor = tt.protoMajor
+		streamHeaders(c, "text/event-stream")
+
+		header := w.Header()
+		if header.Get("Content-Type") != "text/event-stream" || header.Get("Cache-Control") != "no-cache" {
+			t.Errorf("%s: headers %v, want an uncached event stream", tt.name, header)
+		}
+		if got := header.Get("Connection"); got != tt.wantConnection {
+			t.Errorf("%s: Connection = %q, want %q", tt.name, got, tt.wantConnection)
+		}
+		if got := header.Get("X-Accel-Buffering"); got != tt.wantBuffering {
+			t.Errorf("%s: X-Accel-Buffering = %q, want %q", tt.name, got, tt.wantBuffering)
+		}
+		// CORS is left to the middleware
+		if got := header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want none", tt.name, got)
+		}
+	}
+}
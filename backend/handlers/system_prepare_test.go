@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/services"
+)
+
+func TestPrepareSystem(t *testing.T) {
+	cfg := config.Get()
+	mode, image, version := cfg.Mode, cfg.BaseImage, cfg.OllamaVersion
+	cfg.Mode, cfg.BaseImage, cfg.OllamaVersion = "", "ollama/ollama", "0.1.32"
+	t.Cleanup(func() { cfg.Mode, cfg.BaseImage, cfg.OllamaVersion = mode, image, version })
+
+	// The image is missing, and pulling it prints two lines of progress
+	runner := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		switch args[0] {
+		case "image":
+			return exec.CommandContext(ctx, "sh", "-c", "echo 'Error: No such image' >&2; exit 1")
+		case "pull":
+			return exec.CommandContext(ctx, "printf", "Pulling fs layer\nDownload complete\n")
+		}
+		return exec.CommandContext(ctx, "false")
+	}
+	mh := &ModelHandler{dockerService: services.NewDockerServiceWithRunner(runner)}
+
+	w := serve(http.MethodPost, "/system/prepare", "/system/prepare", "", mh.PrepareSystem)
+	events := sseEvents(w.Body.String())
+	want := []string{
+		`progress: {"log":"Pulling fs layer"}`,
+		`progress: {"log":"Download complete"}`,
+		`result: {"already_present":false,"image":"ollama/ollama:0.1.32"}`,
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+
+	cfg.Mode = "local"
+	if w := serve(http.MethodPost, "/system/prepare", "/system/prepare", "", mh.PrepareSystem); w.Code != http.StatusBadRequest {
+		t.Errorf("local mode: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrShutdown is the cause of contexts cancelled by Shutdown
+var ErrShutdown = errors.New("server is shutting down")
+
+var (
+	// shutdown is cancelled when Shutdown starts, stopping every tracked goroutine
+	shutdown, stopAll = context.WithCancelCause(context.Background())
+	// draining is cancelled when the server stops taking requests, before it
+	// waits for the ones in flight
+	draining, stopDraining = context.WithCancelCause(context.Background())
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	closing bool
+	running = make(map[string]int)
+)
+
+// Go runs fn on a goroutine that Shutdown waits for. fn gets a context derived
+// from parent that is also cancelled once shutdown starts, and must return
+// soon after it is done. name identifies the goroutine in shutdown logs.
+func Go(name string, parent context.Context, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancelCause(parent)
+	stop := context.AfterFunc(shutdown, func() { cancel(ErrShutdown) })
+
+	// Goroutines started once shutdown is under way run with a cancelled
+	// context and aren't waited for
+	mu.Lock()
+	tracked := !closing
+	if tracked {
+		running[name]++
+		wg.Add(1)
+	}
+	mu.Unlock()
+	// AfterFunc cancels from its own goroutine, which fn could beat
+	if !tracked {
+		cancel(ErrShutdown)
+	}
+
+	go func() {
+		defer func() {
+			stop()
+			cancel(nil)
+			if !tracked {
+				return
+			}
+			mu.Lock()
+			if running[name]--; running[name] == 0 {
+				delete(running, name)
+			}
+			mu.Unlock()
+			wg.Done()
+		}()
+		fn(ctx)
+	}()
+}
+
+// Context returns a context cancelled once shutdown starts
+func Context() context.Context {
+	return shutdown
+}
+
+// Draining returns a context cancelled once the server starts draining. Streams
+// that never end on their own, such as ones following a status, end with it so
+// draining doesn't wait on them.
+func Draining() context.Context {
+	return draining
+}
+
+// Drain cancels the Draining context; call it when the server stops taking requests
+func Drain() {
+	stopDraining(ErrShutdown)
+}
+
+// Shutdown cancels the context of every goroutine started with Go and waits
+// up to timeout for them to return, reporting the ones still running after it
+func Shutdown(timeout time.Duration) error {
+	mu.Lock()
+	closing = true
+	mu.Unlock()
+	stopAll(ErrShutdown)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	left := make([]string, 0, len(running))
+	for name, count := range running {
+		left = append(left, fmt.Sprintf("%s (%d)", name, count))
+	}
+	sort.Strings(left)
+	return fmt.Errorf("goroutines still running after %v: %s", timeout, strings.Join(left, ", "))
+}
@@ -0,0 +1,123 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reset gives the test a server that hasn't started shutting down. Tests
+// wait for their goroutines, so wg is back at zero.
+func reset(t *testing.T) {
+	shutdown, stopAll = context.WithCancelCause(context.Background())
+	draining, stopDraining = context.WithCancelCause(context.Background())
+	mu.Lock()
+	closing = false
+	running = make(map[string]int)
+	mu.Unlock()
+	t.Cleanup(func() { stopAll(nil) })
+}
+
+// runningCount returns how many goroutines named name are tracked
+func runningCount(name string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	return running[name]
+}
+
+func TestGoEndsWithParent(t *testing.T) {
+	reset(t)
+	parent, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	Go("worker", parent, func(ctx context.Context) {
+		<-ctx.Done()
+		close(done)
+	})
+	if runningCount("worker") != 1 {
+		t.Errorf("running = %d, want the goroutine tracked", runningCount("worker"))
+	}
+
+	cancel()
+	<-done
+	if err := Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if runningCount("worker") != 0 {
+		t.Error("the finished goroutine is still tracked")
+	}
+}
+
+func TestShutdownStopsGoroutines(t *testing.T) {
+	reset(t)
+	causes := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		Go("stream", context.Background(), func(ctx context.Context) {
+			<-ctx.Done()
+			causes <- context.Cause(ctx)
+		})
+	}
+
+	if err := Shutdown(time.Second); err != nil {
+		t.Fatalf("Shutdown = %v, want every goroutine stopped", err)
+	}
+	for i := 0; i < 2; i++ {
+		if cause := <-causes; !errors.Is(cause, ErrShutdown) {
+			t.Errorf("cause = %v, want ErrShutdown", cause)
+		}
+	}
+	if Context().Err() == nil {
+		t.Error("Context wasn't cancelled by Shutdown")
+	}
+}
+
+func TestShutdownReportsStuckGoroutines(t *testing.T) {
+	if os.Getenv("OWNGPT_TEST_STUCK") == "1" {
+		for i := 0; i < 2; i++ {
+			Go("stuck", context.Background(), func(context.Context) { select {} })
+		}
+		Go("prompt", context.Background(), func(ctx context.Context) { <-ctx.Done() })
+		fmt.Println(Shutdown(50 * time.Millisecond))
+		return
+	}
+
+	// The stuck goroutines never return, so they run in a child
+	cmd := exec.Command(os.Args[0], "-test.run=^TestShutdownReportsStuckGoroutines$")
+	cmd.Env = append(os.Environ(), "OWNGPT_TEST_STUCK=1")
+	out, _ := cmd.Output()
+	if !strings.Contains(string(out), "goroutines still running after 50ms: stuck (2)\n") {
+		t.Errorf("Shutdown reported %q, want only the stuck goroutines named", out)
+	}
+}
+
+func TestGoAfterShutdown(t *testing.T) {
+	reset(t)
+	Shutdown(time.Second)
+
+	started := make(chan error, 1)
+	Go("late", context.Background(), func(ctx context.Context) { started <- ctx.Err() })
+	if err := <-started; err == nil {
+		t.Error("a goroutine started during shutdown got a live context")
+	}
+	if runningCount("late") != 0 {
+		t.Error("a goroutine started during shutdown was tracked")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	reset(t)
+	if Draining().Err() != nil {
+		t.Fatal("draining before Drain")
+	}
+	Drain()
+	if cause := context.Cause(Draining()); !errors.Is(cause, ErrShutdown) {
+		t.Errorf("Draining cause = %v, want ErrShutdown", cause)
+	}
+	if Context().Err() != nil {
+		t.Error("Drain cancelled the shutdown context")
+	}
+}
@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"owngpt/models"
+)
+
+// task is the status of a periodic task started with Every
+type task struct {
+	interval  time.Duration
+	started   time.Time
+	lastRun   time.Time
+	lastError string
+	runs      int
+}
+
+var (
+	tasksMu sync.Mutex
+	tasks   = make(map[string]*task)
+)
+
+// Every runs fn every interval until shutdown, on a goroutine Shutdown waits
+// for. Each run's time and error are kept for Tasks. A run that panics is
+// recorded as failed and the task carries on.
+func Every(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	tasksMu.Lock()
+	tasks[name] = &task{interval: interval, started: time.Now().UTC()}
+	tasksMu.Unlock()
+
+	Go(name, context.Background(), func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := runTask(ctx, name, fn)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Background task %s failed: %v", name, err)
+			}
+
+			tasksMu.Lock()
+			t := tasks[name]
+			t.lastRun = time.Now().UTC()
+			t.runs++
+			t.lastError = ""
+			if err != nil {
+				t.lastError = err.Error()
+			}
+			tasksMu.Unlock()
+		}
+	})
+}
+
+// runTask runs one round of a task, turning a panic into an error
+func runTask(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Tasks returns the status of the tasks started with Every, by name. A task
+// is stale when it hasn't finished a run for twice its interval, which means
+// it is stuck or its goroutine has gone.
+func Tasks() []models.BackgroundTask {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+
+	now := time.Now().UTC()
+	list := make([]models.BackgroundTask, 0, len(tasks))
+	for name, t := range tasks {
+		status := models.BackgroundTask{
+			Name:            name,
+			IntervalSeconds: t.interval.Seconds(),
+			Runs:            t.runs,
+			LastError:       t.lastError,
+		}
+		since := t.started
+		if !t.lastRun.IsZero() {
+			lastRun := t.lastRun
+			status.LastRun = &lastRun
+			since = lastRun
+		}
+		status.Stale = now.Sub(since) > 2*t.interval
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,90 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"owngpt/models"
+)
+
+// taskStatus returns what Tasks reports for the named task
+func taskStatus(name string) (models.BackgroundTask, bool) {
+	for _, task := range Tasks() {
+		if task.Name == name {
+			return task, true
+		}
+	}
+	return models.BackgroundTask{}, false
+}
+
+// forgetTask drops the task from Tasks after the test
+func forgetTask(t *testing.T, name string) {
+	t.Cleanup(func() {
+		tasksMu.Lock()
+		delete(tasks, name)
+		tasksMu.Unlock()
+	})
+}
+
+func TestEvery(t *testing.T) {
+	reset(t)
+	forgetTask(t, "flaky")
+
+	// Each round reports what the previous one recorded, since rounds run in turn
+	recorded := make(chan models.BackgroundTask, 10)
+	round := 0
+	Every("flaky", time.Millisecond, func(ctx context.Context) error {
+		round++
+		if status, _ := taskStatus("flaky"); round > 1 {
+			recorded <- status
+		}
+		switch round {
+		case 1:
+			return errors.New("disk full")
+		case 2:
+			panic("nil map")
+		}
+		return nil
+	})
+
+	for i, want := range []string{"disk full", "panic: nil map", ""} {
+		status := <-recorded
+		if status.Runs != i+1 || status.LastRun == nil || status.LastError != want {
+			t.Errorf("after run %d: %+v, want last_error %q", i+1, status, want)
+		}
+	}
+	if err := Shutdown(time.Second); err != nil {
+		t.Errorf("the task didn't stop: %v", err)
+	}
+}
+
+func TestTasksStale(t *testing.T) {
+	forgetTask(t, "never_ran")
+	forgetTask(t, "stuck")
+	forgetTask(t, "healthy")
+	now := time.Now().UTC()
+	tasksMu.Lock()
+	tasks["never_ran"] = &task{interval: time.Minute, started: now.Add(-3 * time.Minute)}
+	tasks["stuck"] = &task{interval: time.Minute, started: now.Add(-time.Hour), lastRun: now.Add(-3 * time.Minute), runs: 5}
+	tasks["healthy"] = &task{interval: time.Minute, started: now.Add(-time.Hour), lastRun: now.Add(-time.Minute), runs: 60}
+	tasksMu.Unlock()
+
+	for name, stale := range map[string]bool{"never_ran": true, "stuck": true, "healthy": false} {
+		status, ok := taskStatus(name)
+		if !ok || status.Stale != stale || status.IntervalSeconds != 60 {
+			t.Errorf("%s: %+v, want stale %v", name, status, stale)
+		}
+	}
+	if status, _ := taskStatus("never_ran"); status.LastRun != nil {
+		t.Errorf("never_ran has a last run %v", status.LastRun)
+	}
+
+	list := Tasks()
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Name > list[i].Name {
+			t.Errorf("tasks aren't sorted by name: %s before %s", list[i-1].Name, list[i].Name)
+		}
+	}
+}
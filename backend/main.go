@@ -1,24 +1,138 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"owngpt/config"
+	"owngpt/evals"
+	"owngpt/lifecycle"
 	"owngpt/models"
+	"owngpt/registry"
 	"owngpt/routes"
+	"owngpt/selfcheck"
 	"owngpt/services"
+	"owngpt/sessions"
+	"owngpt/usage"
 )
 
 func main() {
+	// Local mode can run its own Ollama server, which the self-check expects
+	stopOllama := func() {}
+	if services.LocalMode() {
+		stop, err := services.StartLocalOllama()
+		if err != nil {
+			log.Printf("Failed to start the local Ollama server: %v", err)
+		}
+		stopOllama = stop
+	}
+
+	// Know whether containers get a GPU before the self-check reports it and
+	// before any generation sets num_gpu
+	if !services.LocalMode() {
+		services.WatchGPU()
+	}
+
+	// Surface a broken environment now rather than on the first request
+	if result := selfcheck.Run(); !result.Ready && config.Get().StrictStartup {
+		log.Fatal("Startup self-check failed and OWNGPT_STRICT_STARTUP is set, exiting")
+	}
+
 	// Initialize model detection on startup
 	initializeCurrentModel()
 
+	// Warm the host so the first model build only pays for the model weights
+	if config.Get().PrepareOnStart {
+		go prepareBaseImage()
+	}
+
+	// Restore persisted usage statistics, model tags and evaluations
+	usage.Load()
+	registry.LoadTags()
+	evals.Load()
+
+	// Free expired sessions that are never used again
+	lifecycle.Every("session_reaper", time.Minute, func(ctx context.Context) error {
+		if expired := sessions.Expire(); expired > 0 {
+			log.Printf("Expired %d idle sessions", expired)
+		}
+		return nil
+	})
+
+	// Write usage stats now and then instead of on every chat
+	lifecycle.Every("usage_save", usage.SaveInterval, func(ctx context.Context) error {
+		return usage.Save()
+	})
+
 	// Setup routes
 	r := routes.SetupRoutes()
+	server := &http.Server{Addr: ":8080", Handler: r}
+	server.RegisterOnShutdown(lifecycle.Drain)
 
 	// Start server
-	log.Println("Starting OwnGPT server on :8080")
-	if err := r.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	go func() {
+		log.Println("Starting OwnGPT server on :8080")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then drain in-flight requests
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down OwnGPT server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Get().ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown did not complete: %v", err)
+	}
+
+	// Stop the streams and background work still running. They stop as soon as
+	// they're cancelled, so they get a moment even if draining used up the timeout.
+	deadline, _ := ctx.Deadline()
+	if err := lifecycle.Shutdown(max(time.Until(deadline), time.Second)); err != nil {
+		log.Printf("Background work did not stop: %v", err)
+	}
+
+	if err := usage.Save(); err != nil {
+		log.Printf("Failed to save usage stats: %v", err)
+	}
+	shutdownModels()
+	stopOllama()
+}
+
+// shutdownModels stops managed model containers when OWNGPT_STOP_ON_EXIT is set.
+// By default they keep running so a restarted backend can pick them up again.
+func shutdownModels() {
+	cfg := config.Get()
+	if !cfg.StopOnExit || services.LocalMode() {
+		return
+	}
+
+	log.Println("Stopping model containers (OWNGPT_STOP_ON_EXIT is set)")
+	start := time.Now()
+	services.NewDockerService().StopManagedContainers(cfg.ShutdownTimeout)
+	log.Printf("Finished stopping model containers in %v", time.Since(start).Round(time.Millisecond))
+}
+
+// prepareBaseImage pulls the Ollama base image unless it is already present
+func prepareBaseImage() {
+	present, err := services.NewDockerService().PullBaseImage(nil)
+	switch {
+	case err != nil:
+		log.Printf("Failed to prepare base image: %v", err)
+	case present:
+		log.Printf("Base image %s is already present", services.BaseImage())
+	default:
+		log.Printf("Pulled base image %s", services.BaseImage())
 	}
 }
 
@@ -35,9 +149,13 @@ func initializeCurrentModel() {
 	for _, model := range installedModels {
 		if model.IsRunning {
 			models.ModelMutex.Lock()
+			port := "11434" // Default Ollama port
+			if services.LocalMode() {
+				port = services.LocalPort()
+			}
 			models.CurrentModel = models.ModelContainer{
 				Name:      model.ContainerName,
-				Port:      "11434", // Default Ollama port
+				Port:      port,
 				IsRunning: true,
 			}
 			models.ModelMutex.Unlock()
@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// collector is a metric family that can write itself in the Prometheus text format
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// Handler serves every registered metric in the Prometheus text exposition format
+func Handler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	registryMu.Lock()
+	collectors := append([]collector{}, registry...)
+	registryMu.Unlock()
+
+	for _, col := range collectors {
+		col.write(c.Writer)
+	}
+}
+
+// Counter is a monotonically increasing value partitioned by labels
+type Counter struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	counter := &Counter{name: name, help: help, labelNames: labelNames, values: make(map[string]float64)}
+	register(counter)
+	return counter
+}
+
+// Inc increments the counter for the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta to the counter for the given label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %v\n", c.name, formatLabels(c.labelNames, splitKey(key), "", ""), c.values[key])
+	}
+}
+
+// Gauge is a value that can go up and down, partitioned by labels
+type Gauge struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge creates and registers a gauge
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	gauge := &Gauge{name: name, help: help, labelNames: labelNames, values: make(map[string]float64)}
+	register(gauge)
+	return gauge
+}
+
+// Set sets the gauge for the given label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	g.mu.Lock()
+	g.values[key] = value
+	g.mu.Unlock()
+}
+
+// Add adds delta (which may be negative) to the gauge for the given label values
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	g.mu.Lock()
+	g.values[key] += delta
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	for _, key := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %v\n", g.name, formatLabels(g.labelNames, splitKey(key), "", ""), g.values[key])
+	}
+}
+
+// Histogram tracks the distribution of observed values in cumulative buckets
+type Histogram struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates and registers a histogram with the given upper bucket bounds
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	histogram := &Histogram{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    sorted,
+		series:     make(map[string]*histogramSeries),
+	}
+	register(histogram)
+	return histogram
+}
+
+// Observe records a value for the given label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := h.series[key]
+		values := splitKey(key)
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, values, "le", fmt.Sprint(bound)), series.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, values, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %v\n", h.name, formatLabels(h.labelNames, values, "", ""), series.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labelNames, values, "", ""), series.count)
+	}
+}
+
+// labelKey joins label values into a map key; \xff cannot appear in valid UTF-8
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func splitKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels renders {name="value",...}, optionally appending one extra label
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
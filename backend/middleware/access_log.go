@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessLogEntry is one line of the JSON access log
+type accessLogEntry struct {
+	Time          string  `json:"time"`
+	Method        string  `json:"method"`
+	Path          string  `json:"path"`
+	Status        int     `json:"status"`
+	LatencyMs     float64 `json:"latency_ms"`
+	RequestBytes  int64   `json:"request_bytes"`
+	ResponseBytes int     `json:"response_bytes"`
+	Model         string  `json:"model,omitempty"`
+	ClientIP      string  `json:"client_ip"`
+	// Client is who the request is attributed to, see Client
+	Client string `json:"client,omitempty"`
+	// TTFBMs is the time to the first byte of a streamed response body
+	TTFBMs *float64 `json:"ttfb_ms,omitempty"`
+	// TTFTMs is the time to the first token of a streamed chat
+	TTFTMs *float64 `json:"ttft_ms,omitempty"`
+}
+
+// countingBody counts the request body bytes a handler reads
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// firstByteWriter notes when the response body starts
+type firstByteWriter struct {
+	gin.ResponseWriter
+	firstByte time.Time
+}
+
+func (w *firstByteWriter) Write(data []byte) (int, error) {
+	w.mark()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *firstByteWriter) WriteString(s string) (int, error) {
+	w.mark()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *firstByteWriter) mark() {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, for the write
+// deadlines streaming handlers set
+func (w *firstByteWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog logs each request as one JSON line to out with its status,
+// latency, request and response sizes, the model it targeted, the client it
+// is attributed to and, for streamed responses, the time to the first byte
+// and first token
+func AccessLog(out io.Writer) gin.HandlerFunc {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(out)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		body := &countingBody{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
+		writer := &firstByteWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		entry := accessLogEntry{
+			Time:          start.UTC().Format(time.RFC3339Nano),
+			Method:        c.Request.Method,
+			Path:          c.Request.URL.Path,
+			Status:        c.Writer.Status(),
+			LatencyMs:     milliseconds(time.Since(start)),
+			RequestBytes:  max(c.Request.ContentLength, body.n),
+			ResponseBytes: max(c.Writer.Size(), 0),
+			Model:         c.GetString(modelKey),
+			ClientIP:      c.ClientIP(),
+			Client:        ClientOf(c.Request.Context()),
+		}
+		if entry.Model == "" {
+			entry.Model = c.Param("name")
+		}
+		if isStream(c.Writer.Header().Get("Content-Type")) && !writer.firstByte.IsZero() {
+			ttfb := milliseconds(writer.firstByte.Sub(start))
+			entry.TTFBMs = &ttfb
+		}
+		if value, ok := c.Get(firstTokenKey); ok {
+			ttft := milliseconds(value.(time.Time).Sub(start))
+			entry.TTFTMs = &ttft
+		}
+
+		mu.Lock()
+		encoder.Encode(entry)
+		mu.Unlock()
+	}
+}
+
+// isStream reports whether a response Content-Type is one of the streaming formats
+func isStream(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/event-stream") || strings.HasPrefix(contentType, "application/x-ndjson")
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
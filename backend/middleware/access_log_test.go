@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logRequest runs one request through AccessLog and returns the line it logged
+func logRequest(t *testing.T, route string, req *http.Request, handler gin.HandlerFunc) accessLogEntry {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	router := gin.New()
+	router.Use(AccessLog(&out))
+	router.Handle(req.Method, route, handler)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry accessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("access log %q: %v", out.String(), err)
+	}
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("access log %q, want one line", out.String())
+	}
+	return entry
+}
+
+func TestAccessLog(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/models/llama2/config", strings.NewReader(`{"num_ctx":4096}`))
+	entry := logRequest(t, "/models/:name/config", req, func(c *gin.Context) {
+		io.ReadAll(c.Request.Body)
+		c.String(http.StatusCreated, "created")
+	})
+
+	if entry.Method != http.MethodPost || entry.Path != "/models/llama2/config" || entry.Status != http.StatusCreated {
+		t.Errorf("entry = %+v, want the request and its status", entry)
+	}
+	if entry.RequestBytes != 16 || entry.ResponseBytes != 7 {
+		t.Errorf("sizes = %d in, %d out; want 16 and 7", entry.RequestBytes, entry.ResponseBytes)
+	}
+	// Without a model set by the handler, the route's model is logged
+	if entry.Model != "llama2" {
+		t.Errorf("model = %q, want llama2 from the route", entry.Model)
+	}
+	if entry.TTFBMs != nil || entry.TTFTMs != nil {
+		t.Errorf("entry = %+v, want no stream timings for a plain response", entry)
+	}
+}
+
+func TestAccessLogStream(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", strings.NewReader(`{"message":"hi"}`))
+	entry := logRequest(t, "/chat/stream", req, func(c *gin.Context) {
+		SetModel(c, "mistral")
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Writer.WriteString("{}\n")
+		MarkFirstToken(c)
+		c.Writer.WriteString("{}\n")
+	})
+
+	if entry.Model != "mistral" {
+		t.Errorf("model = %q, want the one the handler set", entry.Model)
+	}
+	if entry.TTFBMs == nil || entry.TTFTMs == nil {
+		t.Fatalf("entry = %+v, want time to first byte and token", entry)
+	}
+	if *entry.TTFBMs > *entry.TTFTMs || *entry.TTFTMs > entry.LatencyMs {
+		t.Errorf("ttfb %v, ttft %v, latency %v; want them in order", *entry.TTFBMs, *entry.TTFTMs, entry.LatencyMs)
+	}
+}
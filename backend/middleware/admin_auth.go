@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth requires "Authorization: Bearer <token>" on admin endpoints. With
+// no token configured the endpoints are disabled.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Admin endpoints are disabled, set OWNGPT_ADMIN_TOKEN to enable them",
+				"code":  "ADMIN_DISABLED",
+			})
+			return
+		}
+
+		if !hasToken(c, token) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or missing admin token",
+				"code":  "UNAUTHORIZED",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// hasToken reports whether the request bears the token in its Authorization
+// header, with or without "Bearer "
+func hasToken(c *gin.Context, token string) bool {
+	provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name, token, header string
+		want                int
+	}{
+		{"disabled", "", "Bearer ", http.StatusForbidden},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"bare token", "secret", "secret", http.StatusOK},
+		{"bearer token", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		router := gin.New()
+		router.POST("/admin/cancel-all", AdminAuth(tt.token), func(c *gin.Context) { c.Status(http.StatusOK) })
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/cancel-all", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminClient is the client requests bearing the admin token are attributed to
+const AdminClient = "admin"
+
+// clientKey holds the client a request is attributed to in its context
+type clientKey struct{}
+
+// Client attributes each request to a client, for the access log and usage
+// stats: AdminClient when it bears OWNGPT_ADMIN_TOKEN and its address
+// otherwise. The token itself is never recorded. The client is kept in the
+// request's context so that generations running apart from the handler can
+// be attributed too.
+func Client(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := c.ClientIP()
+		if adminToken != "" && hasToken(c, adminToken) {
+			client = AdminClient
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), clientKey{}, client))
+		c.Next()
+	}
+}
+
+// ClientOf returns the client the request behind ctx is attributed to, or ""
+// when it went through no Client middleware
+func ClientOf(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name, token, header, want string
+	}{
+		{"admin token", "secret", "Bearer secret", AdminClient},
+		{"bare admin token", "secret", "secret", AdminClient},
+		{"wrong token", "secret", "Bearer wrong", "192.0.2.1"},
+		{"anonymous", "secret", "", "192.0.2.1"},
+		{"admin disabled", "", "Bearer ", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		var got string
+		router := gin.New()
+		router.Use(Client(tt.token))
+		router.GET("/stats", func(c *gin.Context) { got = ClientOf(c.Request.Context()) })
+		req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("%s: client = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAccessLogClient(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(`{"message":"hi"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	entry := logRequest(t, "/chat", req, func(c *gin.Context) {
+		Client("secret")(c)
+		c.Status(http.StatusOK)
+	})
+	if entry.Client != AdminClient {
+		t.Errorf("client = %q, want %q", entry.Client, AdminClient)
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadOnly refuses requests with 403 READ_ONLY when enabled, for routes that
+// change models, configuration or the server's state. Demo deployments turn
+// it on to allow chatting with the models already there and nothing else.
+func ReadOnly(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if enabled {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "The server is read-only, unset OWNGPT_READONLY to manage models and configuration",
+				"code":  "READ_ONLY",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// modelKey holds the model a request was served by
+	modelKey = "owngpt.model"
+	// firstTokenKey holds when a streamed response sent its first token
+	firstTokenKey = "owngpt.first_token_at"
+)
+
+// SetModel records which model served the request, for request logging
+func SetModel(c *gin.Context, model string) {
+	c.Set(modelKey, model)
+}
+
+// MarkFirstToken records when a streamed response sent its first token.
+// Later calls are ignored.
+func MarkFirstToken(c *gin.Context) {
+	if _, ok := c.Get(firstTokenKey); !ok {
+		c.Set(firstTokenKey, time.Now())
+	}
+}
+
+// SlowRequests logs a warning for requests slower than threshold in total, or
+// streamed chat requests whose first token took longer than firstToken.
+// A zero threshold disables that check.
+func SlowRequests(threshold, firstToken time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		total := time.Since(start)
+
+		model := c.GetString(modelKey)
+		if model == "" {
+			model = c.Param("name")
+		}
+		if model == "" {
+			model = "-"
+		}
+
+		if value, ok := c.Get(firstTokenKey); ok && firstToken > 0 {
+			if ttft := value.(time.Time).Sub(start); ttft > firstToken {
+				log.Printf("WARN slow first token: %s %s model=%s ttft=%v threshold=%v",
+					c.Request.Method, c.Request.URL.Path, model, ttft.Round(time.Millisecond), firstToken)
+			}
+		}
+
+		if threshold > 0 && total > threshold {
+			log.Printf("WARN slow request: %s %s model=%s status=%d duration=%v threshold=%v",
+				c.Request.Method, c.Request.URL.Path, model, c.Writer.Status(), total.Round(time.Millisecond), threshold)
+		}
+	}
+}
@@ -0,0 +1,748 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ModelContainer describes the model container currently serving chat requests
+type ModelContainer struct {
+	Name      string `json:"name"`
+	Port      string `json:"port"`
+	IsRunning bool   `json:"is_running"`
+}
+
+var (
+	// CurrentModel is the container chat requests are routed to
+	CurrentModel ModelContainer
+	// ModelMutex guards CurrentModel
+	ModelMutex sync.RWMutex
+)
+
+// CreateDockerfileRequest is the payload for creating a new model container
+type CreateDockerfileRequest struct {
+	Model string `json:"model" binding:"required"`
+	// SkipPreload overrides OWNGPT_SKIP_PRELOAD for this model
+	SkipPreload *bool `json:"skip_preload,omitempty"`
+	// DockerfileTemplate replaces the generated Dockerfile with this template,
+	// rendered for the model. It requires the admin token.
+	DockerfileTemplate string `json:"dockerfile_template,omitempty"`
+	// Labels are custom Docker labels for the model's container, added to
+	// OWNGPT_LABELS and overriding it for the same key
+	Labels map[string]string `json:"labels,omitempty"`
+	// Digest pins the model to a manifest digest (sha256:...), which can also
+	// be given as model@sha256:...
+	Digest string `json:"digest,omitempty"`
+	// Force replaces an installed model whose digest differs from Digest
+	Force bool `json:"force,omitempty"`
+	// NoCache overrides OWNGPT_BUILD_NO_CACHE for this build
+	NoCache *bool `json:"no_cache,omitempty"`
+	// InlineCache overrides OWNGPT_BUILD_INLINE_CACHE for this build
+	InlineCache *bool `json:"inline_cache,omitempty"`
+	// NumParallel is how many requests the model's container serves at once,
+	// its OLLAMA_NUM_PARALLEL (0 for the default of 2)
+	NumParallel int `json:"num_parallel,omitempty"`
+	// Platform overrides OWNGPT_PLATFORM with the platform the image is built
+	// and run for, such as linux/amd64
+	Platform string `json:"platform,omitempty"`
+}
+
+// UpdateModelRequest is the optional payload for rebuilding a model with
+// POST /models/:name/update; its fields work as on CreateDockerfileRequest
+type UpdateModelRequest struct {
+	SkipPreload        *bool  `json:"skip_preload,omitempty"`
+	DockerfileTemplate string `json:"dockerfile_template,omitempty"`
+	NoCache            *bool  `json:"no_cache,omitempty"`
+	InlineCache        *bool  `json:"inline_cache,omitempty"`
+	// NumParallel changes the model's parallelism; 0 keeps the current one
+	NumParallel int `json:"num_parallel,omitempty"`
+	// Platform changes the model's platform; empty keeps the current one
+	Platform string `json:"platform,omitempty"`
+}
+
+// ChatRequest is the payload for sending a message to the current model
+type ChatRequest struct {
+	Message string `json:"message" binding:"required"`
+	// Images are base64-encoded images for multimodal models such as llava
+	Images []string `json:"images,omitempty"`
+	// Tools are function specs the model may call; they switch the request to Ollama's chat API
+	Tools []json.RawMessage `json:"tools,omitempty"`
+	// NumThread overrides the CPU threads used for this generation
+	NumThread *int `json:"num_thread,omitempty"`
+	// Options overrides the default sampling for this request
+	Options *SamplingOptions `json:"options,omitempty"`
+	// SessionID continues a conversation created with POST /chat/sessions
+	SessionID string `json:"session_id,omitempty"`
+	// Lang is a BCP-47 code for the language the model should reply in
+	Lang string `json:"lang,omitempty"`
+	// StripTags overrides OWNGPT_STRIP_TAGS with the tags whose sections are
+	// removed from the reply, such as think; an empty list strips nothing
+	StripTags []string `json:"strip_tags,omitempty"`
+	// Trim overrides OWNGPT_TRIM_OUTPUT, trimming whitespace around the reply
+	Trim *bool `json:"trim,omitempty"`
+	// MaxSentences cuts the reply off after this many sentences, stopping a
+	// streamed generation once it has them (0 for no limit)
+	MaxSentences int `json:"max_sentences,omitempty"`
+	// Logprobs asks for each generated token's log probability along with
+	// this many of the likeliest alternatives (0 for none), on Ollama
+	// versions that report them
+	Logprobs *int `json:"logprobs,omitempty"`
+	// Format is "json" to constrain the reply to valid JSON
+	Format string `json:"format,omitempty"`
+	// Stream has /chat stream the reply like /chat/stream instead of
+	// answering with it whole
+	Stream bool `json:"stream,omitempty"`
+	// Complete false leaves the complete event out of /chat/stream, for
+	// clients that only read the data events, so the reply isn't held in
+	// memory to repeat it
+	Complete *bool `json:"complete,omitempty"`
+	// History is the conversation before Message, filled in from the session
+	History []OllamaChatMessage `json:"-"`
+	// HistoryTrimmed is how many of the oldest turns were left out to fit the token budget
+	HistoryTrimmed int `json:"-"`
+	// NumPredictClamped is the num_predict the model's max_tokens lowered the request's to
+	NumPredictClamped int `json:"-"`
+}
+
+// SamplingOptions are per-request overrides of the default sampling
+type SamplingOptions struct {
+	NumPredict    *int     `json:"num_predict,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+	TfsZ          *float64 `json:"tfs_z,omitempty"`
+}
+
+// ChatResponse is the reply returned by the chat endpoints
+type ChatResponse struct {
+	Response  string     `json:"response,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// HistoryTrimmed is how many of the session's oldest turns were left out of the prompt
+	HistoryTrimmed int `json:"history_trimmed,omitempty"`
+	// FinishReason is why generation stopped: length, stop or end
+	FinishReason string `json:"finish_reason,omitempty"`
+	// Logprobs are the generated tokens' log probabilities, when requested
+	// and reported by Ollama
+	Logprobs []TokenLogprob `json:"logprobs,omitempty"`
+	// NumCtx is the context window the reply was generated with
+	NumCtx int `json:"num_ctx,omitempty"`
+	// NumPredictClamped is the num_predict the model's max_tokens lowered the request's to
+	NumPredictClamped int `json:"num_predict_clamped,omitempty"`
+	// TotalMs is the time from receiving the chat to answering it
+	TotalMs float64 `json:"total_ms,omitempty"`
+}
+
+// TokenLogprob is the log probability of a generated token, with the
+// likeliest alternatives at its position when they were asked for
+type TokenLogprob struct {
+	Token       string         `json:"token"`
+	Logprob     float64        `json:"logprob"`
+	TopLogprobs []TokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// Finish reasons reported on chat responses
+const (
+	// FinishLength means generation hit num_predict
+	FinishLength = "length"
+	// FinishStop means generation was stopped before the model finished, e.g. by the model being unloaded
+	FinishStop = "stop"
+	// FinishEnd means the model finished on its own, at its end token or a stop sequence
+	FinishEnd = "end"
+	// FinishSentences means the reply was cut off at the request's max_sentences
+	FinishSentences = "sentences"
+)
+
+// EmbeddingsRequest asks the running model for an embedding of each input
+type EmbeddingsRequest struct {
+	Input []string `json:"input" binding:"required,min=1"`
+}
+
+// EmbeddingsResponse holds one embedding per input, in the order given
+type EmbeddingsResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+// CompareRequest sends one prompt to several models to compare their answers
+type CompareRequest struct {
+	Prompt  string           `json:"prompt" binding:"required"`
+	Models  []string         `json:"models" binding:"required"`
+	Options *SamplingOptions `json:"options,omitempty"`
+}
+
+// CompareResult is how one model did in a comparison
+type CompareResult struct {
+	Model     string  `json:"model"`
+	LatencyMs float64 `json:"latency_ms"`
+	Tokens    int     `json:"tokens"`
+	// FinishReason is why the model's generation stopped
+	FinishReason string `json:"finish_reason,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// EvalVariant is one side of an A/B evaluation: a model and the sampling to
+// generate with
+type EvalVariant struct {
+	// Model is the running model to ask, the current model when empty
+	Model   string           `json:"model,omitempty"`
+	Options *SamplingOptions `json:"options,omitempty"`
+}
+
+// EvalCompareRequest generates from one prompt under two variants
+type EvalCompareRequest struct {
+	Prompt string      `json:"prompt" binding:"required"`
+	A      EvalVariant `json:"a"`
+	B      EvalVariant `json:"b"`
+}
+
+// EvalResponse is one variant's reply in an evaluation
+type EvalResponse struct {
+	Model            string           `json:"model"`
+	Options          *SamplingOptions `json:"options,omitempty"`
+	Response         string           `json:"response"`
+	FinishReason     string           `json:"finish_reason,omitempty"`
+	LatencyMs        float64          `json:"latency_ms"`
+	PromptTokens     int              `json:"prompt_tokens"`
+	CompletionTokens int              `json:"completion_tokens"`
+	Error            string           `json:"error,omitempty"`
+}
+
+// Preferences an evaluation's feedback can record
+const (
+	PreferA   = "a"
+	PreferB   = "b"
+	PreferTie = "tie"
+)
+
+// EvalComparison is a prompt answered under two variants, with the preference
+// recorded for it once given
+type EvalComparison struct {
+	ID        string       `json:"id"`
+	Prompt    string       `json:"prompt"`
+	CreatedAt time.Time    `json:"created_at"`
+	A         EvalResponse `json:"a"`
+	B         EvalResponse `json:"b"`
+	// Preferred is PreferA, PreferB or PreferTie, empty until feedback is given
+	Preferred  string     `json:"preferred,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	FeedbackAt *time.Time `json:"feedback_at,omitempty"`
+}
+
+// EvalFeedbackRequest records which reply of a comparison was preferred
+type EvalFeedbackRequest struct {
+	ID        string `json:"id" binding:"required"`
+	Preferred string `json:"preferred" binding:"required"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// ChatExplanation is what a chat request would send to Ollama, without generating
+type ChatExplanation struct {
+	Model string `json:"model"`
+	// Endpoint is the Ollama API the request would use, /api/generate or /api/chat
+	Endpoint string                 `json:"endpoint"`
+	Options  map[string]interface{} `json:"options"`
+}
+
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction names the function to call and its arguments
+type ToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// OllamaChatMessage is a message in Ollama's /api/chat conversation format
+type OllamaChatMessage struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// OllamaChatResponse is a single response object from Ollama's /api/chat
+type OllamaChatResponse struct {
+	Model     string            `json:"model"`
+	CreatedAt string            `json:"created_at"`
+	Message   OllamaChatMessage `json:"message"`
+	Done      bool              `json:"done"`
+	// DoneReason is Ollama's reason for stopping, which older versions don't send
+	DoneReason string `json:"done_reason,omitempty"`
+	// FinishReason is DoneReason mapped to a finish reason, or inferred when absent
+	FinishReason string `json:"-"`
+	// Logprobs are reported by Ollama versions that support them, when requested
+	Logprobs []TokenLogprob `json:"logprobs,omitempty"`
+	GenerationStats
+}
+
+// GenerationStats are the token counts and timings (in nanoseconds) Ollama
+// reports once a generation finishes
+type GenerationStats struct {
+	TotalDuration      int64 `json:"total_duration"`
+	LoadDuration       int64 `json:"load_duration"`
+	PromptEvalCount    int   `json:"prompt_eval_count"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration"`
+	EvalCount          int   `json:"eval_count"`
+	EvalDuration       int64 `json:"eval_duration"`
+	// TimeToFirstToken is set by OWNGPT on streamed chats: the nanoseconds
+	// from receiving the request to sending the first token
+	TimeToFirstToken int64 `json:"time_to_first_token,omitempty"`
+}
+
+// OllamaResponse is a single response object from Ollama's /api/generate
+type OllamaResponse struct {
+	Model     string `json:"model"`
+	CreatedAt string `json:"created_at"`
+	Response  string `json:"response"`
+	Done      bool   `json:"done"`
+	// DoneReason is Ollama's reason for stopping, which older versions don't send
+	DoneReason string `json:"done_reason,omitempty"`
+	// FinishReason is DoneReason mapped to a finish reason, or inferred when absent
+	FinishReason string `json:"-"`
+	// Logprobs are reported by Ollama versions that support them, when requested
+	Logprobs []TokenLogprob `json:"logprobs,omitempty"`
+	GenerationStats
+}
+
+// StreamChunk is one piece of a streamed generation. Intermediate chunks carry
+// a token; the final chunk has Done set with the full response and stats.
+type StreamChunk struct {
+	Token string
+	// Logprobs are the log probabilities of the chunk's tokens, when reported
+	Logprobs []TokenLogprob
+	Done     bool
+	Stats    *GenerationStats
+	// FinishReason is set on the final chunk when Ollama reported one
+	FinishReason string
+}
+
+// NDJSONChunk is one line of a newline-delimited JSON chat stream
+type NDJSONChunk struct {
+	Token string `json:"token,omitempty"`
+	// Item is a complete element of a JSON array reply, sent in place of tokens
+	Item json.RawMessage `json:"item,omitempty"`
+	// Logprobs are the log probabilities of the line's tokens, when requested
+	Logprobs []TokenLogprob   `json:"logprobs,omitempty"`
+	Done     bool             `json:"done"`
+	Stats    *GenerationStats `json:"stats,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	// Cancelled is set when an operator cancelled the generation
+	Cancelled bool `json:"cancelled,omitempty"`
+	// Code is a machine-readable error code, such as MODEL_OOM
+	Code string `json:"code,omitempty"`
+	// HistoryTrimmed is set on the final chunk when the session's oldest turns were left out
+	HistoryTrimmed int `json:"history_trimmed,omitempty"`
+	// FinishReason is set on the final chunk: length, stop or end
+	FinishReason string `json:"finish_reason,omitempty"`
+	// NumCtx is set on the final chunk to the context window the reply was generated with
+	NumCtx int `json:"num_ctx,omitempty"`
+	// NumPredictClamped is set on the final chunk to the num_predict the
+	// model's max_tokens lowered the request's to
+	NumPredictClamped int `json:"num_predict_clamped,omitempty"`
+	// JSON is set on the final chunk of a JSON reply to the whole reply
+	JSON json.RawMessage `json:"json,omitempty"`
+}
+
+// StreamComplete is the last event of an SSE chat stream. Text is the whole
+// reply, exactly the concatenation of the stream's data events.
+type StreamComplete struct {
+	Text         string           `json:"text"`
+	FinishReason string           `json:"finish_reason,omitempty"`
+	Stats        *GenerationStats `json:"stats,omitempty"`
+	// HistoryTrimmed is set when the session's oldest turns were left out
+	HistoryTrimmed int `json:"history_trimmed,omitempty"`
+	// NumCtx is the context window the reply was generated with
+	NumCtx int `json:"num_ctx,omitempty"`
+	// NumPredictClamped is the num_predict the model's max_tokens lowered the request's to
+	NumPredictClamped int `json:"num_predict_clamped,omitempty"`
+}
+
+// OllamaShowResponse holds the parts of Ollama's /api/show response we inspect
+type OllamaShowResponse struct {
+	Details struct {
+		Family   string   `json:"family"`
+		Families []string `json:"families"`
+	} `json:"details"`
+	ProjectorInfo map[string]interface{} `json:"projector_info"`
+	Capabilities  []string               `json:"capabilities"`
+	// System is the SYSTEM prompt from the model's Modelfile
+	System string `json:"system"`
+	// Template is the prompt template, which only tool-capable models give tools a place in
+	Template string `json:"template"`
+}
+
+// Capabilities a model can be asked about with GET /models/:name/supports
+const (
+	CapabilityEmbeddings = "embeddings"
+	CapabilityTools      = "tools"
+	CapabilityVision     = "vision"
+)
+
+// CapabilitySupport is whether a model supports a capability, and why
+type CapabilitySupport struct {
+	Model      string `json:"model"`
+	Capability string `json:"capability"`
+	Supported  bool   `json:"supported"`
+	Reason     string `json:"reason"`
+}
+
+// AvailableModel is a model that can be installed
+type AvailableModel struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Size        string `json:"size"`
+	Official    bool   `json:"official"`
+}
+
+// InstalledModel is a model container present on the Docker host
+type InstalledModel struct {
+	Name          string `json:"name"`
+	ContainerName string `json:"container_name"`
+	Status        string `json:"status"`
+	Ports         string `json:"ports"`
+	// State is the container's state parsed from Status, one of the State constants
+	State string `json:"state"`
+	// ExitCode is the last exit code of exited and restarting containers
+	ExitCode *int `json:"exit_code,omitempty"`
+	// IsRunning is set when the container is up and not failing or still
+	// waiting on its health check, so the model can serve
+	IsRunning bool `json:"is_running"`
+	// External marks a container not created by OWNGPT, found by OWNGPT_DISCOVER_EXTERNAL
+	External bool   `json:"external,omitempty"`
+	Image    string `json:"image,omitempty"`
+	// Tags are the metadata set with POST /models/:name/tags
+	Tags map[string]string `json:"tags,omitempty"`
+	// Labels are the custom Docker labels the container was created with
+	Labels map[string]string `json:"labels,omitempty"`
+	// Platform is the platform the container's image was built for, when recorded
+	Platform string `json:"platform,omitempty"`
+}
+
+// AdoptRequest makes an externally created Ollama container the current model
+type AdoptRequest struct {
+	ContainerName string `json:"container_name" binding:"required"`
+	// Model is the Ollama model to serve, defaulting to the only one the container has pulled
+	Model string `json:"model"`
+}
+
+// ModelConfig holds operator-set overrides for a single model
+type ModelConfig struct {
+	// TimeoutSeconds overrides the global generation timeout for this model
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// Scheme overrides how the backend reaches the model's Ollama server (http or https)
+	Scheme string `json:"scheme,omitempty"`
+	// Port overrides the Ollama port inside the model's container
+	Port int `json:"port,omitempty"`
+	// Weight is the model's share of chats under OWNGPT_LOAD_BALANCE; unset
+	// means 1 and 0 takes the model out of the rotation
+	Weight *int `json:"weight,omitempty"`
+	// NumCtx overrides OWNGPT_NUM_CTX, the context window the model's
+	// generations run with
+	NumCtx int `json:"num_ctx,omitempty"`
+	// MaxTokens caps num_predict for every generation with the model,
+	// whatever the request asks for; 0 leaves it uncapped
+	MaxTokens int `json:"max_tokens,omitempty"`
+}
+
+// Container states of an installed model
+const (
+	// StateCreated is a container that was created but never started
+	StateCreated = "created"
+	// StateStarting is a running container whose health check hasn't passed yet
+	StateStarting = "starting"
+	// StateRunning is a running container that is healthy or has no health check
+	StateRunning = "running"
+	// StateUnhealthy is a running container failing its health check
+	StateUnhealthy = "unhealthy"
+	// StatePaused is a container paused with docker pause
+	StatePaused = "paused"
+	// StateRestarting is a container Docker is restarting after it exited
+	StateRestarting = "restarting"
+	// StateExited is a stopped container
+	StateExited = "exited"
+	// StateDead is a container Docker failed to remove
+	StateDead = "dead"
+	// StateRemoving is a container being removed
+	StateRemoving = "removing"
+	// StateUnknown is a status docker ps reported that isn't recognized
+	StateUnknown = "unknown"
+)
+
+// Phases of work on a model that a last error can come from
+const (
+	// PhaseBuild covers writing the Dockerfile, building the image and pulling the model
+	PhaseBuild = "build"
+	// PhaseRun covers starting the container and waiting for the model to be ready
+	PhaseRun = "run"
+	// PhaseChat covers generations
+	PhaseChat = "chat"
+)
+
+// ModelError is the most recent failure of an operation on a model
+type ModelError struct {
+	Phase   string    `json:"phase"`
+	Code    string    `json:"code,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// ModelRecord is what OWNGPT tracks about a model beyond its container
+type ModelRecord struct {
+	Name   string      `json:"name"`
+	Config ModelConfig `json:"config"`
+	// LastError is the model's most recent failure, cleared by the next success
+	LastError *ModelError `json:"last_error,omitempty"`
+	// Tags are free-form key/value metadata for organizing models
+	Tags map[string]string `json:"tags,omitempty"`
+	// Digest is the manifest digest of the model's weights, read after each
+	// create, update or pull
+	Digest string `json:"digest,omitempty"`
+	// PinnedDigest is the digest the model was created with, which a re-pull
+	// may not change unless forced
+	PinnedDigest string `json:"pinned_digest,omitempty"`
+	// NumParallel is the OLLAMA_NUM_PARALLEL the model's container was built
+	// with, which bounds how many of its chats run at once
+	NumParallel int `json:"num_parallel,omitempty"`
+}
+
+// ModelTagsRequest sets a model's tags, replacing any it had
+type ModelTagsRequest struct {
+	Tags map[string]string `json:"tags"`
+}
+
+// ModelInfo describes a single model for /models/:name/info
+type ModelInfo struct {
+	Name             string          `json:"name"`
+	Installed        *InstalledModel `json:"installed,omitempty"`
+	Config           ModelConfig     `json:"config"`
+	EffectiveTimeout string          `json:"effective_timeout"`
+	BaseURL          string          `json:"base_url"`
+	// OOMKilled is set when the model's container has been killed for running
+	// out of memory, with OOMError explaining what to do about it
+	OOMKilled bool   `json:"oom_killed,omitempty"`
+	OOMError  string `json:"oom_error,omitempty"`
+	// LastError is the model's most recent build, run or chat failure
+	LastError *ModelError `json:"last_error,omitempty"`
+	// Digest and PinnedDigest are as recorded in the model's registry record
+	Digest       string `json:"digest,omitempty"`
+	PinnedDigest string `json:"pinned_digest,omitempty"`
+	// NumParallel is the model's recorded parallelism and ChatSlots the chats
+	// it answers at once, 0 for no limit
+	NumParallel int `json:"num_parallel,omitempty"`
+	ChatSlots   int `json:"chat_slots"`
+}
+
+// LoadedModel is a model held in an Ollama server's memory, from its /api/ps
+type LoadedModel struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest,omitempty"`
+	// Size is the memory the model takes, of which SizeVRAM is on the GPU
+	Size     int64 `json:"size"`
+	SizeVRAM int64 `json:"size_vram"`
+	// ExpiresAt is when keep-alive unloads the model unless it is used again
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ModelPS is a model's loaded-model status for GET /models/:name/ps
+type ModelPS struct {
+	Model string `json:"model"`
+	// Loaded is set when the model itself is in memory
+	Loaded bool `json:"loaded"`
+	// Models are all the models the model's Ollama server holds in memory,
+	// empty when nothing is loaded
+	Models []LoadedModel `json:"models"`
+}
+
+// BenchmarkRequest configures a throughput benchmark
+type BenchmarkRequest struct {
+	Prompt     string `json:"prompt"`
+	Iterations int    `json:"iterations"`
+}
+
+// BenchmarkRun is the measurement from a single benchmark generation
+type BenchmarkRun struct {
+	EvalCount       int     `json:"eval_count"`
+	EvalDurationMs  float64 `json:"eval_duration_ms"`
+	TokensPerSecond float64 `json:"tokens_per_second"`
+}
+
+// BenchmarkResult summarizes generation throughput for a model
+type BenchmarkResult struct {
+	Model              string         `json:"model"`
+	Prompt             string         `json:"prompt"`
+	Iterations         int            `json:"iterations"`
+	LoadTimeMs         float64        `json:"load_time_ms"`
+	MinTokensPerSecond float64        `json:"min_tokens_per_second"`
+	AvgTokensPerSecond float64        `json:"avg_tokens_per_second"`
+	MaxTokensPerSecond float64        `json:"max_tokens_per_second"`
+	Runs               []BenchmarkRun `json:"runs"`
+}
+
+// ModelUsage aggregates chat usage for one model
+type ModelUsage struct {
+	Requests       int       `json:"requests"`
+	Errors         int       `json:"errors"`
+	TotalTokens    int       `json:"total_tokens"`
+	TotalLatencyMs float64   `json:"total_latency_ms"`
+	AvgLatencyMs   float64   `json:"avg_latency_ms"`
+	LastUsed       time.Time `json:"last_used"`
+}
+
+// ClientUsage aggregates chat usage for one client, with its own per-model
+// breakdown
+type ClientUsage struct {
+	Requests    int                    `json:"requests"`
+	Errors      int                    `json:"errors"`
+	TotalTokens int                    `json:"total_tokens"`
+	Models      map[string]*ModelUsage `json:"models"`
+}
+
+// UsageStats aggregates chat usage across all models
+type UsageStats struct {
+	Since         time.Time              `json:"since"`
+	TotalRequests int                    `json:"total_requests"`
+	TotalErrors   int                    `json:"total_errors"`
+	TotalTokens   int                    `json:"total_tokens"`
+	Models        map[string]*ModelUsage `json:"models"`
+	// Clients breaks the totals down by the client they're attributed to,
+	// the admin token or the client's address
+	Clients map[string]*ClientUsage `json:"clients,omitempty"`
+}
+
+// Generation describes one finished chat request, for a model's recent history
+type Generation struct {
+	Time time.Time `json:"time"`
+	// PromptChars is the length of the message, without any conversation history
+	PromptChars      int     `json:"prompt_chars"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	LatencyMs        float64 `json:"latency_ms"`
+	FinishReason     string  `json:"finish_reason,omitempty"`
+	// Error is why the generation failed, empty when it succeeded
+	Error string `json:"error,omitempty"`
+	// Prompt is the message itself, kept only with OWNGPT_LOG_PROMPTS
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// ModelHistory is a model's most recent generations, newest first
+type ModelHistory struct {
+	Model string `json:"model"`
+	// Size is how many generations are kept for each model
+	Size        int          `json:"size"`
+	Generations []Generation `json:"generations"`
+}
+
+// PendingBuild is an image build waiting for a free build slot
+type PendingBuild struct {
+	ImageName string `json:"image_name"`
+	Position  int    `json:"position"`
+}
+
+// BuildQueueStatus reports running and pending image builds
+type BuildQueueStatus struct {
+	MaxConcurrent int            `json:"max_concurrent"`
+	Running       []string       `json:"running"`
+	Pending       []PendingBuild `json:"pending"`
+}
+
+// QueuedChat is a chat waiting for a free slot on its model
+type QueuedChat struct {
+	ID            string  `json:"id"`
+	Model         string  `json:"model"`
+	ContainerName string  `json:"container_name"`
+	SessionID     string  `json:"session_id,omitempty"`
+	Position      int     `json:"position"`
+	WaitSeconds   float64 `json:"wait_seconds"`
+}
+
+// ModelfileValidateRequest is the payload for checking a Modelfile
+type ModelfileValidateRequest struct {
+	Modelfile string `json:"modelfile" binding:"required"`
+}
+
+// ModelfileIssue is a problem found in a Modelfile. Line 0 applies to the whole file.
+type ModelfileIssue struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ModelfileValidation is the result of checking a Modelfile
+type ModelfileValidation struct {
+	Valid  bool             `json:"valid"`
+	Errors []ModelfileIssue `json:"errors"`
+}
+
+// ChatSession summarizes a conversation for session listings
+type ChatSession struct {
+	ID           string    `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+	Turns        int       `json:"turns"`
+	Generating   bool      `json:"generating"`
+	// Streams is how many streaming responses are open for the session
+	Streams   int       `json:"streams"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Welcome is the opening assistant message a new session starts with
+	Welcome string `json:"welcome,omitempty"`
+	// TrimmedTurns is how many of an imported transcript's oldest turns were
+	// dropped to keep within OWNGPT_SESSION_MAX_TURNS
+	TrimmedTurns int `json:"trimmed_turns,omitempty"`
+}
+
+// ChatTranscript is a session's whole conversation, as exported to save or
+// share it and imported to resume it in a new session
+type ChatTranscript struct {
+	SessionID  string              `json:"session_id,omitempty"`
+	CreatedAt  *time.Time          `json:"created_at,omitempty"`
+	ExportedAt *time.Time          `json:"exported_at,omitempty"`
+	Messages   []OllamaChatMessage `json:"messages" binding:"required,min=1"`
+}
+
+// CountTokensRequest is the payload for estimating a prompt's size
+type CountTokensRequest struct {
+	Prompt   string              `json:"prompt"`
+	Messages []OllamaChatMessage `json:"messages,omitempty"`
+	// SessionID counts the session's history as well
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// TokenCount is an approximate token count compared against the context window
+type TokenCount struct {
+	Tokens    int    `json:"tokens"`
+	NumCtx    int    `json:"num_ctx"`
+	Remaining int    `json:"remaining"`
+	Overflow  bool   `json:"overflow"`
+	Method    string `json:"method"`
+}
+
+// SelfCheck is the outcome of one startup check. Status is ok, warning or error.
+type SelfCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// SelfCheckResult is the outcome of the startup self-check
+type SelfCheckResult struct {
+	Ready     bool        `json:"ready"`
+	CheckedAt time.Time   `json:"checked_at"`
+	Checks    []SelfCheck `json:"checks"`
+	// BackgroundTasks is filled in by /health/ready with the periodic tasks' status
+	BackgroundTasks []BackgroundTask `json:"background_tasks,omitempty"`
+}
+
+// BackgroundTask is the status of a task the server runs periodically
+type BackgroundTask struct {
+	Name            string     `json:"name"`
+	IntervalSeconds float64    `json:"interval_seconds"`
+	LastRun         *time.Time `json:"last_run,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	Runs            int        `json:"runs"`
+	// Stale is set when the task hasn't finished a run for twice its interval
+	Stale bool `json:"stale"`
+}
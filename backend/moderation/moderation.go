@@ -0,0 +1,127 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"owngpt/config"
+	"owngpt/metrics"
+)
+
+// What is being screened
+const (
+	Prompt   = "prompt"
+	Response = "response"
+)
+
+// Verdict is the outcome of screening a piece of text
+type Verdict struct {
+	Blocked bool
+	// Reason says why the text was blocked, for the client
+	Reason string
+}
+
+var blocked = metrics.NewCounter(
+	"owngpt_moderation_blocked_total",
+	"Prompts and replies blocked by moderation",
+	"direction",
+)
+
+var (
+	compileOnce sync.Once
+	patterns    []*regexp.Regexp
+)
+
+// compiled returns OWNGPT_MODERATION_PATTERNS compiled once, case-insensitive.
+// The config has already dropped patterns that don't compile.
+func compiled() []*regexp.Regexp {
+	compileOnce.Do(func() {
+		for _, pattern := range config.Get().Moderation.Patterns {
+			patterns = append(patterns, regexp.MustCompile("(?i)"+pattern))
+		}
+	})
+	return patterns
+}
+
+// Enabled reports whether text in the direction is screened
+func Enabled(direction string) bool {
+	moderation := config.Get().Moderation
+	if moderation.Mode == "off" {
+		return false
+	}
+	return direction == Prompt || moderation.Responses
+}
+
+// Check screens text going in the direction under OWNGPT_MODERATION. It fails
+// when the moderation endpoint can't give a verdict, which callers treat as
+// blocking so nothing goes unscreened.
+func Check(ctx context.Context, direction, text string) (Verdict, error) {
+	if !Enabled(direction) || text == "" {
+		return Verdict{}, nil
+	}
+
+	var verdict Verdict
+	switch config.Get().Moderation.Mode {
+	case "patterns":
+		for _, pattern := range compiled() {
+			if pattern.MatchString(text) {
+				// The pattern is only logged, so clients can't probe the policy with it
+				log.Printf("Moderation blocked a %s matching %q", direction, pattern.String())
+				verdict = Verdict{Blocked: true, Reason: "it matches the content policy"}
+				break
+			}
+		}
+	case "http":
+		var err error
+		if verdict, err = ask(ctx, direction, text); err != nil {
+			return Verdict{}, err
+		}
+	}
+	if verdict.Blocked {
+		blocked.Inc(direction)
+	}
+	return verdict, nil
+}
+
+// ask posts the text to OWNGPT_MODERATION_URL as {"input": ..., "direction":
+// ...}, which answers {"flagged": bool, "reason": "..."}
+func ask(ctx context.Context, direction, text string) (Verdict, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.Get().ModerationTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]string{"input": text, "direction": direction})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.Get().Moderation.URL, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("moderation endpoint unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Verdict{}, fmt.Errorf("moderation endpoint returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	var result struct {
+		Flagged bool   `json:"flagged"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("invalid moderation response: %v", err)
+	}
+	verdict := Verdict{Blocked: result.Flagged, Reason: result.Reason}
+	if verdict.Blocked && verdict.Reason == "" {
+		verdict.Reason = "it was flagged by moderation"
+	}
+	return verdict, nil
+}
@@ -0,0 +1,70 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"owngpt/config"
+)
+
+// moderateWith sets the moderation settings for the test
+func moderateWith(t *testing.T, moderation config.Moderation) {
+	cfg := config.Get()
+	previous := cfg.Moderation
+	cfg.Moderation = moderation
+	t.Cleanup(func() { cfg.Moderation = previous })
+}
+
+func TestCheckHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Input, Direction string }
+		json.NewDecoder(r.Body).Decode(&body)
+		flagged := strings.Contains(body.Input, "bad")
+		json.NewEncoder(w).Encode(map[string]interface{}{"flagged": flagged, "reason": body.Direction + " is bad"})
+	}))
+	defer server.Close()
+
+	moderateWith(t, config.Moderation{Mode: "http", URL: server.URL, Responses: true})
+	tests := []struct {
+		direction, text string
+		blocked         bool
+	}{
+		{Prompt, "a bad prompt", true},
+		{Prompt, "a good prompt", false},
+		{Response, "a bad reply", true},
+		{Response, "a good reply", false},
+	}
+	for _, tt := range tests {
+		verdict, err := Check(context.Background(), tt.direction, tt.text)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.direction, tt.text, err)
+		}
+		if verdict.Blocked != tt.blocked {
+			t.Errorf("%s %q: blocked = %v, want %v", tt.direction, tt.text, verdict.Blocked, tt.blocked)
+		}
+		if verdict.Blocked && verdict.Reason != tt.direction+" is bad" {
+			t.Errorf("%s %q: reason = %q", tt.direction, tt.text, verdict.Reason)
+		}
+	}
+}
+
+func TestCheckResponsesOptIn(t *testing.T) {
+	moderateWith(t, config.Moderation{Mode: "http", URL: "http://127.0.0.1:1"})
+	if verdict, err := Check(context.Background(), Response, "anything"); err != nil || verdict.Blocked {
+		t.Errorf("reply without OWNGPT_MODERATION_RESPONSES = %+v, %v, want it unscreened", verdict, err)
+	}
+	if _, err := Check(context.Background(), Prompt, "anything"); err == nil {
+		t.Error("prompt with an unreachable endpoint passed, want an error")
+	}
+}
+
+func TestCheckOff(t *testing.T) {
+	moderateWith(t, config.Moderation{Mode: "off", Responses: true})
+	if Enabled(Prompt) || Enabled(Response) {
+		t.Error("moderation enabled with mode off")
+	}
+}
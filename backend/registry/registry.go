@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"sync"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/utils"
+)
+
+var (
+	mu      sync.RWMutex
+	records = make(map[string]*models.ModelRecord)
+)
+
+// key normalizes model names so a name given by a client and one recovered
+// from a container match
+func key(model string) string {
+	return utils.NormalizeModelName(model)
+}
+
+// Get returns a copy of the model's record, or an empty record if none
+// exists, with unset settings filled in from the model's profile
+func Get(model string) models.ModelRecord {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if record, ok := records[key(model)]; ok {
+		return withProfile(*record)
+	}
+	return withProfile(models.ModelRecord{Name: model})
+}
+
+// Update applies fn to the model's record, creating it if needed
+func Update(model string, fn func(record *models.ModelRecord)) models.ModelRecord {
+	mu.Lock()
+	defer mu.Unlock()
+
+	record, ok := records[key(model)]
+	if !ok {
+		record = &models.ModelRecord{Name: model}
+		records[key(model)] = record
+	}
+	fn(record)
+	return withProfile(*record)
+}
+
+// RecordError notes a failed operation as the model's last error
+func RecordError(model string, lastErr models.ModelError) {
+	Update(model, func(record *models.ModelRecord) {
+		record.LastError = &lastErr
+	})
+}
+
+// ClearError forgets the model's last error once an operation on it succeeds
+func ClearError(model string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if record, ok := records[key(model)]; ok {
+		record.LastError = nil
+	}
+}
+
+// Delete forgets everything recorded about the model, including its
+// persisted tags
+func Delete(model string) {
+	mu.Lock()
+	record, ok := records[key(model)]
+	tagged := ok && len(record.Tags) > 0
+	delete(records, key(model))
+	mu.Unlock()
+	if tagged {
+		saveTags()
+	}
+}
+
+// List returns copies of all records
+func List() []models.ModelRecord {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]models.ModelRecord, 0, len(records))
+	for _, record := range records {
+		list = append(list, *record)
+	}
+	return list
+}
+
+// Profile returns the model's profile from the config file, if it has one
+func Profile(model string) (config.Profile, bool) {
+	for name, profile := range config.Get().Profiles {
+		if key(name) == key(model) {
+			return profile, true
+		}
+	}
+	return config.Profile{}, false
+}
+
+// withProfile fills in the settings a record leaves unset from the model's
+// profile, so settings made through the API take precedence over the file
+func withProfile(record models.ModelRecord) models.ModelRecord {
+	profile, ok := Profile(record.Name)
+	if !ok {
+		return record
+	}
+	if record.Config.TimeoutSeconds == 0 {
+		record.Config.TimeoutSeconds = profile.TimeoutSeconds
+	}
+	if record.Config.Scheme == "" {
+		record.Config.Scheme = profile.Scheme
+	}
+	if record.Config.Port == 0 {
+		record.Config.Port = profile.Port
+	}
+	if record.Config.Weight == nil {
+		record.Config.Weight = profile.Weight
+	}
+	if record.Config.NumCtx == 0 {
+		record.Config.NumCtx = profile.NumCtx
+	}
+	if record.Config.MaxTokens == 0 {
+		record.Config.MaxTokens = profile.MaxTokens
+	}
+	return record
+}
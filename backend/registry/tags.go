@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/utils"
+)
+
+// saveMu keeps concurrent saves from writing an older snapshot last
+var saveMu sync.Mutex
+
+// SetTags replaces the model's tags, persisting them to OWNGPT_METADATA_FILE
+func SetTags(model string, tags map[string]string) models.ModelRecord {
+	if len(tags) == 0 {
+		tags = nil
+	}
+	record := Update(model, func(record *models.ModelRecord) {
+		record.Tags = tags
+	})
+	saveTags()
+	return record
+}
+
+// LoadTags restores persisted tags from OWNGPT_METADATA_FILE, if configured
+func LoadTags() {
+	path := config.Get().MetadataFile
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read model metadata from %s: %v", path, err)
+		}
+		return
+	}
+
+	var stored map[string]map[string]string
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("Failed to parse model metadata from %s: %v", path, err)
+		return
+	}
+	for model, tags := range stored {
+		tags := tags
+		Update(model, func(record *models.ModelRecord) {
+			record.Tags = tags
+		})
+	}
+}
+
+// saveTags writes every model's tags to OWNGPT_METADATA_FILE
+func saveTags() {
+	path := config.Get().MetadataFile
+	if path == "" {
+		return
+	}
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	mu.RLock()
+	stored := make(map[string]map[string]string)
+	for _, record := range records {
+		if len(record.Tags) > 0 {
+			stored[record.Name] = record.Tags
+		}
+	}
+	data, err := json.Marshal(stored)
+	mu.RUnlock()
+	if err != nil {
+		log.Printf("Failed to encode model metadata: %v", err)
+		return
+	}
+	if err := utils.WriteFileAtomic(path, data, 0644); err != nil {
+		log.Printf("Failed to write model metadata to %s: %v", path, err)
+	}
+}
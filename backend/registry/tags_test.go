@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// useMetadataFile points OWNGPT_METADATA_FILE at a fresh file and starts from
+// an empty registry
+func useMetadataFile(t *testing.T) string {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.MetadataFile
+	cfg.MetadataFile = filepath.Join(t.TempDir(), "metadata.json")
+
+	mu.Lock()
+	saved := records
+	records = make(map[string]*models.ModelRecord)
+	mu.Unlock()
+	t.Cleanup(func() {
+		cfg.MetadataFile = previous
+		mu.Lock()
+		records = saved
+		mu.Unlock()
+	})
+	return cfg.MetadataFile
+}
+
+// restart forgets every record, as a new process would, and loads the tags again
+func restart() {
+	mu.Lock()
+	records = make(map[string]*models.ModelRecord)
+	mu.Unlock()
+	LoadTags()
+}
+
+func TestSetTags(t *testing.T) {
+	useMetadataFile(t)
+
+	tags := map[string]string{"env": "prod"}
+	if record := SetTags("llama2", tags); !reflect.DeepEqual(record.Tags, tags) {
+		t.Errorf("SetTags returned %v", record.Tags)
+	}
+	if got := Get(" LLaMA2 ").Tags; !reflect.DeepEqual(got, tags) {
+		t.Errorf("Get returned %v", got)
+	}
+
+	if record := SetTags("llama2", map[string]string{}); record.Tags != nil {
+		t.Errorf("empty tags left %v", record.Tags)
+	}
+}
+
+func TestTagsPersistAcrossRestart(t *testing.T) {
+	path := useMetadataFile(t)
+
+	SetTags("llama2", map[string]string{"env": "prod", "team": "ml"})
+	SetTags("mistral", map[string]string{"env": "dev"})
+	SetTags("phi", map[string]string{"env": "dev"})
+	SetTags("phi", nil)
+
+	restart()
+	if got := Get("llama2").Tags; !reflect.DeepEqual(got, map[string]string{"env": "prod", "team": "ml"}) {
+		t.Errorf("llama2 came back with %v", got)
+	}
+	if got := Get("mistral").Tags; !reflect.DeepEqual(got, map[string]string{"env": "dev"}) {
+		t.Errorf("mistral came back with %v", got)
+	}
+	if got := Get("phi").Tags; got != nil {
+		t.Errorf("cleared tags came back as %v", got)
+	}
+
+	// The file is replaced whole, with nothing left next to it
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 || entries[0].Name() != "metadata.json" {
+		t.Errorf("directory holds %v", entries)
+	}
+}
+
+func TestTagsWithoutMetadataFile(t *testing.T) {
+	useMetadataFile(t)
+	config.Get().MetadataFile = ""
+
+	SetTags("llama2", map[string]string{"env": "prod"})
+	restart()
+	if got := Get("llama2").Tags; got != nil {
+		t.Errorf("tags came back without a metadata file: %v", got)
+	}
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mountPprof serves Go's runtime profiles under the group, which must be at
+// /debug/pprof. Named profiles such as goroutine and heap get their own route
+// because pprof.Index only finds them under the root path, not below
+// OWNGPT_BASE_PATH.
+func mountPprof(debug *gin.RouterGroup) {
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	debug.GET("/:profile", func(c *gin.Context) {
+		pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+	})
+}
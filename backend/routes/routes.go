@@ -1,42 +1,137 @@
 package routes
 
 import (
+	"log"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	appconfig "owngpt/config"
 	"owngpt/handlers"
+	"owngpt/metrics"
+	"owngpt/middleware"
 )
 
 // SetupRoutes configures all the routes for the application
 func SetupRoutes() *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	switch appconfig.Get().AccessLog {
+	case "json":
+		r.Use(middleware.AccessLog(gin.DefaultWriter))
+	case "text":
+		r.Use(gin.Logger())
+	}
+	r.Use(gin.Recovery())
+
+	// Only believe X-Forwarded-For from the proxies in front of the backend,
+	// so clients can't pose as others by sending it themselves
+	if err := r.SetTrustedProxies(appconfig.Get().TrustedProxies); err != nil {
+		log.Printf("Failed to set trusted proxies, trusting none: %v", err)
+		r.SetTrustedProxies(nil)
+	}
+
+	// Attribute requests to the admin token or the client's address, for the
+	// access log and usage stats
+	r.Use(middleware.Client(appconfig.Get().AdminToken))
 
-	// Configure CORS
+	// Configure CORS. Streaming handlers leave the CORS headers to this, so
+	// streams are allowed for the same origins as everything else.
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"http://localhost:9090", "http://frontend:9090"}
+	if origins := appconfig.Get().CORSOrigins; len(origins) == 1 && origins[0] == "*" {
+		config.AllowAllOrigins = true
+	} else {
+		config.AllowOrigins = origins
+	}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
 	r.Use(cors.New(config))
 
+	r.Use(middleware.SlowRequests(appconfig.Get().SlowRequestThreshold, appconfig.Get().SlowFirstTokenThreshold))
+
 	// Initialize handlers
 	modelHandler := handlers.NewModelHandler()
 	chatHandler := handlers.NewChatHandler()
 	healthHandler := handlers.NewHealthHandler()
+	statsHandler := handlers.NewStatsHandler()
+	adminHandler := handlers.NewAdminHandler()
+
+	// Every route is served under OWNGPT_BASE_PATH, for reverse proxies
+	// that mount the backend on a subpath
+	api := r.Group(appconfig.Get().BasePath)
+
+	// Routes that change models, configuration or server state are refused
+	// in read-only mode
+	manage := api.Group("", middleware.ReadOnly(appconfig.Get().ReadOnly))
 
 	// Health routes
-	r.GET("/health", healthHandler.CheckHealth)
+	api.GET("/health", healthHandler.CheckHealth)
+	api.GET("/health/ready", healthHandler.CheckReady)
+	api.GET("/metrics", metrics.Handler)
+	api.GET("/version", healthHandler.GetVersion)
+	api.GET("/capabilities", healthHandler.GetCapabilities)
+
+	// Probes inside the cluster reach the backend directly, not through the proxy
+	if appconfig.Get().BasePath != "" && appconfig.Get().RootProbes {
+		r.GET("/health", healthHandler.CheckHealth)
+		r.GET("/health/ready", healthHandler.CheckReady)
+		r.GET("/metrics", metrics.Handler)
+	}
+
+	// Usage statistics routes
+	api.GET("/stats", statsHandler.GetStats)
+	manage.DELETE("/stats", statsHandler.ResetStats)
 
 	// Model management routes
-	r.POST("/create-dockerfile", modelHandler.CreateModel)
-	r.GET("/models", modelHandler.GetInstalledModels)
-	r.GET("/available-models", modelHandler.GetAvailableModels)
-	r.DELETE("/models/:name", modelHandler.DeleteModel)
-	r.POST("/refresh-model", modelHandler.RefreshCurrentModel)
-	r.GET("/system-info", modelHandler.GetSystemInfo)
+	manage.POST("/create-dockerfile", modelHandler.CreateModel)
+	manage.POST("/create-dockerfile/stream", modelHandler.CreateModelStream)
+	api.GET("/models", modelHandler.GetInstalledModels)
+	api.GET("/available-models", modelHandler.GetAvailableModels)
+	manage.POST("/models/adopt", modelHandler.AdoptModel)
+	manage.DELETE("/models/:name", modelHandler.DeleteModel)
+	api.GET("/models/:name/info", modelHandler.GetModelInfo)
+	api.GET("/models/:name/last-error", modelHandler.GetLastError)
+	api.GET("/models/:name/history", modelHandler.GetModelHistory)
+	manage.PUT("/models/:name/config", modelHandler.UpdateModelConfig)
+	manage.POST("/models/:name/tags", modelHandler.SetModelTags)
+	manage.POST("/models/:name/update", modelHandler.UpdateModel)
+	manage.POST("/models/:name/pull-latest", modelHandler.PullLatest)
+	api.POST("/models/:name/benchmark", modelHandler.BenchmarkModel)
+	api.GET("/models/:name/ping", modelHandler.PingModel)
+	api.GET("/models/:name/ps", modelHandler.GetModelPS)
+	api.GET("/models/:name/supports", modelHandler.GetModelSupports)
+	manage.POST("/models/:name/ollama/:endpoint", middleware.AdminAuth(appconfig.Get().AdminToken), modelHandler.ProxyOllama)
+	manage.POST("/refresh-model", modelHandler.RefreshCurrentModel)
+	api.GET("/system-info", modelHandler.GetSystemInfo)
+	manage.POST("/system/prepare", modelHandler.PrepareSystem)
+	api.GET("/builds", modelHandler.GetBuildQueue)
+	api.POST("/modelfile/validate", modelHandler.ValidateModelfile)
 
 	// Chat routes
-	r.POST("/chat", chatHandler.SendMessage)
-	r.POST("/chat/stream", chatHandler.SendMessageStream)
+	api.POST("/chat", chatHandler.SendMessage)
+	api.POST("/chat/stream", chatHandler.SendMessageStream)
+	api.POST("/chat/count-tokens", chatHandler.CountTokens)
+	api.POST("/embeddings", chatHandler.Embed)
+	api.POST("/chat/explain", chatHandler.ExplainChat)
+	api.POST("/chat/compare", chatHandler.CompareModels)
+	api.POST("/eval/compare", chatHandler.EvalCompare)
+	api.POST("/eval/feedback", chatHandler.EvalFeedback)
+	api.POST("/chat/sessions", chatHandler.CreateSession)
+	api.GET("/chat/sessions", chatHandler.ListSessions)
+	api.POST("/chat/sessions/import", chatHandler.ImportSession)
+	api.GET("/chat/session/:id/export", chatHandler.ExportSession)
+	api.GET("/queue", chatHandler.ListQueue)
+	manage.DELETE("/queue/:id", middleware.AdminAuth(appconfig.Get().AdminToken), chatHandler.CancelQueued)
+
+	// Operator routes
+	admin := manage.Group("/admin", middleware.AdminAuth(appconfig.Get().AdminToken))
+	admin.POST("/cancel-all", adminHandler.CancelAll)
+	admin.GET("/config", adminHandler.GetConfig)
+
+	// Runtime profiles expose internals, so they are opt-in and admin-only.
+	// They change nothing, so read-only mode leaves them to the admin.
+	if appconfig.Get().Pprof {
+		mountPprof(api.Group("/debug/pprof", middleware.AdminAuth(appconfig.Get().AdminToken)))
+	}
 
 	return r
 }
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	appconfig "owngpt/config"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// readOnlyRouter sets up the routes with OWNGPT_READONLY, pprof and an admin token
+func readOnlyRouter(t *testing.T) *gin.Engine {
+	cfg := appconfig.Get()
+	readOnly, pprof, token, accessLog := cfg.ReadOnly, cfg.Pprof, cfg.AdminToken, cfg.AccessLog
+	cfg.ReadOnly, cfg.Pprof, cfg.AdminToken, cfg.AccessLog = true, true, "secret", "off"
+	t.Cleanup(func() { cfg.ReadOnly, cfg.Pprof, cfg.AdminToken, cfg.AccessLog = readOnly, pprof, token, accessLog })
+	return SetupRoutes()
+}
+
+func request(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestReadOnlyBlocksChanges(t *testing.T) {
+	router := readOnlyRouter(t)
+
+	blocked := []struct{ method, path string }{
+		{http.MethodPost, "/create-dockerfile"},
+		{http.MethodPost, "/create-dockerfile/stream"},
+		{http.MethodPost, "/models/adopt"},
+		{http.MethodDelete, "/models/llama2"},
+		{http.MethodPut, "/models/llama2/config"},
+		{http.MethodPost, "/models/llama2/tags"},
+		{http.MethodPost, "/models/llama2/update"},
+		{http.MethodPost, "/models/llama2/pull-latest"},
+		{http.MethodPost, "/models/llama2/ollama/show"},
+		{http.MethodPost, "/refresh-model"},
+		{http.MethodPost, "/system/prepare"},
+		{http.MethodDelete, "/stats"},
+		{http.MethodDelete, "/queue/1"},
+		{http.MethodPost, "/admin/cancel-all"},
+		{http.MethodGet, "/admin/config"},
+	}
+	for _, route := range blocked {
+		w := request(router, route.method, route.path, `{}`)
+		var body struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusForbidden || body.Code != "READ_ONLY" {
+			t.Errorf("%s %s: status %d code %q, want 403 READ_ONLY", route.method, route.path, w.Code, body.Code)
+		}
+	}
+}
+
+func TestReadOnlyAllowsReads(t *testing.T) {
+	router := readOnlyRouter(t)
+
+	allowed := []struct{ method, path, body string }{
+		{http.MethodGet, "/health", ""},
+		{http.MethodGet, "/version", ""},
+		{http.MethodGet, "/capabilities", ""},
+		{http.MethodGet, "/stats", ""},
+		{http.MethodGet, "/queue", ""},
+		{http.MethodGet, "/chat/sessions", ""},
+		{http.MethodPost, "/chat/count-tokens", `{"prompt":"hello"}`},
+		{http.MethodPost, "/modelfile/validate", `{"modelfile":"FROM llama2"}`},
+		{http.MethodGet, "/debug/pprof/cmdline", ""},
+	}
+	for _, route := range allowed {
+		if w := request(router, route.method, route.path, route.body); w.Code != http.StatusOK {
+			t.Errorf("%s %s: status %d, want 200", route.method, route.path, w.Code)
+		}
+	}
+}
+
+func TestCancelQueuedNeedsAdminToken(t *testing.T) {
+	cfg := appconfig.Get()
+	token, accessLog := cfg.AdminToken, cfg.AccessLog
+	cfg.AdminToken, cfg.AccessLog = "secret", "off"
+	t.Cleanup(func() { cfg.AdminToken, cfg.AccessLog = token, accessLog })
+	router := SetupRoutes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/queue/1", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without the token: status %d, want 401", w.Code)
+	}
+	if w := request(router, http.MethodDelete, "/queue/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("with the token: status %d, want 404 for a chat that isn't queued", w.Code)
+	}
+}
+
+// basePathRouter sets up the routes under /owngpt, with or without the root probes
+func basePathRouter(t *testing.T, rootProbes bool) *gin.Engine {
+	cfg := appconfig.Get()
+	basePath, probes, accessLog := cfg.BasePath, cfg.RootProbes, cfg.AccessLog
+	cfg.BasePath, cfg.RootProbes, cfg.AccessLog = "/owngpt", rootProbes, "off"
+	t.Cleanup(func() { cfg.BasePath, cfg.RootProbes, cfg.AccessLog = basePath, probes, accessLog })
+	return SetupRoutes()
+}
+
+func TestBasePath(t *testing.T) {
+	router := basePathRouter(t, false)
+	for _, path := range []string{"/owngpt/health", "/owngpt/version", "/owngpt/stats"} {
+		if w := request(router, http.MethodGet, path, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d, want 200", path, w.Code)
+		}
+	}
+	for _, path := range []string{"/health", "/version", "/stats"} {
+		if w := request(router, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404 outside the base path", path, w.Code)
+		}
+	}
+}
+
+func TestRootProbes(t *testing.T) {
+	router := basePathRouter(t, true)
+	for _, path := range []string{"/health", "/metrics", "/owngpt/health"} {
+		if w := request(router, http.MethodGet, path, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d, want 200", path, w.Code)
+		}
+	}
+	if w := request(router, http.MethodGet, "/version", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /version: status %d, want only the probes at the root", w.Code)
+	}
+}
+
+// corsRouter sets up the routes with OWNGPT_CORS_ORIGINS
+func corsRouter(t *testing.T, origins ...string) *gin.Engine {
+	cfg := appconfig.Get()
+	previous, accessLog := cfg.CORSOrigins, cfg.AccessLog
+	cfg.CORSOrigins, cfg.AccessLog = origins, "off"
+	t.Cleanup(func() { cfg.CORSOrigins, cfg.AccessLog = previous, accessLog })
+	return SetupRoutes()
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin a preflight from the origin gets
+func allowedOrigin(router *gin.Engine, origin string) string {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/chat/stream", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	router.ServeHTTP(w, req)
+	return w.Header().Get("Access-Control-Allow-Origin")
+}
+
+func TestCORSOrigins(t *testing.T) {
+	router := corsRouter(t, "https://chat.example.com")
+	if got := allowedOrigin(router, "https://chat.example.com"); got != "https://chat.example.com" {
+		t.Errorf("configured origin allowed %q", got)
+	}
+	if got := allowedOrigin(router, "http://localhost:9090"); got != "" {
+		t.Errorf("other origin allowed %q, want none", got)
+	}
+
+	if got := allowedOrigin(corsRouter(t, "*"), "https://anywhere.example"); got != "*" {
+		t.Errorf("with * allowed %q, want *", got)
+	}
+}
@@ -0,0 +1,133 @@
+package selfcheck
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/services"
+	"owngpt/utils"
+)
+
+const (
+	statusOK      = "ok"
+	statusWarning = "warning"
+	statusError   = "error"
+)
+
+var (
+	mu   sync.RWMutex
+	last models.SelfCheckResult
+)
+
+// Run checks the environment the server depends on, logs a summary and keeps
+// the result for /health/ready. Ready is false if any check has status error.
+func Run() models.SelfCheckResult {
+	dockerService := services.NewDockerService()
+	result := models.SelfCheckResult{Ready: true, CheckedAt: time.Now().UTC()}
+
+	add := func(name, status, format string, args ...interface{}) {
+		result.Checks = append(result.Checks, models.SelfCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+		if status == statusError {
+			result.Ready = false
+		}
+	}
+
+	// Local mode needs only the Ollama server. Otherwise everything needs the
+	// daemon, so skip the Docker checks without it.
+	if services.LocalMode() {
+		if version, err := services.NewLocalOllama().Version(); err != nil {
+			add("ollama", statusError, "Ollama at %s is not reachable: %v", config.Get().OllamaURL, err)
+		} else {
+			add("ollama", statusOK, "Ollama %s is reachable at %s", version, config.Get().OllamaURL)
+		}
+	} else if version, err := dockerService.DaemonVersion(); err != nil {
+		add("docker", statusError, "Docker daemon is not reachable: %v", err)
+	} else {
+		add("docker", statusOK, "Docker daemon %s is reachable", version)
+
+		if created, err := dockerService.EnsureNetwork(services.ModelNetwork()); err != nil {
+			add("network", statusError, "Network %s is missing and could not be created: %v", services.ModelNetwork(), err)
+		} else if created {
+			add("network", statusWarning, "Network %s did not exist and was created", services.ModelNetwork())
+		} else {
+			add("network", statusOK, "Network %s exists", services.ModelNetwork())
+		}
+
+		if dockerService.IsGPUAvailable() {
+			add("gpu", statusOK, "GPU support is available")
+		} else {
+			add("gpu", statusWarning, "No GPU support, models will run on the CPU")
+		}
+	}
+
+	if err := checkWritable(utils.ModelsDir); err != nil {
+		add("models_dir", statusError, "Models directory %s is not writable: %v", utils.ModelsDir, err)
+	} else {
+		add("models_dir", statusOK, "Models directory %s is writable", utils.ModelsDir)
+	}
+
+	if path := config.Get().DockerfileTemplate; path != "" && !services.LocalMode() {
+		if err := checkDockerfileTemplate(path); err != nil {
+			add("dockerfile_template", statusError, "Dockerfile template %s is unusable: %v", path, err)
+		} else {
+			add("dockerfile_template", statusOK, "Model images are built from the Dockerfile template %s", path)
+		}
+	}
+
+	for _, check := range result.Checks {
+		log.Printf("Self-check %-10s %-7s %s", check.Name, check.Status, check.Message)
+	}
+	if result.Ready {
+		log.Println("Self-check passed")
+	} else {
+		log.Println("Self-check found problems, model operations are likely to fail")
+	}
+
+	mu.Lock()
+	last = result
+	mu.Unlock()
+	return result
+}
+
+// Last returns the most recent self-check result
+func Last() models.SelfCheckResult {
+	mu.RLock()
+	defer mu.RUnlock()
+	return last
+}
+
+// checkDockerfileTemplate renders the configured Dockerfile template for a
+// sample model, so a broken template shows up before the first build
+func checkDockerfileTemplate(path string) error {
+	tmpl, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cfg := config.Get()
+	dockerfile, err := utils.RenderDockerfile(string(tmpl), "llama2", utils.DockerfileOptions{
+		OllamaVersion: cfg.OllamaVersion,
+		BaseImage:     cfg.BaseImage,
+	})
+	if err != nil {
+		return err
+	}
+	return utils.ValidateDockerfile(dockerfile, cfg.OllamaPort)
+}
+
+// checkWritable creates dir if needed and writes a scratch file to it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, ".owngpt-write-check")
+	if err := os.WriteFile(path, []byte("ok"), 0644); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"math/rand"
+	"sync"
+
+	"owngpt/metrics"
+	"owngpt/registry"
+)
+
+var routedInFlight = metrics.NewGauge(
+	"owngpt_routed_chats_in_flight",
+	"Chats routed by OWNGPT_LOAD_BALANCE that are still being answered",
+	"model",
+)
+
+// Route is the load balancer's choice of model for a chat
+type Route struct {
+	ContainerName string
+	Model         string
+	Weight        int
+	// InFlight is how many routed chats the model was already answering
+	InFlight int
+	// Candidates is how many running models were in the rotation
+	Candidates int
+}
+
+// chatRouter tracks how many routed chats each container is answering
+type chatRouter struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+var router = &chatRouter{inFlight: make(map[string]int)}
+
+// ModelWeight returns the model's share of balanced chats, 1 unless set with
+// PUT /models/:name/config or its profile
+func ModelWeight(model string) int {
+	if weight := registry.Get(model).Config.Weight; weight != nil {
+		return *weight
+	}
+	return 1
+}
+
+// RouteChat picks one of the running containers for a chat, at random in
+// proportion to each model's weight divided by one more than the chats it is
+// already answering, so idle models are preferred over busy ones of the same
+// weight. Models with weight 0 are skipped. release must be called once the
+// chat is answered. ok is false when no container has a positive weight.
+func RouteChat(containers []string) (route Route, release func(), ok bool) {
+	weights := make(map[string]int, len(containers))
+	for _, containerName := range containers {
+		if weight := ModelWeight(ModelForContainer(containerName)); weight > 0 {
+			weights[containerName] = weight
+		}
+	}
+	return router.pick(containers, weights)
+}
+
+func (r *chatRouter) pick(containers []string, weights map[string]int) (Route, func(), bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	total := 0.0
+	shares := make([]float64, len(containers))
+	for i, containerName := range containers {
+		if weights[containerName] > 0 {
+			shares[i] = float64(weights[containerName]) / float64(1+r.inFlight[containerName])
+			total += shares[i]
+		}
+	}
+	if total == 0 {
+		return Route{}, nil, false
+	}
+
+	chosen := -1
+	target := rand.Float64() * total
+	for i, share := range shares {
+		if share == 0 {
+			continue
+		}
+		chosen = i
+		if target < share {
+			break
+		}
+		target -= share
+	}
+
+	containerName := containers[chosen]
+	route := Route{
+		ContainerName: containerName,
+		Model:         ModelForContainer(containerName),
+		Weight:        weights[containerName],
+		InFlight:      r.inFlight[containerName],
+		Candidates:    len(weights),
+	}
+	r.inFlight[containerName]++
+	routedInFlight.Add(1, route.Model)
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.inFlight[containerName]--; r.inFlight[containerName] <= 0 {
+				delete(r.inFlight, containerName)
+			}
+			routedInFlight.Add(-1, route.Model)
+		})
+	}
+	return route, release, true
+}
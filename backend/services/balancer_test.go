@@ -0,0 +1,106 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestPickHonorsWeights(t *testing.T) {
+	r := &chatRouter{inFlight: make(map[string]int)}
+	containers := []string{"ollama-a-container", "ollama-b-container", "ollama-c-container"}
+	weights := map[string]int{"ollama-a-container": 3, "ollama-b-container": 1}
+
+	const picks = 20000
+	counts := make(map[string]int)
+	for i := 0; i < picks; i++ {
+		route, release, ok := r.pick(containers, weights)
+		if !ok {
+			t.Fatal("pick found no container")
+		}
+		counts[route.ContainerName]++
+		if route.Candidates != 2 {
+			t.Fatalf("Candidates = %d, want 2", route.Candidates)
+		}
+		release()
+	}
+
+	if counts["ollama-c-container"] != 0 {
+		t.Errorf("weight 0 container picked %d times", counts["ollama-c-container"])
+	}
+	if share := float64(counts["ollama-a-container"]) / picks; math.Abs(share-0.75) > 0.03 {
+		t.Errorf("weight 3 of 4 got %.3f of the chats, want about 0.75", share)
+	}
+}
+
+func TestPickNoPositiveWeight(t *testing.T) {
+	r := &chatRouter{inFlight: make(map[string]int)}
+	if _, _, ok := r.pick([]string{"ollama-a-container"}, map[string]int{}); ok {
+		t.Error("pick succeeded without a positive weight")
+	}
+}
+
+func TestPickPrefersLeastLoaded(t *testing.T) {
+	r := &chatRouter{inFlight: make(map[string]int)}
+	busy, idle := "ollama-busy-container", "ollama-idle-container"
+	weights := map[string]int{busy: 1, idle: 1}
+
+	// Keep three chats in flight on the busy container
+	for i := 0; i < 3; i++ {
+		route, _, _ := r.pick([]string{busy}, weights)
+		if route.InFlight != i {
+			t.Fatalf("InFlight = %d, want %d", route.InFlight, i)
+		}
+	}
+
+	const picks = 10000
+	idleCount := 0
+	for i := 0; i < picks; i++ {
+		route, release, _ := r.pick([]string{busy, idle}, weights)
+		if route.ContainerName == idle {
+			idleCount++
+		}
+		release()
+	}
+	// The busy container's share is 1/4 against the idle one's 1
+	if share := float64(idleCount) / picks; math.Abs(share-0.8) > 0.03 {
+		t.Errorf("idle container got %.3f of the chats, want about 0.8", share)
+	}
+}
+
+func TestPickBalancesConcurrentChats(t *testing.T) {
+	r := &chatRouter{inFlight: make(map[string]int)}
+	containers := []string{"ollama-a-container", "ollama-b-container"}
+	weights := map[string]int{"ollama-a-container": 1, "ollama-b-container": 1}
+
+	const chats = 200
+	releases := make(chan func(), chats)
+	var wg sync.WaitGroup
+	for i := 0; i < chats; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, release, _ := r.pick(containers, weights)
+			releases <- release
+		}()
+	}
+	wg.Wait()
+	close(releases)
+
+	a, b := r.inFlight["ollama-a-container"], r.inFlight["ollama-b-container"]
+	if a+b != chats {
+		t.Fatalf("in flight = %d, want %d", a+b, chats)
+	}
+	// Each pick favors the less loaded container, so the two stay close
+	if diff := a - b; diff > 20 || diff < -20 {
+		t.Errorf("in flight split %d/%d, want them close", a, b)
+	}
+
+	for release := range releases {
+		release()
+		release()
+	}
+	if len(r.inFlight) != 0 {
+		t.Errorf("in flight after release = %v, want none", r.inFlight)
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"owngpt/config"
+)
+
+func TestPullBaseImage(t *testing.T) {
+	cfg := config.Get()
+	image, version, platform := cfg.BaseImage, cfg.OllamaVersion, cfg.Platform
+	cfg.BaseImage, cfg.OllamaVersion, cfg.Platform = "ollama/ollama", "0.1.32", ""
+	t.Cleanup(func() { cfg.BaseImage, cfg.OllamaVersion, cfg.Platform = image, version, platform })
+
+	const inspect = "docker image inspect ollama/ollama:0.1.32"
+	tests := []struct {
+		name        string
+		failures    map[string]string
+		wantPresent bool
+		wantPull    bool
+		wantErr     string
+	}{
+		{"present", nil, true, false, ""},
+		{"missing", map[string]string{inspect: "Error: No such image: ollama/ollama:0.1.32"}, false, true, ""},
+		{"pull fails", map[string]string{
+			inspect:       "Error: No such image: ollama/ollama:0.1.32",
+			"docker pull": "manifest unknown",
+		}, false, true, "failed to pull ollama/ollama:0.1.32"},
+		{"daemon down", map[string]string{inspect: "Cannot connect to the Docker daemon"}, false, false, "failed to inspect image"},
+	}
+	for _, tt := range tests {
+		var lines []string
+		present, err := failingDocker(tt.failures).PullBaseImage(func(line string) { lines = append(lines, line) })
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+		if present != tt.wantPresent {
+			t.Errorf("%s: present = %v, want %v", tt.name, present, tt.wantPresent)
+		}
+		// The fake echoes successful commands and prints failures, both to onLine
+		pulled := len(lines) > 0
+		if pulled != tt.wantPull {
+			t.Errorf("%s: pull output %q, want a pull: %v", tt.name, lines, tt.wantPull)
+		}
+		if tt.name == "missing" && (len(lines) != 1 || lines[0] != "docker pull ollama/ollama:0.1.32") {
+			t.Errorf("%s: pulled with %q", tt.name, lines)
+		}
+	}
+}
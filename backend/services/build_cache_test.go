@@ -0,0 +1,41 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildArgs(t *testing.T) {
+	tests := []struct {
+		opts BuildOptions
+		want string
+	}{
+		{BuildOptions{}, "build -t ollama-llama2 /ctx"},
+		{BuildOptions{CacheFrom: "ollama-llama2"}, "build -t ollama-llama2 /ctx"},
+		{BuildOptions{NoCache: true}, "build -t ollama-llama2 --no-cache /ctx"},
+		{
+			BuildOptions{InlineCache: true, CacheFrom: "ollama-llama2"},
+			"build -t ollama-llama2 --build-arg BUILDKIT_INLINE_CACHE=1 --cache-from ollama-llama2 /ctx",
+		},
+		// A clean build still embeds cache metadata, but reuses nothing
+		{
+			BuildOptions{NoCache: true, InlineCache: true, CacheFrom: "ollama-llama2"},
+			"build -t ollama-llama2 --no-cache --build-arg BUILDKIT_INLINE_CACHE=1 /ctx",
+		},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(buildArgs("/ctx", "ollama-llama2", tt.opts), " "); got != tt.want {
+			t.Errorf("buildArgs(%+v) = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestBuildDockerImageCacheOptions(t *testing.T) {
+	ds, fake := newFakeDockerService(map[string]string{"docker build": ""})
+	if err := ds.BuildDockerImage("/ctx", "ollama-llama2", BuildOptions{NoCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.called("docker build -t ollama-llama2 --no-cache /ctx") != 1 {
+		t.Errorf("ran %q, want a --no-cache build", fake.calls)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"sync"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// buildQueue bounds how many docker builds run at once and queues the rest in arrival order
+type buildQueue struct {
+	mu      sync.Mutex
+	slots   int
+	running []string
+	pending []*queuedBuild
+}
+
+type queuedBuild struct {
+	imageName string
+	ready     chan struct{}
+}
+
+// builds is shared by every DockerService so the limit applies process-wide
+var builds = newBuildQueue(config.Get().MaxConcurrentBuilds)
+
+func newBuildQueue(slots int) *buildQueue {
+	return &buildQueue{slots: slots}
+}
+
+// acquire reserves a build slot for the image. It returns the queue position
+// (0 when a slot was free) and a channel that is closed once the build may start.
+func (bq *buildQueue) acquire(imageName string) (int, <-chan struct{}) {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+
+	build := &queuedBuild{imageName: imageName, ready: make(chan struct{})}
+	if len(bq.running) < bq.slots {
+		bq.running = append(bq.running, imageName)
+		close(build.ready)
+		return 0, build.ready
+	}
+
+	bq.pending = append(bq.pending, build)
+	return len(bq.pending), build.ready
+}
+
+// release frees the image's slot and hands it to the oldest pending build
+func (bq *buildQueue) release(imageName string) {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+
+	for i, name := range bq.running {
+		if name == imageName {
+			bq.running = append(bq.running[:i], bq.running[i+1:]...)
+			break
+		}
+	}
+
+	if len(bq.pending) > 0 && len(bq.running) < bq.slots {
+		next := bq.pending[0]
+		bq.pending = bq.pending[1:]
+		bq.running = append(bq.running, next.imageName)
+		close(next.ready)
+	}
+}
+
+// status returns a snapshot of running and pending builds
+func (bq *buildQueue) status() models.BuildQueueStatus {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+
+	status := models.BuildQueueStatus{
+		MaxConcurrent: bq.slots,
+		Running:       append([]string{}, bq.running...),
+		Pending:       []models.PendingBuild{},
+	}
+	for i, build := range bq.pending {
+		status.Pending = append(status.Pending, models.PendingBuild{
+			ImageName: build.imageName,
+			Position:  i + 1,
+		})
+	}
+	return status
+}
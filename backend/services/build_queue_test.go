@@ -0,0 +1,58 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"owngpt/models"
+)
+
+// isReady reports whether the build may start
+func isReady(ready <-chan struct{}) bool {
+	select {
+	case <-ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBuildQueueLimitsConcurrentBuilds(t *testing.T) {
+	bq := newBuildQueue(2)
+
+	var readies []<-chan struct{}
+	for i, image := range []string{"a", "b", "c", "d"} {
+		position, ready := bq.acquire(image)
+		if want := max(i-1, 0); position != want {
+			t.Errorf("%s queued at %d, want %d", image, position, want)
+		}
+		readies = append(readies, ready)
+	}
+	if !isReady(readies[0]) || !isReady(readies[1]) || isReady(readies[2]) || isReady(readies[3]) {
+		t.Fatal("only the first two builds should start")
+	}
+
+	want := models.BuildQueueStatus{
+		MaxConcurrent: 2,
+		Running:       []string{"a", "b"},
+		Pending:       []models.PendingBuild{{ImageName: "c", Position: 1}, {ImageName: "d", Position: 2}},
+	}
+	if got := bq.status(); !reflect.DeepEqual(got, want) {
+		t.Errorf("status = %+v, want %+v", got, want)
+	}
+
+	// Slots go to the oldest pending build
+	bq.release("b")
+	if !isReady(readies[2]) || isReady(readies[3]) {
+		t.Error("releasing b should start c only")
+	}
+	bq.release("a")
+	if !isReady(readies[3]) {
+		t.Error("releasing a should start d")
+	}
+	bq.release("c")
+	bq.release("d")
+	if got := bq.status(); len(got.Running) != 0 || len(got.Pending) != 0 {
+		t.Errorf("status after every build = %+v", got)
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	"owngpt/sessions"
+)
+
+// ErrGenerationCancelled is returned by generations stopped through CancelAllGenerations
+var ErrGenerationCancelled = errors.New("generation cancelled by an operator")
+
+// generations holds the cancel functions of in-flight generations
+var generations = sessions.NewSessionManager[struct{}]()
+
+// generationID numbers generations so each has its own key in generations
+var generationID atomic.Uint64
+
+// trackGeneration returns a context CancelAllGenerations can cancel. Call done
+// once the generation finishes.
+func trackGeneration(parent context.Context) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	id := strconv.FormatUint(generationID.Add(1), 10)
+	generations.SetCancellable(id, struct{}{}, func() { cancel(ErrGenerationCancelled) })
+
+	return ctx, func() {
+		generations.Delete(id)
+		cancel(nil)
+	}
+}
+
+// CancelAllGenerations stops every in-flight generation and returns how many there were
+func CancelAllGenerations() int {
+	return generations.CancelAll()
+}
+
+// generationErr reports ErrGenerationCancelled in place of the context error
+// for generations stopped by CancelAllGenerations
+func generationErr(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), ErrGenerationCancelled) {
+		return ErrGenerationCancelled
+	}
+	return err
+}
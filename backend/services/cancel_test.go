@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owngpt/models"
+)
+
+func TestTrackGeneration(t *testing.T) {
+	ctx, done := trackGeneration(context.Background())
+	finished, finish := trackGeneration(context.Background())
+	finish()
+
+	if cancelled := CancelAllGenerations(); cancelled != 1 {
+		t.Errorf("cancelled %d generations, want only the running one", cancelled)
+	}
+	if err := generationErr(ctx, ctx.Err()); !errors.Is(err, ErrGenerationCancelled) {
+		t.Errorf("err = %v, want ErrGenerationCancelled", err)
+	}
+	done()
+
+	// A generation that ended on its own keeps its own error
+	if err := generationErr(finished, finished.Err()); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the context's own error", err)
+	}
+	if cancelled := CancelAllGenerations(); cancelled != 0 {
+		t.Errorf("cancelled %d generations after all finished, want 0", cancelled)
+	}
+}
+
+func TestCancelAllStopsStream(t *testing.T) {
+	gone := endlessOllama(t)
+
+	responses, errs := NewOllamaService().SendMessageStream(context.Background(), models.ChatRequest{Message: "cancel test"}, "ollama-stream-container")
+	<-responses
+	if cancelled := CancelAllGenerations(); cancelled != 1 {
+		t.Errorf("cancelled %d generations, want 1", cancelled)
+	}
+
+	for range responses {
+	}
+	if err := <-errs; !errors.Is(err, ErrGenerationCancelled) {
+		t.Errorf("err = %v, want ErrGenerationCancelled", err)
+	}
+	waitGone(t, gone)
+}
+
+func TestCallerCancelStopsGeneration(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		generate func(ctx context.Context) error
+	}{
+		{"generate", "/api/generate", func(ctx context.Context) error {
+			_, err := NewOllamaService().Generate(ctx, models.ChatRequest{Message: "cancel test"}, "ollama-llama2-container")
+			return err
+		}},
+		{"chat", "/api/chat", func(ctx context.Context) error {
+			_, err := NewOllamaService().SendChat(ctx, models.ChatRequest{Message: "cancel test"}, "ollama-llama2-container")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gone := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					w.Write([]byte(`{}`))
+					return
+				}
+				// The server only notices the client going away once the body is read
+				io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+				close(gone)
+			}))
+			t.Cleanup(server.Close)
+			useOllama(t, server.URL)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			if err := tt.generate(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("err = %v, want context.Canceled", err)
+			}
+			waitGone(t, gone)
+		})
+	}
+}
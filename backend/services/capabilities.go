@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"owngpt/models"
+)
+
+// embeddingFamilies are the architectures of dedicated embedding models
+var embeddingFamilies = map[string]bool{"bert": true, "nomic-bert": true}
+
+// ollamaCapabilities are the names Ollama's /api/show lists the capabilities under
+var ollamaCapabilities = map[string]string{
+	models.CapabilityEmbeddings: "embedding",
+	models.CapabilityTools:      "tools",
+	models.CapabilityVision:     "vision",
+}
+
+var (
+	// capabilityCache holds each model's answers, which only change when the
+	// model is replaced
+	capabilityCache   = make(map[string]map[string]models.CapabilitySupport)
+	capabilityCacheMu sync.RWMutex
+)
+
+// Supports reports whether the container's model supports the capability,
+// one of the models.Capability names. Newer Ollama versions list a model's
+// capabilities in /api/show; for older ones it is worked out from the model's
+// template, vision projector and families. Answers are cached per model until
+// ForgetCapabilities.
+func (os *OllamaService) Supports(containerName, capability string) (models.CapabilitySupport, error) {
+	model := ModelForContainer(containerName)
+
+	capabilityCacheMu.RLock()
+	support, ok := capabilityCache[model][capability]
+	capabilityCacheMu.RUnlock()
+	if ok {
+		return support, nil
+	}
+
+	showResp, err := os.show(containerName)
+	if err != nil {
+		return models.CapabilitySupport{}, err
+	}
+	answers := make(map[string]models.CapabilitySupport)
+	for _, name := range []string{models.CapabilityEmbeddings, models.CapabilityTools, models.CapabilityVision} {
+		supported, reason := inspectCapability(model, name, showResp)
+		answers[name] = models.CapabilitySupport{Model: model, Capability: name, Supported: supported, Reason: reason}
+	}
+
+	capabilityCacheMu.Lock()
+	capabilityCache[model] = answers
+	capabilityCacheMu.Unlock()
+	return answers[capability], nil
+}
+
+// ForgetCapabilities drops the model's cached answers, for a model that was
+// deleted or replaced with other weights
+func ForgetCapabilities(model string) {
+	capabilityCacheMu.Lock()
+	defer capabilityCacheMu.Unlock()
+	delete(capabilityCache, model)
+}
+
+// inspectCapability decides one capability from the model's /api/show details
+func inspectCapability(model, capability string, showResp models.OllamaShowResponse) (bool, string) {
+	if len(showResp.Capabilities) > 0 {
+		listed := ollamaCapabilities[capability]
+		for _, c := range showResp.Capabilities {
+			if c == listed {
+				return true, fmt.Sprintf("Ollama lists %s among the model's capabilities", listed)
+			}
+		}
+		return false, fmt.Sprintf("Ollama's capabilities for the model (%s) don't include %s", strings.Join(showResp.Capabilities, ", "), listed)
+	}
+
+	embedding := strings.Contains(strings.ToLower(model), "embed")
+	for _, f := range append([]string{showResp.Details.Family}, showResp.Details.Families...) {
+		embedding = embedding || embeddingFamilies[f]
+	}
+
+	switch capability {
+	case models.CapabilityEmbeddings:
+		if embedding {
+			return true, "the model is a dedicated embedding model"
+		}
+		return false, "the model generates text, its embeddings aren't trained for search; use an embedding model such as nomic-embed-text"
+	case models.CapabilityTools:
+		if embedding {
+			return false, "embedding models don't generate text"
+		}
+		if strings.Contains(showResp.Template, ".Tools") {
+			return true, "the model's prompt template renders tool definitions"
+		}
+		return false, "the model's prompt template has no place for tool definitions"
+	case models.CapabilityVision:
+		if len(showResp.ProjectorInfo) > 0 {
+			return true, "the model has a vision projector"
+		}
+		for _, f := range showResp.Details.Families {
+			if f == "clip" {
+				return true, "the model includes the clip image encoder"
+			}
+		}
+		return false, "the model has no vision projector or image encoder"
+	}
+	return false, fmt.Sprintf("unknown capability %s", capability)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"owngpt/models"
+)
+
+func TestInspectCapability(t *testing.T) {
+	show := func(edit func(*models.OllamaShowResponse)) models.OllamaShowResponse {
+		var showResp models.OllamaShowResponse
+		edit(&showResp)
+		return showResp
+	}
+	listed := show(func(s *models.OllamaShowResponse) { s.Capabilities = []string{"completion", "tools"} })
+	tools := show(func(s *models.OllamaShowResponse) { s.Template = "{{ if .Tools }}{{ .Tools }}{{ end }}" })
+	bert := show(func(s *models.OllamaShowResponse) { s.Details.Family = "nomic-bert" })
+	projector := show(func(s *models.OllamaShowResponse) {
+		s.ProjectorInfo = map[string]interface{}{"clip.has_vision_encoder": true}
+	})
+	clip := show(func(s *models.OllamaShowResponse) { s.Details.Families = []string{"llama", "clip"} })
+	plain := models.OllamaShowResponse{}
+
+	tests := []struct {
+		name       string
+		model      string
+		capability string
+		showResp   models.OllamaShowResponse
+		want       bool
+	}{
+		// Ollama's own list wins over the model's details
+		{"listed", "llama3.1", models.CapabilityTools, listed, true},
+		{"not listed", "llama3.1", models.CapabilityVision, listed, false},
+		{"listed, no embedding", "llama3.1", models.CapabilityEmbeddings, listed, false},
+
+		{"tool template", "mistral", models.CapabilityTools, tools, true},
+		{"no tool template", "llama2", models.CapabilityTools, plain, false},
+		{"embedding family", "nomic", models.CapabilityEmbeddings, bert, true},
+		{"embedding name", "mxbai-embed-large", models.CapabilityEmbeddings, plain, true},
+		{"embedding model has no tools", "mxbai-embed-large", models.CapabilityTools, tools, false},
+		{"text model", "llama2", models.CapabilityEmbeddings, plain, false},
+		{"projector", "llava", models.CapabilityVision, projector, true},
+		{"clip family", "bakllava", models.CapabilityVision, clip, true},
+		{"no vision", "llama2", models.CapabilityVision, plain, false},
+	}
+	for _, tt := range tests {
+		supported, reason := inspectCapability(tt.model, tt.capability, tt.showResp)
+		if supported != tt.want || reason == "" {
+			t.Errorf("%s: supported %v (%q), want %v with a reason", tt.name, supported, reason, tt.want)
+		}
+	}
+}
+
+func TestSupportsCaches(t *testing.T) {
+	var shows atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shows.Add(1)
+		w.Write([]byte(`{"capabilities":["completion","vision"]}`))
+	}))
+	t.Cleanup(server.Close)
+	useOllama(t, server.URL)
+	ForgetCapabilities("llava")
+	t.Cleanup(func() { ForgetCapabilities("llava") })
+
+	ollama := NewOllamaService()
+	for _, capability := range []string{models.CapabilityVision, models.CapabilityTools, models.CapabilityEmbeddings} {
+		support, err := ollama.Supports("ollama-llava-container", capability)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := capability == models.CapabilityVision; support.Supported != want || support.Model != "llava" || support.Capability != capability {
+			t.Errorf("Supports(%s) = %+v, want supported %v", capability, support, want)
+		}
+	}
+	// One /api/show answers every capability
+	if got := shows.Load(); got != 1 {
+		t.Errorf("/api/show called %d times, want 1", got)
+	}
+
+	ForgetCapabilities("llava")
+	if multimodal, err := ollama.IsMultimodal("ollama-llava-container"); err != nil || !multimodal {
+		t.Errorf("IsMultimodal = %v, %v, want true", multimodal, err)
+	}
+	if got := shows.Load(); got != 2 {
+		t.Errorf("/api/show called %d times after forgetting, want 2", got)
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"owngpt/config"
+	"owngpt/metrics"
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+// ErrChatQueueFull is returned when OWNGPT_CHAT_QUEUE_DEPTH chats are already
+// waiting for the model
+var ErrChatQueueFull = errors.New("too many chats are waiting for this model, try again later")
+
+// ErrChatDequeued is returned to a queued chat removed with CancelQueuedChat
+var ErrChatDequeued = errors.New("chat removed from the queue by an operator")
+
+var (
+	chatsWaiting = metrics.NewGauge(
+		"owngpt_chat_requests_waiting",
+		"Chats waiting for a free slot on their model",
+		"model",
+	)
+	chatsRejected = metrics.NewCounter(
+		"owngpt_chat_requests_rejected_total",
+		"Chats turned away because their model's queue was full",
+		"model",
+	)
+)
+
+// queuedChat is a chat waiting for a slot on its model
+type queuedChat struct {
+	id            string
+	containerName string
+	sessionID     string
+	enqueued      time.Time
+	// ready is closed once the chat holds a slot
+	ready chan struct{}
+	// dequeued is closed when an operator removes the chat from the queue
+	dequeued chan struct{}
+}
+
+// modelSlots counts a model's generating chats and queues the rest in arrival order
+type modelSlots struct {
+	running int
+	pending []*queuedChat
+}
+
+// chatQueue bounds how many chats each model answers at once
+type chatQueue struct {
+	mu     sync.Mutex
+	models map[string]*modelSlots
+}
+
+var chats = &chatQueue{models: make(map[string]*modelSlots)}
+
+// newQueuedChatID returns a random ID for a queued chat, so one chat's ID
+// can't be guessed from another's
+func newQueuedChatID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ChatSlots returns how many chats the container may answer at once, 0 for no
+// limit: the OLLAMA_NUM_PARALLEL its model was built with, so chats beyond it
+// queue here rather than in Ollama, capped by OWNGPT_CHAT_CONCURRENCY when set
+func ChatSlots(containerName string) int {
+	slots := config.Get().ChatConcurrency
+	parallel := registry.Get(ModelForContainer(containerName)).NumParallel
+	if parallel > 0 && (slots <= 0 || parallel < slots) {
+		slots = parallel
+	}
+	return slots
+}
+
+// AcquireChat waits for a slot to answer a chat on the container under
+// ChatSlots. It fails with ErrChatQueueFull when the model's
+// queue is full, with ErrChatDequeued when an operator removes the chat from
+// the queue, or with the context's error when the request goes away first.
+// Call release once the chat is answered.
+func AcquireChat(ctx context.Context, containerName, sessionID string) (release func(), err error) {
+	slots := ChatSlots(containerName)
+	if slots <= 0 {
+		return func() {}, nil
+	}
+
+	cq := chats
+	cq.mu.Lock()
+	model := cq.models[containerName]
+	if model == nil {
+		model = &modelSlots{}
+		cq.models[containerName] = model
+	}
+	if model.running < slots {
+		model.running++
+		cq.mu.Unlock()
+		return cq.releaser(containerName), nil
+	}
+	modelName := ModelForContainer(containerName)
+	if len(model.pending) >= config.Get().ChatQueueDepth {
+		cq.mu.Unlock()
+		chatsRejected.Inc(modelName)
+		return nil, ErrChatQueueFull
+	}
+	chat := &queuedChat{
+		id:            newQueuedChatID(),
+		containerName: containerName,
+		sessionID:     sessionID,
+		enqueued:      time.Now(),
+		ready:         make(chan struct{}),
+		dequeued:      make(chan struct{}),
+	}
+	model.pending = append(model.pending, chat)
+	cq.mu.Unlock()
+	chatsWaiting.Add(1, modelName)
+	defer chatsWaiting.Add(-1, modelName)
+
+	select {
+	case <-chat.ready:
+		return cq.releaser(containerName), nil
+	case <-chat.dequeued:
+		return nil, ErrChatDequeued
+	case <-ctx.Done():
+	}
+
+	cq.mu.Lock()
+	removed := cq.remove(chat)
+	cq.mu.Unlock()
+	if !removed {
+		select {
+		case <-chat.ready:
+			// The slot was handed over just as the request went away, so pass it on
+			go cq.releaser(containerName)()
+		default:
+		}
+	}
+	return nil, ctx.Err()
+}
+
+// releaser returns the function freeing one of the container's slots, handing
+// it to the oldest waiting chat. Calling it more than once has no effect.
+func (cq *chatQueue) releaser(containerName string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cq.mu.Lock()
+			defer cq.mu.Unlock()
+			model := cq.models[containerName]
+			if len(model.pending) > 0 {
+				next := model.pending[0]
+				model.pending = model.pending[1:]
+				close(next.ready)
+				return
+			}
+			if model.running--; model.running <= 0 {
+				delete(cq.models, containerName)
+			}
+		})
+	}
+}
+
+// remove takes a chat out of its model's queue, reporting whether it was
+// still waiting. cq.mu must be held.
+func (cq *chatQueue) remove(chat *queuedChat) bool {
+	model := cq.models[chat.containerName]
+	if model == nil {
+		return false
+	}
+	for i, waiting := range model.pending {
+		if waiting == chat {
+			model.pending = append(model.pending[:i], model.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// QueuedChats returns the chats waiting for a slot, by model and queue position
+func QueuedChats() []models.QueuedChat {
+	chats.mu.Lock()
+	defer chats.mu.Unlock()
+
+	queued := []models.QueuedChat{}
+	now := time.Now()
+	for _, model := range chats.models {
+		for i, chat := range model.pending {
+			queued = append(queued, models.QueuedChat{
+				ID:            chat.id,
+				Model:         ModelForContainer(chat.containerName),
+				ContainerName: chat.containerName,
+				SessionID:     chat.sessionID,
+				Position:      i + 1,
+				WaitSeconds:   now.Sub(chat.enqueued).Seconds(),
+			})
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		if queued[i].ContainerName != queued[j].ContainerName {
+			return queued[i].ContainerName < queued[j].ContainerName
+		}
+		return queued[i].Position < queued[j].Position
+	})
+	return queued
+}
+
+// CancelQueuedChat removes a waiting chat from its model's queue, failing it
+// with ErrChatDequeued. It returns false when no chat with the ID is waiting,
+// including chats that have already started.
+func CancelQueuedChat(id string) bool {
+	chats.mu.Lock()
+	defer chats.mu.Unlock()
+
+	for _, model := range chats.models {
+		for _, chat := range model.pending {
+			if chat.id == id {
+				chats.remove(chat)
+				close(chat.dequeued)
+				return true
+			}
+		}
+	}
+	return false
+}
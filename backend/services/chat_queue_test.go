@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"owngpt/config"
+)
+
+// setChatQueue sets OWNGPT_CHAT_CONCURRENCY and OWNGPT_CHAT_QUEUE_DEPTH for the test
+func setChatQueue(t *testing.T, concurrency, depth int) {
+	cfg := config.Get()
+	previousConcurrency, previousDepth := cfg.ChatConcurrency, cfg.ChatQueueDepth
+	cfg.ChatConcurrency, cfg.ChatQueueDepth = concurrency, depth
+	t.Cleanup(func() { cfg.ChatConcurrency, cfg.ChatQueueDepth = previousConcurrency, previousDepth })
+}
+
+// queueChat starts a chat waiting for a slot, returning where its result arrives
+func queueChat(containerName, sessionID string) chan error {
+	result := make(chan error, 1)
+	go func() {
+		release, err := AcquireChat(context.Background(), containerName, sessionID)
+		if err == nil {
+			release()
+		}
+		result <- err
+	}()
+	return result
+}
+
+// waitQueued waits until n chats are queued
+func waitQueued(t *testing.T, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(QueuedChats()) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d chats queued, want %d", len(QueuedChats()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestChatQueueHandsSlotsOver(t *testing.T) {
+	setChatQueue(t, 1, 1)
+	containerName := "ollama-queue-container"
+
+	release, err := AcquireChat(context.Background(), containerName, "")
+	if err != nil {
+		t.Fatalf("AcquireChat: %v", err)
+	}
+	waiting := queueChat(containerName, "s1")
+	waitQueued(t, 1)
+
+	// The queue holds one chat, so the next is turned away
+	if _, err := AcquireChat(context.Background(), containerName, "s2"); !errors.Is(err, ErrChatQueueFull) {
+		t.Errorf("err = %v, want ErrChatQueueFull", err)
+	}
+
+	release()
+	release()
+	if err := <-waiting; err != nil {
+		t.Errorf("queued chat failed: %v", err)
+	}
+	waitQueued(t, 0)
+}
+
+func TestCancelQueuedChat(t *testing.T) {
+	setChatQueue(t, 1, 4)
+	containerName := "ollama-queue-container"
+
+	release, _ := AcquireChat(context.Background(), containerName, "")
+	defer release()
+	first := queueChat(containerName, "s1")
+	waitQueued(t, 1)
+	second := queueChat(containerName, "s2")
+	waitQueued(t, 2)
+
+	queued := QueuedChats()
+	if queued[0].SessionID != "s1" || queued[1].Position != 2 {
+		t.Fatalf("queue = %+v, want s1 first and s2 second", queued)
+	}
+	// IDs are random, not counted, so one can't be worked out from another
+	if len(queued[0].ID) != 16 || queued[0].ID == queued[1].ID {
+		t.Errorf("IDs %q and %q, want distinct random IDs", queued[0].ID, queued[1].ID)
+	}
+
+	if CancelQueuedChat("1") {
+		t.Error("cancelled a chat by a guessed ID")
+	}
+	if !CancelQueuedChat(queued[0].ID) {
+		t.Fatal("CancelQueuedChat found no chat")
+	}
+	if err := <-first; !errors.Is(err, ErrChatDequeued) {
+		t.Errorf("cancelled chat err = %v, want ErrChatDequeued", err)
+	}
+	if queued := QueuedChats(); len(queued) != 1 || queued[0].SessionID != "s2" || queued[0].Position != 1 {
+		t.Errorf("queue after cancel = %+v, want s2 moved up", queued)
+	}
+	if CancelQueuedChat(queued[0].ID) {
+		t.Error("cancelled the same chat twice")
+	}
+
+	release()
+	if err := <-second; err != nil {
+		t.Errorf("remaining chat failed: %v", err)
+	}
+}
+
+func TestQueuedChatLeavesWithItsRequest(t *testing.T) {
+	setChatQueue(t, 1, 4)
+	containerName := "ollama-queue-container"
+
+	release, _ := AcquireChat(context.Background(), containerName, "")
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := AcquireChat(ctx, containerName, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the request's deadline", err)
+	}
+	waitQueued(t, 0)
+}
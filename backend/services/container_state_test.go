@@ -0,0 +1,43 @@
+package services
+
+import (
+	"testing"
+
+	"owngpt/models"
+)
+
+func TestInstalledModelStates(t *testing.T) {
+	ds, _ := newFakeDockerService(map[string]string{
+		"docker ps -a": "ollama-llama2-container\tUp 5 minutes (healthy)\t0.0.0.0:11434->11434/tcp\tllama2\t\n" +
+			"ollama-mistral-container\tUp 4 seconds (health: starting)\t0.0.0.0:11435->11434/tcp\tmistral\t\n" +
+			"ollama-phi-container\tRestarting (1) 3 seconds ago\t\tphi\t\n" +
+			"ollama-gemma-container\tExited (137) 2 hours ago\t\tgemma\t\n",
+	})
+	installed, err := ds.GetInstalledModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct {
+		state   string
+		running bool
+		exit    int
+	}{
+		"llama2":  {models.StateRunning, true, -1},
+		"mistral": {models.StateStarting, false, -1},
+		"phi":     {models.StateRestarting, false, 1},
+		"gemma":   {models.StateExited, false, 137},
+	}
+	if len(installed) != len(want) {
+		t.Fatalf("installed = %+v, want %d models", installed, len(want))
+	}
+	for _, model := range installed {
+		w := want[model.Name]
+		if model.State != w.state || model.IsRunning != w.running {
+			t.Errorf("%s: state %q running %v, want %q running %v", model.Name, model.State, model.IsRunning, w.state, w.running)
+		}
+		if (w.exit < 0) != (model.ExitCode == nil) || (model.ExitCode != nil && *model.ExitCode != w.exit) {
+			t.Errorf("%s: exit code %v, want %d", model.Name, model.ExitCode, w.exit)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package services
+
+import "owngpt/models"
+
+// FitContext returns the containers whose model's context window holds a
+// prompt of promptTokens plus the reply's num_predict, keeping only those with
+// the smallest such window, which is returned too. Smaller windows are
+// usually the faster models. fits is empty when the prompt fits no model.
+func FitContext(containers []string, req models.ChatRequest, promptTokens int) (fits []string, numCtx int) {
+	for _, containerName := range containers {
+		model := ModelForContainer(containerName)
+		window := ModelContextWindow(model)
+		numPredict, _ := requestOptions(req, model)["num_predict"].(int)
+		if promptTokens+numPredict > window {
+			continue
+		}
+		switch {
+		case len(fits) == 0 || window < numCtx:
+			fits, numCtx = []string{containerName}, window
+		case window == numCtx:
+			fits = append(fits, containerName)
+		}
+	}
+	return fits, numCtx
+}
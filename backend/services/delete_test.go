@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingDocker answers docker commands starting with a key by failing with
+// its value on stderr, and succeeds at everything else by echoing the command
+func failingDocker(failures map[string]string) *DockerService {
+	run := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		line := strings.Join(append([]string{name}, args...), " ")
+		for prefix, stderr := range failures {
+			if strings.HasPrefix(line, prefix) {
+				return exec.CommandContext(ctx, "sh", "-c", `printf '%s\n' "$1" >&2; exit 1`, "sh", stderr)
+			}
+		}
+		return exec.CommandContext(ctx, "echo", line)
+	}
+	return &DockerService{runCommand: run, timeout: 5 * time.Second, buildTimeout: 5 * time.Second}
+}
+
+func TestDeleteModel(t *testing.T) {
+	const (
+		container = "docker rm -f ollama-llama2-container"
+		image     = "docker rmi -f ollama-llama2"
+	)
+	tests := []struct {
+		name      string
+		failures  map[string]string
+		wantNotes int
+		wantErr   string
+	}{
+		{"both removed", nil, 0, ""},
+		{"container gone", map[string]string{container: "Error: No such container: ollama-llama2-container"}, 1, ""},
+		{"both gone", map[string]string{
+			container: "Error: No such container: ollama-llama2-container",
+			image:     "Error: No such image: ollama-llama2",
+		}, 2, ""},
+		{"container removal fails", map[string]string{container: "Cannot connect to the Docker daemon"}, 0, "failed to remove container"},
+		{"image in use", map[string]string{image: "conflict: unable to remove repository reference"}, 0, "failed to remove image"},
+	}
+	for _, tt := range tests {
+		notes, err := failingDocker(tt.failures).DeleteModel("llama2")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || len(notes) != tt.wantNotes {
+			t.Errorf("%s: DeleteModel = %q, %v, want %d notes", tt.name, notes, err, tt.wantNotes)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"owngpt/config"
+	"owngpt/utils"
+)
+
+// DiskSpaceError reports too little free disk space to start an image build
+type DiskSpaceError struct {
+	Path string
+	Free int64
+	Min  int64
+}
+
+func (e *DiskSpaceError) Error() string {
+	return fmt.Sprintf("only %s free on %s, builds need at least %s (OWNGPT_MIN_FREE_DISK)", formatSize(e.Free), e.Path, formatSize(e.Min))
+}
+
+// freeDisk returns the bytes available on the filesystem holding path
+var freeDisk = diskFree
+
+// checkBuildDisk refuses a build while OWNGPT_BUILD_DISK_PATH has less than
+// OWNGPT_MIN_FREE_DISK free, since a build that fills the disk fails late and
+// can take the Docker daemon down with it. A path that can't be checked lets
+// the build go ahead.
+func checkBuildDisk() error {
+	cfg := config.Get()
+	if cfg.MinFreeDisk <= 0 {
+		return nil
+	}
+	path := cfg.BuildDiskPath
+	if path == "" {
+		path = utils.ModelsDir
+	}
+	free, err := freeDisk(path)
+	if err != nil {
+		log.Printf("Failed to check free disk space on %s, building anyway: %v", path, err)
+		return nil
+	}
+	if free < cfg.MinFreeDisk {
+		return &DiskSpaceError{Path: path, Free: free, Min: cfg.MinFreeDisk}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package services
+
+import "errors"
+
+// diskFree can't check free space outside unix, so builds aren't held back
+func diskFree(path string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"owngpt/config"
+)
+
+// setFreeDisk sets OWNGPT_MIN_FREE_DISK and has the disk report free bytes,
+// or fail to be checked when err is set
+func setFreeDisk(t *testing.T, min, free int64, err error) {
+	cfg := config.Get()
+	previousMin, previousPath, previousFree := cfg.MinFreeDisk, cfg.BuildDiskPath, freeDisk
+	cfg.MinFreeDisk, cfg.BuildDiskPath = min, "/var/lib/docker"
+	freeDisk = func(path string) (int64, error) {
+		if path != "/var/lib/docker" {
+			t.Errorf("checked %s, want OWNGPT_BUILD_DISK_PATH", path)
+		}
+		return free, err
+	}
+	t.Cleanup(func() { cfg.MinFreeDisk, cfg.BuildDiskPath, freeDisk = previousMin, previousPath, previousFree })
+}
+
+func TestBuildDockerImageDiskSpace(t *testing.T) {
+	tests := []struct {
+		name      string
+		min, free int64
+		err       error
+		wantBuild bool
+	}{
+		{"enough space", 5 << 30, 6 << 30, nil, true},
+		{"too little space", 5 << 30, 1 << 30, nil, false},
+		{"check disabled", 0, 0, nil, true},
+		{"check fails", 5 << 30, 0, errors.New("no such file or directory"), true},
+	}
+	for _, tt := range tests {
+		setFreeDisk(t, tt.min, tt.free, tt.err)
+		ds, fake := newFakeDockerService(map[string]string{"docker build": ""})
+		err := ds.BuildDockerImage("/ctx", "ollama-llama2", BuildOptions{})
+
+		built := fake.called("docker build") == 1
+		if built != tt.wantBuild {
+			t.Errorf("%s: built %v, want %v", tt.name, built, tt.wantBuild)
+		}
+		var diskErr *DiskSpaceError
+		if tt.wantBuild {
+			if err != nil {
+				t.Errorf("%s: err = %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.As(err, &diskErr) || diskErr.Free != tt.free || diskErr.Path != "/var/lib/docker" {
+			t.Errorf("%s: err = %v, want a DiskSpaceError", tt.name, err)
+		} else if want := "only 1GB free on /var/lib/docker, builds need at least 5GB (OWNGPT_MIN_FREE_DISK)"; err.Error() != want {
+			t.Errorf("%s: err = %q, want %q", tt.name, err, want)
+		}
+	}
+}
+
+func TestBuildDiskSpaceFreesSlot(t *testing.T) {
+	setFreeDisk(t, 5<<30, 0, nil)
+	ds, _ := newFakeDockerService(nil)
+	ds.BuildDockerImage("/ctx", "ollama-llama2", BuildOptions{})
+	if running := ds.GetBuildQueue().Running; len(running) != 0 {
+		t.Errorf("running builds = %v, want the refused build's slot freed", running)
+	}
+}
+
+func TestDiskFree(t *testing.T) {
+	free, err := diskFree(t.TempDir())
+	if err != nil || free <= 0 {
+		t.Errorf("diskFree = %d, %v, want the free bytes", free, err)
+	}
+	if _, err := diskFree("/does/not/exist"); err == nil {
+		t.Error("diskFree succeeded on a missing path")
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"time"
+
+	"owngpt/metrics"
+	"owngpt/utils"
+)
+
+var (
+	dockerOperationDuration = metrics.NewHistogram(
+		"owngpt_docker_operation_duration_seconds",
+		"Duration of Docker operations performed for model containers",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600},
+		"operation", "model",
+	)
+	dockerOperationFailures = metrics.NewCounter(
+		"owngpt_docker_operation_failures_total",
+		"Docker operations that returned an error",
+		"operation", "model",
+	)
+)
+
+// observeDockerOperation records how long a Docker operation took and whether it failed
+func observeDockerOperation(operation, model string, start time.Time, err error) {
+	dockerOperationDuration.Observe(time.Since(start).Seconds(), operation, model)
+	if err != nil {
+		dockerOperationFailures.Inc(operation, model)
+	}
+}
+
+// metricModelLabel turns an image or container name into the model label value
+func metricModelLabel(name string) string {
+	if utils.IsModelContainer(name) || utils.IsUpdateContainer(name) {
+		return utils.ModelNameFromContainer(name)
+	}
+	return utils.ModelNameFromImage(name)
+}
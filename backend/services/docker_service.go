@@ -1,41 +1,152 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"owngpt/config"
 	"owngpt/models"
+	"owngpt/utils"
 )
 
-type DockerService struct{}
+// ModelNetwork returns the Docker network model containers join so the
+// backend can reach them by container name. By default it is the one docker
+// compose creates for the owngpt project.
+func ModelNetwork() string {
+	return config.Get().Network
+}
+
+// CommandRunner builds the external commands DockerService runs, so a fake
+// can stand in for the docker CLI
+type CommandRunner func(ctx context.Context, name string, args ...string) *exec.Cmd
+
+type DockerService struct {
+	runCommand   CommandRunner
+	timeout      time.Duration
+	buildTimeout time.Duration
+}
 
 func NewDockerService() *DockerService {
-	return &DockerService{}
+	return NewDockerServiceWithRunner(exec.CommandContext)
 }
 
-// IsGPUAvailable checks if NVIDIA GPU is available for Docker
-func (ds *DockerService) IsGPUAvailable() bool {
-	// Check if nvidia-smi is available
-	cmd := exec.Command("nvidia-smi")
-	if err := cmd.Run(); err != nil {
-		log.Printf("nvidia-smi not available: %v", err)
-		return false
+// NewDockerServiceWithRunner returns a DockerService that runs its commands
+// through runCommand instead of executing them directly
+func NewDockerServiceWithRunner(runCommand CommandRunner) *DockerService {
+	cfg := config.Get()
+	return &DockerService{
+		runCommand:   runCommand,
+		timeout:      cfg.DockerTimeout,
+		buildTimeout: cfg.DockerBuildTimeout,
 	}
+}
 
-	// Check if Docker supports GPU (nvidia-docker or Docker with GPU support)
-	cmd = exec.Command("docker", "run", "--rm", "--gpus", "all", "hello-world")
-	if err := cmd.Run(); err != nil {
-		log.Printf("Docker GPU support not available: %v", err)
-		return false
+// run executes a command bounded by timeout and returns its stdout. With
+// stream set, output goes to the server's stdout/stderr instead.
+func (ds *DockerService) run(timeout time.Duration, stream bool, name string, args ...string) ([]byte, error) {
+	if stream {
+		return ds.runTo(timeout, os.Stdout, os.Stderr, name, args...)
+	}
+	return ds.runTo(timeout, nil, nil, name, args...)
+}
+
+// runTo is run with output streamed to the given writers. With nil writers
+// stdout is returned instead.
+func (ds *DockerService) runTo(timeout time.Duration, stdout, stderr io.Writer, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := ds.runCommand(ctx, name, args...)
+	// Don't wait forever on output pipes held open by a killed command's children
+	cmd.WaitDelay = 5 * time.Second
+
+	var output []byte
+	var err error
+	if stdout != nil {
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err = cmd.Run()
+	} else {
+		output, err = cmd.Output()
 	}
 
-	log.Println("GPU support detected and available")
-	return true
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		command := name
+		if len(args) > 0 {
+			command += " " + args[0]
+		}
+		return output, fmt.Errorf("%s timed out after %v", command, timeout)
+	}
+	return output, err
+}
+
+// DaemonVersion returns the Docker daemon's version, failing if it can't be reached
+func (ds *DockerService) DaemonVersion() (string, error) {
+	output, err := ds.run(ds.timeout, false, "docker", "version", "--format", "{{.Server.Version}}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// EnsureNetwork creates the Docker network if it doesn't exist, reporting whether it did
+func (ds *DockerService) EnsureNetwork(name string) (created bool, err error) {
+	if _, err := ds.run(ds.timeout, false, "docker", "network", "inspect", name); err == nil {
+		return false, nil
+	}
+	if _, err := ds.run(ds.timeout, false, "docker", "network", "create", name); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BaseImage returns the pinned Ollama image model images are built from
+func BaseImage() string {
+	return config.Get().BaseImage + ":" + config.Get().OllamaVersion
+}
+
+// PullBaseImage pulls the Ollama base image ahead of the first build, sending
+// docker pull's progress to onLine. It reports whether the image was already
+// present, in which case nothing is pulled.
+func (ds *DockerService) PullBaseImage(onLine func(line string)) (present bool, err error) {
+	image := BaseImage()
+	if _, err := ds.run(ds.timeout, false, "docker", "image", "inspect", image); err == nil {
+		return true, nil
+	} else if !isNotFound(err) {
+		return false, fmt.Errorf("failed to inspect image %s: %v", image, err)
+	}
+
+	start := time.Now()
+	defer func() { observeDockerOperation("pull_base_image", "", start, err) }()
+
+	args := []string{"pull", image}
+	if platform := config.Get().Platform; platform != "" {
+		args = []string{"pull", "--platform", platform, image}
+	}
+	if onLine == nil {
+		_, err = ds.run(ds.buildTimeout, true, "docker", args...)
+	} else {
+		logs := newLineWriter(os.Stdout, onLine)
+		_, err = ds.runTo(ds.buildTimeout, logs, logs, "docker", args...)
+		logs.Flush()
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to pull %s: %v", image, err)
+	}
+	return false, nil
 }
 
 // GetAvailableModels fetches available models from Docker Hub
@@ -75,8 +186,7 @@ func (ds *DockerService) GetAvailableModels() ([]models.AvailableModel, error) {
 
 // getLocalOllamaModels gets models from local Docker images
 func (ds *DockerService) getLocalOllamaModels() ([]models.AvailableModel, error) {
-	cmd := exec.Command("docker", "images", "--format", "{{.Repository}}:{{.Tag}}\t{{.Size}}")
-	output, err := cmd.Output()
+	output, err := ds.run(ds.timeout, false, "docker", "images", "--format", "{{.Repository}}:{{.Tag}}\t{{.Size}}")
 	if err != nil {
 		return nil, err
 	}
@@ -92,10 +202,8 @@ func (ds *DockerService) getLocalOllamaModels() ([]models.AvailableModel, error)
 				size := parts[1]
 
 				// Extract model name from image name
-				modelName := strings.TrimPrefix(imageName, "ollama-")
-				modelName = strings.TrimSuffix(modelName, ":latest")
-
-				if modelName != imageName { // Only if it's actually an ollama model
+				if strings.HasPrefix(imageName, "ollama-") { // Only if it's actually an ollama model
+					modelName := utils.ModelNameFromImage(imageName)
 					localModels = append(localModels, models.AvailableModel{
 						Name:        modelName,
 						Description: "Locally available model",
@@ -110,10 +218,14 @@ func (ds *DockerService) getLocalOllamaModels() ([]models.AvailableModel, error)
 	return localModels, nil
 }
 
-// GetInstalledModels returns list of installed model containers
+// GetInstalledModels returns list of installed model containers, or in local
+// mode the models pulled into the local Ollama server
 func (ds *DockerService) GetInstalledModels() ([]models.InstalledModel, error) {
-	cmd := exec.Command("docker", "ps", "-a", "--format", "{{.Names}}\t{{.Status}}\t{{.Ports}}")
-	output, err := cmd.Output()
+	if LocalMode() {
+		return NewLocalOllama().InstalledModels()
+	}
+
+	output, err := ds.run(ds.timeout, false, "docker", "ps", "-a", "--format", "{{.Names}}\t{{.Status}}\t{{.Ports}}\t{{.Label \"owngpt.model\"}}\t{{.Labels}}")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list containers: %v", err)
 	}
@@ -122,50 +234,196 @@ func (ds *DockerService) GetInstalledModels() ([]models.InstalledModel, error) {
 	lines := strings.Split(string(output), "\n")
 
 	for _, line := range lines {
-		if strings.Contains(line, "ollama-") && strings.Contains(line, "-container") {
-			parts := strings.Split(line, "\t")
-			if len(parts) >= 3 {
-				containerName := parts[0]
-				status := parts[1]
-				ports := parts[2]
-
-				// Extract model name
-				modelName := strings.TrimSuffix(strings.TrimPrefix(containerName, "ollama-"), "-container")
-
-				installedModels = append(installedModels, models.InstalledModel{
-					Name:          modelName,
-					ContainerName: containerName,
-					Status:        status,
-					Ports:         ports,
-					IsRunning:     strings.Contains(status, "Up"),
-				})
+		parts := strings.Split(line, "\t")
+		if len(parts) >= 3 && utils.IsModelContainer(parts[0]) {
+			containerName := parts[0]
+			status := parts[1]
+			ports := parts[2]
+
+			// Prefer the exact name recorded on the container, falling
+			// back to decoding it from the container name
+			modelName := utils.ModelNameFromContainer(containerName)
+			if len(parts) >= 4 && parts[3] != "" {
+				modelName = parts[3]
+			}
+
+			var labels map[string]string
+			var platform string
+			if len(parts) >= 5 {
+				labels = customLabels(parts[4])
+				platform = labelValue(parts[4], utils.PlatformLabel)
 			}
+
+			state, exitCode := utils.ParseContainerStatus(status)
+			installedModels = append(installedModels, models.InstalledModel{
+				Name:          modelName,
+				ContainerName: containerName,
+				Status:        status,
+				Ports:         ports,
+				State:         state,
+				ExitCode:      exitCode,
+				IsRunning:     state == models.StateRunning,
+				Labels:        labels,
+				Platform:      platform,
+			})
 		}
 	}
 
 	return installedModels, nil
 }
 
-// BuildDockerImage builds a Docker image for the specified model
-func (ds *DockerService) BuildDockerImage(contextPath, imageName string) error {
-	cmd := exec.Command("docker", "build", "-t", imageName, contextPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// labelValue returns the value of one label in a docker ps Labels column, or
+// "" when the container doesn't have it
+func labelValue(column, key string) string {
+	for _, label := range strings.Split(column, ",") {
+		if k, value, ok := strings.Cut(label, "="); ok && k == key {
+			return value
+		}
+	}
+	return ""
+}
+
+// customLabels picks the custom labels out of a docker ps Labels column such
+// as "owngpt.labels=team;project,team=ml,project=chat,owngpt.managed=true",
+// using the keys listed in owngpt.labels. It returns nil when there are none.
+func customLabels(column string) map[string]string {
+	all := make(map[string]string)
+	for _, label := range strings.Split(column, ",") {
+		if key, value, ok := strings.Cut(label, "="); ok {
+			all[key] = value
+		}
+	}
+	if all[utils.CustomLabelsLabel] == "" {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, key := range strings.Split(all[utils.CustomLabelsLabel], ";") {
+		if value, ok := all[key]; ok {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// BuildOptions controls how an image build uses the layer cache and which
+// platform it targets. The zero value is a plain docker build, which reuses
+// cached layers.
+type BuildOptions struct {
+	// NoCache rebuilds every layer, for a clean build
+	NoCache bool
+	// InlineCache embeds BuildKit cache metadata in the image and reuses the
+	// layers of CacheFrom
+	InlineCache bool
+	// CacheFrom is the image to take cached layers from, usually the model's
+	// previous image
+	CacheFrom string
+	// Platform is the platform to build for, such as linux/arm64; empty
+	// leaves it to docker
+	Platform string
+}
+
+// buildArgs returns the docker build arguments for the image
+func buildArgs(contextPath, imageName string, opts BuildOptions) []string {
+	args := []string{"build", "-t", imageName}
+	if opts.Platform != "" {
+		args = append(args, "--platform", opts.Platform)
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if opts.InlineCache {
+		args = append(args, "--build-arg", "BUILDKIT_INLINE_CACHE=1")
+		if opts.CacheFrom != "" && !opts.NoCache {
+			args = append(args, "--cache-from", opts.CacheFrom)
+		}
+	}
+	return append(args, contextPath)
+}
+
+// BuildDockerImage builds a Docker image for the specified model, waiting for a
+// free build slot when the concurrent build limit is reached
+func (ds *DockerService) BuildDockerImage(contextPath, imageName string, opts BuildOptions) error {
+	return ds.BuildDockerImageWithLogs(contextPath, imageName, opts, nil)
+}
+
+// BuildDockerImageWithLogs is BuildDockerImage that also passes each line of
+// build output to onLine. Output still goes to the server's stdout.
+func (ds *DockerService) BuildDockerImageWithLogs(contextPath, imageName string, opts BuildOptions, onLine func(line string)) (err error) {
+	position, ready := builds.acquire(imageName)
+	if position > 0 {
+		log.Printf("Build for %s queued at position %d", imageName, position)
+		if onLine != nil {
+			onLine(fmt.Sprintf("Waiting for a free build slot, queue position %d", position))
+		}
+	}
+	<-ready
+	defer builds.release(imageName)
+
+	start := time.Now()
+	defer func() { observeDockerOperation("build", metricModelLabel(imageName), start, err) }()
+
+	// Queued builds may start long after they were asked for, so check the
+	// disk once the slot is free
+	if err := checkBuildDisk(); err != nil {
+		return err
+	}
+
+	args := buildArgs(contextPath, imageName, opts)
+	if onLine == nil {
+		_, err = ds.run(ds.buildTimeout, true, "docker", args...)
+		return err
+	}
+
+	// docker build writes its progress to stderr, so both streams feed the log
+	logs := newLineWriter(os.Stdout, onLine)
+	_, err = ds.runTo(ds.buildTimeout, logs, logs, "docker", args...)
+	logs.Flush()
+	return err
+}
+
+// GetBuildQueue returns the running and pending image builds
+func (ds *DockerService) GetBuildQueue() models.BuildQueueStatus {
+	return builds.status()
 }
 
-// RunDockerContainer runs a Docker container for the model
-func (ds *DockerService) RunDockerContainer(imageName, containerName, port string) error {
+// RunDockerContainer runs a Docker container for the model on the platform
+// its image was built for, with the given custom labels alongside the
+// owngpt.* ones
+func (ds *DockerService) RunDockerContainer(imageName, containerName, port, platform string, labels map[string]string) (err error) {
+	start := time.Now()
+	defer func() { observeDockerOperation("run", metricModelLabel(containerName), start, err) }()
+
+	// docker run only reports a port clash deep in its stderr, so check first
+	if err := ds.checkPortFree(port, containerName); err != nil {
+		return err
+	}
+
 	// Remove existing container if it exists
-	exec.Command("docker", "rm", "-f", containerName).Run()
+	ds.run(ds.timeout, false, "docker", "rm", "-f", containerName)
 
 	// Base docker run arguments
 	args := []string{
 		"run", "-d", "--name", containerName,
-		"--network", "owngpt_owngpt-network",
+		"--network", ModelNetwork(),
 		"-p", fmt.Sprintf("%s:11434", port),
 		"--restart", "unless-stopped",
 		"--memory", "4g", // Limit memory to 4GB
+		"--label", utils.ManagedLabel + "=true",
+		"--label", utils.ModelLabel + "=" + utils.ModelNameFromContainer(containerName),
+	}
+	if platform != "" {
+		args = append(args, "--platform", platform, "--label", utils.PlatformLabel+"="+platform)
+	}
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			args = append(args, "--label", key+"="+labels[key])
+		}
+		args = append(args, "--label", utils.CustomLabelsLabel+"="+strings.Join(keys, ";"))
 	}
 
 	// Add GPU support if available
@@ -179,22 +437,61 @@ func (ds *DockerService) RunDockerContainer(imageName, containerName, port strin
 	// Add the image name at the end
 	args = append(args, imageName)
 
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
 	fmt.Printf("Running command: docker %s\n", strings.Join(args, " "))
-	err := cmd.Run()
+	_, err = ds.run(ds.timeout, true, "docker", args...)
 	if err != nil {
 		fmt.Printf("Docker run failed: %v\n", err)
 	}
 	return err
 }
 
+// checkPortFree returns a PortInUseError if another running container publishes the host port
+func (ds *DockerService) checkPortFree(port, containerName string) error {
+	output, err := ds.run(ds.timeout, false, "docker", "ps", "--format", "{{.Names}}\t{{.Ports}}")
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) < 2 || parts[0] == containerName {
+			continue
+		}
+		if publishesHostPort(parts[1], port) {
+			return &PortInUseError{Port: port, Container: parts[0]}
+		}
+	}
+	return nil
+}
+
+// publishesHostPort reports whether a docker ps Ports column such as
+// "0.0.0.0:11434->11434/tcp, :::11434->11434/tcp" binds the host port
+func publishesHostPort(ports, port string) bool {
+	for _, mapping := range strings.Split(ports, ",") {
+		hostSide, _, found := strings.Cut(strings.TrimSpace(mapping), "->")
+		if !found {
+			continue
+		}
+		hostPort := hostSide[strings.LastIndex(hostSide, ":")+1:]
+		if hostPort == port {
+			return true
+		}
+		// Published ranges look like 0.0.0.0:8000-8005->8000-8005/tcp
+		if low, high, isRange := strings.Cut(hostPort, "-"); isRange {
+			p, errP := strconv.Atoi(port)
+			l, errL := strconv.Atoi(low)
+			h, errH := strconv.Atoi(high)
+			if errP == nil && errL == nil && errH == nil && p >= l && p <= h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ContainerExists checks if a container exists
 func (ds *DockerService) ContainerExists(containerName string) bool {
-	cmd := exec.Command("docker", "ps", "-a", "--format", "{{.Names}}")
-	output, err := cmd.Output()
+	output, err := ds.run(ds.timeout, false, "docker", "ps", "-a", "--format", "{{.Names}}")
 	if err != nil {
 		return false
 	}
@@ -210,48 +507,218 @@ func (ds *DockerService) ContainerExists(containerName string) bool {
 
 // StartExistingContainer starts an existing stopped container
 func (ds *DockerService) StartExistingContainer(containerName string) error {
-	cmd := exec.Command("docker", "start", containerName)
-	return cmd.Run()
+	_, err := ds.run(ds.timeout, false, "docker", "start", containerName)
+	return err
 }
 
-// DeleteModel removes a model container and image
-func (ds *DockerService) DeleteModel(modelName string) error {
-	safeModelName := strings.ReplaceAll(strings.ToLower(modelName), ":", "-")
-	safeModelName = strings.ReplaceAll(safeModelName, "/", "-")
-	containerName := fmt.Sprintf("ollama-%s-container", safeModelName)
+// RemoveContainer removes a container whether or not it is running. One that
+// doesn't exist counts as removed.
+func (ds *DockerService) RemoveContainer(containerName string) error {
+	if _, err := ds.run(ds.timeout, false, "docker", "rm", "-f", containerName); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// StopContainer stops a container, leaving it in place to start again
+func (ds *DockerService) StopContainer(containerName string) error {
+	_, err := ds.run(ds.timeout, false, "docker", "stop", containerName)
+	return err
+}
+
+// StopManagedContainers stops every running model container, giving up once timeout elapses
+func (ds *DockerService) StopManagedContainers(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	installedModels, err := ds.GetInstalledModels()
+	if err != nil {
+		log.Printf("Failed to list model containers to stop: %v", err)
+		return
+	}
+
+	for _, model := range installedModels {
+		if !utils.ContainerUp(model.State) {
+			continue
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			log.Printf("Shutdown timeout reached, leaving %s running", model.ContainerName)
+			continue
+		}
+		if _, err := ds.run(remaining, false, "docker", "stop", model.ContainerName); err != nil {
+			log.Printf("Failed to stop container %s: %v", model.ContainerName, err)
+			continue
+		}
+		log.Printf("Stopped container %s", model.ContainerName)
+	}
+}
 
-	// Stop and remove the container
-	cmd := exec.Command("docker", "rm", "-f", containerName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to remove container: %v", err)
+// DeleteModel removes a model container and image
+func (ds *DockerService) DeleteModel(modelName string) (notes []string, err error) {
+	start := time.Now()
+	defer func() { observeDockerOperation("delete", modelName, start, err) }()
+
+	// A container or image that is already gone counts as removed, so a
+	// retried delete after a partial failure succeeds
+	containerName := utils.ContainerName(modelName)
+	if _, err := ds.run(ds.timeout, false, "docker", "rm", "-f", containerName); err != nil {
+		if !isNotFound(err) {
+			return nil, fmt.Errorf("failed to remove container: %v", err)
+		}
+		notes = append(notes, fmt.Sprintf("container %s was already removed", containerName))
 	}
 
-	// Remove the image
-	imageName := fmt.Sprintf("ollama-%s", safeModelName)
-	cmd = exec.Command("docker", "rmi", "-f", imageName)
-	cmd.Run() // Don't fail if image removal fails
+	imageName := utils.ImageName(modelName)
+	if _, err := ds.run(ds.timeout, false, "docker", "rmi", "-f", imageName); err != nil {
+		if !isNotFound(err) {
+			return notes, fmt.Errorf("failed to remove image: %v", err)
+		}
+		notes = append(notes, fmt.Sprintf("image %s was already removed", imageName))
+	}
 
-	return nil
+	return notes, nil
 }
 
 // WaitForModelReady waits for the model container to be ready
-func (ds *DockerService) WaitForModelReady(containerName string, timeout time.Duration) error {
-	client := &http.Client{Timeout: 100 * time.Second}
-	deadline := time.Now().Add(timeout)
+func (ds *DockerService) WaitForModelReady(containerName string, timeouts ReadyTimeouts) error {
+	return ds.WaitForModelReadyProgress(containerName, timeouts, nil)
+}
+
+// WaitForModelReadyProgress is WaitForModelReady that reports the startup
+// script's status (starting, pulling, warming_up) to onStatus whenever it
+// changes. percent is the pull progress, or -1 when it isn't known.
+//
+// Waiting is split into the server start, pull and load phases, each bounded
+// by its own timeout; a *ReadyTimeoutError names the phase that ran out.
+func (ds *DockerService) WaitForModelReadyProgress(containerName string, timeouts ReadyTimeouts, onStatus func(status string, percent int)) (err error) {
+	start := time.Now()
+	defer func() { observeDockerOperation("wait_ready", metricModelLabel(containerName), start, err) }()
+	setStatus, done := beginLoading(containerName)
+	defer func() { done(err == nil) }()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	phase, phaseStart := phaseServer, time.Now()
+	lastStatus, lastPercent := "", -1
+
+	for {
+		if elapsed := time.Since(phaseStart); elapsed > timeouts.forPhase(phase) {
+			return &ReadyTimeoutError{Phase: phase, Elapsed: elapsed}
+		}
+
+		// A container that exited or is restart-looping will never become ready
+		if state := ds.containerState(containerName); state == "exited" || state == "dead" || state == "restarting" {
+			if oom := ds.OOMKilled(containerName, start); oom != nil {
+				return oom
+			}
+			return fmt.Errorf("model container is %s, the model pull may have failed (see docker logs %s)", state, containerName)
+		}
 
-	for time.Now().Before(deadline) {
-		// Use container name for internal Docker networking
-		resp, err := client.Get(fmt.Sprintf("http://%s:11434/api/tags", containerName))
+		resp, err := client.Get(ollamaURL(containerName, "/api/tags"))
 		if err == nil && resp.StatusCode == http.StatusOK {
 			resp.Body.Close()
-			fmt.Println("Model is ready")
-			return nil
-		}
-		if resp != nil {
+
+			// The server answers before the model is pulled, so wait for the
+			// startup script to report the pull result. Images built before pull
+			// status reporting have no status file, so theirs is ready now. Any
+			// other failure to read it says nothing about the pull, so ask again.
+			status, err := ds.pullStatus(containerName)
+			if err != nil && !isMissingFile(err) {
+				log.Printf("Failed to read the pull status of %s, retrying: %v", containerName, err)
+				time.Sleep(2 * time.Second)
+				continue
+			}
+			if err != nil || status == "success" {
+				log.Printf("Model in %s is ready after %v", containerName, time.Since(start).Round(time.Second))
+				return nil
+			}
+			if strings.HasPrefix(status, "failed") {
+				return fmt.Errorf("model pull failed: %s", strings.TrimPrefix(status, "failed: "))
+			}
+
+			// Each phase's clock starts when the previous one finishes
+			next := phasePull
+			if status == "warming_up" {
+				next = phaseLoad
+			}
+			if next != phase {
+				phase, phaseStart = next, time.Now()
+			}
+			setStatus(status)
+
+			if onStatus != nil {
+				percent := -1
+				if status == "pulling" {
+					percent = ds.pullPercent(containerName)
+				}
+				if status != lastStatus || percent != lastPercent {
+					lastStatus, lastPercent = status, percent
+					onStatus(status, percent)
+				}
+			}
+		} else if resp != nil {
 			resp.Body.Close()
 		}
 		time.Sleep(2 * time.Second)
 	}
+}
+
+// CPULimit returns how many CPUs the container may use: its --cpus limit, or
+// every CPU visible to the server when it has none. In local mode models
+// share the host's CPUs.
+func (ds *DockerService) CPULimit(containerName string) (int, error) {
+	if LocalMode() {
+		return runtime.NumCPU(), nil
+	}
+	output, err := ds.run(ds.timeout, false, "docker", "inspect", "-f", "{{.HostConfig.NanoCpus}}", containerName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect container %s: %v", containerName, err)
+	}
+	nanoCPUs, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected CPU limit %q for %s", strings.TrimSpace(string(output)), containerName)
+	}
+	if nanoCPUs <= 0 {
+		return runtime.NumCPU(), nil
+	}
+	// Round fractional limits such as --cpus=1.5 up to whole threads
+	return int((nanoCPUs + 1e9 - 1) / 1e9), nil
+}
+
+// containerState returns Docker's state for the container (running, exited, restarting, ...)
+func (ds *DockerService) containerState(containerName string) string {
+	output, err := ds.run(ds.timeout, false, "docker", "inspect", "-f", "{{.State.Status}}", containerName)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// pullPercentPattern matches the percentage in ollama pull's progress output
+var pullPercentPattern = regexp.MustCompile(`(\d{1,3})%`)
+
+// pullPercent estimates pull progress from the container's recent log output,
+// returning -1 when no progress is shown
+func (ds *DockerService) pullPercent(containerName string) int {
+	var logs bytes.Buffer
+	if _, err := ds.runTo(ds.timeout, &logs, &logs, "docker", "logs", "--tail", "5", containerName); err != nil {
+		return -1
+	}
+	matches := pullPercentPattern.FindAllStringSubmatch(logs.String(), -1)
+	if len(matches) == 0 {
+		return -1
+	}
+	percent, err := strconv.Atoi(matches[len(matches)-1][1])
+	if err != nil || percent > 100 {
+		return -1
+	}
+	return percent
+}
 
-	return fmt.Errorf("model failed to become ready within %v", timeout)
+// pullStatus reads the model pull result recorded by the container's startup script
+func (ds *DockerService) pullStatus(containerName string) (string, error) {
+	output, err := ds.run(ds.timeout, false, "docker", "exec", containerName, "cat", utils.PullStatusFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
 }
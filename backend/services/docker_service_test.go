@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker answers the commands a DockerService runs with canned output,
+// picked by the longest prefix of the command line. Commands without an
+// answer fail.
+type fakeDocker struct {
+	mu      sync.Mutex
+	outputs map[string]string
+	calls   []string
+}
+
+func (f *fakeDocker) run(ctx context.Context, name string, args ...string) *exec.Cmd {
+	line := strings.Join(append([]string{name}, args...), " ")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, line)
+	prefix, found := "", false
+	for candidate := range f.outputs {
+		if strings.HasPrefix(line, candidate) && len(candidate) >= len(prefix) {
+			prefix, found = candidate, true
+		}
+	}
+	if !found {
+		return exec.CommandContext(ctx, "sh", "-c", "echo unknown command >&2; exit 1")
+	}
+	return exec.CommandContext(ctx, "printf", "%s", f.outputs[prefix])
+}
+
+// called returns how many commands started with prefix
+func (f *fakeDocker) called(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, line := range f.calls {
+		if strings.HasPrefix(line, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func newFakeDockerService(outputs map[string]string) (*DockerService, *fakeDocker) {
+	fake := &fakeDocker{outputs: outputs}
+	return &DockerService{runCommand: fake.run, timeout: 5 * time.Second, buildTimeout: 5 * time.Second}, fake
+}
+
+func TestFakeDockerAnswersByPrefix(t *testing.T) {
+	ds, fake := newFakeDockerService(map[string]string{"docker ps": "one", "docker ps -a": "all"})
+	if output, err := ds.run(ds.timeout, false, "docker", "ps", "-a"); err != nil || string(output) != "all" {
+		t.Errorf("docker ps -a = %q, %v, want all", output, err)
+	}
+	if _, err := ds.run(ds.timeout, false, "docker", "rm", "x"); err == nil {
+		t.Error("unanswered command succeeded")
+	}
+	if fake.called("docker") != 2 {
+		t.Errorf("called = %d, want 2", fake.called("docker"))
+	}
+}
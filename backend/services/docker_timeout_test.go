@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hangingDocker returns a DockerService whose commands never finish on their own
+func hangingDocker(timeout, buildTimeout time.Duration) *DockerService {
+	hang := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sleep", "30")
+	}
+	return &DockerService{runCommand: hang, timeout: timeout, buildTimeout: buildTimeout}
+}
+
+func TestHungCommandTimesOut(t *testing.T) {
+	ds := hangingDocker(50*time.Millisecond, time.Minute)
+
+	start := time.Now()
+	_, err := ds.DaemonVersion()
+	if err == nil || !strings.Contains(err.Error(), "docker version timed out after 50ms") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("gave up after %v", elapsed)
+	}
+}
+
+func TestBuildUsesBuildTimeout(t *testing.T) {
+	ds := hangingDocker(time.Minute, 50*time.Millisecond)
+
+	// Builds streaming their output are bounded the same way
+	err := ds.BuildDockerImageWithLogs(t.TempDir(), "ollama-timeout-test", BuildOptions{}, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "docker build timed out after 50ms") {
+		t.Errorf("err = %v, want a build timeout", err)
+	}
+	if status := ds.GetBuildQueue(); len(status.Running) != 0 {
+		t.Errorf("the timed out build still holds a slot: %+v", status)
+	}
+}
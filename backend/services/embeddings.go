@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"owngpt/config"
+	"owngpt/metrics"
+)
+
+// ErrEmbedQueueFull is returned when OWNGPT_EMBED_QUEUE_DEPTH requests are
+// already waiting for an embedding slot
+var ErrEmbedQueueFull = errors.New("too many embedding requests are waiting, try again later")
+
+var (
+	embedRunning = metrics.NewGauge(
+		"owngpt_embed_requests_running",
+		"Embedding requests currently being computed",
+	)
+	embedWaiting = metrics.NewGauge(
+		"owngpt_embed_requests_waiting",
+		"Embedding requests waiting for a free slot",
+	)
+	embedRejected = metrics.NewCounter(
+		"owngpt_embed_requests_rejected_total",
+		"Embedding requests turned away because the queue was full",
+	)
+	embedBatches = metrics.NewCounter(
+		"owngpt_embed_batches_total",
+		"Ollama calls made to compute embeddings",
+	)
+)
+
+// embedQueue bounds how many embedding requests run at once and queues a
+// limited number of the rest in arrival order, so bulk ingestion can't starve
+// chats on the same model
+type embedQueue struct {
+	mu      sync.Mutex
+	slots   int
+	depth   int
+	running int
+	pending []chan struct{}
+}
+
+// embeds is shared by every OllamaService so the limit applies process-wide
+var embeds = &embedQueue{slots: config.Get().EmbedConcurrency, depth: config.Get().EmbedQueueDepth}
+
+// acquire waits for a slot, failing with ErrEmbedQueueFull when the queue is
+// full or with the context's error when the request goes away first. Call
+// release once the embedding is done.
+func (eq *embedQueue) acquire(ctx context.Context) (release func(), err error) {
+	eq.mu.Lock()
+	if eq.running < eq.slots {
+		eq.running++
+		eq.mu.Unlock()
+		embedRunning.Add(1)
+		return eq.release, nil
+	}
+	if len(eq.pending) >= eq.depth {
+		eq.mu.Unlock()
+		embedRejected.Inc()
+		return nil, ErrEmbedQueueFull
+	}
+	ready := make(chan struct{})
+	eq.pending = append(eq.pending, ready)
+	eq.mu.Unlock()
+	embedWaiting.Add(1)
+	defer embedWaiting.Add(-1)
+
+	select {
+	case <-ready:
+		embedRunning.Add(1)
+		return eq.release, nil
+	case <-ctx.Done():
+	}
+
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
+	for i, waiter := range eq.pending {
+		if waiter == ready {
+			eq.pending = append(eq.pending[:i], eq.pending[i+1:]...)
+			return nil, ctx.Err()
+		}
+	}
+	// The slot was handed over just as the request went away, so pass it on
+	embedRunning.Add(1)
+	go eq.release()
+	return nil, ctx.Err()
+}
+
+// release frees a slot, handing it to the oldest waiting request
+func (eq *embedQueue) release() {
+	embedRunning.Add(-1)
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
+	if len(eq.pending) > 0 {
+		next := eq.pending[0]
+		eq.pending = eq.pending[1:]
+		close(next)
+		return
+	}
+	eq.running--
+}
+
+// errEmbedUnsupported means the Ollama server predates the batch /api/embed API
+var errEmbedUnsupported = errors.New("ollama has no /api/embed")
+
+// Embed returns an embedding for each input, computed by the model in the
+// container. It waits for a slot under OWNGPT_EMBED_CONCURRENCY and sends
+// the inputs in batches of OWNGPT_EMBED_BATCH_SIZE per Ollama call, falling
+// back to one call per input on Ollama versions without batch embedding.
+func (os *OllamaService) Embed(ctx context.Context, containerName string, inputs []string) ([][]float64, error) {
+	release, err := embeds.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	modelName := ModelForContainer(containerName)
+	ctx, done := trackGeneration(ctx)
+	defer done()
+
+	batchSize := config.Get().EmbedBatchSize
+	embeddings := make([][]float64, 0, len(inputs))
+	for start := 0; start < len(inputs); start += batchSize {
+		batch := inputs[start:min(start+batchSize, len(inputs))]
+		vectors, err := os.embedWithTimeout(ctx, containerName, modelName, batch)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, vectors...)
+	}
+	return embeddings, nil
+}
+
+// embedWithTimeout embeds one batch, giving it the model's own generation
+// timeout so a large request is not cut short by the number of batches
+func (os *OllamaService) embedWithTimeout(ctx context.Context, containerName, modelName string, batch []string) ([][]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, GenerationTimeout(modelName))
+	defer cancel()
+
+	vectors, err := os.embedBatch(ctx, containerName, modelName, batch)
+	if errors.Is(err, errEmbedUnsupported) {
+		vectors, err = os.embedEach(ctx, containerName, modelName, batch)
+	}
+	if err != nil {
+		return nil, generationErr(ctx, err)
+	}
+	return vectors, nil
+}
+
+// embedBatch embeds several inputs with one call to /api/embed
+func (os *OllamaService) embedBatch(ctx context.Context, containerName, modelName string, inputs []string) ([][]float64, error) {
+	var result struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	err := os.postEmbed(ctx, containerName, "/api/embed", map[string]interface{}{"model": modelName, "input": inputs}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Embeddings) != len(inputs) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(result.Embeddings), len(inputs))
+	}
+	return result.Embeddings, nil
+}
+
+// embedEach embeds inputs one at a time with the older /api/embeddings
+func (os *OllamaService) embedEach(ctx context.Context, containerName, modelName string, inputs []string) ([][]float64, error) {
+	embeddings := make([][]float64, 0, len(inputs))
+	for _, input := range inputs {
+		var result struct {
+			Embedding []float64 `json:"embedding"`
+		}
+		err := os.postEmbed(ctx, containerName, "/api/embeddings", map[string]interface{}{"model": modelName, "prompt": input}, &result)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, result.Embedding)
+	}
+	return embeddings, nil
+}
+
+// postEmbed makes one embedding call to Ollama and decodes its response
+func (os *OllamaService) postEmbed(ctx context.Context, containerName, path string, payload interface{}, result interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	embedBatches.Inc()
+	resp, err := postJSON(ctx, os.client, ollamaURL(containerName, path), jsonData)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && path == "/api/embed" {
+		return errEmbedUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ollama API returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owngpt/config"
+)
+
+// useOllama points local mode at the server for the test
+func useOllama(t *testing.T, url string) {
+	cfg := config.Get()
+	mode, ollama := cfg.Mode, cfg.OllamaURL
+	cfg.Mode, cfg.OllamaURL = "local", url
+	t.Cleanup(func() { cfg.Mode, cfg.OllamaURL = mode, ollama })
+}
+
+func TestEmbedTimeoutAppliesPerBatch(t *testing.T) {
+	var batches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		batches.Add(1)
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte(`{"embeddings":[[1,2]]}`))
+	}))
+	defer server.Close()
+	useOllama(t, server.URL)
+
+	cfg := config.Get()
+	timeout, batchSize := cfg.GenerationTimeout, cfg.EmbedBatchSize
+	cfg.GenerationTimeout, cfg.EmbedBatchSize = 300*time.Millisecond, 1
+	t.Cleanup(func() { cfg.GenerationTimeout, cfg.EmbedBatchSize = timeout, batchSize })
+
+	// Four batches take longer than one timeout, but each fits in its own
+	inputs := []string{"a", "b", "c", "d"}
+	vectors, err := NewOllamaService().Embed(context.Background(), "ollama-embed-container", inputs)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vectors) != len(inputs) || batches.Load() != 4 {
+		t.Errorf("got %d embeddings from %d batches, want 4 from 4", len(vectors), batches.Load())
+	}
+}
+
+func TestEmbedBatchTimesOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+	useOllama(t, server.URL)
+
+	cfg := config.Get()
+	timeout := cfg.GenerationTimeout
+	cfg.GenerationTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { cfg.GenerationTimeout = timeout })
+
+	if _, err := NewOllamaService().Embed(context.Background(), "ollama-embed-container", []string{"a"}); err == nil {
+		t.Fatal("Embed succeeded past the timeout")
+	}
+}
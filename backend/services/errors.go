@@ -0,0 +1,38 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PortInUseError reports a host port already published by another container
+type PortInUseError struct {
+	Port      string
+	Container string
+}
+
+func (e *PortInUseError) Error() string {
+	return fmt.Sprintf("host port %s is already in use by container %s", e.Port, e.Container)
+}
+
+// isNotFound reports whether a docker command failed only because the
+// container or image it names doesn't exist
+func isNotFound(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(exitErr.Stderr)), "no such")
+}
+
+// isMissingFile reports whether a command run in a container failed only
+// because the file it reads doesn't exist
+func isMissingFile(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(exitErr.Stderr)), "no such file")
+}
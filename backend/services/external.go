@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"owngpt/models"
+	"owngpt/utils"
+)
+
+var (
+	adoptedMu sync.RWMutex
+	// adopted maps externally created containers to the Ollama model they serve
+	adopted = make(map[string]string)
+)
+
+// ModelForContainer returns the Ollama model a container serves: the model it
+// was adopted with, or the one encoded in an OWNGPT container name
+func ModelForContainer(containerName string) string {
+	adoptedMu.RLock()
+	model, ok := adopted[containerName]
+	adoptedMu.RUnlock()
+	if ok {
+		return model
+	}
+	return utils.ModelNameFromContainer(containerName)
+}
+
+// isOllamaImage reports whether an image reference is the Ollama server image,
+// with or without a registry prefix or tag
+func isOllamaImage(image string) bool {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image == "ollama/ollama" || strings.HasSuffix(image, "/ollama/ollama")
+}
+
+// GetExternalContainers lists Ollama containers OWNGPT did not create, found
+// by their image or by exposing Ollama's default port
+func (ds *DockerService) GetExternalContainers() ([]models.InstalledModel, error) {
+	output, err := ds.run(ds.timeout, false, "docker", "ps", "-a", "--format", "{{.Names}}\t{{.Image}}\t{{.Status}}\t{{.Ports}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	var external []models.InstalledModel
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.Split(line, "\t")
+		if len(parts) < 4 || utils.IsModelContainer(parts[0]) {
+			continue
+		}
+		containerName, image, status, ports := parts[0], parts[1], parts[2], parts[3]
+		if !isOllamaImage(image) && !strings.Contains(ports, "11434/tcp") {
+			continue
+		}
+
+		adoptedMu.RLock()
+		modelName := adopted[containerName]
+		adoptedMu.RUnlock()
+
+		state, exitCode := utils.ParseContainerStatus(status)
+		external = append(external, models.InstalledModel{
+			Name:          modelName,
+			ContainerName: containerName,
+			Status:        status,
+			Ports:         ports,
+			State:         state,
+			ExitCode:      exitCode,
+			IsRunning:     state == models.StateRunning,
+			External:      true,
+			Image:         image,
+		})
+	}
+
+	return external, nil
+}
+
+// ConnectToModelNetwork attaches a container to the model network, which the
+// backend reaches Ollama servers over, unless it is already attached
+func (ds *DockerService) ConnectToModelNetwork(containerName string) error {
+	networks, err := ds.run(ds.timeout, false, "docker", "inspect", "--format", "{{json .NetworkSettings.Networks}}", containerName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %v", containerName, err)
+	}
+	if !strings.Contains(string(networks), `"`+ModelNetwork()+`"`) {
+		if _, err := ds.run(ds.timeout, false, "docker", "network", "connect", ModelNetwork(), containerName); err != nil {
+			return fmt.Errorf("failed to connect %s to %s: %v", containerName, ModelNetwork(), err)
+		}
+	}
+	return nil
+}
+
+// AdoptContainer records the model an external container serves, so requests
+// routed to it name the right model
+func AdoptContainer(containerName, model string) {
+	adoptedMu.Lock()
+	defer adoptedMu.Unlock()
+	adopted[containerName] = model
+}
+
+// ListModels returns the models pulled into a container's Ollama server
+func (os *OllamaService) ListModels(containerName string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ollamaURL(containerName, "/api/tags"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := os.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama API returned status %d", resp.StatusCode)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+
+	"owngpt/models"
+)
+
+func TestFinishReason(t *testing.T) {
+	tests := []struct {
+		doneReason            string
+		evalCount, numPredict int
+		want                  string
+	}{
+		{"stop", 250, 250, models.FinishEnd},
+		{"length", 10, 250, models.FinishLength},
+		{"unload", 10, 250, models.FinishStop},
+		// Older Ollama versions send no done_reason
+		{"", 250, 250, models.FinishLength},
+		{"", 10, 250, models.FinishEnd},
+		{"", 10, -1, models.FinishEnd},
+	}
+	for _, tt := range tests {
+		if got := finishReason(tt.doneReason, tt.evalCount, tt.numPredict); got != tt.want {
+			t.Errorf("finishReason(%q, %d, %d) = %q, want %q", tt.doneReason, tt.evalCount, tt.numPredict, got, tt.want)
+		}
+	}
+}
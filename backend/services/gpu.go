@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"owngpt/lifecycle"
+)
+
+// gpuRecheck is how often GPU support is detected again, for a driver or
+// runtime installed while the backend runs. Detection runs a container, so it
+// happens in the background and never on a request.
+const gpuRecheck = 10 * time.Minute
+
+// gpuState holds the result of the last detection
+var gpuState struct {
+	sync.Mutex
+	available bool
+	detected  bool
+}
+
+// WatchGPU detects GPU support now and then again every gpuRecheck
+func WatchGPU() {
+	ds := NewDockerService()
+	ds.DetectGPU()
+	lifecycle.Every("gpu_detect", gpuRecheck, func(ctx context.Context) error {
+		ds.DetectGPU()
+		return nil
+	})
+}
+
+// IsGPUAvailable reports whether model containers get an NVIDIA GPU, as last
+// detected by DetectGPU. Before the first detection it reports false.
+func (ds *DockerService) IsGPUAvailable() bool {
+	gpuState.Lock()
+	defer gpuState.Unlock()
+	return gpuState.available
+}
+
+// DetectGPU checks for nvidia-smi and for Docker running containers with
+// --gpus, keeping the result for IsGPUAvailable. A change is logged.
+func (ds *DockerService) DetectGPU() bool {
+	err := ds.detectGPU()
+	available := err == nil
+
+	gpuState.Lock()
+	changed := !gpuState.detected || gpuState.available != available
+	gpuState.available, gpuState.detected = available, true
+	gpuState.Unlock()
+
+	if changed {
+		if available {
+			log.Println("GPU support detected and available")
+		} else {
+			log.Printf("No GPU support: %v", err)
+		}
+	}
+	return available
+}
+
+// detectGPU returns why model containers can't get a GPU, or nil if they can
+func (ds *DockerService) detectGPU() error {
+	// Check if nvidia-smi is available
+	if _, err := ds.run(ds.timeout, false, "nvidia-smi"); err != nil {
+		return fmt.Errorf("nvidia-smi not available: %v", err)
+	}
+
+	// Check if Docker supports GPU (nvidia-docker or Docker with GPU support)
+	if _, err := ds.run(ds.timeout, false, "docker", "run", "--rm", "--gpus", "all", "hello-world"); err != nil {
+		return fmt.Errorf("Docker GPU support not available: %v", err)
+	}
+	return nil
+}
+
+// gpuOption sets num_gpu for the host: 1 where model containers get a GPU and
+// 0 on CPU-only hosts, so Ollama isn't asked for a GPU that isn't there. Local
+// mode leaves it to the Ollama server, which may use a GPU Docker can't see,
+// such as Apple's Metal.
+func gpuOption(options map[string]interface{}) {
+	if LocalMode() {
+		return
+	}
+	options["num_gpu"] = 0
+	if NewDockerService().IsGPUAvailable() {
+		options["num_gpu"] = 1
+	}
+}
+
+// gpuFailure reports whether an Ollama error is the model failing to run on
+// the GPU, such as a CUDA error or the GPU running out of memory
+func gpuFailure(message string) bool {
+	message = strings.ToLower(message)
+	for _, marker := range []string{"cuda", "gpu", "rocm", "hip error", "cublas", "vram"} {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// postGeneration sends a generation payload and returns Ollama's response
+// once it has accepted it. A generation Ollama can't run on the GPU is tried
+// once more on the CPU with num_gpu 0.
+func (os *OllamaService) postGeneration(ctx context.Context, url string, payload map[string]interface{}) (*http.Response, error) {
+	for {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := postJSON(ctx, os.client, url, jsonData)
+		if err != nil {
+			return nil, generationErr(ctx, err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err = fmt.Errorf("ollama API returned status %d: %s", resp.StatusCode, string(bytes.TrimSpace(body)))
+
+		options, _ := payload["options"].(map[string]interface{})
+		if options == nil || options["num_gpu"] == 0 || !gpuFailure(string(body)) {
+			return nil, err
+		}
+		log.Printf("Generation on %v failed on the GPU, retrying on the CPU with num_gpu 0: %v", payload["model"], err)
+		options["num_gpu"] = 0
+	}
+}
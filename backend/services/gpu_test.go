@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// setGPU records a detection result for the test, restoring the previous one after it
+func setGPU(t *testing.T, available bool) {
+	gpuState.Lock()
+	previous, detected := gpuState.available, gpuState.detected
+	gpuState.available, gpuState.detected = available, true
+	gpuState.Unlock()
+	t.Cleanup(func() {
+		gpuState.Lock()
+		gpuState.available, gpuState.detected = previous, detected
+		gpuState.Unlock()
+	})
+}
+
+func TestDetectGPU(t *testing.T) {
+	setGPU(t, false)
+
+	ds, fake := newFakeDockerService(map[string]string{"nvidia-smi": "", "docker run --rm --gpus all hello-world": ""})
+	if !ds.DetectGPU() || !ds.IsGPUAvailable() {
+		t.Fatal("GPU not detected with nvidia-smi and docker --gpus working")
+	}
+
+	// Reading the result never runs a command
+	for i := 0; i < 10; i++ {
+		ds.IsGPUAvailable()
+	}
+	if calls := fake.called(""); calls != 2 {
+		t.Errorf("ran %d commands, want 2", calls)
+	}
+
+	ds, _ = newFakeDockerService(map[string]string{"docker run": ""})
+	if ds.DetectGPU() || ds.IsGPUAvailable() {
+		t.Error("GPU detected without nvidia-smi")
+	}
+}
+
+func TestDefaultOptionsCPUHost(t *testing.T) {
+	setGPU(t, false)
+	if numGPU := defaultOptions()["num_gpu"]; numGPU != 0 {
+		t.Errorf("num_gpu on a CPU host = %v, want 0", numGPU)
+	}
+
+	setGPU(t, true)
+	if numGPU := defaultOptions()["num_gpu"]; numGPU != 1 {
+		t.Errorf("num_gpu on a GPU host = %v, want 1", numGPU)
+	}
+}
+
+func TestPostGenerationFallsBackToCPU(t *testing.T) {
+	var requests atomic.Int32
+	var mu sync.Mutex
+	var numGPU []float64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Options map[string]float64 `json:"options"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		mu.Lock()
+		numGPU = append(numGPU, payload.Options["num_gpu"])
+		mu.Unlock()
+		if requests.Add(1) == 1 {
+			http.Error(w, `{"error":"CUDA error: out of memory"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"response":"ok","done":true}`))
+	}))
+	defer server.Close()
+
+	payload := map[string]interface{}{"model": "llama2", "options": map[string]interface{}{"num_gpu": 1}}
+	resp, err := NewOllamaService().postGeneration(context.Background(), server.URL, payload)
+	if err != nil {
+		t.Fatalf("postGeneration: %v", err)
+	}
+	resp.Body.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(numGPU) != 2 || numGPU[0] != 1 || numGPU[1] != 0 {
+		t.Errorf("num_gpu sent = %v, want [1 0]", numGPU)
+	}
+}
+
+func TestPostGenerationKeepsOtherErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	payload := map[string]interface{}{"model": "llama2", "options": map[string]interface{}{"num_gpu": 1}}
+	if _, err := NewOllamaService().postGeneration(context.Background(), server.URL, payload); err == nil {
+		t.Fatal("postGeneration succeeded on a 404")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("sent %d requests, want 1", requests.Load())
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// HistoryBudget returns how many tokens of conversation history a request may
+// send: OWNGPT_HISTORY_TOKEN_BUDGET when set, otherwise what the model's
+// num_ctx leaves after the reply's num_predict
+func HistoryBudget(req models.ChatRequest, containerName string) int {
+	if budget := config.Get().HistoryTokenBudget; budget > 0 {
+		return budget
+	}
+	numCtx := ModelContextWindow(ModelForContainer(containerName))
+	if numPredict, _ := requestOptions(req, ModelForContainer(containerName))["num_predict"].(int); numPredict > 0 && numPredict < numCtx {
+		return numCtx - numPredict
+	}
+	return numCtx
+}
+
+// SummarizeConversation asks the model for a short summary of messages, so
+// turns trimmed from a long conversation aren't forgotten entirely
+func (os *OllamaService) SummarizeConversation(messages []models.OllamaChatMessage, containerName string) (string, error) {
+	var transcript strings.Builder
+	transcript.WriteString("Summarize the key facts of this conversation in a few sentences:\n\n")
+	for _, message := range messages {
+		transcript.WriteString(message.Role + ": " + message.Content + "\n")
+	}
+
+	resp, err := os.Generate(context.Background(), models.ChatRequest{Message: transcript.String()}, containerName)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Response), nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+func TestHistoryBudget(t *testing.T) {
+	const model = "budget-test"
+	containerName := "ollama-" + model + "-container"
+	registry.Update(model, func(record *models.ModelRecord) { record.Config.NumCtx = 4096 })
+	t.Cleanup(func() { registry.Delete(model) })
+
+	cfg := config.Get()
+	previous := cfg.HistoryTokenBudget
+	cfg.HistoryTokenBudget = 0
+	t.Cleanup(func() { cfg.HistoryTokenBudget = previous })
+
+	reply := func(numPredict int) models.ChatRequest {
+		return models.ChatRequest{Options: &models.SamplingOptions{NumPredict: intPtr(numPredict)}}
+	}
+	tests := []struct {
+		name string
+		req  models.ChatRequest
+		want int
+	}{
+		{"reply reserved", reply(1000), 3096},
+		{"unlimited reply", reply(-1), 4096},
+		{"reply beyond the window", reply(5000), 4096},
+	}
+	for _, tt := range tests {
+		if got := HistoryBudget(tt.req, containerName); got != tt.want {
+			t.Errorf("%s: budget = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	cfg.HistoryTokenBudget = 500
+	if got := HistoryBudget(reply(1000), containerName); got != 500 {
+		t.Errorf("budget = %d, want OWNGPT_HISTORY_TOKEN_BUDGET", got)
+	}
+}
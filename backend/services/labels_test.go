@@ -0,0 +1,41 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCustomLabels(t *testing.T) {
+	column := "owngpt.labels=project;team,maintainer=ollama,team=ml,project=chat,owngpt.managed=true"
+	want := map[string]string{"team": "ml", "project": "chat"}
+	if got := customLabels(column); !reflect.DeepEqual(got, want) {
+		t.Errorf("customLabels = %v, want %v without the image's labels", got, want)
+	}
+	if got := customLabels("maintainer=ollama,owngpt.managed=true"); got != nil {
+		t.Errorf("customLabels without owngpt.labels = %v, want nil", got)
+	}
+}
+
+func TestRunDockerContainerLabels(t *testing.T) {
+	ds, fake := newFakeDockerService(map[string]string{
+		psPorts:      "",
+		"docker rm":  "",
+		"docker run": "abc123",
+	})
+	labels := map[string]string{"team": "ml", "project": "chat"}
+	if err := ds.RunDockerContainer("ollama-llama2", "ollama-llama2-container", "11434", "", labels); err != nil {
+		t.Fatal(err)
+	}
+
+	var run string
+	for _, line := range fake.calls {
+		if strings.HasPrefix(line, "docker run") {
+			run = line
+		}
+	}
+	want := "--label project=chat --label team=ml --label owngpt.labels=project;team"
+	if !strings.Contains(run, want) {
+		t.Errorf("docker run = %q, want %q", run, want)
+	}
+}
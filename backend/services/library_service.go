@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"owngpt/config"
+)
+
+// LibraryService checks model names against the Ollama model registry
+type LibraryService struct {
+	client *http.Client
+}
+
+var (
+	// knownModels caches names confirmed to exist so repeated creates skip the lookup
+	knownModels   = make(map[string]bool)
+	knownModelsMu sync.RWMutex
+)
+
+func NewLibraryService() *LibraryService {
+	return &LibraryService{
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ModelExists reports whether the model's manifest is published in the registry.
+// An error means the registry couldn't be asked, not that the model is missing.
+func (ls *LibraryService) ModelExists(model string) (bool, error) {
+	name := strings.ToLower(model)
+
+	knownModelsMu.RLock()
+	known := knownModels[name]
+	knownModelsMu.RUnlock()
+	if known {
+		return true, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, manifestURL(config.Get().OllamaRegistry, name), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+
+	resp, err := ls.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		knownModelsMu.Lock()
+		knownModels[name] = true
+		knownModelsMu.Unlock()
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("registry returned status %d", resp.StatusCode)
+	}
+}
+
+// manifestURL maps "name[:tag]" or "namespace/name[:tag]" to its registry manifest URL
+func manifestURL(registry, model string) string {
+	repository, tag := model, "latest"
+	if i := strings.LastIndex(model, ":"); i > strings.LastIndex(model, "/") {
+		repository, tag = model[:i], model[i+1:]
+	}
+	if !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return fmt.Sprintf("%s/v2/%s/manifests/%s", strings.TrimSuffix(registry, "/"), repository, tag)
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// lineWriter copies command output to out and hands each complete line to
+// onLine. Carriage returns end a line too, since progress bars redraw with them.
+type lineWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	onLine func(string)
+	buf    bytes.Buffer
+}
+
+func newLineWriter(out io.Writer, onLine func(string)) *lineWriter {
+	return &lineWriter{out: out, onLine: onLine}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.out != nil {
+		w.out.Write(p)
+	}
+	w.buf.Write(p)
+	for {
+		data := w.buf.Bytes()
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.emit(string(data[:i]))
+		w.buf.Next(i + 1)
+	}
+	return len(p), nil
+}
+
+// Flush hands any trailing partial line to onLine
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.emit(w.buf.String())
+	w.buf.Reset()
+}
+
+func (w *lineWriter) emit(line string) {
+	if line = strings.TrimSpace(line); line != "" {
+		w.onLine(line)
+	}
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/utils"
+)
+
+// LocalMode reports whether models live in a local Ollama server
+// (OWNGPT_MODE=local) rather than in a Docker container each. Models keep
+// their container names as identifiers, so the rest of the server works the
+// same in both modes.
+func LocalMode() bool {
+	return config.Get().Mode == "local"
+}
+
+// LocalPort returns the port of OWNGPT_OLLAMA_URL, which local mode reports as
+// the port of every model
+func LocalPort() string {
+	u, err := url.Parse(config.Get().OllamaURL)
+	if err != nil {
+		return ""
+	}
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// LocalOllama pulls, lists, loads and deletes models through the API of the
+// Ollama server local mode talks to
+type LocalOllama struct {
+	client *http.Client
+}
+
+// NewLocalOllama creates a client for the local Ollama server
+func NewLocalOllama() *LocalOllama {
+	return &LocalOllama{client: &http.Client{Transport: ollamaTransport}}
+}
+
+// do sends a request to the local Ollama server, failing on non-2xx statuses
+func (lo *LocalOllama) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, config.Get().OllamaURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := lo.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(resp.Body)
+		return nil, &localStatusError{status: resp.StatusCode, message: strings.TrimSpace(string(message))}
+	}
+	return resp, nil
+}
+
+// localStatusError is a non-2xx response from the local Ollama server
+type localStatusError struct {
+	status  int
+	message string
+}
+
+func (e *localStatusError) Error() string {
+	return fmt.Sprintf("ollama API returned status %d: %s", e.status, e.message)
+}
+
+// Version returns the local Ollama server's version, failing if it can't be reached
+func (lo *LocalOllama) Version() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := lo.do(ctx, http.MethodGet, "/api/version", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", err
+	}
+	return version.Version, nil
+}
+
+// InstalledModels lists the models pulled into the local Ollama server. Any
+// of them can answer, so all count as running; Status says which are loaded.
+func (lo *LocalOllama) InstalledModels() ([]models.InstalledModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var tags, loaded struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	resp, err := lo.do(ctx, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local models: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to list local models: %v", err)
+	}
+
+	// Loaded models are only informational, so older servers without /api/ps are fine
+	inMemory := make(map[string]bool)
+	if resp, err := lo.do(ctx, http.MethodGet, "/api/ps", nil); err == nil {
+		defer resp.Body.Close()
+		if json.NewDecoder(resp.Body).Decode(&loaded) == nil {
+			for _, model := range loaded.Models {
+				inMemory[model.Name] = true
+			}
+		}
+	}
+
+	installed := make([]models.InstalledModel, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		status := "Pulled"
+		if inMemory[model.Name] {
+			status = "Loaded"
+		}
+		// Ollama lists untagged models as name:latest, which is the same
+		// model, and container, as the plain name OWNGPT is given
+		name := strings.TrimSuffix(model.Name, ":latest")
+		installed = append(installed, models.InstalledModel{
+			Name:          name,
+			ContainerName: utils.ContainerName(name),
+			Status:        status,
+			State:         models.StateRunning,
+			IsRunning:     true,
+		})
+	}
+	return installed, nil
+}
+
+// Pull downloads a model into the local Ollama server, reporting progress to
+// onStatus as "pulling" with a percentage, or -1 when it isn't known. A pull
+// that is interrupted is tried up to OWNGPT_PULL_ATTEMPTS times within the
+// timeout, reporting "retrying <attempt>/<attempts>" before each retry. Ollama
+// resumes the layers the failed attempt left partly downloaded.
+func (lo *LocalOllama) Pull(modelName string, timeout time.Duration, onStatus func(status string, percent int)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	attempts := config.Get().PullAttempts
+	for attempt := 1; ; attempt++ {
+		err := lo.pullOnce(ctx, modelName, onStatus)
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts || !retryablePull(ctx, err) {
+			if attempt > 1 {
+				err = fmt.Errorf("model pull failed after %d attempts: %w", attempt, err)
+			}
+			return localErr(ctx, "pull", timeout, err)
+		}
+		log.Printf("Pull of %s failed, retrying (attempt %d of %d): %v", modelName, attempt+1, attempts, err)
+		if onStatus != nil {
+			onStatus(pullRetryStatus(attempt+1, attempts), -1)
+		}
+		if !waitToRetry(ctx, attempt+1) {
+			return localErr(ctx, "pull", timeout, err)
+		}
+	}
+}
+
+// pullOnce makes one attempt at pulling a model into the local Ollama server
+func (lo *LocalOllama) pullOnce(ctx context.Context, modelName string, onStatus func(status string, percent int)) error {
+	resp, err := lo.do(ctx, http.MethodPost, "/api/pull", map[string]interface{}{"model": modelName, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var progress struct {
+			Status    string `json:"status"`
+			Total     int64  `json:"total"`
+			Completed int64  `json:"completed"`
+			Error     string `json:"error"`
+		}
+		if err := decoder.Decode(&progress); err != nil {
+			return err
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("model pull failed: %s", progress.Error)
+		}
+		if progress.Status == "success" {
+			return nil
+		}
+		if onStatus != nil {
+			percent := -1
+			if progress.Total > 0 {
+				percent = int(progress.Completed * 100 / progress.Total)
+			}
+			onStatus("pulling", percent)
+		}
+	}
+	return errors.New("model pull ended without reporting success")
+}
+
+// Load loads a model into memory with an empty generation, so the first chat
+// doesn't pay for it
+func (lo *LocalOllama) Load(modelName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp, err := lo.do(ctx, http.MethodPost, "/api/generate", map[string]interface{}{"model": modelName, "stream": false})
+	if err != nil {
+		return localErr(ctx, "load", timeout, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Delete removes a model from the local Ollama server, reporting whether it
+// was there to remove
+func (lo *LocalOllama) Delete(modelName string) (found bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := lo.do(ctx, http.MethodDelete, "/api/delete", map[string]string{"model": modelName})
+	var statusErr *localStatusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete model %s: %v", modelName, err)
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// localErr names the phase that ran out of time, like readiness does for containers
+func localErr(ctx context.Context, phase string, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &ReadyTimeoutError{Phase: phase, Elapsed: timeout}
+	}
+	return err
+}
+
+// StartLocalOllama runs "ollama serve" for local mode when OWNGPT_SPAWN_OLLAMA
+// is set and no server answers at OWNGPT_OLLAMA_URL yet. The returned function
+// stops the server it started; it does nothing if none was started.
+func StartLocalOllama() (stop func(), err error) {
+	stop = func() {}
+	cfg := config.Get()
+	local := NewLocalOllama()
+	if !cfg.SpawnOllama {
+		return stop, nil
+	}
+	if _, err := local.Version(); err == nil {
+		log.Printf("Ollama is already running at %s, not starting one", cfg.OllamaURL)
+		return stop, nil
+	}
+
+	u, err := url.Parse(cfg.OllamaURL)
+	if err != nil || u.Host == "" {
+		return stop, fmt.Errorf("invalid OWNGPT_OLLAMA_URL %q", cfg.OllamaURL)
+	}
+	cmd := exec.Command("ollama", "serve")
+	cmd.Env = append(os.Environ(), "OLLAMA_HOST="+u.Host)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return stop, fmt.Errorf("failed to start ollama serve: %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	stop = func() {
+		log.Println("Stopping the Ollama server")
+		cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+		}
+	}
+
+	deadline := time.Now().Add(cfg.ReadyServerTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return func() {}, fmt.Errorf("ollama serve exited: %v", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+		if version, err := local.Version(); err == nil {
+			log.Printf("Started Ollama %s at %s", version, cfg.OllamaURL)
+			return stop, nil
+		}
+	}
+	stop()
+	return func() {}, fmt.Errorf("ollama serve did not answer at %s within %v", cfg.OllamaURL, cfg.ReadyServerTimeout)
+}
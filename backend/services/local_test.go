@@ -0,0 +1,36 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owngpt/utils"
+)
+
+func TestLocalInstalledModelsDropLatest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[{"name":"llama2:latest"},{"name":"mistral:7b"}]}`))
+		case "/api/ps":
+			w.Write([]byte(`{"models":[{"name":"llama2:latest"}]}`))
+		}
+	}))
+	defer server.Close()
+	useOllama(t, server.URL)
+
+	installed, err := NewLocalOllama().InstalledModels()
+	if err != nil {
+		t.Fatalf("InstalledModels: %v", err)
+	}
+	want := []struct{ name, status string }{{"llama2", "Loaded"}, {"mistral:7b", "Pulled"}}
+	if len(installed) != len(want) {
+		t.Fatalf("got %d models, want %d", len(installed), len(want))
+	}
+	for i, model := range installed {
+		if model.Name != want[i].name || model.ContainerName != utils.ContainerName(want[i].name) || model.Status != want[i].status {
+			t.Errorf("model %d = %s (%s, %s), want %s (%s)", i, model.Name, model.ContainerName, model.Status, want[i].name, want[i].status)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"owngpt/config"
+)
+
+// loadHistorySize is how many of a model's recent startups its expected load
+// time is averaged over
+const loadHistorySize = 5
+
+// minRetryAfter is the least a client is told to wait before retrying a loading model
+const minRetryAfter = time.Second
+
+// ModelLoadingStatus describes a model container still becoming ready
+type ModelLoadingStatus struct {
+	// Status is the startup script's status, such as pulling or warming_up
+	Status string
+	// Elapsed is how long the model has been starting
+	Elapsed time.Duration
+	// RetryAfter is how much longer the model is expected to take
+	RetryAfter time.Duration
+}
+
+var (
+	loadingMu sync.Mutex
+	// loading holds the containers being waited on to become ready
+	loading = make(map[string]*loadingModel)
+	// loadTimes are each container's most recent successful startup times
+	loadTimes = make(map[string][]time.Duration)
+)
+
+// loadingModel is a container being waited on, with its latest status
+type loadingModel struct {
+	since  time.Time
+	status string
+}
+
+// beginLoading marks the container as starting until the returned function is
+// called with whether it became ready, which records how long it took
+func beginLoading(containerName string) (setStatus func(status string), done func(ready bool)) {
+	model := &loadingModel{since: time.Now(), status: "starting"}
+	loadingMu.Lock()
+	loading[containerName] = model
+	loadingMu.Unlock()
+
+	setStatus = func(status string) {
+		loadingMu.Lock()
+		model.status = status
+		loadingMu.Unlock()
+	}
+	done = func(ready bool) {
+		loadingMu.Lock()
+		defer loadingMu.Unlock()
+		if loading[containerName] == model {
+			delete(loading, containerName)
+		}
+		if ready {
+			times := append(loadTimes[containerName], time.Since(model.since))
+			if len(times) > loadHistorySize {
+				times = times[len(times)-loadHistorySize:]
+			}
+			loadTimes[containerName] = times
+		}
+	}
+	return setStatus, done
+}
+
+// ModelLoading reports whether the container is still becoming ready, rather
+// than ready or failed, and how long a client should wait before retrying:
+// what remains of the container's average observed startup time, or
+// OWNGPT_LOADING_RETRY_AFTER before any startup has been observed
+func ModelLoading(containerName string) (ModelLoadingStatus, bool) {
+	loadingMu.Lock()
+	defer loadingMu.Unlock()
+
+	model, ok := loading[containerName]
+	if !ok {
+		return ModelLoadingStatus{}, false
+	}
+	status := ModelLoadingStatus{Status: model.status, Elapsed: time.Since(model.since)}
+	status.RetryAfter = config.Get().LoadingRetryAfter
+	if times := loadTimes[containerName]; len(times) > 0 {
+		var total time.Duration
+		for _, t := range times {
+			total += t
+		}
+		status.RetryAfter = total/time.Duration(len(times)) - status.Elapsed
+	}
+	status.RetryAfter = max(status.RetryAfter, minRetryAfter)
+	return status, true
+}
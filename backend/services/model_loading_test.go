@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owngpt/config"
+)
+
+// forgetLoadTimes drops the container's observed startup times after the test
+func forgetLoadTimes(t *testing.T, containerName string) {
+	t.Cleanup(func() {
+		loadingMu.Lock()
+		delete(loadTimes, containerName)
+		loadingMu.Unlock()
+	})
+}
+
+func TestModelLoading(t *testing.T) {
+	const container = "ollama-loading-test-container"
+	forgetLoadTimes(t, container)
+	cfg := config.Get()
+	retryAfter := cfg.LoadingRetryAfter
+	cfg.LoadingRetryAfter = 10 * time.Second
+	t.Cleanup(func() { cfg.LoadingRetryAfter = retryAfter })
+
+	if _, loading := ModelLoading(container); loading {
+		t.Fatal("a container nobody waits on is loading")
+	}
+
+	setStatus, done := beginLoading(container)
+	setStatus("pulling")
+	status, loading := ModelLoading(container)
+	if !loading || status.Status != "pulling" || status.RetryAfter != 10*time.Second {
+		t.Errorf("status = %+v, %v, want pulling with the configured retry", status, loading)
+	}
+
+	// A failed startup isn't a startup time to expect
+	done(false)
+	if _, loading := ModelLoading(container); loading {
+		t.Error("still loading after done")
+	}
+	_, done = beginLoading(container)
+	if status, _ := ModelLoading(container); status.RetryAfter != 10*time.Second {
+		t.Errorf("RetryAfter = %v after a failed startup, want the configured 10s", status.RetryAfter)
+	}
+	done(false)
+
+	loadingMu.Lock()
+	loadTimes[container] = []time.Duration{20 * time.Second, 40 * time.Second}
+	loadingMu.Unlock()
+	_, done = beginLoading(container)
+	defer done(false)
+	if status, _ := ModelLoading(container); status.RetryAfter <= 29*time.Second || status.RetryAfter > 30*time.Second {
+		t.Errorf("RetryAfter = %v, want what remains of the 30s average", status.RetryAfter)
+	}
+
+	loadingMu.Lock()
+	loadTimes[container] = []time.Duration{time.Millisecond}
+	loadingMu.Unlock()
+	if status, _ := ModelLoading(container); status.RetryAfter != minRetryAfter {
+		t.Errorf("RetryAfter = %v for an overdue model, want %v", status.RetryAfter, minRetryAfter)
+	}
+}
+
+func TestLoadTimesKeepRecentStartups(t *testing.T) {
+	const container = "ollama-load-times-test-container"
+	forgetLoadTimes(t, container)
+	for i := 0; i < loadHistorySize+2; i++ {
+		_, done := beginLoading(container)
+		done(true)
+	}
+	loadingMu.Lock()
+	count := len(loadTimes[container])
+	loadingMu.Unlock()
+	if count != loadHistorySize {
+		t.Errorf("kept %d startup times, want %d", count, loadHistorySize)
+	}
+
+	// An earlier wait ending doesn't end a newer one
+	_, stale := beginLoading(container)
+	_, current := beginLoading(container)
+	stale(false)
+	if _, loading := ModelLoading(container); !loading {
+		t.Error("the newer wait ended with the stale one")
+	}
+	current(false)
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// proxyEndpoints are the Ollama API endpoints POST /models/:name/ollama/:endpoint
+// passes through, with the method Ollama serves each with. Pulling, pushing and
+// creating models are left out: they run for minutes and stream their
+// progress, and OWNGPT's own build and update endpoints cover them.
+var proxyEndpoints = map[string]string{
+	"show":    http.MethodPost,
+	"copy":    http.MethodPost,
+	"delete":  http.MethodDelete,
+	"tags":    http.MethodGet,
+	"ps":      http.MethodGet,
+	"version": http.MethodGet,
+}
+
+// proxyTimeout bounds a passed-through call; none of the allowed endpoints generate
+const proxyTimeout = 30 * time.Second
+
+// maxProxyResponseBytes caps how much of Ollama's response is passed back
+const maxProxyResponseBytes = 10 << 20
+
+// ProxyEndpoints returns the Ollama endpoints that can be passed through, sorted
+func ProxyEndpoints() []string {
+	endpoints := make([]string, 0, len(proxyEndpoints))
+	for endpoint := range proxyEndpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// ProxyAllowed reports whether the Ollama endpoint can be passed through
+func ProxyAllowed(endpoint string) bool {
+	_, ok := proxyEndpoints[endpoint]
+	return ok
+}
+
+// ProxyResponse is Ollama's reply to a passed-through call
+type ProxyResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// ProxyOllama calls /api/<endpoint> on the container's Ollama server with the
+// body as given and returns Ollama's response unchanged. The endpoint must be
+// one ProxyAllowed accepts.
+func (os *OllamaService) ProxyOllama(ctx context.Context, containerName, endpoint string, body []byte) (ProxyResponse, error) {
+	method, ok := proxyEndpoints[endpoint]
+	if !ok {
+		return ProxyResponse{}, fmt.Errorf("ollama endpoint %q can't be passed through", endpoint)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, proxyTimeout)
+	defer cancel()
+
+	var reader io.Reader
+	if method != http.MethodGet && len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, ollamaURL(containerName, "/api/"+endpoint), reader)
+	if err != nil {
+		return ProxyResponse{}, err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := os.client.Do(req)
+	if err != nil {
+		return ProxyResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxProxyResponseBytes))
+	if err != nil {
+		return ProxyResponse{}, err
+	}
+	return ProxyResponse{
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        respBody,
+	}, nil
+}
@@ -2,178 +2,593 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"owngpt/config"
+	"owngpt/lifecycle"
 	"owngpt/models"
+	"owngpt/registry"
+	"owngpt/utils"
 )
 
-type OllamaService struct{}
+type OllamaService struct {
+	client *http.Client
+}
+
+// ollamaTransport is shared by every OllamaService so connections to model
+// containers are pooled and reused across requests. Timeouts are applied per
+// request through the request context.
+var ollamaTransport = &http.Transport{
+	MaxIdleConns:        10,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     30 * time.Second,
+}
 
 func NewOllamaService() *OllamaService {
-	return &OllamaService{}
+	return &OllamaService{
+		client: &http.Client{Transport: ollamaTransport},
+	}
+}
+
+// GenerationTimeout returns the model's configured generation timeout, or the global default
+func GenerationTimeout(modelName string) time.Duration {
+	if seconds := registry.Get(modelName).Config.TimeoutSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return config.Get().GenerationTimeout
+}
+
+// postJSON posts a JSON body, bounded by the context's deadline
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return client.Do(req)
+}
+
+// defaultOptions returns the generation options tuned for sub-6s responses.
+// Sampling comes from the configured defaults.
+func defaultOptions() map[string]interface{} {
+	sampling := config.Get().Sampling
+	options := map[string]interface{}{
+		"num_predict":    sampling.NumPredict,
+		"temperature":    sampling.Temperature,
+		"top_p":          sampling.TopP,
+		"top_k":          sampling.TopK,
+		"num_ctx":        config.Get().NumCtx,
+		"num_batch":      128,   // Smaller batch for faster processing
+		"low_vram":       false, // Don't limit VRAM usage for speed
+		"f16_kv":         true,  // Use FP16 for key-value cache (faster)
+		"use_mlock":      true,  // Keep model in memory
+		"use_mmap":       true,  // Memory-mapped model loading
+		"repeat_penalty": sampling.RepeatPenalty,
+		"tfs_z":          sampling.TfsZ,
+	}
+	gpuOption(options)
+	return options
+}
+
+// ContextWindow returns the num_ctx generations run with, OWNGPT_NUM_CTX. It
+// is also the limit prompts and history are checked against.
+func ContextWindow() int {
+	return config.Get().NumCtx
+}
+
+// ModelContextWindow returns the num_ctx the model's generations run with:
+// its num_ctx set with PUT /models/:name/config or its profile, otherwise
+// ContextWindow
+func ModelContextWindow(model string) int {
+	if numCtx := registry.Get(model).Config.NumCtx; numCtx > 0 {
+		return numCtx
+	}
+	return ContextWindow()
+}
+
+// requestOptions returns the default options with the model's profile from
+// the config file and then the request's overrides applied, with num_predict
+// capped at the model's max_tokens
+func requestOptions(req models.ChatRequest, modelName string) map[string]interface{} {
+	options := requestedOptions(req, modelName)
+	capNumPredict(options, modelName)
+	return options
+}
+
+// NumPredictClamp returns the num_predict the container's model caps the
+// request's reply at when its max_tokens is lower than what the request asks
+// for, whether itself or through the defaults; otherwise 0
+func NumPredictClamp(req models.ChatRequest, containerName string) int {
+	model := ModelForContainer(containerName)
+	options := requestedOptions(req, model)
+	if !capNumPredict(options, model) {
+		return 0
+	}
+	return options["num_predict"].(int)
+}
+
+// capNumPredict lowers num_predict to the model's max_tokens, which an
+// unlimited num_predict (-1 or -2) is above as well, reporting whether it did
+func capNumPredict(options map[string]interface{}, modelName string) bool {
+	maxTokens := registry.Get(modelName).Config.MaxTokens
+	if maxTokens <= 0 {
+		return false
+	}
+	if numPredict, _ := options["num_predict"].(int); numPredict >= 0 && numPredict <= maxTokens {
+		return false
+	}
+	options["num_predict"] = maxTokens
+	return true
+}
+
+// requestedOptions is requestOptions before the model's max_tokens applies
+func requestedOptions(req models.ChatRequest, modelName string) map[string]interface{} {
+	options := defaultOptions()
+	options["num_ctx"] = ModelContextWindow(modelName)
+	if threads := config.Get().NumThread; threads > 0 {
+		options["num_thread"] = threads
+	}
+	if profile, ok := registry.Profile(modelName); ok {
+		applySampling(options, profile.Options.NumPredict, profile.Options.Temperature, profile.Options.TopP,
+			profile.Options.TopK, profile.Options.RepeatPenalty, profile.Options.TfsZ)
+	}
+	if req.NumThread != nil {
+		options["num_thread"] = *req.NumThread
+	}
+	if o := req.Options; o != nil {
+		applySampling(options, o.NumPredict, o.Temperature, o.TopP, o.TopK, o.RepeatPenalty, o.TfsZ)
+	}
+	return options
+}
+
+// applySampling sets the sampling options that are given, leaving the rest
+func applySampling(options map[string]interface{}, numPredict *int, temperature, topP *float64, topK *int, repeatPenalty, tfsZ *float64) {
+	if numPredict != nil {
+		options["num_predict"] = *numPredict
+	}
+	if temperature != nil {
+		options["temperature"] = *temperature
+	}
+	if topP != nil {
+		options["top_p"] = *topP
+	}
+	if topK != nil {
+		options["top_k"] = *topK
+	}
+	if repeatPenalty != nil {
+		options["repeat_penalty"] = *repeatPenalty
+	}
+	if tfsZ != nil {
+		options["tfs_z"] = *tfsZ
+	}
+}
+
+// finishReason maps Ollama's done_reason to a finish reason. Ollama reports
+// "stop" both at the model's end token and at a stop sequence, which is the
+// model finishing either way. Without a done_reason, a generation that used
+// all of num_predict is taken to have hit the limit.
+func finishReason(doneReason string, evalCount, numPredict int) string {
+	switch doneReason {
+	case "length":
+		return models.FinishLength
+	case "stop":
+		return models.FinishEnd
+	case "":
+		if numPredict > 0 && evalCount >= numPredict {
+			return models.FinishLength
+		}
+		return models.FinishEnd
+	default:
+		// e.g. "unload", when the model was unloaded mid-generation
+		return models.FinishStop
+	}
+}
+
+// MaxLogprobs is the most alternatives per token a request may ask for
+const MaxLogprobs = 20
+
+// requestLogprobs asks Ollama for the generated tokens' log probabilities when
+// the request wants them. Ollama versions without logprobs ignore the fields
+// and the response simply has none.
+func requestLogprobs(payload map[string]interface{}, req models.ChatRequest) {
+	if req.Logprobs == nil {
+		return
+	}
+	payload["logprobs"] = true
+	if *req.Logprobs > 0 {
+		payload["top_logprobs"] = *req.Logprobs
+	}
+}
+
+// FormatJSON is the request format constraining the reply to JSON
+const FormatJSON = "json"
+
+// requestFormat asks Ollama to constrain the reply to the request's format
+func requestFormat(payload map[string]interface{}, req models.ChatRequest) {
+	if req.Format != "" {
+		payload["format"] = req.Format
+	}
+}
+
+// ExplainRequest returns the model, API and fully merged options a generation
+// for req would be sent with, so option layering can be inspected
+func ExplainRequest(req models.ChatRequest, containerName string) models.ChatExplanation {
+	endpoint := "/api/generate"
+	if len(req.Tools) > 0 || req.SessionID != "" {
+		endpoint = "/api/chat"
+	}
+	return models.ChatExplanation{
+		Model:    ModelForContainer(containerName),
+		Endpoint: endpoint,
+		Options:  requestOptions(req, ModelForContainer(containerName)),
+	}
+}
+
+// chatMessages returns the conversation history followed by the new user
+// message, led by the system prompt when one is given
+func chatMessages(req models.ChatRequest, system string) []models.OllamaChatMessage {
+	messages := make([]models.OllamaChatMessage, 0, len(req.History)+2)
+	if system != "" {
+		messages = append(messages, models.OllamaChatMessage{Role: "system", Content: system})
+	}
+	messages = append(messages, req.History...)
+	return append(messages, models.OllamaChatMessage{Role: "user", Content: req.Message, Images: req.Images})
+}
+
+// systemPrompt returns the system prompt to send with req, or "" to leave the
+// model's own in place. A reply language is asked for by appending to the
+// Modelfile's SYSTEM prompt, since a system prompt sent with the request
+// replaces it.
+func (os *OllamaService) systemPrompt(req models.ChatRequest, containerName string) string {
+	language, ok := utils.LanguageName(req.Lang)
+	if !ok {
+		return ""
+	}
+	instruction := "Respond in " + language + "."
+
+	showResp, err := os.show(containerName)
+	if err != nil {
+		log.Printf("Failed to read the system prompt of %s, sending only the language instruction: %v", containerName, err)
+		return instruction
+	}
+	if system := strings.TrimSpace(showResp.System); system != "" {
+		return system + "\n\n" + instruction
+	}
+	return instruction
 }
 
 // SendMessage sends a message to the Ollama model and returns the response
-func (os *OllamaService) SendMessage(message, containerName string) (string, error) {
-	// Optimized HTTP client with connection pooling and aggressive timeout
-	client := &http.Client{
-		Timeout: 15 * time.Second, // Aggressive timeout for sub-6s responses
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			MaxIdleConnsPerHost: 10,
-			IdleConnTimeout:     30 * time.Second,
-		},
+func (os *OllamaService) SendMessage(req models.ChatRequest, containerName string) (string, error) {
+	ollamaResp, err := os.Generate(context.Background(), req, containerName)
+	if err != nil {
+		return "", err
 	}
+	return ollamaResp.Response, nil
+}
+
+// Generate runs a non-streaming generation and returns Ollama's full
+// response, including stats. It is abandoned when ctx is done.
+func (os *OllamaService) Generate(ctx context.Context, req models.ChatRequest, containerName string) (models.OllamaResponse, error) {
+	var ollamaResp models.OllamaResponse
 
 	// Extract model name from container name
-	modelName := strings.TrimSuffix(strings.TrimPrefix(containerName, "ollama-"), "-container")
+	modelName := ModelForContainer(containerName)
+
+	ctx, done := trackGeneration(ctx)
+	defer done()
+	ctx, cancel := context.WithTimeout(ctx, GenerationTimeout(modelName))
+	defer cancel()
 
 	// Optimized payload with performance parameters
+	options := requestOptions(req, modelName)
 	payload := map[string]interface{}{
-		"model":  modelName,
-		"prompt": message,
-		"stream": false,
-		"options": map[string]interface{}{
-			"num_predict":    250,   // Reduced for sub-6s responses
-			"temperature":    0.2,   // Much lower for faster, focused responses
-			"top_p":          0.7,   // More focused sampling
-			"top_k":          15,    // Limit vocabulary for speed
-			"num_ctx":        512,   // Much smaller context for speed
-			"num_batch":      128,   // Smaller batch for faster processing
-			"num_gpu":        1,     // Use GPU if available
-			"low_vram":       false, // Don't limit VRAM usage for speed
-			"f16_kv":         true,  // Use FP16 for key-value cache (faster)
-			"use_mlock":      true,  // Keep model in memory
-			"use_mmap":       true,  // Memory-mapped model loading
-			"repeat_penalty": 1.05,  // Minimal penalty for speed
-			"tfs_z":          0.95,  // Tail free sampling for speed
-		},
-	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return "", err
+		"model":   modelName,
+		"prompt":  req.Message,
+		"stream":  false,
+		"options": options,
+	}
+
+	if len(req.Images) > 0 {
+		payload["images"] = req.Images
+	}
+	requestLogprobs(payload, req)
+	requestFormat(payload, req)
+	if system := os.systemPrompt(req, containerName); system != "" {
+		payload["system"] = system
 	}
 
 	// Use container name for internal Docker networking
-	url := fmt.Sprintf("http://%s:11434/api/generate", containerName)
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := os.postGeneration(ctx, ollamaURL(containerName, "/api/generate"), payload)
 	if err != nil {
-		return "", err
+		return ollamaResp, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ollama API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return ollamaResp, generationErr(ctx, err)
 	}
 
-	var ollamaResp models.OllamaResponse
 	if err := json.Unmarshal(body, &ollamaResp); err != nil {
-		return "", err
+		return ollamaResp, err
 	}
 
-	return ollamaResp.Response, nil
+	numPredict, _ := options["num_predict"].(int)
+	ollamaResp.FinishReason = finishReason(ollamaResp.DoneReason, ollamaResp.EvalCount, numPredict)
+	return ollamaResp, nil
+}
+
+// SendChat sends the message through Ollama's /api/chat, which supports tool
+// calling. It is abandoned when ctx is done.
+func (os *OllamaService) SendChat(ctx context.Context, req models.ChatRequest, containerName string) (models.OllamaChatResponse, error) {
+	var chatResp models.OllamaChatResponse
+
+	// Extract model name from container name
+	modelName := ModelForContainer(containerName)
+
+	ctx, done := trackGeneration(ctx)
+	defer done()
+	ctx, cancel := context.WithTimeout(ctx, GenerationTimeout(modelName))
+	defer cancel()
+
+	options := requestOptions(req, modelName)
+	payload := map[string]interface{}{
+		"model":    modelName,
+		"messages": chatMessages(req, os.systemPrompt(req, containerName)),
+		"stream":   false,
+		"options":  options,
+	}
+	if len(req.Tools) > 0 {
+		payload["tools"] = req.Tools
+	}
+	requestLogprobs(payload, req)
+	requestFormat(payload, req)
+
+	resp, err := os.postGeneration(ctx, ollamaURL(containerName, "/api/chat"), payload)
+	if err != nil {
+		return chatResp, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return chatResp, generationErr(ctx, err)
+	}
+	numPredict, _ := options["num_predict"].(int)
+	chatResp.FinishReason = finishReason(chatResp.DoneReason, chatResp.EvalCount, numPredict)
+	return chatResp, nil
+}
+
+// SendMessageStream sends a message and returns streaming response for faster UI updates.
+// The generation stops when ctx is cancelled, or when the consumer stops taking
+// chunks for longer than the configured stream stall timeout. Identical
+// requests with temperature 0 made while one is streaming share its generation.
+func (os *OllamaService) SendMessageStream(ctx context.Context, req models.ChatRequest, containerName string) (chan models.StreamChunk, chan error) {
+	if key, ok := flightKey(req, containerName); ok {
+		return os.joinStream(ctx, key, req, containerName)
+	}
+	return os.generateStream(ctx, req, containerName)
 }
 
-// SendMessageStream sends a message and returns streaming response for faster UI updates
-func (os *OllamaService) SendMessageStream(message, containerName string) (chan string, chan error) {
-	responseChan := make(chan string, 10)
+// generateStream runs one streamed generation for SendMessageStream
+func (os *OllamaService) generateStream(ctx context.Context, req models.ChatRequest, containerName string) (chan models.StreamChunk, chan error) {
+	responseChan := make(chan models.StreamChunk, 10)
 	errorChan := make(chan error, 1)
 
-	go func() {
+	lifecycle.Go("chat stream", ctx, func(ctx context.Context) {
 		defer close(responseChan)
 		defer close(errorChan)
 
-		// Optimized HTTP client for streaming
-		client := &http.Client{
-			Timeout: 15 * time.Second, // Aggressive timeout for sub-6s responses
-			Transport: &http.Transport{
-				MaxIdleConns:        10,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     30 * time.Second,
-			},
-		}
-
 		// Extract model name from container name
-		modelName := strings.TrimSuffix(strings.TrimPrefix(containerName, "ollama-"), "-container")
+		modelName := ModelForContainer(containerName)
+
+		ctx, done := trackGeneration(ctx)
+		defer done()
+		ctx, cancel := context.WithTimeout(ctx, GenerationTimeout(modelName))
+		defer cancel()
+
+		// send hands a chunk to the consumer, giving up once the request is
+		// gone or the consumer has stalled so the goroutine doesn't leak
+		stall := config.Get().StreamStallTimeout
+		send := func(chunk models.StreamChunk) bool {
+			timer := time.NewTimer(stall)
+			defer timer.Stop()
+			select {
+			case responseChan <- chunk:
+				return true
+			case <-ctx.Done():
+				errorChan <- generationErr(ctx, fmt.Errorf("stream aborted: %v", ctx.Err()))
+			case <-timer.C:
+				errorChan <- fmt.Errorf("stream aborted: client stopped reading for %v", stall)
+			}
+			return false
+		}
 
 		// Streaming payload with optimized parameters
+		options := requestOptions(req, modelName)
 		payload := map[string]interface{}{
-			"model":  modelName,
-			"prompt": message,
-			"stream": true, // Enable streaming
-			"options": map[string]interface{}{
-				"num_predict":    250,   // Reduced for sub-6s responses
-				"temperature":    0.2,   // Much lower for faster responses
-				"top_p":          0.7,   // More focused sampling
-				"top_k":          15,    // Limit vocabulary for speed
-				"num_ctx":        512,   // Much smaller context for speed
-				"num_batch":      128,   // Smaller batch for faster processing
-				"num_gpu":        1,     // Use GPU if available
-				"low_vram":       false, // Don't limit VRAM usage for speed
-				"f16_kv":         true,  // Use FP16 for key-value cache (faster)
-				"use_mlock":      true,  // Keep model in memory
-				"use_mmap":       true,  // Memory-mapped model loading
-				"repeat_penalty": 1.05,  // Minimal penalty for speed
-				"tfs_z":          0.95,  // Tail free sampling for speed
-			},
+			"model":   modelName,
+			"prompt":  req.Message,
+			"stream":  true, // Enable streaming
+			"options": options,
 		}
 
-		jsonData, err := json.Marshal(payload)
-		if err != nil {
-			errorChan <- err
-			return
+		if len(req.Images) > 0 {
+			payload["images"] = req.Images
+		}
+		requestLogprobs(payload, req)
+		requestFormat(payload, req)
+		system := os.systemPrompt(req, containerName)
+		if system != "" {
+			payload["system"] = system
 		}
 
-		url := fmt.Sprintf("http://%s:11434/api/generate", containerName)
-		resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+		// Conversations go through the chat API so the model sees the history
+		url := ollamaURL(containerName, "/api/generate")
+		if req.SessionID != "" {
+			delete(payload, "prompt")
+			delete(payload, "images")
+			delete(payload, "system")
+			payload["messages"] = chatMessages(req, system)
+			url = ollamaURL(containerName, "/api/chat")
+		}
+
+		resp, err := os.postGeneration(ctx, url, payload)
 		if err != nil {
 			errorChan <- err
 			return
 		}
 		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			errorChan <- fmt.Errorf("ollama API returned status %d: %s", resp.StatusCode, string(body))
-			return
-		}
-
-		// Read streaming response line by line
+		// Read streaming response line by line. Tokens are passed on as they
+		// come and not kept, the consumer holds on to the reply if it needs it.
 		decoder := json.NewDecoder(resp.Body)
-		var fullResponse strings.Builder
-
 		for decoder.More() {
-			var streamResp models.OllamaResponse
+			// Generate responses carry the token in response, chat responses in message.content
+			var streamResp struct {
+				models.OllamaResponse
+				Message models.OllamaChatMessage `json:"message"`
+			}
 			if err := decoder.Decode(&streamResp); err != nil {
-				errorChan <- err
+				errorChan <- generationErr(ctx, err)
 				return
 			}
 
-			if streamResp.Response != "" {
-				fullResponse.WriteString(streamResp.Response)
-				responseChan <- streamResp.Response
+			if token := streamResp.Response + streamResp.Message.Content; token != "" {
+				if !send(models.StreamChunk{Token: token, Logprobs: streamResp.Logprobs}) {
+					return
+				}
 			}
 
 			if streamResp.Done {
-				break
+				stats := streamResp.GenerationStats
+				numPredict, _ := options["num_predict"].(int)
+				send(models.StreamChunk{
+					Done:         true,
+					Stats:        &stats,
+					FinishReason: finishReason(streamResp.DoneReason, stats.EvalCount, numPredict),
+				})
+				return
 			}
 		}
 
 		// Send final complete response
-		responseChan <- fullResponse.String()
-	}()
+		send(models.StreamChunk{Done: true})
+	})
 
 	return responseChan, errorChan
 }
+
+// Benchmark measures generation throughput. One warm-up run loads the model
+// and reports the load time; the following runs are measured.
+func (os *OllamaService) Benchmark(containerName, prompt string, iterations int) (models.BenchmarkResult, error) {
+	result := models.BenchmarkResult{
+		Model:      ModelForContainer(containerName),
+		Prompt:     prompt,
+		Iterations: iterations,
+	}
+	req := models.ChatRequest{Message: prompt}
+
+	warmup, err := os.Generate(context.Background(), req, containerName)
+	if err != nil {
+		return result, fmt.Errorf("warm-up run failed: %v", err)
+	}
+	result.LoadTimeMs = float64(warmup.LoadDuration) / float64(time.Millisecond)
+
+	var total float64
+	for i := 0; i < iterations; i++ {
+		resp, err := os.Generate(context.Background(), req, containerName)
+		if err != nil {
+			return result, fmt.Errorf("run %d failed: %v", i+1, err)
+		}
+		if resp.EvalDuration <= 0 {
+			return result, fmt.Errorf("run %d returned no timing information", i+1)
+		}
+
+		tokensPerSecond := float64(resp.EvalCount) / time.Duration(resp.EvalDuration).Seconds()
+		result.Runs = append(result.Runs, models.BenchmarkRun{
+			EvalCount:       resp.EvalCount,
+			EvalDurationMs:  float64(resp.EvalDuration) / float64(time.Millisecond),
+			TokensPerSecond: tokensPerSecond,
+		})
+
+		total += tokensPerSecond
+		if i == 0 || tokensPerSecond < result.MinTokensPerSecond {
+			result.MinTokensPerSecond = tokensPerSecond
+		}
+		if tokensPerSecond > result.MaxTokensPerSecond {
+			result.MaxTokensPerSecond = tokensPerSecond
+		}
+	}
+	result.AvgTokensPerSecond = total / float64(iterations)
+
+	return result, nil
+}
+
+// Ping checks the container's Ollama server answers /api/tags, which neither
+// loads the model nor generates, and returns how long it took
+func (os *OllamaService) Ping(containerName string, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	url := ollamaURL(containerName, "/api/tags")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := os.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	latency := time.Since(start)
+
+	if resp.StatusCode != http.StatusOK {
+		return latency, fmt.Errorf("ollama API returned status %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
+// show returns Ollama's /api/show details for the container's model
+func (os *OllamaService) show(containerName string) (models.OllamaShowResponse, error) {
+	var showResp models.OllamaShowResponse
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	modelName := ModelForContainer(containerName)
+	jsonData, err := json.Marshal(map[string]string{"name": modelName})
+	if err != nil {
+		return showResp, err
+	}
+
+	url := ollamaURL(containerName, "/api/show")
+	resp, err := postJSON(ctx, os.client, url, jsonData)
+	if err != nil {
+		return showResp, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return showResp, fmt.Errorf("ollama API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&showResp)
+	return showResp, err
+}
+
+// IsMultimodal reports whether the container's model accepts images
+func (os *OllamaService) IsMultimodal(containerName string) (bool, error) {
+	support, err := os.Supports(containerName, models.CapabilityVision)
+	return support.Supported, err
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+func TestMaxTokensClampsNumPredict(t *testing.T) {
+	const model = "clamp-test"
+	containerName := "ollama-" + model + "-container"
+	registry.Update(model, func(record *models.ModelRecord) { record.Config.MaxTokens = 5 })
+	t.Cleanup(func() { registry.Delete(model) })
+
+	tests := []struct {
+		name       string
+		numPredict *int
+		want       int
+		clamped    int
+	}{
+		{"above the cap", intPtr(100), 5, 5},
+		{"below the cap", intPtr(3), 3, 0},
+		{"at the cap", intPtr(5), 5, 0},
+		{"unlimited", intPtr(-1), 5, 5},
+		{"until the context fills", intPtr(-2), 5, 5},
+		{"default", nil, 5, 5},
+	}
+	for _, tt := range tests {
+		req := models.ChatRequest{Message: "hi"}
+		if tt.numPredict != nil {
+			req.Options = &models.SamplingOptions{NumPredict: tt.numPredict}
+		}
+		if got := requestOptions(req, model)["num_predict"]; got != tt.want {
+			t.Errorf("%s: num_predict = %v, want %d", tt.name, got, tt.want)
+		}
+		if got := NumPredictClamp(req, containerName); got != tt.clamped {
+			t.Errorf("%s: NumPredictClamp = %d, want %d", tt.name, got, tt.clamped)
+		}
+	}
+}
+
+func TestNoMaxTokensLeavesNumPredict(t *testing.T) {
+	req := models.ChatRequest{Message: "hi", Options: &models.SamplingOptions{NumPredict: intPtr(100000)}}
+	if got := requestOptions(req, "unclamped-test")["num_predict"]; got != 100000 {
+		t.Errorf("num_predict = %v, want 100000", got)
+	}
+	if got := NumPredictClamp(req, "ollama-unclamped-test-container"); got != 0 {
+		t.Errorf("NumPredictClamp = %d, want 0", got)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// countingOllama starts a server answering every request with an empty JSON
+// object, returning its URL and a count of the connections opened to it
+func countingOllama(tb testing.TB) (string, *atomic.Int64) {
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	tb.Cleanup(server.Close)
+	return server.URL, &conns
+}
+
+// post sends one request with the client, reading the whole response so its
+// connection can be reused
+func post(tb testing.TB, client *http.Client, url string) {
+	resp, err := postJSON(context.Background(), client, url+"/api/generate", []byte(`{}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func TestOllamaTransportReusesConnections(t *testing.T) {
+	url, conns := countingOllama(t)
+	for i := 0; i < 20; i++ {
+		post(t, NewOllamaService().client, url)
+	}
+	if got := conns.Load(); got != 1 {
+		t.Errorf("20 requests opened %d connections, want 1", got)
+	}
+}
+
+// BenchmarkOllamaClient compares the transport shared by every OllamaService
+// with a client made for each call, reporting the connections each request
+// opens
+func BenchmarkOllamaClient(b *testing.B) {
+	b.Run("shared", func(b *testing.B) {
+		url, conns := countingOllama(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			post(b, NewOllamaService().client, url)
+		}
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+	b.Run("per-call", func(b *testing.B) {
+		url, conns := countingOllama(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			transport := &http.Transport{}
+			post(b, &http.Client{Transport: transport}, url)
+			transport.CloseIdleConnections()
+		}
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+}
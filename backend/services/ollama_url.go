@@ -0,0 +1,34 @@
+package services
+
+import (
+	"fmt"
+
+	"owngpt/config"
+	"owngpt/registry"
+)
+
+// OllamaBaseURL returns the base URL of the Ollama server in a model
+// container. The scheme and port come from the model's config when set, then
+// OWNGPT_OLLAMA_SCHEME and OWNGPT_OLLAMA_PORT. The container name is the host
+// on the Docker network. In local mode every model is served from OWNGPT_OLLAMA_URL.
+func OllamaBaseURL(containerName string) string {
+	cfg := config.Get()
+	if LocalMode() {
+		return cfg.OllamaURL
+	}
+	scheme, port := cfg.OllamaScheme, cfg.OllamaPort
+
+	modelConfig := registry.Get(ModelForContainer(containerName)).Config
+	if modelConfig.Scheme != "" {
+		scheme = modelConfig.Scheme
+	}
+	if modelConfig.Port > 0 {
+		port = modelConfig.Port
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, containerName, port)
+}
+
+// ollamaURL returns the URL of an Ollama API path such as /api/generate in a model container
+func ollamaURL(containerName, path string) string {
+	return OllamaBaseURL(containerName) + path
+}
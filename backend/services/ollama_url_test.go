@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/registry"
+)
+
+func TestOllamaBaseURL(t *testing.T) {
+	cfg := config.Get()
+	mode, scheme, port := cfg.Mode, cfg.OllamaScheme, cfg.OllamaPort
+	cfg.Mode, cfg.OllamaScheme, cfg.OllamaPort = "", "http", 11434
+	t.Cleanup(func() { cfg.Mode, cfg.OllamaScheme, cfg.OllamaPort = mode, scheme, port })
+
+	const model = "url-test"
+	containerName := "ollama-" + model + "-container"
+	t.Cleanup(func() { registry.Delete(model) })
+
+	if got, want := OllamaBaseURL(containerName), "http://"+containerName+":11434"; got != want {
+		t.Errorf("default URL = %q, want %q", got, want)
+	}
+
+	cfg.OllamaScheme, cfg.OllamaPort = "https", 8443
+	if got, want := ollamaURL(containerName, "/api/chat"), "https://"+containerName+":8443/api/chat"; got != want {
+		t.Errorf("URL from the environment = %q, want %q", got, want)
+	}
+
+	// The model's config wins over the environment, field by field
+	registry.Update(model, func(record *models.ModelRecord) { record.Config.Port = 9000 })
+	if got, want := OllamaBaseURL(containerName), "https://"+containerName+":9000"; got != want {
+		t.Errorf("URL with a model port = %q, want %q", got, want)
+	}
+	registry.Update(model, func(record *models.ModelRecord) { record.Config.Scheme = "http" })
+	if got, want := OllamaBaseURL(containerName), "http://"+containerName+":9000"; got != want {
+		t.Errorf("URL with a model scheme and port = %q, want %q", got, want)
+	}
+
+	useOllama(t, "http://127.0.0.1:11434")
+	if got := OllamaBaseURL(containerName); got != "http://127.0.0.1:11434" {
+		t.Errorf("local mode URL = %q, want OWNGPT_OLLAMA_URL", got)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OOMError is a model whose container the kernel killed for going over its
+// memory limit. Without it the failure shows up as a dropped connection.
+type OOMError struct {
+	Model string
+	// MemoryLimit is the container's limit in bytes, or 0 when it has none
+	MemoryLimit int64
+	// Err is the failure that led to the check
+	Err error
+}
+
+func (e *OOMError) Error() string {
+	limit := "its memory limit"
+	if e.MemoryLimit > 0 {
+		limit = fmt.Sprintf("its %s memory limit", formatSize(e.MemoryLimit))
+	}
+	return fmt.Sprintf("model %s ran out of memory and was killed by %s; give the container more memory or use a smaller model", e.Model, limit)
+}
+
+func (e *OOMError) Unwrap() error {
+	return e.Err
+}
+
+// containerInspect is the part of docker inspect's output OOM detection reads
+type containerInspect struct {
+	Created time.Time `json:"Created"`
+	State   struct {
+		Status    string `json:"Status"`
+		OOMKilled bool   `json:"OOMKilled"`
+		ExitCode  int    `json:"ExitCode"`
+	} `json:"State"`
+	HostConfig struct {
+		Memory int64 `json:"Memory"`
+	} `json:"HostConfig"`
+}
+
+// parseInspect reads the output of docker inspect for a single container
+func parseInspect(output []byte) (containerInspect, error) {
+	var inspected []containerInspect
+	if err := json.Unmarshal(output, &inspected); err != nil {
+		return containerInspect{}, fmt.Errorf("unexpected docker inspect output: %v", err)
+	}
+	if len(inspected) != 1 {
+		return containerInspect{}, fmt.Errorf("docker inspect returned %d containers, expected 1", len(inspected))
+	}
+	return inspected[0], nil
+}
+
+// OOMKilled reports whether the container, or the model runner inside it,
+// was killed by the out-of-memory killer since the given time, or at any
+// point in the container's life when since is zero. Containers run with
+// --restart unless-stopped and Docker clears State.OOMKilled when one starts
+// again, so the daemon's oom events are checked as well as the flag. It
+// returns nil when there's no sign of an OOM kill or the container can't be
+// inspected, and always in local mode.
+func (ds *DockerService) OOMKilled(containerName string, since time.Time) *OOMError {
+	if LocalMode() {
+		return nil
+	}
+	output, err := ds.run(ds.timeout, false, "docker", "inspect", containerName)
+	if err != nil {
+		return nil
+	}
+	inspected, err := parseInspect(output)
+	if err != nil {
+		return nil
+	}
+	if since.IsZero() {
+		since = inspected.Created
+	}
+	if !inspected.State.OOMKilled && !ds.oomEventSince(containerName, since) {
+		return nil
+	}
+	return &OOMError{Model: ModelForContainer(containerName), MemoryLimit: inspected.HostConfig.Memory}
+}
+
+// oomEventSince reports whether Docker recorded an oom event for the
+// container between since and now
+func (ds *DockerService) oomEventSince(containerName string, since time.Time) bool {
+	output, err := ds.run(ds.timeout, false, "docker", "events",
+		"--since", strconv.FormatInt(since.Unix(), 10),
+		"--until", strconv.FormatInt(time.Now().Unix()+1, 10),
+		"--filter", "container="+containerName,
+		"--filter", "event=oom",
+		"--format", "{{.Time}}")
+	return err == nil && strings.TrimSpace(string(output)) != ""
+}
+
+// ExplainFailure returns an *OOMError in place of the error of a generation
+// that started at start when the model's container was OOM-killed since
+// then, and err otherwise. Cancelled generations are left alone since they
+// didn't fail on the model's side.
+func (ds *DockerService) ExplainFailure(containerName string, start time.Time, err error) error {
+	if err == nil || errors.Is(err, ErrGenerationCancelled) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	if oom := ds.OOMKilled(containerName, start); oom != nil {
+		oom.Err = err
+		return oom
+	}
+	return err
+}
+
+// formatSize renders a memory limit in the units parseSize reads, e.g. "4GB"
+func formatSize(n int64) string {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	}
+	for _, unit := range units {
+		if n >= unit.size {
+			return strconv.FormatFloat(math.Round(float64(n)*10/float64(unit.size))/10, 'f', -1, 64) + unit.suffix
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const inspectRunning = `[{"Created":"2026-01-02T03:04:05.000000006Z","State":{"Status":"running","OOMKilled":false},"HostConfig":{"Memory":4294967296}}]`
+
+func TestOOMKilledFlag(t *testing.T) {
+	ds, _ := newFakeDockerService(map[string]string{
+		"docker inspect": `[{"State":{"Status":"exited","OOMKilled":true},"HostConfig":{"Memory":4294967296}}]`,
+		"docker events":  "",
+	})
+	oom := ds.OOMKilled("ollama-llama2-container", time.Now())
+	if oom == nil {
+		t.Fatal("OOM kill not detected from the container state")
+	}
+	if oom.Model != "llama2" || oom.MemoryLimit != 4<<30 {
+		t.Errorf("OOMError = %+v, want llama2 with a 4GB limit", oom)
+	}
+}
+
+func TestOOMKilledAfterRestart(t *testing.T) {
+	// The container restarted, clearing the flag, but the daemon saw the kill
+	ds, fake := newFakeDockerService(map[string]string{
+		"docker inspect": inspectRunning,
+		"docker events":  "1767323100\n",
+	})
+	start := time.Now().Add(-time.Minute)
+	if ds.OOMKilled("ollama-llama2-container", start) == nil {
+		t.Fatal("OOM kill before the restart not detected")
+	}
+	if fake.called("docker events --since "+itoa(start.Unix())) != 1 {
+		t.Errorf("oom events not read since the request start, calls: %v", fake.calls)
+	}
+}
+
+func TestOOMKilledSinceCreation(t *testing.T) {
+	ds, fake := newFakeDockerService(map[string]string{
+		"docker inspect": inspectRunning,
+		"docker events":  "",
+	})
+	if ds.OOMKilled("ollama-llama2-container", time.Time{}) != nil {
+		t.Error("OOM kill reported without a flag or event")
+	}
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if fake.called("docker events --since "+itoa(created.Unix())) != 1 {
+		t.Errorf("oom events not read since the container was created, calls: %v", fake.calls)
+	}
+}
+
+func TestExplainFailure(t *testing.T) {
+	ds, _ := newFakeDockerService(map[string]string{
+		"docker inspect": inspectRunning,
+		"docker events":  "1767323100\n",
+	})
+	cause := errors.New("connection reset by peer")
+	err := ds.ExplainFailure("ollama-llama2-container", time.Now(), cause)
+	var oom *OOMError
+	if !errors.As(err, &oom) || !errors.Is(err, cause) {
+		t.Fatalf("ExplainFailure = %v, want an OOMError wrapping the failure", err)
+	}
+
+	if err := ds.ExplainFailure("ollama-llama2-container", time.Now(), ErrGenerationCancelled); err != ErrGenerationCancelled {
+		t.Errorf("cancelled generation explained as %v", err)
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
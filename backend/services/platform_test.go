@@ -0,0 +1,81 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"owngpt/config"
+)
+
+func TestPullBaseImagePlatform(t *testing.T) {
+	cfg := config.Get()
+	image, version, platform := cfg.BaseImage, cfg.OllamaVersion, cfg.Platform
+	cfg.BaseImage, cfg.OllamaVersion, cfg.Platform = "ollama/ollama", "0.1.32", "linux/arm64"
+	t.Cleanup(func() { cfg.BaseImage, cfg.OllamaVersion, cfg.Platform = image, version, platform })
+
+	var lines []string
+	failures := map[string]string{"docker image inspect": "Error: No such image: ollama/ollama:0.1.32"}
+	if _, err := failingDocker(failures).PullBaseImage(func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0] != "docker pull --platform linux/arm64 ollama/ollama:0.1.32" {
+		t.Errorf("pulled with %q, want the arm64 image", lines)
+	}
+}
+
+func TestBuildArgsPlatform(t *testing.T) {
+	got := strings.Join(buildArgs("/ctx", "ollama-llama2", BuildOptions{Platform: "linux/arm64", NoCache: true}), " ")
+	if want := "build -t ollama-llama2 --platform linux/arm64 --no-cache /ctx"; got != want {
+		t.Errorf("buildArgs = %q, want %q", got, want)
+	}
+}
+
+func TestRunDockerContainerPlatform(t *testing.T) {
+	ds, fake := newFakeDockerService(map[string]string{
+		psPorts:      "",
+		"docker rm":  "",
+		"docker run": "abc123",
+	})
+	for _, platform := range []string{"linux/arm64", ""} {
+		if err := ds.RunDockerContainer("ollama-llama2", "ollama-llama2-container", "11434", platform, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var runs []string
+	for _, line := range fake.calls {
+		if strings.HasPrefix(line, "docker run") {
+			runs = append(runs, line)
+		}
+	}
+	if len(runs) != 2 {
+		t.Fatalf("ran %q, want two containers", runs)
+	}
+	if want := "--platform linux/arm64 --label owngpt.platform=linux/arm64"; !strings.Contains(runs[0], want) {
+		t.Errorf("docker run = %q, want %q", runs[0], want)
+	}
+	// Without one docker picks the platform and nothing is recorded
+	if strings.Contains(runs[1], "platform") {
+		t.Errorf("docker run = %q, want no platform", runs[1])
+	}
+}
+
+func TestInstalledModelPlatform(t *testing.T) {
+	ds, _ := newFakeDockerService(map[string]string{
+		"docker ps -a": "ollama-llama2-container\tUp 5 minutes\t\tllama2\towngpt.managed=true,owngpt.platform=linux/arm64\n" +
+			"ollama-mistral-container\tUp 5 minutes\t\tmistral\towngpt.managed=true\n",
+	})
+	installed, err := ds.GetInstalledModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"llama2": "linux/arm64", "mistral": ""}
+	if len(installed) != len(want) {
+		t.Fatalf("installed = %+v, want %d models", installed, len(want))
+	}
+	for _, model := range installed {
+		if model.Platform != want[model.Name] {
+			t.Errorf("%s: platform %q, want %q", model.Name, model.Platform, want[model.Name])
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+const psPorts = "docker ps --format {{.Names}}\t{{.Ports}}"
+
+func TestPublishesHostPort(t *testing.T) {
+	tests := []struct {
+		ports string
+		port  string
+		want  bool
+	}{
+		{"0.0.0.0:11434->11434/tcp, :::11434->11434/tcp", "11434", true},
+		{"0.0.0.0:11435->11434/tcp", "11434", false},
+		{"[::]:8080->80/tcp", "8080", true},
+		{"0.0.0.0:8000-8005->8000-8005/tcp", "8003", true},
+		{"0.0.0.0:8000-8005->8000-8005/tcp", "8006", false},
+		{"11434/tcp", "11434", false},
+		{"", "11434", false},
+	}
+	for _, tt := range tests {
+		if got := publishesHostPort(tt.ports, tt.port); got != tt.want {
+			t.Errorf("publishesHostPort(%q, %s) = %v, want %v", tt.ports, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestRunDockerContainerPortConflict(t *testing.T) {
+	ds, fake := newFakeDockerService(map[string]string{
+		psPorts:      "someone-else\t0.0.0.0:11434->11434/tcp\nollama-llama2-container\t0.0.0.0:11435->11434/tcp\n",
+		"docker rm":  "",
+		"docker run": "abc123",
+	})
+
+	err := ds.RunDockerContainer("ollama-mistral", "ollama-mistral-container", "11434", "", nil)
+	var portErr *PortInUseError
+	if !errors.As(err, &portErr) || portErr.Port != "11434" || portErr.Container != "someone-else" {
+		t.Fatalf("err = %v, want the port in use by someone-else", err)
+	}
+	if fake.called("docker run") != 0 || fake.called("docker rm") != 0 {
+		t.Error("the container was touched despite the conflict")
+	}
+
+	// A container may take back the port it publishes itself
+	if err := ds.RunDockerContainer("ollama-llama2", "ollama-llama2-container", "11435", "", nil); err != nil {
+		t.Fatalf("rerunning on its own port: %v", err)
+	}
+	if fake.called("docker run") != 1 {
+		t.Error("the container wasn't run")
+	}
+}
+
+func TestFreeHostPortSkipsPublishedPorts(t *testing.T) {
+	ds, _ := newFakeDockerService(map[string]string{
+		psPorts: "a\t0.0.0.0:11434->11434/tcp\nb\t0.0.0.0:11435-11437->11434/tcp\n",
+	})
+	if port, err := ds.FreeHostPort("ollama-llama2-container"); err != nil || port != "11438" {
+		t.Errorf("FreeHostPort = %s, %v, want 11438", port, err)
+	}
+
+	broken, _ := newFakeDockerService(nil)
+	if _, err := broken.FreeHostPort("ollama-llama2-container"); err == nil {
+		t.Error("FreeHostPort succeeded without listing containers")
+	}
+}
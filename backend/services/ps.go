@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"owngpt/models"
+)
+
+// SameModel reports whether a model name Ollama lists, such as "llama2:latest",
+// is the given model. Names without a tag are listed with the implicit :latest.
+func SameModel(listed, model string) bool {
+	model = strings.ToLower(model)
+	return listed == model || (!strings.Contains(model, ":") && listed == model+":latest")
+}
+
+// LoadedModels returns the models a container's Ollama server holds in memory,
+// from its /api/ps, which is empty once keep-alive has unloaded them
+func (os *OllamaService) LoadedModels(containerName string) ([]models.LoadedModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ollamaURL(containerName, "/api/ps"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := os.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama API returned status %d", resp.StatusCode)
+	}
+
+	var ps struct {
+		Models []models.LoadedModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return nil, err
+	}
+	if ps.Models == nil {
+		ps.Models = []models.LoadedModel{}
+	}
+	return ps.Models, nil
+}
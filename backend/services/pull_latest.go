@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"owngpt/config"
+)
+
+// ModelDigest returns the digest of the model's weights in a container's
+// Ollama server, which changes when a pull fetches updated layers
+func (os *OllamaService) ModelDigest(containerName, model string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ollamaURL(containerName, "/api/tags"), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := os.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ollama API returned status %d", resp.StatusCode)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name   string `json:"name"`
+			Digest string `json:"digest"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return "", err
+	}
+
+	for _, m := range tags.Models {
+		if SameModel(m.Name, model) {
+			return m.Digest, nil
+		}
+	}
+	return "", fmt.Errorf("model %s is not in the container's Ollama server", model)
+}
+
+// PullModelInContainer runs ollama pull inside a model's running container,
+// fetching any layers updated upstream without rebuilding the image. Each
+// line of pull output is passed to onLine. A failed pull that may pass is
+// tried up to OWNGPT_PULL_ATTEMPTS times, with a line announcing each retry,
+// until ctx is done.
+func (ds *DockerService) PullModelInContainer(ctx context.Context, containerName, model string, onLine func(line string)) (err error) {
+	start := time.Now()
+	defer func() { observeDockerOperation("pull_latest", model, start, err) }()
+
+	attempts := config.Get().PullAttempts
+	for attempt := 1; ; attempt++ {
+		// ollama pull exits with a status, the reason is in its last line
+		var last string
+		logs := newLineWriter(os.Stdout, func(line string) {
+			last = line
+			if onLine != nil {
+				onLine(line)
+			}
+		})
+		_, err = ds.runTo(config.Get().PullTimeout, logs, logs, "docker", "exec", containerName, "ollama", "pull", model)
+		logs.Flush()
+		if err == nil {
+			return nil
+		}
+		if last != "" {
+			err = fmt.Errorf("%v: %s", err, last)
+		}
+		if attempt >= attempts || !retryablePull(ctx, err) {
+			if attempt > 1 {
+				return fmt.Errorf("ollama pull failed after %d attempts: %v", attempt, err)
+			}
+			return fmt.Errorf("ollama pull failed: %v", err)
+		}
+		if onLine != nil {
+			onLine(fmt.Sprintf("Pull failed, retrying in %v (attempt %d of %d)", pullBackoff(attempt+1), attempt+1, attempts))
+		}
+		if !waitToRetry(ctx, attempt+1) {
+			return fmt.Errorf("ollama pull failed: %v", err)
+		}
+	}
+}
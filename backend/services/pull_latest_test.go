@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"owngpt/config"
+)
+
+// scriptedPulls is a docker CLI whose ollama pulls run each shell script in
+// turn, the last one for every pull after it
+type scriptedPulls struct {
+	mu      sync.Mutex
+	scripts []string
+	pulls   int
+}
+
+func (s *scriptedPulls) run(ctx context.Context, name string, args ...string) *exec.Cmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	script := s.scripts[min(s.pulls, len(s.scripts)-1)]
+	s.pulls++
+	return exec.CommandContext(ctx, "sh", "-c", script)
+}
+
+// setPullRetries sets OWNGPT_PULL_ATTEMPTS and OWNGPT_PULL_RETRY_BACKOFF for the test
+func setPullRetries(t *testing.T, attempts int, backoff time.Duration) {
+	cfg := config.Get()
+	previousAttempts, previousBackoff := cfg.PullAttempts, cfg.PullRetryBackoff
+	cfg.PullAttempts, cfg.PullRetryBackoff = attempts, backoff
+	t.Cleanup(func() { cfg.PullAttempts, cfg.PullRetryBackoff = previousAttempts, previousBackoff })
+}
+
+func TestPullModelInContainerRetries(t *testing.T) {
+	setPullRetries(t, 3, time.Millisecond)
+	pulls := &scriptedPulls{scripts: []string{
+		"echo pulling manifest; echo 'Error: connection reset by peer' >&2; exit 1",
+		"echo success",
+	}}
+	ds := NewDockerServiceWithRunner(pulls.run)
+
+	var lines []string
+	err := ds.PullModelInContainer(context.Background(), "ollama-llama2-container", "llama2", func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatalf("PullModelInContainer: %v", err)
+	}
+	if pulls.pulls != 2 {
+		t.Errorf("pulled %d times, want 2", pulls.pulls)
+	}
+	if !strings.Contains(strings.Join(lines, "\n"), "retrying in 1ms (attempt 2 of 3)") {
+		t.Errorf("lines = %q, want a retry announced", lines)
+	}
+}
+
+func TestPullModelInContainerMissingModel(t *testing.T) {
+	setPullRetries(t, 3, time.Millisecond)
+	pulls := &scriptedPulls{scripts: []string{"echo 'Error: pull model manifest: file does not exist' >&2; exit 1"}}
+	ds := NewDockerServiceWithRunner(pulls.run)
+
+	err := ds.PullModelInContainer(context.Background(), "ollama-llama9-container", "llama9", func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "file does not exist") {
+		t.Fatalf("err = %v, want the pull's reason", err)
+	}
+	if pulls.pulls != 1 {
+		t.Errorf("pulled %d times, want 1 for a model that doesn't exist", pulls.pulls)
+	}
+}
+
+func TestPullModelInContainerStopsWhenRequestGoes(t *testing.T) {
+	setPullRetries(t, 3, time.Hour)
+	pulls := &scriptedPulls{scripts: []string{"echo 'Error: connection reset by peer' >&2; exit 1"}}
+	ds := NewDockerServiceWithRunner(pulls.run)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ds.PullModelInContainer(ctx, "ollama-llama2-container", "llama2", func(line string) {
+			if strings.HasPrefix(line, "Pull failed, retrying") {
+				cancel()
+			}
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || pulls.pulls != 1 {
+			t.Errorf("err = %v after %d pulls, want a failure after 1", err, pulls.pulls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("PullModelInContainer kept waiting after the request went away")
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"owngpt/config"
+)
+
+// pullRetryStatus is the status reported while waiting to pull again after a
+// failed attempt, the same "retrying 2/3" the container startup script writes
+func pullRetryStatus(attempt, attempts int) string {
+	return fmt.Sprintf("retrying %d/%d", attempt, attempts)
+}
+
+// ParsePullRetry reads the coming attempt and the most attempts from a
+// "retrying <attempt>/<attempts>" pull status
+func ParsePullRetry(status string) (attempt, attempts int, ok bool) {
+	if _, err := fmt.Sscanf(status, "retrying %d/%d", &attempt, &attempts); err != nil {
+		return 0, 0, false
+	}
+	return attempt, attempts, true
+}
+
+// pullBackoff returns the wait before a pull's attempt, from the second on:
+// OWNGPT_PULL_RETRY_BACKOFF, doubling for each attempt after that
+func pullBackoff(attempt int) time.Duration {
+	return config.Get().PullRetryBackoff << max(attempt-2, 0)
+}
+
+// retryablePull reports whether a failed pull is worth trying again. Models
+// that don't exist and pulls that ran out of time fail the same way again.
+func retryablePull(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *localStatusError
+	if errors.As(err, &statusErr) && statusErr.status == 404 {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	return !strings.Contains(message, "file does not exist") && !strings.Contains(message, "not found")
+}
+
+// waitToRetry sleeps before the next pull attempt, returning false if the
+// context ends first
+func waitToRetry(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(pullBackoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
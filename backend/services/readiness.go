@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"owngpt/config"
+	"owngpt/utils"
+)
+
+// Readiness phases a new model container goes through
+const (
+	phaseServer = "server start"
+	phasePull   = "pull"
+	phaseLoad   = "load"
+)
+
+// minPullTimeout is the least time a pull is given, whatever the model size
+const minPullTimeout = 2 * time.Minute
+
+// ReadyTimeouts bounds each phase of waiting for a model container
+type ReadyTimeouts struct {
+	// ServerUp is how long Ollama may take to answer on the container
+	ServerUp time.Duration
+	// Pull is how long the model download may take
+	Pull time.Duration
+	// Load is how long the warm-up generation may take to load the model
+	Load time.Duration
+}
+
+func (t ReadyTimeouts) forPhase(phase string) time.Duration {
+	switch phase {
+	case phasePull:
+		return t.Pull
+	case phaseLoad:
+		return t.Load
+	default:
+		return t.ServerUp
+	}
+}
+
+// ReadyTimeoutError reports which readiness phase ran out of time
+type ReadyTimeoutError struct {
+	Phase   string
+	Elapsed time.Duration
+}
+
+func (e *ReadyTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %v", e.Phase, e.Elapsed.Round(time.Second))
+}
+
+// ReadyTimeoutsFor returns the readiness timeouts for a model. The pull timeout
+// grows with the model's listed size, assuming at least OWNGPT_PULL_MIN_BANDWIDTH;
+// models of unknown size get OWNGPT_PULL_TIMEOUT.
+func (ds *DockerService) ReadyTimeoutsFor(modelName string) ReadyTimeouts {
+	cfg := config.Get()
+	timeouts := ReadyTimeouts{
+		ServerUp: cfg.ReadyServerTimeout,
+		Pull:     cfg.PullTimeout,
+		Load:     cfg.LoadTimeout,
+	}
+
+	availableModels, err := ds.GetAvailableModels()
+	if err != nil {
+		return timeouts
+	}
+	name := utils.NormalizeModelName(modelName)
+	for _, model := range availableModels {
+		if utils.NormalizeModelName(model.Name) != name {
+			continue
+		}
+		if size, ok := parseSize(model.Size); ok && cfg.PullMinBandwidth > 0 {
+			timeouts.Pull = minPullTimeout + time.Duration(size/cfg.PullMinBandwidth)*time.Second
+		}
+		break
+	}
+	return timeouts
+}
+
+// parseSize reads sizes such as "4.1GB", "900 MB" or "3.8GiB" as bytes
+func parseSize(size string) (int64, bool) {
+	size = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(size), " ", ""))
+	size = strings.Replace(size, "IB", "B", 1)
+
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+	for _, unit := range units {
+		if !strings.HasSuffix(size, unit.suffix) {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSuffix(size, unit.suffix), 64)
+		if err != nil || value <= 0 {
+			return 0, false
+		}
+		return int64(value * unit.multiplier), true
+	}
+	return 0, false
+}
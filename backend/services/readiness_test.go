@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+		ok   bool
+	}{
+		{"4.5GB", 9 << 29, true},
+		{"900 MB", 900 << 20, true},
+		{"1.5GiB", 3 << 29, true},
+		{"512kb", 512 << 10, true},
+		{"1TB", 1 << 40, true},
+		{"0GB", 0, false},
+		{"big", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSize(tt.size)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseSize(%q) = %d, %v, want %d, %v", tt.size, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWaitForModelReadyPhases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models":[]}`))
+	}))
+	t.Cleanup(server.Close)
+	useOllama(t, server.URL)
+
+	const state = "docker inspect -f {{.State.Status}}"
+	long := ReadyTimeouts{ServerUp: time.Minute, Pull: time.Minute, Load: time.Minute}
+	tests := []struct {
+		name    string
+		outputs map[string]string
+		// execErr fails reading the pull status file with this stderr
+		execErr  string
+		timeouts ReadyTimeouts
+		want     string
+		phase    string
+	}{
+		{"pulled", map[string]string{state: "running", "docker exec": "success"}, "", long, "", ""},
+		{"no status file", map[string]string{state: "running"}, "cat: can't open '/tmp/owngpt-pull-status': No such file or directory", long, "", ""},
+		// Failing to read the file doesn't make the model ready
+		{"status unreadable", map[string]string{state: "running"}, "Error response from daemon: context deadline exceeded", ReadyTimeouts{ServerUp: time.Millisecond, Pull: time.Minute, Load: time.Minute}, "server start timed out", phaseServer},
+		{"pull failed", map[string]string{state: "running", "docker exec": "failed: disk full"}, "", long, "model pull failed: disk full", ""},
+		{"container exited", map[string]string{state: "exited"}, "", long, "model container is exited", ""},
+		{"pull too slow", map[string]string{state: "running", "docker exec": "pulling"}, "", ReadyTimeouts{ServerUp: time.Minute, Pull: time.Millisecond, Load: time.Minute}, "pull timed out", phasePull},
+		{"load too slow", map[string]string{state: "running", "docker exec": "warming_up"}, "", ReadyTimeouts{ServerUp: time.Minute, Pull: time.Minute, Load: time.Millisecond}, "load timed out", phaseLoad},
+	}
+	for i, tt := range tests {
+		i, tt := i, tt
+		t.Run(tt.name, func(t *testing.T) {
+			// The timeouts are only checked every 2s, so wait on them together
+			t.Parallel()
+			ds, _ := newFakeDockerService(tt.outputs)
+			if tt.execErr != "" {
+				run := ds.runCommand
+				ds.runCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+					if len(args) > 0 && args[0] == "exec" {
+						return exec.CommandContext(ctx, "sh", "-c", `printf '%s\n' "$1" >&2; exit 1`, "sh", tt.execErr)
+					}
+					return run(ctx, name, args...)
+				}
+			}
+			var statuses []string
+			err := ds.WaitForModelReadyProgress(fmt.Sprintf("ollama-ready%d-container", i), tt.timeouts, func(status string, percent int) {
+				statuses = append(statuses, status)
+			})
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want ready", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+			var timeoutErr *ReadyTimeoutError
+			if (tt.phase != "") != errors.As(err, &timeoutErr) || (timeoutErr != nil && timeoutErr.Phase != tt.phase) {
+				t.Errorf("err = %#v, want a timeout in phase %q", err, tt.phase)
+			}
+			if tt.phase != "" && tt.phase != phaseServer && len(statuses) == 0 {
+				t.Error("no progress was reported before the timeout")
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// endlessOllama streams tokens until the request goes away, which it reports on gone
+func endlessOllama(t *testing.T) (gone chan struct{}) {
+	gone = make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/generate" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				close(gone)
+				return
+			case <-time.After(time.Millisecond):
+			}
+			encoder.Encode(map[string]interface{}{"response": "token ", "done": false})
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+	useOllama(t, server.URL)
+	return gone
+}
+
+// setStallTimeout sets OWNGPT_STREAM_STALL_TIMEOUT for the test
+func setStallTimeout(t *testing.T, stall time.Duration) {
+	cfg := config.Get()
+	previous := cfg.StreamStallTimeout
+	cfg.StreamStallTimeout = stall
+	t.Cleanup(func() { cfg.StreamStallTimeout = previous })
+}
+
+// waitGone waits for the generation's request to Ollama to be cancelled
+func waitGone(t *testing.T, gone chan struct{}) {
+	select {
+	case <-gone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the generation kept running")
+	}
+}
+
+func TestStreamAbortsWhenClientStalls(t *testing.T) {
+	gone := endlessOllama(t)
+	setStallTimeout(t, 50*time.Millisecond)
+
+	responses, errs := NewOllamaService().SendMessageStream(context.Background(), models.ChatRequest{Message: "stall test"}, "ollama-stream-container")
+	<-responses
+
+	// Nothing more is read, so the stream gives up once its buffer is full
+	select {
+	case err := <-errs:
+		if err == nil || !strings.Contains(err.Error(), "client stopped reading for 50ms") {
+			t.Errorf("err = %v, want a stall", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stalled stream never gave up")
+	}
+	waitGone(t, gone)
+}
+
+func TestStreamAbortsWhenRequestGoes(t *testing.T) {
+	gone := endlessOllama(t)
+	setStallTimeout(t, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	responses, errs := NewOllamaService().SendMessageStream(ctx, models.ChatRequest{Message: "disconnect test"}, "ollama-stream-container")
+	<-responses
+	cancel()
+
+	// Drain what was already sent until the stream ends
+	for range responses {
+	}
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("err = %v, want the request's cancellation", err)
+	}
+	waitGone(t, gone)
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"owngpt/config"
+	"owngpt/lifecycle"
+	"owngpt/models"
+)
+
+var (
+	flightsMu sync.Mutex
+	// flights are the deterministic streamed generations in progress, keyed by flightKey
+	flights = make(map[string]*streamFlight)
+)
+
+// streamFlight is one streamed generation shared by every identical request
+// made while it runs. Chunks are kept so a late joiner gets the whole stream.
+type streamFlight struct {
+	key    string
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	chunks      []models.StreamChunk
+	finished    bool
+	err         error
+	subscribers int
+}
+
+// flightKey identifies what a streamed request would generate. Only requests
+// with temperature 0 are deterministic enough to share a generation, so others
+// report false.
+func flightKey(req models.ChatRequest, containerName string) (string, bool) {
+	options := requestOptions(req, ModelForContainer(containerName))
+	if temperature, _ := options["temperature"].(float64); temperature != 0 {
+		return "", false
+	}
+
+	data, err := json.Marshal(struct {
+		Container string
+		Message   string
+		Images    []string
+		History   []models.OllamaChatMessage
+		Lang      string
+		Logprobs  *int
+		Format    string
+		Options   map[string]interface{}
+	}{containerName, req.Message, req.Images, req.History, req.Lang, req.Logprobs, req.Format, options})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// joinStream attaches to the identical generation in flight, or starts one.
+// The generation isn't tied to any one request: it stops early only when every
+// request has gone.
+func (os *OllamaService) joinStream(ctx context.Context, key string, req models.ChatRequest, containerName string) (chan models.StreamChunk, chan error) {
+	flightsMu.Lock()
+	flight, ok := flights[key]
+	if ok {
+		flight.mu.Lock()
+		flight.subscribers++
+		flight.mu.Unlock()
+		log.Printf("Joining an identical generation in flight on %s", containerName)
+	} else {
+		var flightCtx context.Context
+		flight = &streamFlight{key: key, subscribers: 1}
+		flight.cond = sync.NewCond(&flight.mu)
+		flightCtx, flight.cancel = context.WithCancel(context.Background())
+		flights[key] = flight
+		lifecycle.Go("shared chat stream", flightCtx, func(ctx context.Context) {
+			os.runFlight(ctx, flight, req, containerName)
+		})
+	}
+	flightsMu.Unlock()
+
+	return flight.subscribe(ctx)
+}
+
+// runFlight runs the shared generation, recording its chunks and outcome for
+// the subscribers
+func (os *OllamaService) runFlight(ctx context.Context, flight *streamFlight, req models.ChatRequest, containerName string) {
+	defer flight.cancel()
+
+	responseChan, errorChan := os.generateStream(ctx, req, containerName)
+	var err error
+	for responseChan != nil || errorChan != nil {
+		select {
+		case chunk, ok := <-responseChan:
+			if !ok {
+				responseChan = nil
+				continue
+			}
+			flight.mu.Lock()
+			flight.chunks = append(flight.chunks, chunk)
+			flight.cond.Broadcast()
+			flight.mu.Unlock()
+		case e, ok := <-errorChan:
+			if !ok {
+				errorChan = nil
+				continue
+			}
+			if e != nil {
+				err = e
+			}
+		}
+	}
+
+	// New requests start a fresh generation from here on
+	flightsMu.Lock()
+	if flights[flight.key] == flight {
+		delete(flights, flight.key)
+	}
+	flightsMu.Unlock()
+
+	flight.mu.Lock()
+	flight.finished, flight.err = true, err
+	flight.cond.Broadcast()
+	flight.mu.Unlock()
+}
+
+// subscribe streams the flight's chunks from the start to one request, with
+// the same channels and stall handling as an unshared stream
+func (f *streamFlight) subscribe(ctx context.Context) (chan models.StreamChunk, chan error) {
+	responseChan := make(chan models.StreamChunk, 10)
+	errorChan := make(chan error, 1)
+
+	lifecycle.Go("chat stream subscriber", ctx, func(ctx context.Context) {
+		defer close(responseChan)
+		defer close(errorChan)
+
+		// Wake the subscriber when its request goes away while it waits for chunks
+		stop := context.AfterFunc(ctx, func() {
+			f.mu.Lock()
+			f.cond.Broadcast()
+			f.mu.Unlock()
+		})
+		defer stop()
+
+		stall := config.Get().StreamStallTimeout
+		for next := 0; ; next++ {
+			f.mu.Lock()
+			for next >= len(f.chunks) && !f.finished && ctx.Err() == nil {
+				f.cond.Wait()
+			}
+			if ctx.Err() != nil {
+				f.mu.Unlock()
+				f.detach()
+				errorChan <- fmt.Errorf("stream aborted: %v", ctx.Err())
+				return
+			}
+			if next >= len(f.chunks) {
+				err := f.err
+				f.mu.Unlock()
+				if err != nil {
+					errorChan <- err
+				}
+				return
+			}
+			chunk := f.chunks[next]
+			f.mu.Unlock()
+
+			timer := time.NewTimer(stall)
+			select {
+			case responseChan <- chunk:
+				timer.Stop()
+			case <-ctx.Done():
+				timer.Stop()
+				f.detach()
+				errorChan <- fmt.Errorf("stream aborted: %v", ctx.Err())
+				return
+			case <-timer.C:
+				f.detach()
+				errorChan <- fmt.Errorf("stream aborted: client stopped reading for %v", stall)
+				return
+			}
+		}
+	})
+
+	return responseChan, errorChan
+}
+
+// detach drops a subscriber that went away early, stopping the generation
+// once nobody is left to read it
+func (f *streamFlight) detach() {
+	flightsMu.Lock()
+	f.mu.Lock()
+	f.subscribers--
+	last := f.subscribers == 0 && !f.finished
+	if last && flights[f.key] == f {
+		delete(flights, f.key)
+	}
+	f.mu.Unlock()
+	flightsMu.Unlock()
+
+	if last {
+		f.cancel()
+	}
+}
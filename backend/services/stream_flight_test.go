@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owngpt/models"
+)
+
+// deterministic returns a streamed chat with temperature 0
+func deterministic(message string) models.ChatRequest {
+	zero := 0.0
+	return models.ChatRequest{Message: message, Options: &models.SamplingOptions{Temperature: &zero}}
+}
+
+// collect reads a stream to the end, returning its text and error
+func collect(responses chan models.StreamChunk, errs chan error) (string, error) {
+	var text strings.Builder
+	for chunk := range responses {
+		text.WriteString(chunk.Token)
+	}
+	return text.String(), <-errs
+}
+
+func TestFlightKey(t *testing.T) {
+	const containerName = "ollama-flight-container"
+	first, ok := flightKey(deterministic("hi"), containerName)
+	if !ok {
+		t.Fatal("a chat with temperature 0 can't be shared")
+	}
+	if again, _ := flightKey(deterministic("hi"), containerName); again != first {
+		t.Error("identical chats have different keys")
+	}
+	if other, _ := flightKey(deterministic("hello"), containerName); other == first {
+		t.Error("different messages share a key")
+	}
+	if other, _ := flightKey(deterministic("hi"), "ollama-other-container"); other == first {
+		t.Error("different models share a key")
+	}
+	if _, ok := flightKey(models.ChatRequest{Message: "hi"}, containerName); ok {
+		t.Error("a chat at the default temperature is shared")
+	}
+}
+
+func TestIdenticalStreamsShareGeneration(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/generate" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		requests.Add(1)
+		<-release
+		encoder := json.NewEncoder(w)
+		for _, token := range []string{"Hello", " there."} {
+			encoder.Encode(map[string]interface{}{"response": token, "done": false})
+		}
+		encoder.Encode(map[string]interface{}{"response": "", "done": true, "done_reason": "stop"})
+	}))
+	t.Cleanup(server.Close)
+	useOllama(t, server.URL)
+
+	os := NewOllamaService()
+	const containerName = "ollama-flight-container"
+	firstResponses, firstErrs := os.SendMessageStream(context.Background(), deterministic("share test"), containerName)
+	secondResponses, secondErrs := os.SendMessageStream(context.Background(), deterministic("share test"), containerName)
+	close(release)
+
+	firstText, firstErr := collect(firstResponses, firstErrs)
+	secondText, secondErr := collect(secondResponses, secondErrs)
+	if firstText != "Hello there." || secondText != firstText || firstErr != nil || secondErr != nil {
+		t.Errorf("streams = %q, %v and %q, %v; want the whole reply twice", firstText, firstErr, secondText, secondErr)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Ollama got %d generations, want 1 shared", n)
+	}
+}
+
+func TestSharedStreamStopsWhenAllLeave(t *testing.T) {
+	gone := endlessOllama(t)
+	setStallTimeout(t, time.Minute)
+
+	os := NewOllamaService()
+	const containerName = "ollama-flight-container"
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	secondCtx, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	first, firstErrs := os.SendMessageStream(firstCtx, deterministic("leave test"), containerName)
+	second, secondErrs := os.SendMessageStream(secondCtx, deterministic("leave test"), containerName)
+	<-first
+	<-second
+
+	// One request leaving doesn't stop the other's generation
+	cancelFirst()
+	if _, err := collect(first, firstErrs); err == nil {
+		t.Error("the request that left got no error")
+	}
+	for i := 0; i < 20; i++ {
+		if _, ok := <-second; !ok {
+			t.Fatal("the remaining stream ended when the other request left")
+		}
+	}
+	select {
+	case <-gone:
+		t.Fatal("the generation stopped while a request still read it")
+	default:
+	}
+
+	cancelSecond()
+	collect(second, secondErrs)
+	waitGone(t, gone)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"owngpt/utils"
+)
+
+// updateTag is the tag a rolling update builds the model's new image under,
+// so the image the model runs keeps its name until the new one is ready
+const updateTag = ":next"
+
+// UpdateImageName returns the image a rolling update of the model builds
+func UpdateImageName(model string) string {
+	return utils.ImageName(model) + updateTag
+}
+
+// FreeHostPort returns the first host port from 11434 up that no running
+// container other than containerName publishes, for a container started next
+// to existing ones
+func (ds *DockerService) FreeHostPort(containerName string) (string, error) {
+	for port := 11434; port < 11534; port++ {
+		err := ds.checkPortFree(strconv.Itoa(port), containerName)
+		if err == nil {
+			return strconv.Itoa(port), nil
+		}
+		var portErr *PortInUseError
+		if !errors.As(err, &portErr) {
+			return "", err
+		}
+	}
+	return "", errors.New("no free host port between 11434 and 11533")
+}
+
+// containerImage returns the ID of the image a container was created from
+func (ds *DockerService) containerImage(containerName string) string {
+	output, err := ds.run(ds.timeout, false, "docker", "inspect", "-f", "{{.Image}}", containerName)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// SwapUpdateContainer puts a rolling update's new container in place of the
+// model's old one. The old container is renamed aside before the new one takes
+// its name, so requests find a container under the name almost throughout,
+// then it is removed along with its image. If the new container can't take
+// the name, the old one gets it back and keeps serving.
+func (ds *DockerService) SwapUpdateContainer(model string) (err error) {
+	containerName := utils.ContainerName(model)
+	updateName := utils.UpdateContainerName(model)
+	retiredName := containerName + "-retired"
+	oldImage := ds.containerImage(containerName)
+
+	if _, err := ds.run(ds.timeout, false, "docker", "rename", containerName, retiredName); err != nil {
+		return fmt.Errorf("failed to move the old container aside: %v", err)
+	}
+	if _, err := ds.run(ds.timeout, false, "docker", "rename", updateName, containerName); err != nil {
+		if _, restoreErr := ds.run(ds.timeout, false, "docker", "rename", retiredName, containerName); restoreErr != nil {
+			log.Printf("Failed to restore container %s from %s: %v", containerName, retiredName, restoreErr)
+		}
+		return fmt.Errorf("failed to rename the new container: %v", err)
+	}
+
+	if _, err := ds.run(ds.timeout, false, "docker", "rm", "-f", retiredName); err != nil {
+		log.Printf("Failed to remove the old container %s: %v", retiredName, err)
+	}
+
+	// The new image takes over the model's image name; the old one is only
+	// removed if nothing else uses it
+	imageName := utils.ImageName(model)
+	if _, err := ds.run(ds.timeout, false, "docker", "tag", UpdateImageName(model), imageName); err != nil {
+		log.Printf("Failed to tag %s as %s: %v", UpdateImageName(model), imageName, err)
+		return nil
+	}
+	ds.run(ds.timeout, false, "docker", "rmi", UpdateImageName(model))
+	if oldImage != "" && oldImage != ds.containerImage(containerName) {
+		if _, err := ds.run(ds.timeout, false, "docker", "rmi", oldImage); err != nil {
+			log.Printf("Left the old image %s of %s in place: %v", oldImage, model, err)
+		}
+	}
+	return nil
+}
+
+// AbortUpdate removes a failed rolling update's new container and image,
+// leaving the model's old container untouched
+func (ds *DockerService) AbortUpdate(model string) {
+	updateName := utils.UpdateContainerName(model)
+	if _, err := ds.run(ds.timeout, false, "docker", "rm", "-f", updateName); err != nil && !isNotFound(err) {
+		log.Printf("Failed to remove the update container %s: %v", updateName, err)
+	}
+	if _, err := ds.run(ds.timeout, false, "docker", "rmi", UpdateImageName(model)); err != nil && !isNotFound(err) {
+		log.Printf("Failed to remove the update image %s: %v", UpdateImageName(model), err)
+	}
+}
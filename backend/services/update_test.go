@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// swappingDocker fakes the containers of a rolling update of llama2: the
+// model's container runs image old until the update container, running image
+// new, takes its name. Commands starting with fail fail.
+type swappingDocker struct {
+	fail string
+
+	mu      sync.Mutex
+	swapped bool
+	calls   []string
+}
+
+func (s *swappingDocker) run(ctx context.Context, name string, args ...string) *exec.Cmd {
+	line := strings.Join(append([]string{name}, args...), " ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, line)
+
+	if s.fail != "" && strings.HasPrefix(line, s.fail) {
+		return exec.CommandContext(ctx, "sh", "-c", "echo 'Error: failed' >&2; exit 1")
+	}
+	switch {
+	case line == "docker rename ollama-llama2-container-next ollama-llama2-container":
+		s.swapped = true
+	case strings.HasPrefix(line, "docker inspect"):
+		if s.swapped {
+			return exec.CommandContext(ctx, "echo", "sha256:new")
+		}
+		return exec.CommandContext(ctx, "echo", "sha256:old")
+	}
+	return exec.CommandContext(ctx, "true")
+}
+
+// changes returns the calls that change containers or images, leaving out inspects
+func (s *swappingDocker) changes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changes []string
+	for _, call := range s.calls {
+		if !strings.HasPrefix(call, "docker inspect") {
+			changes = append(changes, call)
+		}
+	}
+	return changes
+}
+
+func (s *swappingDocker) service() *DockerService {
+	return &DockerService{runCommand: s.run, timeout: 5 * time.Second, buildTimeout: 5 * time.Second}
+}
+
+func TestSwapUpdateContainer(t *testing.T) {
+	docker := &swappingDocker{}
+	if err := docker.service().SwapUpdateContainer("llama2"); err != nil {
+		t.Fatalf("SwapUpdateContainer: %v", err)
+	}
+	want := []string{
+		"docker rename ollama-llama2-container ollama-llama2-container-retired",
+		"docker rename ollama-llama2-container-next ollama-llama2-container",
+		"docker rm -f ollama-llama2-container-retired",
+		"docker tag ollama-llama2:next ollama-llama2",
+		"docker rmi ollama-llama2:next",
+		"docker rmi sha256:old",
+	}
+	if got := docker.changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
+
+func TestSwapUpdateContainerRestoresOld(t *testing.T) {
+	docker := &swappingDocker{fail: "docker rename ollama-llama2-container-next"}
+	if err := docker.service().SwapUpdateContainer("llama2"); err == nil || !strings.Contains(err.Error(), "failed to rename the new container") {
+		t.Fatalf("err = %v, want the failed rename", err)
+	}
+	want := []string{
+		"docker rename ollama-llama2-container ollama-llama2-container-retired",
+		"docker rename ollama-llama2-container-next ollama-llama2-container",
+		"docker rename ollama-llama2-container-retired ollama-llama2-container",
+	}
+	if got := docker.changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want the old container given its name back", got)
+	}
+}
+
+func TestAbortUpdate(t *testing.T) {
+	docker := &swappingDocker{}
+	docker.service().AbortUpdate("llama2")
+	want := []string{
+		"docker rm -f ollama-llama2-container-next",
+		"docker rmi ollama-llama2:next",
+	}
+	if got := docker.changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want only the update's container and image removed", got)
+	}
+}
+
+func TestFreeHostPortKeepsOwnPort(t *testing.T) {
+	ds, _ := newFakeDockerService(map[string]string{
+		psPorts: "ollama-llama2-container\t0.0.0.0:11434->11434/tcp\n" +
+			"ollama-llama2-container-next\t0.0.0.0:11435->11434/tcp\n",
+	})
+	// A retried update's container may take back the port it already publishes
+	if port, err := ds.FreeHostPort("ollama-llama2-container-next"); err != nil || port != "11435" {
+		t.Errorf("FreeHostPort = %q, %v, want 11435", port, err)
+	}
+}
@@ -0,0 +1,128 @@
+package sessions
+
+import "sync"
+
+// SessionManager is a concurrency-safe map of per-session state, shared by
+// handlers, streaming goroutines and reapers. An entry may carry a cancel
+// function that stops work tied to it, which CancelAll calls.
+type SessionManager[V any] struct {
+	mu      sync.RWMutex
+	entries map[string]managedEntry[V]
+}
+
+type managedEntry[V any] struct {
+	value  V
+	cancel func()
+}
+
+// NewSessionManager returns an empty SessionManager
+func NewSessionManager[V any]() *SessionManager[V] {
+	return &SessionManager[V]{entries: make(map[string]managedEntry[V])}
+}
+
+// Get returns the value stored under key
+func (m *SessionManager[V]) Get(key string) (value V, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.entries[key]
+	return entry.value, ok
+}
+
+// Set stores value under key, replacing any entry and its cancel function
+func (m *SessionManager[V]) Set(key string, value V) {
+	m.SetCancellable(key, value, nil)
+}
+
+// SetCancellable stores value under key along with a function that stops the
+// work tied to it
+func (m *SessionManager[V]) SetCancellable(key string, value V, cancel func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = managedEntry[V]{value: value, cancel: cancel}
+}
+
+// Update replaces the value under key with fn's result while holding the
+// lock, so read-modify-write changes don't race. It reports false, without
+// calling fn, if key isn't present.
+func (m *SessionManager[V]) Update(key string, fn func(value V) V) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return false
+	}
+	entry.value = fn(entry.value)
+	m.entries[key] = entry
+	return true
+}
+
+// Delete removes key without calling its cancel function and returns the value it held
+func (m *SessionManager[V]) Delete(key string) (value V, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	delete(m.entries, key)
+	return entry.value, ok
+}
+
+// DeleteFunc removes every entry fn returns true for, deciding and deleting
+// under the lock so an entry changed in the meantime isn't removed by mistake.
+// Cancel functions aren't called. It returns how many entries were removed.
+func (m *SessionManager[V]) DeleteFunc(fn func(key string, value V) bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for key, entry := range m.entries {
+		if fn(key, entry.value) {
+			delete(m.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Range calls fn for each entry until it returns false. It works on a
+// snapshot, so fn may call back into the manager.
+func (m *SessionManager[V]) Range(fn func(key string, value V) bool) {
+	m.mu.RLock()
+	snapshot := make(map[string]V, len(m.entries))
+	for key, entry := range m.entries {
+		snapshot[key] = entry.value
+	}
+	m.mu.RUnlock()
+
+	for key, value := range snapshot {
+		if !fn(key, value) {
+			return
+		}
+	}
+}
+
+// Len returns the number of entries
+func (m *SessionManager[V]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.entries)
+}
+
+// CancelAll calls every entry's cancel function and returns how many it
+// called. Entries stay until their owners delete them.
+func (m *SessionManager[V]) CancelAll() int {
+	m.mu.RLock()
+	var cancels []func()
+	for _, entry := range m.entries {
+		if entry.cancel != nil {
+			cancels = append(cancels, entry.cancel)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return len(cancels)
+}
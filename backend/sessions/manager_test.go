@@ -0,0 +1,106 @@
+package sessions
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSessionManagerConcurrentUpdates(t *testing.T) {
+	m := NewSessionManager[int]()
+	m.Set("shared", 0)
+
+	const workers, updates = 20, 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			own := fmt.Sprintf("worker-%d", w)
+			for i := 0; i < updates; i++ {
+				m.Update("shared", func(n int) int { return n + 1 })
+
+				// Readers, writers and removals of other keys run alongside
+				m.Set(own, i)
+				m.Get("shared")
+				m.Len()
+				m.Range(func(key string, value int) bool { return true })
+				m.DeleteFunc(func(key string, value int) bool { return key == own && value%2 == 1 })
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if n, _ := m.Get("shared"); n != workers*updates {
+		t.Errorf("shared = %d after %d updates", n, workers*updates)
+	}
+	// Each worker's last value was odd, so DeleteFunc removed it
+	if m.Len() != 1 {
+		t.Errorf("%d entries left, want only shared", m.Len())
+	}
+}
+
+func TestSessionManagerUpdateMissing(t *testing.T) {
+	m := NewSessionManager[int]()
+	called := false
+	if m.Update("missing", func(n int) int { called = true; return n }) || called {
+		t.Error("Update ran on a missing key")
+	}
+	if _, ok := m.Get("missing"); ok {
+		t.Error("Update created the key")
+	}
+}
+
+func TestSessionManagerCancelAll(t *testing.T) {
+	m := NewSessionManager[string]()
+	var cancelled atomic.Int32
+	cancel := func() { cancelled.Add(1) }
+
+	m.SetCancellable("a", "stream a", cancel)
+	m.SetCancellable("b", "stream b", cancel)
+	m.SetCancellable("replaced", "old", cancel)
+	m.Set("replaced", "new")
+	m.Set("plain", "no cancel")
+	m.SetCancellable("deleted", "gone", cancel)
+	if value, ok := m.Delete("deleted"); !ok || value != "gone" {
+		t.Errorf("Delete returned %q, %v", value, ok)
+	}
+	if cancelled.Load() != 0 {
+		t.Fatal("Set or Delete called a cancel function")
+	}
+
+	if n := m.CancelAll(); n != 2 || cancelled.Load() != 2 {
+		t.Errorf("CancelAll called %d (counted %d), want 2", cancelled.Load(), n)
+	}
+	// Entries stay for their owners to delete
+	if m.Len() != 4 {
+		t.Errorf("%d entries after CancelAll, want 4", m.Len())
+	}
+}
+
+func TestSessionManagerRangeCallsBack(t *testing.T) {
+	m := NewSessionManager[int]()
+	for i := 0; i < 10; i++ {
+		m.Set(fmt.Sprint(i), i)
+	}
+
+	// fn may change the manager without deadlocking
+	m.Range(func(key string, value int) bool {
+		m.Delete(key)
+		m.Set("seen-"+key, value)
+		return true
+	})
+	if m.Len() != 10 {
+		t.Errorf("%d entries, want 10", m.Len())
+	}
+
+	visited := 0
+	m.Range(func(key string, value int) bool {
+		visited++
+		return visited < 3
+	})
+	if visited != 3 {
+		t.Errorf("Range visited %d entries after being stopped at 3", visited)
+	}
+}
@@ -0,0 +1,158 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// session is a conversation's history and activity
+type session struct {
+	id           string
+	createdAt    time.Time
+	lastActivity time.Time
+	messages     []models.OllamaChatMessage
+	// generating is set while a chat is answering in the session
+	generating bool
+}
+
+var (
+	// ErrNotFound is returned for unknown or expired sessions
+	ErrNotFound = errors.New("session does not exist or has expired")
+	// ErrBusy is returned by Begin while another chat is answering in the session
+	ErrBusy = errors.New("session is already generating a reply")
+)
+
+var store = NewSessionManager[session]()
+
+// Create starts a conversation, seeded with any messages given such as a
+// welcome message, and returns its summary
+func Create(messages ...models.OllamaChatMessage) models.ChatSession {
+	now := time.Now().UTC()
+	s := session{id: newID(), createdAt: now, lastActivity: now, messages: messages}
+	store.Set(s.id, s)
+	return summary(s)
+}
+
+// History returns a copy of the conversation so far. ok is false for unknown
+// or expired sessions.
+func History(id string) (messages []models.OllamaChatMessage, ok bool) {
+	Expire()
+	s, ok := store.Get(id)
+	if !ok {
+		return nil, false
+	}
+	return append([]models.OllamaChatMessage(nil), s.messages...), true
+}
+
+// Export returns the session's whole conversation. ok is false for unknown or
+// expired sessions.
+func Export(id string) (transcript models.ChatTranscript, ok bool) {
+	Expire()
+	s, ok := store.Get(id)
+	if !ok {
+		return models.ChatTranscript{}, false
+	}
+	createdAt, now := s.createdAt, time.Now().UTC()
+	return models.ChatTranscript{
+		SessionID:  s.id,
+		CreatedAt:  &createdAt,
+		ExportedAt: &now,
+		Messages:   append([]models.OllamaChatMessage{}, s.messages...),
+	}, true
+}
+
+// Append adds messages to the conversation. It reports false if the session
+// is unknown or has expired.
+func Append(id string, messages ...models.OllamaChatMessage) bool {
+	Expire()
+	return store.Update(id, func(s session) session {
+		// Copy rather than grow in place, so earlier History callers keep their own slice
+		s.messages = append(s.messages[:len(s.messages):len(s.messages)], messages...)
+		s.lastActivity = time.Now().UTC()
+		return s
+	})
+}
+
+// Begin marks a chat as answering in the session, so only one chat at a time
+// reads and extends its history. Call end once the chat has appended its turn
+// or given up. It fails with ErrBusy while another chat holds the session.
+func Begin(id string) (end func(), err error) {
+	Expire()
+	err = ErrBusy
+	found := store.Update(id, func(s session) session {
+		if !s.generating {
+			s.generating = true
+			err = nil
+		}
+		return s
+	})
+	if !found {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		store.Update(id, func(s session) session {
+			s.generating = false
+			return s
+		})
+	}, nil
+}
+
+// List returns the active sessions, most recently used first
+func List() []models.ChatSession {
+	Expire()
+	list := make([]models.ChatSession, 0, store.Len())
+	store.Range(func(_ string, s session) bool {
+		list = append(list, summary(s))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastActivity.After(list[j].LastActivity)
+	})
+	return list
+}
+
+// Expire drops sessions idle for longer than OWNGPT_SESSION_TTL and returns
+// how many it dropped. Sessions are also expired as they're used; calling it
+// periodically frees the ones nobody comes back to. Sessions with a chat
+// answering aren't idle, however long the reply takes.
+func Expire() int {
+	cutoff := time.Now().UTC().Add(-config.Get().SessionTTL)
+	return store.DeleteFunc(func(_ string, s session) bool {
+		return !s.generating && s.lastActivity.Before(cutoff)
+	})
+}
+
+// summary describes a session for listings
+func summary(s session) models.ChatSession {
+	turns := 0
+	for _, message := range s.messages {
+		if message.Role == "user" {
+			turns++
+		}
+	}
+	return models.ChatSession{
+		ID:           s.id,
+		CreatedAt:    s.createdAt,
+		LastActivity: s.lastActivity,
+		Turns:        turns,
+		Generating:   s.generating,
+		Streams:      Streams(s.id),
+		ExpiresAt:    s.lastActivity.Add(config.Get().SessionTTL),
+	}
+}
+
+// newID returns a random 128-bit session ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
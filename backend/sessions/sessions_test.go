@@ -0,0 +1,164 @@
+package sessions
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// setSessionTTL sets OWNGPT_SESSION_TTL for the test
+func setSessionTTL(t *testing.T, ttl time.Duration) {
+	cfg := config.Get()
+	previous := cfg.SessionTTL
+	cfg.SessionTTL = ttl
+	t.Cleanup(func() { cfg.SessionTTL = previous })
+}
+
+// idle makes the session look unused for d
+func idle(id string, d time.Duration) {
+	store.Update(id, func(s session) session {
+		s.lastActivity = s.lastActivity.Add(-d)
+		return s
+	})
+}
+
+func TestSessionHistory(t *testing.T) {
+	setSessionTTL(t, time.Hour)
+	welcome := models.OllamaChatMessage{Role: "assistant", Content: "Hi!"}
+	created := Create(welcome)
+	defer store.Delete(created.ID)
+
+	if len(created.ID) != 32 || created.Turns != 0 {
+		t.Errorf("created %+v", created)
+	}
+
+	before, _ := History(created.ID)
+	turn := []models.OllamaChatMessage{{Role: "user", Content: "hello"}, {Role: "assistant", Content: "hey"}}
+	if !Append(created.ID, turn...) {
+		t.Fatal("Append to a live session failed")
+	}
+	after, ok := History(created.ID)
+	if !ok || len(after) != 3 || after[1].Content != "hello" {
+		t.Errorf("history = %+v", after)
+	}
+	// Earlier copies of the history don't change
+	if len(before) != 1 {
+		t.Errorf("an earlier history grew to %d messages", len(before))
+	}
+
+	transcript, ok := Export(created.ID)
+	if !ok || transcript.SessionID != created.ID || len(transcript.Messages) != 3 {
+		t.Errorf("transcript = %+v", transcript)
+	}
+
+	if Append("missing", turn...) {
+		t.Error("Append to an unknown session succeeded")
+	}
+	if _, ok := History("missing"); ok {
+		t.Error("an unknown session has a history")
+	}
+}
+
+func TestListMostRecentFirst(t *testing.T) {
+	setSessionTTL(t, time.Hour)
+	older, newer := Create(), Create()
+	defer store.Delete(older.ID)
+	defer store.Delete(newer.ID)
+	idle(older.ID, time.Minute)
+	Append(newer.ID, models.OllamaChatMessage{Role: "user", Content: "hi"})
+
+	var order []string
+	for _, s := range List() {
+		if s.ID == older.ID || s.ID == newer.ID {
+			order = append(order, s.ID)
+			if s.ID == newer.ID && s.Turns != 1 {
+				t.Errorf("newer session has %d turns, want 1", s.Turns)
+			}
+		}
+	}
+	if len(order) != 2 || order[0] != newer.ID {
+		t.Errorf("listed %v, want the newer session first", order)
+	}
+}
+
+func TestBeginHoldsTheSession(t *testing.T) {
+	setSessionTTL(t, time.Hour)
+	s := Create()
+	defer store.Delete(s.ID)
+
+	end, err := Begin(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Begin(s.ID); !errors.Is(err, ErrBusy) {
+		t.Errorf("second Begin err = %v, want ErrBusy", err)
+	}
+	end()
+	end2, err := Begin(s.ID)
+	if err != nil {
+		t.Fatalf("Begin after end: %v", err)
+	}
+	end2()
+
+	if _, err := Begin("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Begin on an unknown session err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpireIdleSessions(t *testing.T) {
+	setSessionTTL(t, time.Minute)
+	stale, busy, fresh := Create(), Create(), Create()
+	defer store.Delete(fresh.ID)
+	defer store.Delete(busy.ID)
+
+	end, _ := Begin(busy.ID)
+	idle(stale.ID, time.Hour)
+	idle(busy.ID, time.Hour)
+
+	if expired := Expire(); expired != 1 {
+		t.Errorf("expired %d sessions, want 1", expired)
+	}
+	if _, ok := History(stale.ID); ok {
+		t.Error("the idle session survived")
+	}
+	// A session answering a chat isn't idle, however long it takes
+	if _, ok := History(busy.ID); !ok {
+		t.Error("the generating session expired")
+	}
+	if _, ok := History(fresh.ID); !ok {
+		t.Error("the fresh session expired")
+	}
+
+	end()
+	if expired := Expire(); expired != 1 {
+		t.Errorf("expired %d sessions once the chat ended, want 1", expired)
+	}
+}
+
+func TestExport(t *testing.T) {
+	setSessionTTL(t, time.Hour)
+	created := Create(models.OllamaChatMessage{Role: "assistant", Content: "Hi!"})
+	defer store.Delete(created.ID)
+	Append(created.ID, models.OllamaChatMessage{Role: "user", Content: "hello"})
+
+	transcript, ok := Export(created.ID)
+	if !ok || transcript.SessionID != created.ID || transcript.CreatedAt == nil || !transcript.CreatedAt.Equal(created.CreatedAt) || transcript.ExportedAt == nil {
+		t.Fatalf("Export = %+v, %v", transcript, ok)
+	}
+	if len(transcript.Messages) != 2 || transcript.Messages[1].Content != "hello" {
+		t.Errorf("exported %v, want both messages", transcript.Messages)
+	}
+
+	// The transcript is a copy
+	transcript.Messages[0].Content = "changed"
+	if history, _ := History(created.ID); history[0].Content != "Hi!" {
+		t.Error("changing the transcript changed the session")
+	}
+
+	if _, ok := Export("missing"); ok {
+		t.Error("exported an unknown session")
+	}
+}
@@ -0,0 +1,79 @@
+package sessions
+
+import (
+	"errors"
+	"sync"
+
+	"owngpt/config"
+	"owngpt/metrics"
+)
+
+var (
+	// ErrTooManyStreams is returned by OpenStream when OWNGPT_MAX_STREAMS
+	// streams are already open
+	ErrTooManyStreams = errors.New("too many streams are open, try again later")
+	// ErrTooManySessionStreams is returned by OpenStream when the session
+	// already has OWNGPT_MAX_STREAMS_PER_SESSION streams open
+	ErrTooManySessionStreams = errors.New("too many streams are open for this session, close one first")
+)
+
+var (
+	streamsMu sync.Mutex
+	// streamsOpen is the total of streamCounts
+	streamsOpen  int
+	streamCounts = make(map[string]int)
+
+	streamsActive = metrics.NewGauge(
+		"owngpt_streams_open",
+		"Streaming responses currently open",
+	)
+	streamsRejected = metrics.NewCounter(
+		"owngpt_streams_rejected_total",
+		"Streams turned away by OWNGPT_MAX_STREAMS or OWNGPT_MAX_STREAMS_PER_SESSION",
+	)
+)
+
+// OpenStream counts a new streaming response against key, a chat session ID
+// or another identifier of the client for streams without a session. It
+// fails once OWNGPT_MAX_STREAMS streams are open in total or
+// OWNGPT_MAX_STREAMS_PER_SESSION for the key. Call close when the stream
+// ends, however it ends; calls after the first do nothing.
+func OpenStream(key string) (close func(), err error) {
+	cfg := config.Get()
+
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	switch {
+	case cfg.MaxStreams > 0 && streamsOpen >= cfg.MaxStreams:
+		err = ErrTooManyStreams
+	case cfg.MaxStreamsPerSession > 0 && streamCounts[key] >= cfg.MaxStreamsPerSession:
+		err = ErrTooManySessionStreams
+	}
+	if err != nil {
+		streamsRejected.Inc()
+		return nil, err
+	}
+	streamsOpen++
+	streamCounts[key]++
+	streamsActive.Set(float64(streamsOpen))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			streamsMu.Lock()
+			defer streamsMu.Unlock()
+			streamsOpen--
+			if streamCounts[key]--; streamCounts[key] <= 0 {
+				delete(streamCounts, key)
+			}
+			streamsActive.Set(float64(streamsOpen))
+		})
+	}, nil
+}
+
+// Streams returns how many streams are open for key
+func Streams(key string) int {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	return streamCounts[key]
+}
@@ -0,0 +1,76 @@
+package sessions
+
+import (
+	"errors"
+	"testing"
+
+	"owngpt/config"
+)
+
+// limitStreams sets the stream caps for the test, restoring them after it
+func limitStreams(t *testing.T, total, perSession int) {
+	cfg := config.Get()
+	previousTotal, previousPerSession := cfg.MaxStreams, cfg.MaxStreamsPerSession
+	cfg.MaxStreams, cfg.MaxStreamsPerSession = total, perSession
+	t.Cleanup(func() { cfg.MaxStreams, cfg.MaxStreamsPerSession = previousTotal, previousPerSession })
+}
+
+func TestOpenStreamPerSessionCap(t *testing.T) {
+	limitStreams(t, 0, 2)
+
+	first, err := OpenStream("session-a")
+	if err != nil {
+		t.Fatalf("first stream: %v", err)
+	}
+	second, err := OpenStream("session-a")
+	if err != nil {
+		t.Fatalf("second stream: %v", err)
+	}
+	if _, err := OpenStream("session-a"); !errors.Is(err, ErrTooManySessionStreams) {
+		t.Fatalf("third stream err = %v, want ErrTooManySessionStreams", err)
+	}
+	other, err := OpenStream("session-b")
+	if err != nil {
+		t.Fatalf("another session's stream: %v", err)
+	}
+	defer other()
+
+	// Closing twice only frees one slot
+	first()
+	first()
+	if n := Streams("session-a"); n != 1 {
+		t.Errorf("streams after closing one = %d, want 1", n)
+	}
+	third, err := OpenStream("session-a")
+	if err != nil {
+		t.Fatalf("stream after closing one: %v", err)
+	}
+	second()
+	third()
+	if n := Streams("session-a"); n != 0 {
+		t.Errorf("streams after closing all = %d, want 0", n)
+	}
+}
+
+func TestOpenStreamTotalCap(t *testing.T) {
+	limitStreams(t, 2, 0)
+
+	var closes []func()
+	for _, key := range []string{"total-a", "total-b"} {
+		close, err := OpenStream(key)
+		if err != nil {
+			t.Fatalf("stream for %s: %v", key, err)
+		}
+		closes = append(closes, close)
+	}
+	if _, err := OpenStream("total-c"); !errors.Is(err, ErrTooManyStreams) {
+		t.Fatalf("stream past the total err = %v, want ErrTooManyStreams", err)
+	}
+	closes[0]()
+	close, err := OpenStream("total-c")
+	if err != nil {
+		t.Fatalf("stream after one closed: %v", err)
+	}
+	close()
+	closes[1]()
+}
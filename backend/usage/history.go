@@ -0,0 +1,86 @@
+package usage
+
+import (
+	"sync"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// ring holds a model's most recent generations, overwriting the oldest once full
+type ring struct {
+	entries []models.Generation
+	// next is where the next generation goes
+	next int
+	full bool
+}
+
+func (r *ring) add(generation models.Generation) {
+	r.entries[r.next] = generation
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns up to limit generations, newest first
+func (r *ring) list(limit int) []models.Generation {
+	count := r.next
+	if r.full {
+		count = len(r.entries)
+	}
+	if limit > 0 && limit < count {
+		count = limit
+	}
+	generations := make([]models.Generation, 0, count)
+	for i := 1; i <= count; i++ {
+		generations = append(generations, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return generations
+}
+
+var (
+	historyMu sync.Mutex
+	histories = make(map[string]*ring)
+)
+
+// RecordGeneration adds a finished chat request to the model's recent
+// history, which keeps the last OWNGPT_GENERATION_HISTORY of them. The prompt
+// text is dropped unless OWNGPT_LOG_PROMPTS is set.
+func RecordGeneration(model string, generation models.Generation) {
+	size := config.Get().GenerationHistory
+	if size <= 0 {
+		return
+	}
+	if !config.Get().LogPrompts {
+		generation.Prompt = ""
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	history, ok := histories[model]
+	if !ok {
+		history = &ring{entries: make([]models.Generation, size)}
+		histories[model] = history
+	}
+	history.add(generation)
+}
+
+// History returns up to limit of the model's most recent generations, newest
+// first; a limit of 0 returns all that are kept
+func History(model string, limit int) []models.Generation {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	history, ok := histories[model]
+	if !ok {
+		return []models.Generation{}
+	}
+	return history.list(limit)
+}
+
+// ForgetHistory drops the model's history, for a model that was deleted
+func ForgetHistory(model string) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	delete(histories, model)
+}
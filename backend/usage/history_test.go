@@ -0,0 +1,110 @@
+package usage
+
+import (
+	"reflect"
+	"testing"
+
+	"owngpt/config"
+	"owngpt/models"
+)
+
+// setHistory sets OWNGPT_GENERATION_HISTORY and OWNGPT_LOG_PROMPTS for the
+// test, which starts without any history
+func setHistory(t *testing.T, size int, logPrompts bool) {
+	cfg := config.Get()
+	previousSize, previousLog := cfg.GenerationHistory, cfg.LogPrompts
+	cfg.GenerationHistory, cfg.LogPrompts = size, logPrompts
+	historyMu.Lock()
+	histories = make(map[string]*ring)
+	historyMu.Unlock()
+	t.Cleanup(func() {
+		cfg.GenerationHistory, cfg.LogPrompts = previousSize, previousLog
+		historyMu.Lock()
+		histories = make(map[string]*ring)
+		historyMu.Unlock()
+	})
+}
+
+// tokens returns the completion tokens of the generations, which tests use to number them
+func tokens(generations []models.Generation) []int {
+	numbers := []int{}
+	for _, generation := range generations {
+		numbers = append(numbers, generation.CompletionTokens)
+	}
+	return numbers
+}
+
+func TestHistoryRingWraps(t *testing.T) {
+	setHistory(t, 3, false)
+	if got := History("llama2", 0); len(got) != 0 {
+		t.Fatalf("history before any generation = %v", got)
+	}
+
+	tests := []struct {
+		added int
+		want  []int
+	}{
+		{1, []int{1}},
+		{2, []int{2, 1}},
+		{3, []int{3, 2, 1}},
+		{4, []int{4, 3, 2}},
+		{5, []int{5, 4, 3}},
+		{6, []int{6, 5, 4}},
+		{7, []int{7, 6, 5}},
+	}
+	for _, tt := range tests {
+		RecordGeneration("llama2", models.Generation{CompletionTokens: tt.added})
+		if got := tokens(History("llama2", 0)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("after %d generations: %v, want %v", tt.added, got, tt.want)
+		}
+	}
+
+	if got := tokens(History("llama2", 2)); !reflect.DeepEqual(got, []int{7, 6}) {
+		t.Errorf("History(limit 2) = %v, want the newest two", got)
+	}
+	if got := tokens(History("llama2", 10)); len(got) != 3 {
+		t.Errorf("History(limit 10) = %v, want the 3 kept", got)
+	}
+	if got := History("mistral", 0); len(got) != 0 {
+		t.Errorf("mistral shares llama2's history: %v", got)
+	}
+}
+
+func TestHistoryPrompts(t *testing.T) {
+	setHistory(t, 5, false)
+	RecordGeneration("llama2", models.Generation{Prompt: "my secret", PromptChars: 9})
+	if got := History("llama2", 0)[0]; got.Prompt != "" || got.PromptChars != 9 {
+		t.Errorf("generation = %+v, want the prompt dropped but its length kept", got)
+	}
+
+	config.Get().LogPrompts = true
+	RecordGeneration("llama2", models.Generation{Prompt: "my secret", PromptChars: 9})
+	if got := History("llama2", 0)[0]; got.Prompt != "my secret" {
+		t.Errorf("prompt = %q with OWNGPT_LOG_PROMPTS, want it kept", got.Prompt)
+	}
+}
+
+func TestHistoryDisabledAndForgotten(t *testing.T) {
+	setHistory(t, 0, false)
+	RecordGeneration("llama2", models.Generation{CompletionTokens: 1})
+	if got := History("llama2", 0); len(got) != 0 {
+		t.Errorf("history with OWNGPT_GENERATION_HISTORY=0 = %v", got)
+	}
+
+	config.Get().GenerationHistory = 5
+	RecordGeneration("llama2", models.Generation{CompletionTokens: 1})
+	RecordGeneration("mistral", models.Generation{CompletionTokens: 1})
+	ForgetHistory("llama2")
+	if got := History("llama2", 0); len(got) != 0 {
+		t.Errorf("history of a forgotten model = %v", got)
+	}
+	if got := History("mistral", 0); len(got) != 1 {
+		t.Errorf("forgetting llama2 dropped mistral's history: %v", got)
+	}
+
+	useStatsFile(t)
+	Reset()
+	if got := History("mistral", 0); len(got) != 0 {
+		t.Errorf("history after Reset = %v", got)
+	}
+}
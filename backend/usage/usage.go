@@ -0,0 +1,219 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"owngpt/config"
+	"owngpt/models"
+	"owngpt/utils"
+)
+
+// SaveInterval is how often changed stats are written to OWNGPT_STATS_FILE
+const SaveInterval = 30 * time.Second
+
+const (
+	// MaxClients bounds the clients usage is broken down by, since every
+	// address that chats is one
+	MaxClients = 1000
+	// OtherClient gathers the usage of clients past MaxClients
+	OtherClient = "other"
+)
+
+var (
+	mu    sync.Mutex
+	stats = newStats()
+	// dirty is set when stats changed since they were last saved
+	dirty bool
+
+	// saveMu keeps saves from overtaking each other
+	saveMu sync.Mutex
+)
+
+func newStats() models.UsageStats {
+	return models.UsageStats{
+		Since:   time.Now().UTC(),
+		Models:  make(map[string]*models.ModelUsage),
+		Clients: make(map[string]*models.ClientUsage),
+	}
+}
+
+// Load restores persisted stats from OWNGPT_STATS_FILE, if configured
+func Load() {
+	path := config.Get().StatsFile
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read usage stats from %s: %v", path, err)
+		}
+		return
+	}
+
+	loaded := newStats()
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		log.Printf("Failed to parse usage stats from %s: %v", path, err)
+		return
+	}
+	if loaded.Models == nil {
+		loaded.Models = make(map[string]*models.ModelUsage)
+	}
+	if loaded.Clients == nil {
+		loaded.Clients = make(map[string]*models.ClientUsage)
+	}
+
+	mu.Lock()
+	stats = loaded
+	mu.Unlock()
+}
+
+// Record adds one chat request made by client to the totals. Tokens counts
+// prompt and generated tokens. Requests with no client only count towards the
+// totals.
+func Record(model, client string, tokens int, latency time.Duration, failed bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	stats.TotalRequests++
+	if failed {
+		stats.TotalErrors++
+	} else {
+		stats.TotalTokens += tokens
+	}
+	addModelUsage(stats.Models, model, tokens, latency, failed)
+
+	if client != "" {
+		if _, ok := stats.Clients[client]; !ok && len(stats.Clients) >= MaxClients {
+			client = OtherClient
+		}
+		clientUsage, ok := stats.Clients[client]
+		if !ok {
+			clientUsage = &models.ClientUsage{Models: make(map[string]*models.ModelUsage)}
+			stats.Clients[client] = clientUsage
+		}
+		clientUsage.Requests++
+		if failed {
+			clientUsage.Errors++
+		} else {
+			clientUsage.TotalTokens += tokens
+		}
+		addModelUsage(clientUsage.Models, model, tokens, latency, failed)
+	}
+	dirty = true
+}
+
+// addModelUsage adds one chat request to the model's entry in usage
+func addModelUsage(usage map[string]*models.ModelUsage, model string, tokens int, latency time.Duration, failed bool) {
+	modelUsage, ok := usage[model]
+	if !ok {
+		modelUsage = &models.ModelUsage{}
+		usage[model] = modelUsage
+	}
+
+	modelUsage.Requests++
+	if failed {
+		modelUsage.Errors++
+	} else {
+		modelUsage.TotalTokens += tokens
+		modelUsage.TotalLatencyMs += float64(latency) / float64(time.Millisecond)
+		modelUsage.AvgLatencyMs = modelUsage.TotalLatencyMs / float64(modelUsage.Requests-modelUsage.Errors)
+	}
+	modelUsage.LastUsed = time.Now().UTC()
+}
+
+// Snapshot returns a copy of the current stats
+func Snapshot() models.UsageStats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	snapshot := stats
+	snapshot.Models = copyModels(stats.Models)
+	snapshot.Clients = make(map[string]*models.ClientUsage, len(stats.Clients))
+	for client, clientUsage := range stats.Clients {
+		copied := *clientUsage
+		copied.Models = copyModels(clientUsage.Models)
+		snapshot.Clients[client] = &copied
+	}
+	return snapshot
+}
+
+// ClientSnapshot returns a copy of the stats of the client's requests alone,
+// with no client breakdown. A client that hasn't chatted has empty stats.
+func ClientSnapshot(client string) models.UsageStats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	snapshot := models.UsageStats{Since: stats.Since, Models: make(map[string]*models.ModelUsage)}
+	if clientUsage, ok := stats.Clients[client]; ok {
+		snapshot.TotalRequests = clientUsage.Requests
+		snapshot.TotalErrors = clientUsage.Errors
+		snapshot.TotalTokens = clientUsage.TotalTokens
+		snapshot.Models = copyModels(clientUsage.Models)
+	}
+	return snapshot
+}
+
+func copyModels(usage map[string]*models.ModelUsage) map[string]*models.ModelUsage {
+	copied := make(map[string]*models.ModelUsage, len(usage))
+	for name, modelUsage := range usage {
+		entry := *modelUsage
+		copied[name] = &entry
+	}
+	return copied
+}
+
+// Reset clears all stats, along with every model's generation history
+func Reset() {
+	mu.Lock()
+	stats = newStats()
+	dirty = true
+	mu.Unlock()
+
+	historyMu.Lock()
+	histories = make(map[string]*ring)
+	historyMu.Unlock()
+
+	if err := Save(); err != nil {
+		log.Printf("Failed to save usage stats: %v", err)
+	}
+}
+
+// Save writes the stats to OWNGPT_STATS_FILE if they changed since the last
+// save. Chats only mark the stats changed, so call it every SaveInterval and
+// on shutdown.
+func Save() error {
+	path := config.Get().StatsFile
+	if path == "" {
+		return nil
+	}
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	mu.Lock()
+	if !dirty {
+		mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(stats)
+	dirty = false
+	mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode usage stats: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(path, data, 0644); err != nil {
+		// Try again on the next save
+		mu.Lock()
+		dirty = true
+		mu.Unlock()
+		return fmt.Errorf("failed to write usage stats to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package usage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"owngpt/config"
+)
+
+// useStatsFile points OWNGPT_STATS_FILE at a fresh file and starts from empty stats
+func useStatsFile(t *testing.T) string {
+	t.Helper()
+	cfg := config.Get()
+	previous := cfg.StatsFile
+	cfg.StatsFile = filepath.Join(t.TempDir(), "stats.json")
+	t.Cleanup(func() {
+		cfg.StatsFile = previous
+		mu.Lock()
+		stats, dirty = newStats(), false
+		mu.Unlock()
+	})
+	mu.Lock()
+	stats, dirty = newStats(), false
+	mu.Unlock()
+	return cfg.StatsFile
+}
+
+func TestRecordSavesLater(t *testing.T) {
+	path := useStatsFile(t)
+
+	Record("llama2", "", 10, time.Second, false)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Record wrote the stats file: %v", err)
+	}
+
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+	Record("llama2", "", 5, time.Second, true)
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing but the stats file is left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 || entries[0].Name() != "stats.json" {
+		t.Errorf("directory holds %v", entries)
+	}
+
+	mu.Lock()
+	stats = newStats()
+	mu.Unlock()
+	Load()
+	got := Snapshot()
+	if got.TotalRequests != 2 || got.TotalErrors != 1 || got.TotalTokens != 10 || got.Models["llama2"].Requests != 2 {
+		t.Errorf("loaded %+v", got)
+	}
+}
+
+func TestSaveSkipsUnchangedStats(t *testing.T) {
+	path := useStatsFile(t)
+
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("unchanged stats were written: %v", err)
+	}
+
+	Record("llama2", "", 10, time.Second, false)
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+	// Left alone, the next save keeps the file as it is
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{}" {
+		t.Errorf("unchanged stats were written again: %s", data)
+	}
+}
+
+func TestFailedSaveIsRetried(t *testing.T) {
+	path := useStatsFile(t)
+	cfg := config.Get()
+	cfg.StatsFile = filepath.Join(path, "missing", "stats.json")
+
+	Record("llama2", "", 10, time.Second, false)
+	if err := Save(); err == nil {
+		t.Fatal("saving into a missing directory succeeded")
+	}
+
+	cfg.StatsFile = path
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("stats were not saved after the failure: %v", err)
+	}
+}
+
+func TestRecordByClient(t *testing.T) {
+	useStatsFile(t)
+
+	Record("llama2", "admin", 10, time.Second, false)
+	Record("mistral", "192.0.2.1", 5, time.Second, false)
+	Record("llama2", "192.0.2.1", 0, time.Second, true)
+	Record("llama2", "", 3, time.Second, false)
+
+	got := Snapshot()
+	if got.TotalRequests != 4 || got.TotalTokens != 18 {
+		t.Errorf("totals = %d requests, %d tokens; want every request counted", got.TotalRequests, got.TotalTokens)
+	}
+	if len(got.Clients) != 2 {
+		t.Fatalf("clients = %v, want admin and 192.0.2.1 only", got.Clients)
+	}
+	if remote := got.Clients["192.0.2.1"]; remote.Requests != 2 || remote.Errors != 1 || remote.TotalTokens != 5 || remote.Models["llama2"].Errors != 1 {
+		t.Errorf("192.0.2.1 = %+v", remote)
+	}
+
+	admin := ClientSnapshot("admin")
+	if admin.TotalRequests != 1 || admin.TotalTokens != 10 || len(admin.Models) != 1 || admin.Models["llama2"].Requests != 1 || admin.Clients != nil {
+		t.Errorf("admin stats = %+v, want its llama2 request alone", admin)
+	}
+	if unknown := ClientSnapshot("198.51.100.7"); unknown.TotalRequests != 0 || unknown.Models == nil {
+		t.Errorf("unknown client stats = %+v, want empty", unknown)
+	}
+
+	// Snapshots are copies
+	got.Clients["admin"].Models["llama2"].Requests = 100
+	if Snapshot().Clients["admin"].Models["llama2"].Requests != 1 {
+		t.Error("changing a snapshot changed the stats")
+	}
+}
+
+func TestRecordCapsClients(t *testing.T) {
+	useStatsFile(t)
+
+	for i := 0; i < MaxClients; i++ {
+		Record("llama2", fmt.Sprintf("client-%d", i), 1, time.Second, false)
+	}
+	Record("llama2", "late", 1, time.Second, false)
+	Record("llama2", "client-0", 1, time.Second, false)
+
+	got := Snapshot()
+	if got.Clients["late"] != nil || got.Clients[OtherClient].Requests != 1 {
+		t.Errorf("a client past MaxClients wasn't counted as %s", OtherClient)
+	}
+	if got.Clients["client-0"].Requests != 2 {
+		t.Errorf("client-0 has %d requests, want 2", got.Clients["client-0"].Requests)
+	}
+}
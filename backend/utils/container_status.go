@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"owngpt/models"
+)
+
+// exitCodePattern finds the exit code in statuses like "Exited (137) 2 hours ago"
+var exitCodePattern = regexp.MustCompile(`^\w+ \((-?\d+)\)`)
+
+// ParseContainerStatus reads the state of a container from the Status column
+// of docker ps, such as "Up 5 minutes (health: starting)" or "Restarting (1)
+// 3 seconds ago", along with the exit code of exited and restarting
+// containers. Statuses it doesn't recognize give models.StateUnknown.
+func ParseContainerStatus(status string) (state string, exitCode *int) {
+	status = strings.TrimSpace(status)
+	if m := exitCodePattern.FindStringSubmatch(status); m != nil {
+		if code, err := strconv.Atoi(m[1]); err == nil {
+			exitCode = &code
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(status, "Up "), status == "Up":
+		switch {
+		case strings.HasSuffix(status, "(Paused)"):
+			return models.StatePaused, nil
+		case strings.HasSuffix(status, "(health: starting)"):
+			return models.StateStarting, nil
+		case strings.HasSuffix(status, "(unhealthy)"):
+			return models.StateUnhealthy, nil
+		}
+		return models.StateRunning, nil
+	case strings.HasPrefix(status, "Restarting"):
+		return models.StateRestarting, exitCode
+	case strings.HasPrefix(status, "Exited"):
+		return models.StateExited, exitCode
+	case status == "Created":
+		return models.StateCreated, nil
+	case strings.HasPrefix(status, "Removal In Progress"):
+		return models.StateRemoving, nil
+	case status == "Dead":
+		return models.StateDead, nil
+	}
+	return models.StateUnknown, nil
+}
+
+// ContainerUp reports whether a container in the state has a running
+// process, whether or not it is ready to serve
+func ContainerUp(state string) bool {
+	switch state {
+	case models.StateRunning, models.StateStarting, models.StateUnhealthy, models.StatePaused:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"testing"
+
+	"owngpt/models"
+)
+
+func TestParseContainerStatus(t *testing.T) {
+	tests := []struct {
+		status   string
+		state    string
+		exitCode int
+	}{
+		{"Up 5 minutes", models.StateRunning, -1},
+		{"Up", models.StateRunning, -1},
+		{"Up 2 hours (healthy)", models.StateRunning, -1},
+		{"Up 3 seconds (health: starting)", models.StateStarting, -1},
+		{"Up 10 minutes (unhealthy)", models.StateUnhealthy, -1},
+		{"Up 1 hour (Paused)", models.StatePaused, -1},
+		{"Restarting (1) 3 seconds ago", models.StateRestarting, 1},
+		{"Exited (137) 2 hours ago", models.StateExited, 137},
+		{"Exited (0) About a minute ago", models.StateExited, 0},
+		{"Created", models.StateCreated, -1},
+		{"Removal In Progress", models.StateRemoving, -1},
+		{"Dead", models.StateDead, -1},
+		{"  Up 5 minutes  ", models.StateRunning, -1},
+		{"Upgrading", models.StateUnknown, -1},
+		{"", models.StateUnknown, -1},
+	}
+	for _, tt := range tests {
+		state, exitCode := ParseContainerStatus(tt.status)
+		if state != tt.state {
+			t.Errorf("ParseContainerStatus(%q) state = %q, want %q", tt.status, state, tt.state)
+		}
+		switch {
+		case tt.exitCode < 0 && exitCode != nil:
+			t.Errorf("ParseContainerStatus(%q) exit code = %d, want none", tt.status, *exitCode)
+		case tt.exitCode >= 0 && (exitCode == nil || *exitCode != tt.exitCode):
+			t.Errorf("ParseContainerStatus(%q) exit code = %v, want %d", tt.status, exitCode, tt.exitCode)
+		}
+	}
+}
+
+func TestContainerUp(t *testing.T) {
+	up := map[string]bool{
+		models.StateRunning:    true,
+		models.StateStarting:   true,
+		models.StateUnhealthy:  true,
+		models.StatePaused:     true,
+		models.StateRestarting: false,
+		models.StateExited:     false,
+		models.StateCreated:    false,
+		models.StateDead:       false,
+		models.StateRemoving:   false,
+		models.StateUnknown:    false,
+	}
+	for state, want := range up {
+		if got := ContainerUp(state); got != want {
+			t.Errorf("ContainerUp(%q) = %v, want %v", state, got, want)
+		}
+	}
+}
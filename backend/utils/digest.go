@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// digestPattern matches a full manifest digest as Ollama pulls by it
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// SplitModelDigest splits a model reference such as
+// "llama2@sha256:8934d96d..." into the model name and its pinned digest,
+// which is empty for a plain model name
+func SplitModelDigest(ref string) (model, digest string) {
+	model, digest, _ = strings.Cut(ref, "@")
+	return model, digest
+}
+
+// NormalizeDigest lowercases a digest and adds the sha256: prefix Ollama's
+// /api/tags leaves off, so digests from either source compare equal
+func NormalizeDigest(digest string) string {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if digest != "" && !strings.Contains(digest, ":") {
+		digest = "sha256:" + digest
+	}
+	return digest
+}
+
+// CheckDigest validates a digest to pin a model to, which must be a full
+// sha256 manifest digest
+func CheckDigest(digest string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("invalid digest %q: expected sha256: followed by 64 lowercase hex digits", digest)
+	}
+	return nil
+}
+
+// PullReference returns what to pass to ollama pull for the model, pinned to
+// digest when one is given
+func PullReference(model, digest string) string {
+	if digest == "" {
+		return model
+	}
+	return model + "@" + digest
+}
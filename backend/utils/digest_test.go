@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:8934d96d3f08982e95922b2b7a2c626a1fe873d7c3b06e8e56d7bc0a1fef9246"
+
+func TestSplitModelDigest(t *testing.T) {
+	tests := map[string][2]string{
+		"llama2":                   {"llama2", ""},
+		"llama2:13b":               {"llama2:13b", ""},
+		"llama2@" + testDigest:     {"llama2", testDigest},
+		"llama2:13b@" + testDigest: {"llama2:13b", testDigest},
+	}
+	for ref, want := range tests {
+		if model, digest := SplitModelDigest(ref); model != want[0] || digest != want[1] {
+			t.Errorf("SplitModelDigest(%q) = %q, %q, want %q, %q", ref, model, digest, want[0], want[1])
+		}
+	}
+}
+
+func TestNormalizeDigest(t *testing.T) {
+	bare := strings.TrimPrefix(testDigest, "sha256:")
+	for _, digest := range []string{testDigest, bare, strings.ToUpper(bare), " " + testDigest + "\n"} {
+		if got := NormalizeDigest(digest); got != testDigest {
+			t.Errorf("NormalizeDigest(%q) = %q, want %q", digest, got, testDigest)
+		}
+	}
+	if got := NormalizeDigest(""); got != "" {
+		t.Errorf("NormalizeDigest(\"\") = %q, want empty", got)
+	}
+}
+
+func TestCheckDigest(t *testing.T) {
+	if err := CheckDigest(testDigest); err != nil {
+		t.Errorf("CheckDigest(%q) = %v", testDigest, err)
+	}
+	for _, digest := range []string{
+		"",
+		strings.TrimPrefix(testDigest, "sha256:"),
+		strings.ToUpper(testDigest),
+		testDigest[:len(testDigest)-1],
+		"sha512:" + strings.TrimPrefix(testDigest, "sha256:"),
+		testDigest + "; rm -rf /",
+	} {
+		if err := CheckDigest(digest); err == nil {
+			t.Errorf("CheckDigest(%q) accepted an invalid digest", digest)
+		}
+	}
+}
+
+func TestGenerateDockerfilePinned(t *testing.T) {
+	dockerfile := GenerateDockerfile("llama2", DockerfileOptions{Digest: testDigest})
+	if !strings.Contains(dockerfile, "ollama pull "+scriptArg("llama2@"+testDigest)) {
+		t.Error("the Dockerfile doesn't pull the pinned digest")
+	}
+	// The pulled model is still listed under its name
+	if !strings.Contains(dockerfile, `"name":"llama2:latest"`) {
+		t.Error("the Dockerfile checks /api/tags for the pinned reference")
+	}
+	if PullReference("llama2", "") != "llama2" {
+		t.Error("an unpinned model pulls with a digest")
+	}
+}
@@ -1,20 +1,101 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 )
 
-// GenerateDockerfile generates a Dockerfile content for the specified model
+// ModelsDir holds the per-model Docker build contexts
+const ModelsDir = "/app/models"
 
-func GenerateDockerfile(model string) string {
-	return fmt.Sprintf(`FROM ollama/ollama:latest
+// PullStatusFile is where the startup script records the outcome of the model pull.
+// It holds "starting", "pulling", "retrying <attempt>/<attempts>" while waiting
+// to pull again after a failed attempt, "warming_up", "success" or "failed: <reason>".
+const PullStatusFile = "/tmp/owngpt-pull-status"
+
+// DefaultNumParallel is the OLLAMA_NUM_PARALLEL model containers get unless
+// their create request sets num_parallel
+const DefaultNumParallel = 2
+
+// DockerfileOptions tunes the generated Dockerfile
+type DockerfileOptions struct {
+	// SkipPreload leaves out the warm-up generation after the pull. The container
+	// becomes ready sooner, but the first chat request pays the model load time.
+	SkipPreload bool
+	// OllamaVersion is the base image tag to build from; empty means latest
+	OllamaVersion string
+	// BaseImage is the Ollama image to build from; empty means ollama/ollama
+	BaseImage string
+	// PullAttempts is how many times the startup script tries ollama pull;
+	// 0 means once. Ollama resumes the layers a failed attempt left partly downloaded.
+	PullAttempts int
+	// PullRetryDelay is the wait before the second attempt, doubling after each
+	PullRetryDelay time.Duration
+	// Digest pins the pull to a manifest digest (sha256:...); empty pulls the tag
+	Digest string
+	// NumParallel is the container's OLLAMA_NUM_PARALLEL, how many requests
+	// Ollama serves at once; 0 means DefaultNumParallel
+	NumParallel int
+}
+
+// NumParallel returns the OLLAMA_NUM_PARALLEL for a requested parallelism,
+// where 0 means DefaultNumParallel
+func NumParallel(requested int) int {
+	if requested <= 0 {
+		return DefaultNumParallel
+	}
+	return requested
+}
+
+// GenerateDockerfile generates a Dockerfile content for the specified model.
+// Every interpolated value is shell-quoted, so model names can't break or
+// inject into the startup script.
+func GenerateDockerfile(model string, opts DockerfileOptions) string {
+	model = strings.ToLower(model)
+	statusFile := scriptArg(PullStatusFile)
+
+	version := opts.OllamaVersion
+	if version == "" {
+		version = "latest"
+	}
+	baseImage := opts.BaseImage
+	if baseImage == "" {
+		baseImage = "ollama/ollama"
+	}
+	pullRef := PullReference(model, opts.Digest)
+	attempts := max(opts.PullAttempts, 1)
+	retryDelay := max(int(opts.PullRetryDelay/time.Second), 1)
+	numParallel := NumParallel(opts.NumParallel)
+
+	preloadBody, _ := json.Marshal(map[string]interface{}{
+		"model":      model,
+		"prompt":     "Hello",
+		"stream":     false,
+		"keep_alive": "5m",
+	})
+	preload := fmt.Sprintf(`echo "warming_up" > %[2]s\n\
+echo "Preloading model for faster responses..."\n\
+curl -X POST http://localhost:11434/api/generate -d %[1]s || true\n\
+\n\
+`, scriptArg(string(preloadBody)), statusFile)
+	if opts.SkipPreload {
+		preload = `echo "Skipping model preload, the first request will load the model"\n\
+\n\
+`
+	}
+
+	return fmt.Sprintf(`FROM %[6]s:%[5]s
 
 # Install curl for health checks
 RUN apt-get update && apt-get install -y curl && rm -rf /var/lib/apt/lists/*
 
 # Set aggressive performance environment variables for sub-6s responses
-ENV OLLAMA_NUM_PARALLEL=2
+ENV OLLAMA_NUM_PARALLEL=%[10]d
 ENV OLLAMA_MAX_LOADED_MODELS=1
 ENV OLLAMA_FLASH_ATTENTION=1
 ENV OLLAMA_LLM_LIBRARY=cpu
@@ -29,10 +110,11 @@ EXPOSE 11434
 # Create optimized startup script
 RUN echo '#!/bin/bash\n\
 set -e\n\
+echo "starting" > %[2]s\n\
 echo "Starting optimized Ollama server..."\n\
 \n\
 # Set aggressive performance options for sub-6s responses\n\
-export OLLAMA_NUM_PARALLEL=2\n\
+export OLLAMA_NUM_PARALLEL=%[10]d\n\
 export OLLAMA_MAX_LOADED_MODELS=1\n\
 export OLLAMA_FLASH_ATTENTION=1\n\
 export OLLAMA_KEEP_ALIVE=10m\n\
@@ -51,16 +133,170 @@ while ! curl -s http://localhost:11434/api/tags >/dev/null 2>&1; do\n\
     echo "Still waiting for Ollama..."\n\
 done\n\
 \n\
-echo "Ollama is ready, pulling model: %s"\n\
-ollama pull %s\n\
-\n\
-echo "Preloading model for faster responses..."\n\
-curl -X POST http://localhost:11434/api/generate -d '"'"'{"model": "%s", "prompt": "Hello", "stream": false, "keep_alive": "5m"}'"'"' || true\n\
+echo "Ollama is ready, pulling model:" %[9]s\n\
+echo "pulling" > %[2]s\n\
+# Retry interrupted pulls, which resume the partly downloaded layers\n\
+attempt=1\n\
+delay=%[8]d\n\
+until ollama pull %[9]s; do\n\
+    if [ "$attempt" -ge %[7]d ]; then\n\
+        echo "failed: ollama pull failed after %[7]d attempts" > %[2]s\n\
+        echo "Failed to pull model" %[9]s\n\
+        kill $OLLAMA_PID\n\
+        exit 1\n\
+    fi\n\
+    attempt=$((attempt + 1))\n\
+    echo "retrying $attempt/%[7]d" > %[2]s\n\
+    echo "Pull failed, retrying in ${delay}s (attempt $attempt of %[7]d)"\n\
+    sleep "$delay"\n\
+    delay=$((delay * 2))\n\
+    echo "pulling" > %[2]s\n\
+done\n\
 \n\
-echo "Model %s is ready and optimized!"\n\
+# Make sure the model actually landed before reporting success\n\
+if ! curl -s http://localhost:11434/api/tags | grep -Fq %[4]s; then\n\
+    echo "failed: model missing from /api/tags after pull" > %[2]s\n\
+    echo "Model" %[1]s "not found after pull"\n\
+    kill $OLLAMA_PID\n\
+    exit 1\n\
+fi\n\
+%[3]secho "success" > %[2]s\n\
+echo "Model" %[1]s "is ready and optimized!"\n\
 wait $OLLAMA_PID' > /usr/local/bin/start-with-model.sh && chmod +x /usr/local/bin/start-with-model.sh
 
 # Override the entrypoint to use our script
 ENTRYPOINT ["/usr/local/bin/start-with-model.sh"]
-`, strings.ToLower(model), strings.ToLower(model), strings.ToLower(model), strings.ToLower(model))
+`, scriptArg(model), statusFile, preload, tagPatterns(model), version, baseImage, attempts, retryDelay, scriptArg(pullRef), numParallel)
+}
+
+// DockerfileTemplateData is what a custom Dockerfile template can refer to,
+// e.g. {{.Model}} or {{.BaseImage}}:{{.OllamaVersion}}
+type DockerfileTemplateData struct {
+	// Model is the lowercased model name
+	Model string
+	// ModelArg is Model quoted as a single shell word, for RUN lines
+	ModelArg      string
+	BaseImage     string
+	OllamaVersion string
+	SkipPreload   bool
+	// Digest is the manifest digest the model is pinned to, or empty; a
+	// template honours a pin by pulling {{.PullRef}} instead of {{.Model}}
+	Digest string
+	// PullRef is the model, with @Digest when pinned, for ollama pull
+	PullRef string
+	// PullRefArg is PullRef quoted as a single shell word, for RUN lines
+	PullRefArg string
+	// NumParallel is the OLLAMA_NUM_PARALLEL to set, which the backend's chat
+	// queue admits as many concurrent chats as
+	NumParallel int
+	// StatusFile is where a startup script can record the pull outcome the
+	// backend waits on, as GenerateDockerfile's script does
+	StatusFile string
+}
+
+// RenderDockerfile renders a user-supplied Dockerfile template for the model
+// in place of GenerateDockerfile. Unknown fields are an error rather than an
+// empty string, so a typo can't silently produce a broken image.
+func RenderDockerfile(tmpl, model string, opts DockerfileOptions) (string, error) {
+	t, err := template.New("Dockerfile").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid Dockerfile template: %v", err)
+	}
+
+	model = strings.ToLower(model)
+	data := DockerfileTemplateData{
+		Model:         model,
+		ModelArg:      ShellQuote(model),
+		BaseImage:     opts.BaseImage,
+		OllamaVersion: opts.OllamaVersion,
+		SkipPreload:   opts.SkipPreload,
+		Digest:        opts.Digest,
+		PullRef:       PullReference(model, opts.Digest),
+		PullRefArg:    ShellQuote(PullReference(model, opts.Digest)),
+		NumParallel:   NumParallel(opts.NumParallel),
+		StatusFile:    PullStatusFile,
+	}
+	if data.BaseImage == "" {
+		data.BaseImage = "ollama/ollama"
+	}
+	if data.OllamaVersion == "" {
+		data.OllamaVersion = "latest"
+	}
+
+	var out strings.Builder
+	if err := t.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render Dockerfile template: %v", err)
+	}
+	return out.String(), nil
+}
+
+// TemplateUsesNumParallel reports whether the template's output depends on
+// {{.NumParallel}}, found by rendering it with two different values. One that
+// doesn't leaves OLLAMA_NUM_PARALLEL to whatever its image sets.
+func TemplateUsesNumParallel(tmpl, model string, opts DockerfileOptions) bool {
+	opts.NumParallel = 1
+	one, err := RenderDockerfile(tmpl, model, opts)
+	if err != nil {
+		return false
+	}
+	opts.NumParallel = 2
+	two, err := RenderDockerfile(tmpl, model, opts)
+	return err == nil && one != two
+}
+
+// ValidateDockerfile checks that a rendered Dockerfile has what the backend
+// relies on: a FROM, an EXPOSE of the Ollama port and an ENTRYPOINT or CMD
+// that starts the server
+func ValidateDockerfile(content string, port int) error {
+	var from, expose, entrypoint bool
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FROM":
+			from = true
+		case "EXPOSE":
+			for _, field := range fields[1:] {
+				if strings.TrimSuffix(field, "/tcp") == strconv.Itoa(port) {
+					expose = true
+				}
+			}
+		case "ENTRYPOINT", "CMD":
+			entrypoint = true
+		}
+	}
+
+	var missing []string
+	if !from {
+		missing = append(missing, "FROM")
+	}
+	if !expose {
+		missing = append(missing, fmt.Sprintf("EXPOSE %d", port))
+	}
+	if !entrypoint {
+		missing = append(missing, "ENTRYPOINT or CMD")
+	}
+	if len(missing) > 0 {
+		return errors.New("Dockerfile is missing " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// tagPatterns returns grep -F arguments matching the model's entry in /api/tags,
+// with or without the implicit :latest tag
+func tagPatterns(model string) string {
+	name, _ := json.Marshal(model)
+	patterns := []string{`"name":` + string(name)}
+	if !strings.Contains(model, ":") {
+		latest, _ := json.Marshal(model + ":latest")
+		patterns = append(patterns, `"name":`+string(latest))
+	}
+
+	args := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		args[i] = "-e " + scriptArg(pattern)
+	}
+	return strings.Join(args, " ")
 }
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateDockerfilePreload(t *testing.T) {
+	withPreload := GenerateDockerfile("llama2", DockerfileOptions{})
+	for _, want := range []string{`echo "warming_up" >`, "http://localhost:11434/api/generate", `"keep_alive":"5m"`} {
+		if !strings.Contains(withPreload, want) {
+			t.Errorf("Dockerfile with preload lacks %q", want)
+		}
+	}
+
+	skipped := GenerateDockerfile("llama2", DockerfileOptions{SkipPreload: true})
+	if strings.Contains(skipped, "/api/generate") || strings.Contains(skipped, "warming_up") {
+		t.Error("Dockerfile without preload still warms the model up")
+	}
+	if !strings.Contains(skipped, "Skipping model preload") || !strings.Contains(skipped, `echo "success" >`) {
+		t.Error("Dockerfile without preload doesn't report success after the pull")
+	}
+}
+
+func TestGenerateDockerfileBaseImage(t *testing.T) {
+	tests := []struct {
+		opts DockerfileOptions
+		want string
+	}{
+		{DockerfileOptions{}, "FROM ollama/ollama:latest\n"},
+		{DockerfileOptions{OllamaVersion: "0.1.32"}, "FROM ollama/ollama:0.1.32\n"},
+		{DockerfileOptions{OllamaVersion: "0.1.32", BaseImage: "mirror.local/ollama"}, "FROM mirror.local/ollama:0.1.32\n"},
+	}
+	for _, tt := range tests {
+		if got := GenerateDockerfile("llama2", tt.opts); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%+v: Dockerfile starts %q, want %q", tt.opts, strings.SplitN(got, "\n", 2)[0], tt.want)
+		}
+	}
+}
+
+func TestRenderDockerfile(t *testing.T) {
+	tmpl := "FROM {{.BaseImage}}:{{.OllamaVersion}}\nRUN ollama pull {{.PullRefArg}}\n"
+	got, err := RenderDockerfile(tmpl, "LLaMA2", DockerfileOptions{Digest: "sha256:abc"})
+	if err != nil {
+		t.Fatalf("RenderDockerfile: %v", err)
+	}
+	if want := "FROM ollama/ollama:latest\nRUN ollama pull 'llama2@sha256:abc'\n"; got != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"FROM {{.Modle}}", "FROM {{.Model"} {
+		if _, err := RenderDockerfile(bad, "llama2", DockerfileOptions{}); err == nil {
+			t.Errorf("template %q rendered without an error", bad)
+		}
+	}
+}
+
+func TestValidateDockerfile(t *testing.T) {
+	tests := []struct {
+		content string
+		missing string
+	}{
+		{"FROM ollama/ollama\nEXPOSE 11434\nENTRYPOINT [\"ollama\", \"serve\"]", ""},
+		{"from ollama/ollama\nexpose 11434/tcp\ncmd serve", ""},
+		{"FROM ollama/ollama\nEXPOSE 8080\nCMD serve", "EXPOSE 11434"},
+		{"# FROM ollama/ollama\nEXPOSE 11434\nCMD serve", "FROM"},
+		{"FROM ollama/ollama\nEXPOSE 11434", "ENTRYPOINT or CMD"},
+	}
+	for _, tt := range tests {
+		err := ValidateDockerfile(tt.content, 11434)
+		if tt.missing == "" && err != nil {
+			t.Errorf("%q: %v, want it valid", tt.content, err)
+		}
+		if tt.missing != "" && (err == nil || !strings.Contains(err.Error(), tt.missing)) {
+			t.Errorf("%q: err = %v, want %s missing", tt.content, err, tt.missing)
+		}
+	}
+
+	// The generated Dockerfile meets its own requirements
+	if err := ValidateDockerfile(GenerateDockerfile("llama2", DockerfileOptions{}), 11434); err != nil {
+		t.Errorf("generated Dockerfile: %v", err)
+	}
+}
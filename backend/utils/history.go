@@ -0,0 +1,77 @@
+package utils
+
+import "owngpt/models"
+
+// TrimHistory drops the oldest turns of a conversation until it fits within
+// budget tokens. A turn is a user message and the replies that follow it.
+// System messages are always kept. It returns the kept history, the dropped
+// messages and how many turns were dropped.
+func TrimHistory(history []models.OllamaChatMessage, budget int) (kept, evicted []models.OllamaChatMessage, turns int) {
+	total := 0
+	for _, message := range history {
+		total += EstimateMessageTokens(message.Content)
+	}
+	if total <= budget {
+		return history, nil, 0
+	}
+
+	dropped := make([]bool, len(history))
+	for i := 0; i < len(history) && total > budget; {
+		if history[i].Role == "system" {
+			i++
+			continue
+		}
+
+		// Drop the whole turn, up to the next user message
+		turns++
+		for first := true; i < len(history); i++ {
+			role := history[i].Role
+			if role == "system" {
+				continue
+			}
+			if role == "user" && !first {
+				break
+			}
+			first = false
+			dropped[i] = true
+			total -= EstimateMessageTokens(history[i].Content)
+		}
+	}
+
+	for i, message := range history {
+		if dropped[i] {
+			evicted = append(evicted, message)
+		} else {
+			kept = append(kept, message)
+		}
+	}
+	return kept, evicted, turns
+}
+
+// KeepTurns drops the oldest turns of a conversation beyond its last maxTurns,
+// along with any replies that come before the first of them. System messages
+// are always kept. It returns the kept history and how many turns were
+// dropped; a maxTurns of 0 keeps everything.
+func KeepTurns(history []models.OllamaChatMessage, maxTurns int) (kept []models.OllamaChatMessage, turns int) {
+	total := 0
+	for _, message := range history {
+		if message.Role == "user" {
+			total++
+		}
+	}
+	if maxTurns <= 0 || total <= maxTurns {
+		return history, 0
+	}
+
+	turns = total - maxTurns
+	users := 0
+	for _, message := range history {
+		if message.Role == "user" {
+			users++
+		}
+		if message.Role == "system" || users > turns {
+			kept = append(kept, message)
+		}
+	}
+	return kept, turns
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"owngpt/models"
+)
+
+// conversation builds chat messages from role, content pairs
+func conversation(pairs ...string) []models.OllamaChatMessage {
+	var history []models.OllamaChatMessage
+	for i := 0; i+1 < len(pairs); i += 2 {
+		history = append(history, models.OllamaChatMessage{Role: pairs[i], Content: pairs[i+1]})
+	}
+	return history
+}
+
+func TestTrimHistory(t *testing.T) {
+	// Each message is one token of text plus the template overhead, 5 in all
+	history := conversation(
+		"system", "rule",
+		"user", "q1",
+		"assistant", "a1",
+		"user", "q2",
+		"assistant", "a2",
+		"user", "q3",
+	)
+
+	tests := []struct {
+		name    string
+		budget  int
+		kept    []models.OllamaChatMessage
+		evicted []models.OllamaChatMessage
+		turns   int
+	}{
+		{"fits", 30, history, nil, 0},
+		{"one turn over", 25, conversation("system", "rule", "user", "q2", "assistant", "a2", "user", "q3"), conversation("user", "q1", "assistant", "a1"), 1},
+		{"two turns over", 15, conversation("system", "rule", "user", "q3"), conversation("user", "q1", "assistant", "a1", "user", "q2", "assistant", "a2"), 2},
+		{"only the system prompt fits", 5, conversation("system", "rule"), history[1:], 3},
+	}
+	for _, tt := range tests {
+		kept, evicted, turns := TrimHistory(history, tt.budget)
+		if !reflect.DeepEqual(kept, tt.kept) || !reflect.DeepEqual(evicted, tt.evicted) || turns != tt.turns {
+			t.Errorf("%s: TrimHistory = %v, %v, %d; want %v, %v, %d", tt.name, kept, evicted, turns, tt.kept, tt.evicted, tt.turns)
+		}
+	}
+}
+
+func TestTrimHistoryKeepsSystemMidway(t *testing.T) {
+	history := conversation("user", "q1", "system", "rule", "assistant", "a1", "user", "q2")
+	kept, evicted, turns := TrimHistory(history, 10)
+	if want := conversation("system", "rule", "user", "q2"); !reflect.DeepEqual(kept, want) {
+		t.Errorf("kept %v, want %v", kept, want)
+	}
+	if want := conversation("user", "q1", "assistant", "a1"); !reflect.DeepEqual(evicted, want) || turns != 1 {
+		t.Errorf("evicted %v in %d turns, want %v in 1", evicted, turns, want)
+	}
+}
+
+func TestKeepTurns(t *testing.T) {
+	history := conversation(
+		"system", "rule",
+		"assistant", "welcome",
+		"user", "q1",
+		"assistant", "a1",
+		"user", "q2",
+		"assistant", "a2",
+		"user", "q3",
+		"assistant", "a3",
+	)
+
+	tests := []struct {
+		name     string
+		maxTurns int
+		kept     []models.OllamaChatMessage
+		turns    int
+	}{
+		{"no limit", 0, history, 0},
+		{"fits", 3, history, 0},
+		{"one turn over", 2, conversation("system", "rule", "user", "q2", "assistant", "a2", "user", "q3", "assistant", "a3"), 1},
+		{"last turn only", 1, conversation("system", "rule", "user", "q3", "assistant", "a3"), 2},
+	}
+	for _, tt := range tests {
+		kept, turns := KeepTurns(history, tt.maxTurns)
+		if !reflect.DeepEqual(kept, tt.kept) || turns != tt.turns {
+			t.Errorf("%s: kept %v dropping %d turns, want %v dropping %d", tt.name, kept, turns, tt.kept, tt.turns)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// JSONStream assembles a JSON completion streamed token by token, whose
+// fragments aren't valid JSON on their own. When the completion is an array,
+// Write returns each of its elements as soon as it is complete, so they can be
+// streamed as whole values; anything else is only usable once finished.
+type JSONStream struct {
+	text []byte
+	// scanned is how much of text has been scanned
+	scanned int
+	// started is set once the first non-space byte is seen, and array when
+	// that was the opening bracket of an array
+	started, array bool
+	// depth is the nesting level, 1 inside the top-level array
+	depth            int
+	inString, escape bool
+	// element is where the current array element starts, or -1 between elements
+	element int
+}
+
+// NewJSONStream returns an empty JSONStream
+func NewJSONStream() *JSONStream {
+	return &JSONStream{element: -1}
+}
+
+// Write takes the next piece of the completion and returns the array elements
+// it completes, each checked to be valid JSON. Elements that aren't are left
+// out, and make Check fail.
+func (s *JSONStream) Write(token string) []json.RawMessage {
+	s.text = append(s.text, token...)
+
+	var elements []json.RawMessage
+	for ; s.scanned < len(s.text); s.scanned++ {
+		i, b := s.scanned, s.text[s.scanned]
+		if !s.started {
+			if isJSONSpace(b) {
+				continue
+			}
+			s.started = true
+			if b != '[' {
+				// Not an array, so there is nothing to return before the end
+				s.scanned = len(s.text)
+				break
+			}
+			s.array, s.depth = true, 1
+			continue
+		}
+		if !s.array || s.depth == 0 {
+			s.scanned = len(s.text)
+			break
+		}
+
+		if s.inString {
+			switch {
+			case s.escape:
+				s.escape = false
+			case b == '\\':
+				s.escape = true
+			case b == '"':
+				s.inString = false
+			}
+			continue
+		}
+		if s.depth == 1 && s.element < 0 && !isJSONSpace(b) && b != ',' && b != ']' {
+			s.element = i
+		}
+		switch b {
+		case '"':
+			s.inString = true
+		case '{', '[':
+			s.depth++
+		case '}', ']':
+			s.depth--
+			switch {
+			case s.depth == 1:
+				elements = s.appendElement(elements, i+1)
+			case s.depth == 0:
+				// The closing bracket ends a trailing scalar element
+				elements = s.appendElement(elements, i)
+			}
+		case ',':
+			if s.depth == 1 {
+				elements = s.appendElement(elements, i)
+			}
+		}
+	}
+	return elements
+}
+
+// appendElement ends the current array element at end, appending it to
+// elements when it is valid JSON
+func (s *JSONStream) appendElement(elements []json.RawMessage, end int) []json.RawMessage {
+	if s.element < 0 {
+		return elements
+	}
+	element := bytes.TrimSpace(s.text[s.element:end])
+	s.element = -1
+	if len(element) == 0 || !json.Valid(element) {
+		return elements
+	}
+	return append(elements, json.RawMessage(bytes.Clone(element)))
+}
+
+// Text returns the completion written so far
+func (s *JSONStream) Text() string {
+	return string(s.text)
+}
+
+// Check reports whether the finished completion is one valid JSON value
+func (s *JSONStream) Check() error {
+	if len(bytes.TrimSpace(s.text)) == 0 {
+		return errors.New("the reply is empty")
+	}
+	var value interface{}
+	if err := json.Unmarshal(s.text, &value); err != nil {
+		return fmt.Errorf("the reply is not valid JSON: %v", err)
+	}
+	return nil
+}
+
+// isJSONSpace reports whether b is whitespace between JSON tokens
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
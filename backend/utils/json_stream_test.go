@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// streamJSON writes text to a JSONStream in tokens of size bytes, returning
+// the elements it completed
+func streamJSON(text string, size int) (*JSONStream, []string) {
+	s := NewJSONStream()
+	var elements []string
+	for start := 0; start < len(text); start += size {
+		for _, element := range s.Write(text[start:min(start+size, len(text))]) {
+			elements = append(elements, string(element))
+		}
+	}
+	return s, elements
+}
+
+func TestJSONStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		elements []string
+		valid    bool
+	}{
+		{"scalars", `[1, 2.5, "three", true, null]`, []string{`1`, `2.5`, `"three"`, `true`, `null`}, true},
+		{"objects", `[{"a": 1}, {"b": 2}]`, []string{`{"a": 1}`, `{"b": 2}`}, true},
+		{"brackets and commas in strings", `["a,b", "c]d", {"e": "f], [g"}]`, []string{`"a,b"`, `"c]d"`, `{"e": "f], [g"}`}, true},
+		{"escaped quotes", `["say \"hi\"]", "\\"]`, []string{`"say \"hi\"]"`, `"\\"`}, true},
+		{"nested arrays", `[[1, 2], [3, [4, 5]], {"x": [6]}]`, []string{`[1, 2]`, `[3, [4, 5]]`, `{"x": [6]}`}, true},
+		{"whitespace", "\n  [\n  1 ,\n  {\"a\" : 2}\n]\n", []string{`1`, `{"a" : 2}`}, true},
+		{"empty array", `[]`, nil, true},
+		{"top-level object", `{"items": [1, 2]}`, nil, true},
+		{"top-level string", `"[1, 2]"`, nil, true},
+		{"truncated", `[{"a": 1}, {"b": [2, `, []string{`{"a": 1}`}, false},
+		{"truncated in a string", `["one", "tw`, []string{`"one"`}, false},
+		{"invalid element", `[1, tru, 3]`, []string{`1`, `3`}, false},
+		{"empty", "  ", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// However the reply is split into tokens, the same elements come out
+			for _, size := range []int{1, 2, 3, 7, len(tt.text) + 1} {
+				s, elements := streamJSON(tt.text, size)
+				if !reflect.DeepEqual(elements, tt.elements) {
+					t.Errorf("tokens of %d bytes: elements %q, want %q", size, elements, tt.elements)
+				}
+				if s.Text() != tt.text {
+					t.Errorf("tokens of %d bytes: text %q", size, s.Text())
+				}
+				if err := s.Check(); (err == nil) != tt.valid {
+					t.Errorf("tokens of %d bytes: Check() = %v, want valid %v", size, err, tt.valid)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONStreamReturnsElementsWhenComplete(t *testing.T) {
+	s := NewJSONStream()
+	steps := []struct {
+		token string
+		want  []string
+	}{
+		{`[{"a": `, nil},
+		{`1}`, []string{`{"a": 1}`}},
+		{`, 2`, nil},
+		{`, [3`, []string{`2`}},
+		{`]`, []string{`[3]`}},
+		{` ]`, nil},
+	}
+	for _, step := range steps {
+		var got []string
+		for _, element := range s.Write(step.token) {
+			got = append(got, string(element))
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("after %q: elements %q, want %q", s.Text(), got, step.want)
+		}
+	}
+}
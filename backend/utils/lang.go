@@ -0,0 +1,59 @@
+package utils
+
+import "strings"
+
+// languages maps the BCP-47 codes accepted as a reply language to the name
+// the model is asked to respond in
+var languages = map[string]string{
+	"ar":    "Arabic",
+	"bn":    "Bengali",
+	"cs":    "Czech",
+	"da":    "Danish",
+	"de":    "German",
+	"el":    "Greek",
+	"en":    "English",
+	"en-GB": "British English",
+	"en-US": "American English",
+	"es":    "Spanish",
+	"es-MX": "Mexican Spanish",
+	"fa":    "Persian",
+	"fi":    "Finnish",
+	"fr":    "French",
+	"fr-CA": "Canadian French",
+	"he":    "Hebrew",
+	"hi":    "Hindi",
+	"hu":    "Hungarian",
+	"id":    "Indonesian",
+	"it":    "Italian",
+	"ja":    "Japanese",
+	"ko":    "Korean",
+	"ms":    "Malay",
+	"nb":    "Norwegian Bokmål",
+	"nl":    "Dutch",
+	"pl":    "Polish",
+	"pt":    "Portuguese",
+	"pt-BR": "Brazilian Portuguese",
+	"ro":    "Romanian",
+	"ru":    "Russian",
+	"sv":    "Swedish",
+	"ta":    "Tamil",
+	"th":    "Thai",
+	"tr":    "Turkish",
+	"uk":    "Ukrainian",
+	"ur":    "Urdu",
+	"vi":    "Vietnamese",
+	"zh":    "Chinese",
+	"zh-CN": "Simplified Chinese",
+	"zh-TW": "Traditional Chinese",
+}
+
+// LanguageName returns the name of the language a BCP-47 code names, if it is
+// supported. Codes are matched case-insensitively, as BCP-47 specifies.
+func LanguageName(code string) (string, bool) {
+	for supported, name := range languages {
+		if strings.EqualFold(code, supported) {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,23 @@
+package utils
+
+import "testing"
+
+func TestLanguageName(t *testing.T) {
+	tests := []struct {
+		code, want string
+		ok         bool
+	}{
+		{"fr", "French", true},
+		{"pt-BR", "Brazilian Portuguese", true},
+		{"PT-br", "Brazilian Portuguese", true},
+		{"zh-tw", "Traditional Chinese", true},
+		{"pt_BR", "", false},
+		{"klingon", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := LanguageName(tt.code); got != tt.want || ok != tt.ok {
+			t.Errorf("LanguageName(%q) = %q, %v; want %q, %v", tt.code, got, ok, tt.want, tt.ok)
+		}
+	}
+}
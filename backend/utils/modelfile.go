@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"owngpt/models"
+)
+
+// modelfileParameters are the PARAMETER names Ollama accepts
+var modelfileParameters = map[string]bool{
+	"mirostat": true, "mirostat_eta": true, "mirostat_tau": true,
+	"num_ctx": true, "num_batch": true, "num_gpu": true, "num_thread": true, "num_predict": true,
+	"repeat_last_n": true, "repeat_penalty": true, "temperature": true, "seed": true,
+	"stop": true, "tfs_z": true, "top_k": true, "top_p": true, "min_p": true,
+	"typical_p": true, "presence_penalty": true, "frequency_penalty": true,
+	"penalize_newline": true, "num_keep": true, "use_mmap": true, "use_mlock": true,
+}
+
+// modelfileRoles are the roles a MESSAGE directive may use
+var modelfileRoles = map[string]bool{"system": true, "user": true, "assistant": true}
+
+// ValidateModelfile checks Modelfile syntax without building anything: a FROM
+// line is present, every directive is recognized and has its arguments, and
+// quotes are balanced. Issues carry 1-based line numbers.
+func ValidateModelfile(content string) []models.ModelfileIssue {
+	var issues []models.ModelfileIssue
+	addIssue := func(line int, format string, args ...interface{}) {
+		issues = append(issues, models.ModelfileIssue{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	hasFrom := false
+
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		directive, args := cutSpace(line)
+		directive = strings.ToUpper(directive)
+		args = strings.TrimSpace(args)
+
+		// Triple-quoted values may span several lines
+		if strings.Contains(args, `"""`) {
+			if strings.Count(args, `"""`) == 1 {
+				closed := false
+				for i+1 < len(lines) {
+					i++
+					if strings.Contains(lines[i], `"""`) {
+						closed = true
+						break
+					}
+				}
+				if !closed {
+					addIssue(lineNo, `unterminated """ block`)
+				}
+			} else if strings.Count(args, `"""`) > 2 {
+				addIssue(lineNo, `unbalanced """ quotes`)
+			}
+		} else if strings.Count(args, `"`)%2 != 0 {
+			addIssue(lineNo, "unbalanced quotes")
+		}
+
+		switch directive {
+		case "FROM":
+			hasFrom = true
+			if args == "" {
+				addIssue(lineNo, "FROM requires a model name or path")
+			}
+		case "PARAMETER":
+			fields := strings.Fields(args)
+			if len(fields) < 2 {
+				addIssue(lineNo, "PARAMETER requires a name and a value")
+			} else if !modelfileParameters[strings.ToLower(fields[0])] {
+				addIssue(lineNo, "unknown parameter %q", fields[0])
+			}
+		case "MESSAGE":
+			role, _ := cutSpace(args)
+			if !modelfileRoles[strings.ToLower(role)] {
+				addIssue(lineNo, "MESSAGE role must be system, user or assistant")
+			}
+		case "TEMPLATE", "SYSTEM", "ADAPTER", "LICENSE", "REQUIRES":
+			if args == "" {
+				addIssue(lineNo, "%s requires a value", directive)
+			}
+		default:
+			addIssue(lineNo, "unknown directive %q", directive)
+		}
+	}
+
+	if !hasFrom {
+		addIssue(0, "missing FROM directive")
+	}
+	return issues
+}
+
+// cutSpace splits s at its first whitespace, so a tab works as well as a
+// space between a directive and its arguments
+func cutSpace(s string) (before, after string) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
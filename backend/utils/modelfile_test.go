@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateModelfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		issues  []string
+	}{
+		{"minimal", "FROM llama2", nil},
+		{"tab after directive", "FROM\tllama2\nPARAMETER\ttemperature 0.5\nSYSTEM\tBe brief.", nil},
+		{"tab after message role", "FROM llama2\nMESSAGE user\tHello", nil},
+		{"several spaces", "FROM   llama2\nPARAMETER  top_k  20", nil},
+		{"lower case directive", "from llama2\nparameter temperature 0.5", nil},
+		{"comments and blank lines", "# base\n\nFROM llama2\r\n", nil},
+		{"multi-line system", "FROM llama2\nSYSTEM \"\"\"\nBe brief.\n\"\"\"", nil},
+		{"missing from", "PARAMETER temperature 0.5", []string{"0: missing FROM directive"}},
+		{"from without model", "FROM", []string{"1: FROM requires a model name or path"}},
+		{"unknown directive", "FROM llama2\nRUN echo", []string{`2: unknown directive "RUN"`}},
+		{"unknown parameter", "FROM llama2\nPARAMETER\tcolor blue", []string{`2: unknown parameter "color"`}},
+		{"parameter without value", "FROM llama2\nPARAMETER temperature", []string{"2: PARAMETER requires a name and a value"}},
+		{"bad message role", "FROM llama2\nMESSAGE\tbot Hi", []string{"2: MESSAGE role must be system, user or assistant"}},
+		{"unbalanced quotes", "FROM llama2\nSYSTEM \"Be brief", []string{"2: unbalanced quotes"}},
+		{"unterminated block", "FROM llama2\nTEMPLATE \"\"\"\n{{ .Prompt }}", []string{`2: unterminated """ block`}},
+		{"empty system", "FROM llama2\nSYSTEM\t", []string{"2: SYSTEM requires a value"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, issue := range ValidateModelfile(tt.content) {
+				got = append(got, fmt.Sprintf("%d: %s", issue.Line, issue.Message))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.issues, "\n") {
+				t.Errorf("issues %q, want %q", got, tt.issues)
+			}
+		})
+	}
+}
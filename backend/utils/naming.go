@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ModelLabel carries the exact model name on containers OWNGPT creates
+	ModelLabel = "owngpt.model"
+	// ManagedLabel marks containers created by OWNGPT
+	ManagedLabel = "owngpt.managed"
+	// CustomLabelsLabel lists the keys of the custom labels a container was
+	// created with, separated by semicolons, telling them apart from the
+	// image's own labels
+	CustomLabelsLabel = "owngpt.labels"
+	// PlatformLabel carries the platform a container's image was built for
+	PlatformLabel = "owngpt.platform"
+)
+
+// NormalizeModelName lowercases and trims a model name; Ollama model names are case-insensitive
+func NormalizeModelName(model string) string {
+	return strings.ToLower(strings.TrimSpace(model))
+}
+
+// EncodeModelName turns a model name into a string usable in Docker image and
+// container names. Lowercase letters, digits, '.' and '-' are kept and every
+// other byte becomes '_' followed by two hex digits, so "llama2:13b" encodes
+// to "llama2_3a13b" and decodes back exactly.
+func EncodeModelName(model string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(NormalizeModelName(model)) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= '0' && b <= '9', b == '.', b == '-':
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "_%02x", b)
+		}
+	}
+	return encoded.String()
+}
+
+// DecodeModelName reverses EncodeModelName. Names from before the encoding
+// (which replaced ':' and '/' with '-') decode to themselves.
+func DecodeModelName(encoded string) string {
+	var decoded strings.Builder
+	for i := 0; i < len(encoded); i++ {
+		if encoded[i] == '_' && i+2 < len(encoded) {
+			if b, err := strconv.ParseUint(encoded[i+1:i+3], 16, 8); err == nil {
+				decoded.WriteByte(byte(b))
+				i += 2
+				continue
+			}
+		}
+		decoded.WriteByte(encoded[i])
+	}
+	return decoded.String()
+}
+
+// ImageName returns the Docker image name for a model
+func ImageName(model string) string {
+	return "ollama-" + EncodeModelName(model)
+}
+
+// ContainerName returns the Docker container name for a model
+func ContainerName(model string) string {
+	return ImageName(model) + "-container"
+}
+
+// updateSuffix marks the container a rolling update starts next to the one
+// serving the model, until it takes over the model's container name
+const updateSuffix = "-next"
+
+// UpdateContainerName returns the name of the container a rolling update of
+// the model starts before swapping it in
+func UpdateContainerName(model string) string {
+	return ContainerName(model) + updateSuffix
+}
+
+// IsUpdateContainer reports whether the container is a rolling update's new container
+func IsUpdateContainer(containerName string) bool {
+	return IsModelContainer(strings.TrimSuffix(containerName, updateSuffix)) && strings.HasSuffix(containerName, updateSuffix)
+}
+
+// IsModelContainer reports whether the container name follows OWNGPT's naming scheme
+func IsModelContainer(containerName string) bool {
+	return strings.HasPrefix(containerName, "ollama-") && strings.HasSuffix(containerName, "-container")
+}
+
+// ModelNameFromContainer recovers the model name from a container name,
+// including a rolling update's new container
+func ModelNameFromContainer(containerName string) string {
+	if IsUpdateContainer(containerName) {
+		containerName = strings.TrimSuffix(containerName, updateSuffix)
+	}
+	return DecodeModelName(strings.TrimSuffix(strings.TrimPrefix(containerName, "ollama-"), "-container"))
+}
+
+// ModelNameFromImage recovers the model name from an image name, ignoring the tag
+func ModelNameFromImage(imageName string) string {
+	if i := strings.LastIndex(imageName, ":"); i >= 0 {
+		imageName = imageName[:i]
+	}
+	return DecodeModelName(strings.TrimPrefix(imageName, "ollama-"))
+}
@@ -0,0 +1,61 @@
+package utils
+
+import "testing"
+
+func TestContainerNamesRoundTrip(t *testing.T) {
+	tests := []struct {
+		model     string
+		container string
+	}{
+		{"llama2", "ollama-llama2-container"},
+		{"llama2:13b", "ollama-llama2_3a13b-container"},
+		{"library/mistral:7b-instruct", "ollama-library_2fmistral_3a7b-instruct-container"},
+		{"hf.co/org/model_v2", "ollama-hf.co_2forg_2fmodel_5fv2-container"},
+		{"  LLaMA2:Latest ", "ollama-llama2_3alatest-container"},
+	}
+	for _, tt := range tests {
+		name := ContainerName(tt.model)
+		if name != tt.container {
+			t.Errorf("ContainerName(%q) = %q, want %q", tt.model, name, tt.container)
+		}
+		if !IsModelContainer(name) || IsUpdateContainer(name) {
+			t.Errorf("%q isn't recognized as a model container", name)
+		}
+		want := NormalizeModelName(tt.model)
+		if got := ModelNameFromContainer(name); got != want {
+			t.Errorf("ModelNameFromContainer(%q) = %q, want %q", name, got, want)
+		}
+		if got := ModelNameFromImage(ImageName(tt.model) + ":latest"); got != want {
+			t.Errorf("ModelNameFromImage(%q) = %q, want %q", ImageName(tt.model), got, want)
+		}
+
+		next := UpdateContainerName(tt.model)
+		if !IsUpdateContainer(next) || ModelNameFromContainer(next) != want {
+			t.Errorf("update container %q doesn't map back to %q", next, want)
+		}
+	}
+}
+
+func TestDecodeLegacyNames(t *testing.T) {
+	// Names from before the encoding decode to themselves
+	for _, name := range []string{"llama2-13b", "mistral", "a_b", "x_zz"} {
+		if got := DecodeModelName(name); got != name {
+			t.Errorf("DecodeModelName(%q) = %q", name, got)
+		}
+	}
+}
+
+func TestIsModelContainer(t *testing.T) {
+	tests := map[string]bool{
+		"ollama-llama2-container":      true,
+		"ollama-llama2-container-next": false,
+		"ollama":                       false,
+		"my-ollama-container":          false,
+		"ollama-llama2":                false,
+	}
+	for name, want := range tests {
+		if got := IsModelContainer(name); got != want {
+			t.Errorf("IsModelContainer(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"owngpt/models"
+)
+
+// OutputFilter cleans up completions for display: it removes sections wrapped
+// in the given tags, such as <think>...</think>, and can trim the whitespace
+// around the result. A section that is never closed runs to the end of the
+// completion. Use Apply on a whole completion, or Write and Flush on a stream.
+// A nil filter passes text through unchanged.
+type OutputFilter struct {
+	tags []string
+	trim bool
+	// sections matches a tagged section in a whole completion
+	sections *regexp.Regexp
+
+	// pending is streamed text held back because it may be part of a tag
+	pending string
+	// offset is where pending starts in the completion
+	offset int
+	// inside is the tag whose section the stream is in, if any
+	inside string
+	// started is set once the stream has emitted something other than whitespace
+	started bool
+	// space is trailing whitespace held back until more text follows it,
+	// taken from the spaceRanges of the completion
+	space       string
+	spaceRanges []textRange
+	// marks are the streamed tokens whose log probabilities wait for their
+	// text to be shown or dropped
+	marks []logprobMark
+}
+
+// textRange is a part of a completion, by byte offsets
+type textRange struct {
+	start, end int
+}
+
+// logprobMark is a streamed token's place in the completion, with its log
+// probabilities and whether any of its text has been shown
+type logprobMark struct {
+	textRange
+	shown    bool
+	logprobs []models.TokenLogprob
+}
+
+// NewOutputFilter returns a filter stripping the tags' sections and trimming
+// whitespace when trim is set, or nil when it would do nothing
+func NewOutputFilter(tags []string, trim bool) *OutputFilter {
+	if len(tags) == 0 && !trim {
+		return nil
+	}
+	f := &OutputFilter{tags: tags, trim: trim}
+	if len(tags) > 0 {
+		alternatives := make([]string, len(tags))
+		for i, tag := range tags {
+			tag = regexp.QuoteMeta(tag)
+			alternatives[i] = "<" + tag + ">.*?(?:</" + tag + ">|$)"
+		}
+		f.sections = regexp.MustCompile("(?s)" + strings.Join(alternatives, "|"))
+	}
+	return f
+}
+
+// Apply cleans up a whole completion
+func (f *OutputFilter) Apply(text string) string {
+	if f == nil {
+		return text
+	}
+	if f.sections != nil {
+		text = f.sections.ReplaceAllString(text, "")
+	}
+	if f.trim {
+		text = strings.TrimSpace(text)
+	}
+	return text
+}
+
+// Write takes the next piece of a streamed completion and returns the text
+// that can be shown so far. Text that might start a tag is held back until
+// the following pieces settle it.
+func (f *OutputFilter) Write(token string) string {
+	text, _ := f.WriteLogprobs(token, nil)
+	return text
+}
+
+// WriteLogprobs is Write for a token with its log probabilities. They are
+// returned with the text they belong to once it is shown, or dropped with it
+// when it is stripped or trimmed away.
+func (f *OutputFilter) WriteLogprobs(token string, logprobs []models.TokenLogprob) (string, []models.TokenLogprob) {
+	if f == nil {
+		return token, logprobs
+	}
+	if len(logprobs) > 0 {
+		start := f.offset + len(f.pending)
+		f.marks = append(f.marks, logprobMark{textRange: textRange{start, start + len(token)}, logprobs: logprobs})
+	}
+	f.pending += token
+
+	var out strings.Builder
+	for {
+		if f.inside != "" {
+			closing := "</" + f.inside + ">"
+			end := strings.Index(f.pending, closing)
+			if end < 0 {
+				// Only a partial closing tag at the end needs keeping
+				f.skip(len(f.pending) - partialSuffix(f.pending, []string{closing}))
+				break
+			}
+			f.skip(end + len(closing))
+			f.inside = ""
+			continue
+		}
+
+		start, tag := -1, ""
+		for _, t := range f.tags {
+			if i := strings.Index(f.pending, "<"+t+">"); i >= 0 && (start < 0 || i < start) {
+				start, tag = i, t
+			}
+		}
+		if start < 0 {
+			keep := partialSuffix(f.pending, f.openingTags())
+			out.WriteString(f.show(len(f.pending) - keep))
+			break
+		}
+		out.WriteString(f.show(start))
+		f.skip(len(tag) + 2)
+		f.inside = tag
+	}
+	return out.String(), f.settled()
+}
+
+// Flush returns what was held back once the stream has ended. An unclosed
+// section is dropped, and trailing whitespace too when trimming.
+func (f *OutputFilter) Flush() string {
+	text, _ := f.FlushLogprobs()
+	return text
+}
+
+// FlushLogprobs is Flush returning the log probabilities of the text it
+// shows
+func (f *OutputFilter) FlushLogprobs() (string, []models.TokenLogprob) {
+	if f == nil {
+		return "", nil
+	}
+	out := ""
+	if f.inside == "" {
+		out = f.show(len(f.pending))
+	}
+	f.skip(len(f.pending))
+	f.inside = ""
+	if !f.trim {
+		out += f.space
+		f.mark(f.spaceRanges...)
+	}
+	f.space, f.spaceRanges = "", nil
+	return out, f.settled()
+}
+
+// show takes the first n bytes of pending as text to show, applying
+// whitespace trimming: leading whitespace is dropped and trailing whitespace
+// waits to see if more follows
+func (f *OutputFilter) show(n int) string {
+	text, start := f.pending[:n], f.offset
+	f.skip(n)
+	if text == "" {
+		return ""
+	}
+	if !f.trim {
+		f.mark(textRange{start, start + n})
+		return text
+	}
+	if !f.started {
+		trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+		start += len(text) - len(trimmed)
+		if text = trimmed; text == "" {
+			return ""
+		}
+		f.started = true
+	}
+	trimmed := strings.TrimRightFunc(text, unicode.IsSpace)
+	if trimmed == "" {
+		f.space += text
+		f.spaceRanges = append(f.spaceRanges, textRange{start, start + len(text)})
+		return ""
+	}
+	out := f.space + trimmed
+	f.mark(f.spaceRanges...)
+	f.mark(textRange{start, start + len(trimmed)})
+	f.space, f.spaceRanges = text[len(trimmed):], nil
+	if f.space != "" {
+		f.spaceRanges = []textRange{{start + len(trimmed), start + len(text)}}
+	}
+	return out
+}
+
+// skip moves past the first n bytes of pending
+func (f *OutputFilter) skip(n int) {
+	f.pending = f.pending[n:]
+	f.offset += n
+}
+
+// mark records that the text in the ranges is shown
+func (f *OutputFilter) mark(ranges ...textRange) {
+	for _, r := range ranges {
+		if r.start == r.end {
+			continue
+		}
+		for i := range f.marks {
+			if f.marks[i].start < r.end && r.start < f.marks[i].end {
+				f.marks[i].shown = true
+			}
+		}
+	}
+}
+
+// settled returns the log probabilities of the tokens whose text has all been
+// shown or dropped, keeping only those with text that was shown
+func (f *OutputFilter) settled() []models.TokenLogprob {
+	undecided := f.offset
+	if len(f.spaceRanges) > 0 {
+		undecided = f.spaceRanges[0].start
+	}
+	var logprobs []models.TokenLogprob
+	for len(f.marks) > 0 && f.marks[0].end <= undecided {
+		if f.marks[0].shown {
+			logprobs = append(logprobs, f.marks[0].logprobs...)
+		}
+		f.marks = f.marks[1:]
+	}
+	return logprobs
+}
+
+// openingTags returns the tags as they open a section, e.g. <think>
+func (f *OutputFilter) openingTags() []string {
+	opening := make([]string, len(f.tags))
+	for i, tag := range f.tags {
+		opening[i] = "<" + tag + ">"
+	}
+	return opening
+}
+
+// partialSuffix returns the length of the longest end of text that is the
+// start of one of the markers, which the next piece of text may complete
+func partialSuffix(text string, markers []string) int {
+	longest := 0
+	for _, marker := range markers {
+		for n := min(len(marker)-1, len(text)); n > longest; n-- {
+			if strings.HasSuffix(text, marker[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
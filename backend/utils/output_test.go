@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"owngpt/models"
+)
+
+// streamPiece is what a filter gave out for one written token
+type streamPiece struct {
+	text     string
+	logprobs []string
+}
+
+// stream writes each token to the filter with a logprob naming it, then
+// flushes, returning what came out at each step
+func stream(f *OutputFilter, tokens []string) []streamPiece {
+	var pieces []streamPiece
+	add := func(text string, logprobs []models.TokenLogprob) {
+		piece := streamPiece{text: text}
+		for _, logprob := range logprobs {
+			piece.logprobs = append(piece.logprobs, logprob.Token)
+		}
+		pieces = append(pieces, piece)
+	}
+	for _, token := range tokens {
+		add(f.WriteLogprobs(token, []models.TokenLogprob{{Token: token}}))
+	}
+	add(f.FlushLogprobs())
+	return pieces
+}
+
+func TestOutputFilterStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		trim     bool
+		tokens   []string
+		text     string
+		logprobs []string
+	}{
+		{
+			name:     "section in one token",
+			tags:     []string{"think"},
+			tokens:   []string{"<think>plan</think>", "Hi"},
+			text:     "Hi",
+			logprobs: []string{"Hi"},
+		},
+		{
+			name:     "tags split across tokens",
+			tags:     []string{"think"},
+			tokens:   []string{"Hi", " <th", "ink>", "secret", "</thi", "nk>", " there"},
+			text:     "Hi  there",
+			logprobs: []string{"Hi", " <th", " there"},
+		},
+		{
+			name:     "partial tag that isn't one",
+			tags:     []string{"think"},
+			tokens:   []string{"a <", "b> c"},
+			text:     "a <b> c",
+			logprobs: []string{"a <", "b> c"},
+		},
+		{
+			name:     "unclosed section",
+			tags:     []string{"think"},
+			tokens:   []string{"Hi", "<think>", "never", " closed"},
+			text:     "Hi",
+			logprobs: []string{"Hi"},
+		},
+		{
+			name:     "trimmed whitespace",
+			trim:     true,
+			tokens:   []string{" ", "\n", "Hello", " ", "world", "  ", "\n"},
+			text:     "Hello world",
+			logprobs: []string{"Hello", " ", "world"},
+		},
+		{
+			name:     "strip and trim",
+			tags:     []string{"think"},
+			trim:     true,
+			tokens:   []string{"<think>", "x", "</think>", "\n\n", "Answer", "\n"},
+			text:     "Answer",
+			logprobs: []string{"Answer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewOutputFilter(tt.tags, tt.trim)
+			var text strings.Builder
+			var logprobs []string
+			for _, piece := range stream(f, tt.tokens) {
+				text.WriteString(piece.text)
+				logprobs = append(logprobs, piece.logprobs...)
+			}
+			if text.String() != tt.text {
+				t.Errorf("text = %q, want %q", text.String(), tt.text)
+			}
+			if whole := NewOutputFilter(tt.tags, tt.trim).Apply(strings.Join(tt.tokens, "")); whole != tt.text {
+				t.Errorf("Apply = %q, streamed %q", whole, tt.text)
+			}
+			if strings.Join(logprobs, "|") != strings.Join(tt.logprobs, "|") {
+				t.Errorf("logprobs = %q, want %q", logprobs, tt.logprobs)
+			}
+		})
+	}
+}
+
+func TestOutputFilterHoldsLogprobsWithText(t *testing.T) {
+	f := NewOutputFilter([]string{"think"}, false)
+
+	// "<" may start a tag, so neither it nor its token's logprob is given out
+	text, logprobs := f.WriteLogprobs("Hi <", []models.TokenLogprob{{Token: "Hi <"}})
+	if text != "Hi " || len(logprobs) != 0 {
+		t.Fatalf("Write = %q %v, want Hi and no logprobs", text, logprobs)
+	}
+	text, logprobs = f.WriteLogprobs("b>", []models.TokenLogprob{{Token: "b>"}})
+	if text != "<b>" || len(logprobs) != 2 || logprobs[0].Token != "Hi <" || logprobs[1].Token != "b>" {
+		t.Errorf("Write = %q %v, want <b> with both logprobs", text, logprobs)
+	}
+}
+
+func TestNilOutputFilterPassesLogprobs(t *testing.T) {
+	var f *OutputFilter
+	text, logprobs := f.WriteLogprobs("Hi", []models.TokenLogprob{{Token: "Hi"}})
+	if text != "Hi" || len(logprobs) != 1 {
+		t.Errorf("Write = %q %v, want it unchanged", text, logprobs)
+	}
+	if text, logprobs := f.FlushLogprobs(); text != "" || logprobs != nil {
+		t.Errorf("Flush = %q %v, want nothing", text, logprobs)
+	}
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// titles are abbreviations that come before a name, so their period never
+// ends a sentence
+var titles = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true,
+	"sr": true, "jr": true, "st": true, "rev": true, "gen": true,
+}
+
+// closers are the quotes and brackets that may follow a sentence's final
+// punctuation and still belong to the sentence
+const closers = "\"')]”’»"
+
+// SentenceEnd returns the byte offset just past the nth sentence of text, or
+// -1 if text doesn't have that many yet. A sentence ends at ., ! or ? (or a
+// run of them, or …) followed by whitespace, or at a blank line. A period
+// doesn't end one after a title such as Dr, an initial, a list number at the
+// start of a line, or when the next word on the same line starts in lower
+// case or with a digit, as in "e.g. this" or "No. 5". Unless final is set,
+// text may still grow, so a sentence only ends once the next word has started.
+func SentenceEnd(text string, n int, final bool) int {
+	return sentenceEnd(text, 0, n, final)
+}
+
+// sentenceEnd is SentenceEnd counting sentences from offset from, which must
+// be 0 or where an earlier sentence ended, so a stream can carry on from its
+// last sentence instead of going over the whole text again
+func sentenceEnd(text string, from, n int, final bool) int {
+	count := 0
+	// content is set once the current sentence has something other than whitespace
+	content := false
+	for i := from; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == '.' || r == '!' || r == '?' || r == '…':
+			end := i + size
+			for end < len(text) {
+				c, size := utf8.DecodeRuneInString(text[end:])
+				if !strings.ContainsRune(".!?…", c) {
+					break
+				}
+				end += size
+			}
+			for end < len(text) {
+				c, size := utf8.DecodeRuneInString(text[end:])
+				if !strings.ContainsRune(closers, c) {
+					break
+				}
+				end += size
+			}
+			next := end
+			if next < len(text) {
+				c, _ := utf8.DecodeRuneInString(text[next:])
+				if !unicode.IsSpace(c) {
+					// Decimals, domains and the like: "3.14", "example.com"
+					i = end
+					continue
+				}
+			}
+			for next < len(text) {
+				c, size := utf8.DecodeRuneInString(text[next:])
+				if !unicode.IsSpace(c) {
+					break
+				}
+				next += size
+			}
+			if next == len(text) && !final {
+				// The end of the sentence depends on the word that comes next
+				return -1
+			}
+			if r == '.' && end == i+size && !periodEndsSentence(text[:i], text[end:next], text[next:]) {
+				i = end
+				continue
+			}
+			count++
+			if count == n {
+				return end
+			}
+			content = false
+			i = end
+		case r == '\n' && strings.HasPrefix(text[i:], "\n\n"):
+			if content {
+				count++
+				if count == n {
+					return len(strings.TrimRightFunc(text[:i], unicode.IsSpace))
+				}
+				content = false
+			}
+			i += 2
+		default:
+			if !unicode.IsSpace(r) {
+				content = true
+			}
+			i += size
+		}
+	}
+	if final && content && count+1 == n {
+		return len(text)
+	}
+	return -1
+}
+
+// periodEndsSentence decides whether a single period ends the sentence, given
+// the text before it, the whitespace following it and the text after that
+func periodEndsSentence(before, gap, after string) bool {
+	word := before[strings.LastIndexFunc(before, unicode.IsSpace)+1:]
+	word = strings.TrimLeft(word, "([\"'“‘")
+	if titles[strings.ToLower(word)] {
+		return false
+	}
+	// Initials such as the J in "J. Smith"
+	if utf8.RuneCountInString(word) == 1 && unicode.IsUpper([]rune(word)[0]) {
+		return false
+	}
+	// Numbered list items: "1. First step"
+	line := before[strings.LastIndexByte(before, '\n')+1:]
+	if word != "" && strings.TrimSpace(line) == word && strings.Trim(word, "0123456789") == "" {
+		return false
+	}
+	if after == "" || strings.Contains(gap, "\n") {
+		return true
+	}
+	next, _ := utf8.DecodeRuneInString(after)
+	return !unicode.IsLower(next) && !unicode.IsDigit(next)
+}
+
+// SentenceLimit cuts a completion off after a number of sentences. Use Apply
+// on a whole completion, or Write on a stream and stop once Reached. A nil
+// limit passes text through unchanged.
+type SentenceLimit struct {
+	max int
+	// text is the streamed completion so far
+	text strings.Builder
+	// emitted is how much of text Write has returned
+	emitted int
+	// done is where the last complete sentence of text ends, and count how
+	// many sentences there are up to it
+	done, count int
+	// kept is the completion up to the limit, once it is reached
+	kept    string
+	reached bool
+}
+
+// NewSentenceLimit returns a limit of max sentences, or nil for no limit
+func NewSentenceLimit(max int) *SentenceLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &SentenceLimit{max: max}
+}
+
+// Apply cuts a whole completion after the limit, reporting whether it was cut
+func (l *SentenceLimit) Apply(text string) (string, bool) {
+	if l == nil {
+		return text, false
+	}
+	end := SentenceEnd(text, l.max, true)
+	if end < 0 || strings.TrimSpace(text[end:]) == "" {
+		return text, false
+	}
+	return text[:end], true
+}
+
+// Write takes the next piece of a streamed completion and returns the part of
+// it within the limit. Once the limit is reached it returns nothing more.
+func (l *SentenceLimit) Write(token string) string {
+	if l == nil {
+		return token
+	}
+	if l.reached {
+		return ""
+	}
+	l.text.WriteString(token)
+	text := l.text.String()
+
+	// Only the text after the last complete sentence needs looking at
+	for {
+		end := sentenceEnd(text, l.done, 1, false)
+		if end < 0 {
+			break
+		}
+		l.done, l.count = end, l.count+1
+		if l.count < l.max {
+			continue
+		}
+		l.reached = true
+		l.kept = text[:end]
+		if l.emitted >= end {
+			return ""
+		}
+		return text[l.emitted:end]
+	}
+	out := text[l.emitted:]
+	l.emitted = len(text)
+	return out
+}
+
+// Reached reports whether the stream has reached the limit, after which the
+// rest of the generation can be dropped
+func (l *SentenceLimit) Reached() bool {
+	return l != nil && l.reached
+}
+
+// Text returns the streamed completion up to the limit
+func (l *SentenceLimit) Text() string {
+	if l == nil {
+		return ""
+	}
+	if l.reached {
+		return l.kept
+	}
+	return l.text.String()
+}
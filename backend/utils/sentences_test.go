@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestSentenceEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		n     int
+		final bool
+		want  string
+	}{
+		{"first sentence", "Hello world. Next one", 1, false, "Hello world."},
+		{"second sentence", "Hello world. Next one. Last", 2, false, "Hello world. Next one."},
+		{"not ended yet", "Hello world.", 1, false, ""},
+		{"ended by the end of text", "Hello world.", 1, true, "Hello world."},
+		{"title", "Dr. Smith is here. Yes", 1, false, "Dr. Smith is here."},
+		{"initial", "J. Smith wrote it. Yes", 1, false, "J. Smith wrote it."},
+		{"lower case after the period", "Use e.g. this one. Ok", 1, false, "Use e.g. this one."},
+		{"decimal", "Pi is 3.14 or so. Ok", 1, false, "Pi is 3.14 or so."},
+		{"list number", "1. First step\n2. Second step. Ok", 1, false, "1. First step\n2. Second step."},
+		{"closing quote", `He said "stop." Then left`, 1, false, `He said "stop."`},
+		{"run of punctuation", "Really?! Yes", 1, false, "Really?!"},
+		{"ellipsis run", "Wait…… Yes", 1, false, "Wait……"},
+		{"period then ellipsis", "Wait.… Yes", 1, false, "Wait.…"},
+		{"non-breaking space before lower case", "See fig. three below. Ok", 1, false, "See fig. three below."},
+		{"ideographic space", "Done!　Next", 1, false, "Done!"},
+		{"blank line", "A heading\n\nText", 1, false, "A heading"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end := SentenceEnd(tt.text, tt.n, tt.final)
+			got := ""
+			if end >= 0 {
+				got = tt.text[:end]
+			}
+			if got != tt.want {
+				t.Errorf("SentenceEnd(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentenceLimitStream(t *testing.T) {
+	texts := []string{
+		"One. Two. Three. Four.",
+		"Dr. Smith arrived. He sat down. Then he left.",
+		"1. First step\n2. Second step\n3. Third step",
+		"Done. 1. Next thing. Last.",
+		"Heading\n\nBody text here. More.",
+		"Wait… really? Yes! Fine.",
+	}
+	for _, text := range texts {
+		for max := 1; max <= 3; max++ {
+			want, cut := NewSentenceLimit(max).Apply(text)
+
+			// Streamed one rune at a time, the limit cuts in the same place,
+			// though whitespace after the last sentence may already be out
+			l := NewSentenceLimit(max)
+			var out strings.Builder
+			for _, r := range text {
+				out.WriteString(l.Write(string(r)))
+				if l.Reached() {
+					break
+				}
+			}
+			streamed := strings.TrimRightFunc(out.String(), unicode.IsSpace)
+			if cut && (streamed != want || !l.Reached() || l.Text() != want) {
+				t.Errorf("%q limited to %d: streamed %q (reached %v), want %q", text, max, out.String(), l.Reached(), want)
+			}
+			if !cut && (out.String() != text || l.Reached()) {
+				t.Errorf("%q limited to %d: streamed %q (reached %v), want it whole", text, max, out.String(), l.Reached())
+			}
+		}
+	}
+}
+
+func TestSentenceLimitResumes(t *testing.T) {
+	l := NewSentenceLimit(1000)
+	for i := 0; i < 500; i++ {
+		l.Write("Another sentence here. ")
+	}
+	l.Write("And one more")
+	// Only the unfinished sentence is left to look at on the next write
+	if rest := l.Text()[l.done:]; rest != " And one more" || l.count != 500 {
+		t.Errorf("after %d sentences, %q is left to scan", l.count, rest)
+	}
+}
+
+func TestNilSentenceLimit(t *testing.T) {
+	var l *SentenceLimit
+	if l.Write("One. Two.") != "One. Two." || l.Reached() {
+		t.Error("nil limit changed the stream")
+	}
+}
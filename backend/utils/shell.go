@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShellQuote quotes s as a single shell word; nothing inside it is expanded
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// echoEscape prepares script text for the Dockerfile's RUN echo '...' line,
+// which writes the startup script. Single quotes close and reopen the echo's
+// quoting, and backslashes and control characters are written as the escapes
+// echo turns back into the original bytes, so the text lands in the script
+// unchanged and can't break the Dockerfile line.
+func echoEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			b.WriteString(`'"'"'`)
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\0%03o`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// scriptArg quotes a value for use as a word in the generated startup script
+func scriptArg(s string) string {
+	return echoEscape(ShellQuote(s))
+}
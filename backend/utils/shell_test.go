@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// hostileValues are values a model name or tag could smuggle into a shell
+var hostileValues = []string{
+	"llama2",
+	"it's",
+	"$(touch /tmp/owned)",
+	"`id`",
+	"a b\tc",
+	`back\slash "quoted"`,
+	"line\nbreak",
+	"'; rm -rf / #",
+}
+
+// shellOutput runs script with sh and returns what it prints
+func shellOutput(t *testing.T, script string) string {
+	t.Helper()
+	out, err := exec.Command("sh", "-c", script).Output()
+	if err != nil {
+		t.Fatalf("sh -c %q: %v", script, err)
+	}
+	return string(out)
+}
+
+func TestShellQuote(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the quoted values through")
+	}
+	for _, value := range hostileValues {
+		if got := shellOutput(t, "printf %s "+ShellQuote(value)); got != value {
+			t.Errorf("ShellQuote(%q) reads back as %q", value, got)
+		}
+	}
+}
+
+func TestScriptArg(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the quoted values through")
+	}
+	for _, value := range hostileValues {
+		arg := scriptArg(value)
+		if strings.ContainsAny(arg, "\n\r") {
+			t.Errorf("scriptArg(%q) = %q, which breaks the RUN line", value, arg)
+		}
+		// printf %b expands the escapes the way the RUN line's echo does,
+		// giving the word written into the startup script
+		word := shellOutput(t, "printf %b '"+arg+"'")
+		if word != ShellQuote(value) {
+			t.Errorf("scriptArg(%q) writes %q to the script, want %q", value, word, ShellQuote(value))
+			continue
+		}
+		if got := shellOutput(t, "printf %s "+word); got != value {
+			t.Errorf("scriptArg(%q) reads back as %q in the script", value, got)
+		}
+	}
+}
+
+func TestGenerateDockerfileHostileModel(t *testing.T) {
+	lines := strings.Count(GenerateDockerfile("llama2", DockerfileOptions{}), "\n")
+	for _, model := range hostileValues {
+		dockerfile := GenerateDockerfile(model, DockerfileOptions{})
+		if got := strings.Count(dockerfile, "\n"); got != lines {
+			t.Errorf("Dockerfile for %q has %d lines, want %d", model, got, lines)
+		}
+		if strings.Contains(dockerfile, "$(touch") && !strings.Contains(dockerfile, "'$(touch /tmp/owned)'") {
+			t.Errorf("Dockerfile for %q runs the command substitution", model)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// messageTokenOverhead approximates the tokens a chat template adds around each message
+const messageTokenOverhead = 4
+
+// EstimateTokens approximates how many tokens text takes. Llama-style
+// tokenizers average about four characters per token on English text, but
+// never fewer tokens than words, so the larger of the two estimates is used.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	byChars := (utf8.RuneCountInString(text) + 3) / 4
+	byWords := len(strings.Fields(text))
+	if byWords > byChars {
+		return byWords
+	}
+	return byChars
+}
+
+// EstimateMessageTokens approximates the tokens for a chat message, including
+// the template's role markers
+func EstimateMessageTokens(content string) int {
+	return EstimateTokens(content) + messageTokenOverhead
+}
@@ -43,7 +43,7 @@ function Chat() {
     try {
       const response = await axios.get(`${API_BASE_URL}/health`);
       if (response.data.model_running && response.data.model_name) {
-        const modelNameFromContainer = response.data.model_name.replace('ollama-', '').replace('-container', '');
+        const modelNameFromContainer = response.data.model || response.data.model_name.replace('ollama-', '').replace('-container', '');
         setCurrentModel(modelNameFromContainer);
         setModelStatus({ 
           type: 'success', 
@@ -110,8 +110,19 @@ function ModelManagement() {
     }
 
     try {
-      await axios.delete(`${API_BASE_URL}/models/${modelName}`);
-      setStatus({ 
+      try {
+        await axios.delete(`${API_BASE_URL}/models/${modelName}`);
+      } catch (error) {
+        // Running models need an explicit second confirmation
+        if (error.response?.data?.code !== 'MODEL_RUNNING') {
+          throw error;
+        }
+        if (!window.confirm(`${modelName} is running. Stop and delete it anyway?`)) {
+          return;
+        }
+        await axios.delete(`${API_BASE_URL}/models/${modelName}`, { params: { force: true } });
+      }
+      setStatus({
         type: 'success', 
         message: `${modelName} model deleted successfully` 
       });
@@ -294,7 +305,7 @@ function ModelManagement() {
                       <h4>{model.name}</h4>
                       <div className="model-status">
                         <span className={`status-indicator ${model.is_running ? 'running' : 'stopped'}`}></span>
-                        {model.is_running ? 'Running' : 'Stopped'}
+                        {model.is_running ? 'Running' : model.state === 'starting' ? 'Starting' : 'Stopped'}
                       </div>
                     </div>
                     <p className="model-info">Container: {model.container_name}</p>